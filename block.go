@@ -0,0 +1,119 @@
+package stardb
+
+import (
+	"time"
+)
+
+type (
+	// waitQueue 阻塞在各个key上等待数据的客户端, list和有序集合的阻塞命令共用
+	// 除wait和unblockAll之外的方法调用方需持有mu
+	waitQueue struct {
+		mu 		 *idxMutex
+		waiters  map[string][]*waiter  //阻塞在每个key上的客户端, 按阻塞先后排列
+	}
+
+	// waiter 阻塞在一个或多个key上等待数据的客户端
+	waiter struct {
+		keys 	[][]byte
+		take    func(key []byte) waitResult   //被唤醒时从key中取出数据, 调用时持有mu
+		ch      chan waitResult
+	}
+
+	waitResult struct {
+		key 	[]byte
+		val 	[]byte
+		score   float64    //只用于有序集合
+		err 	error
+	}
+)
+
+func newWaitQueue(mu *idxMutex) *waitQueue{
+	return &waitQueue{mu: mu, waiters: make(map[string][]*waiter)}
+}
+
+func (q *waitQueue) block(keys [][]byte, take func(key []byte) waitResult) *waiter{
+	w := &waiter{keys: keys, take: take, ch: make(chan waitResult, 1)}
+	for _, k := range keys{
+		q.waiters[string(k)] = append(q.waiters[string(k)], w)
+	}
+	return w
+}
+
+func (q *waitQueue) unblock(w *waiter){
+	for _, k := range w.keys{
+		waiters := q.waiters[string(k)]
+		for i := 0; i < len(waiters); i++{
+			if waiters[i] == w{
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+
+		if len(waiters) == 0{
+			delete(q.waiters, string(k))
+		}else{
+			q.waiters[string(k)] = waiters
+		}
+	}
+}
+
+//等待被唤醒或者超时, 调用前需释放mu
+func (q *waitQueue) wait(w *waiter, timeout time.Duration)(res waitResult){
+	var timer <-chan time.Time
+	if timeout > 0{
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	select {
+	case res = <-w.ch:
+		return
+	case <-timer:
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	//超时的同时可能已经被唤醒, 数据已经取出, 不能丢弃
+	select {
+	case res = <-w.ch:
+	default:
+		q.unblock(w)
+	}
+	return
+}
+
+//key中有数据之后按阻塞的先后顺序唤醒等待它的客户端, ready返回key中是否还有数据
+func (q *waitQueue) serve(key []byte, ready func() bool) error{
+	for {
+		waiters := q.waiters[string(key)]
+		if len(waiters) == 0 || !ready(){
+			return nil
+		}
+
+		w := waiters[0]
+		q.unblock(w)
+
+		res := w.take(key)
+		w.ch <- res
+		if res.err != nil{
+			return res.err
+		}
+	}
+}
+
+//唤醒所有阻塞的客户端
+func (q *waitQueue) unblockAll(err error){
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.waiters) > 0{
+		for _, waiters := range q.waiters{
+			w := waiters[0]
+			q.unblock(w)
+			w.ch <- waitResult{err: err}
+			break
+		}
+	}
+}
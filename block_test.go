@@ -0,0 +1,48 @@
+package stardb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWaitQueue(t *testing.T) {
+	var mu idxMutex
+	q := newWaitQueue(&mu)
+	data := map[string][][]byte{}
+	take := func(key []byte) waitResult{
+		val := data[string(key)][0]
+		data[string(key)] = data[string(key)][1:]
+		return waitResult{key: key, val: val}
+	}
+	ready := func(key []byte) func() bool{
+		return func() bool{
+			return len(data[string(key)]) > 0
+		}
+	}
+
+	//先阻塞的客户端先被唤醒, 同时等待多个key的客户端只被唤醒一次
+	w1 := q.block([][]byte{[]byte("a"), []byte("b")}, take)
+	w2 := q.block([][]byte{[]byte("a")}, take)
+	w3 := q.block([][]byte{[]byte("b")}, take)
+
+	data["b"] = [][]byte{[]byte("1")}
+	assert.Nil(t, q.serve([]byte("b"), ready([]byte("b"))))
+	res := q.wait(w1, time.Second)
+	assert.Equal(t, []byte("b"), res.key)
+	assert.Equal(t, []byte("1"), res.val)
+
+	data["a"] = [][]byte{[]byte("2"), []byte("3")}
+	assert.Nil(t, q.serve([]byte("a"), ready([]byte("a"))))
+	assert.Equal(t, []byte("2"), q.wait(w2, time.Second).val)
+	assert.Equal(t, 1, len(data["a"]))
+
+	//超时之后不再等待
+	res = q.wait(w3, 10 * time.Millisecond)
+	assert.Nil(t, res.val)
+	assert.Equal(t, 0, len(q.waiters))
+
+	w4 := q.block([][]byte{[]byte("c")}, take)
+	q.unblockAll(ErrDBClosed)
+	assert.Equal(t, ErrDBClosed, q.wait(w4, time.Second).err)
+}
@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+)
+
+//每个缓存项除了值之外的估算内存开销
+const entryOverhead = 64
+
+type (
+	// Key 缓存的key, 即entry所在的数据文件id和偏移量
+	Key struct {
+		FileId uint32
+		Offset int64
+	}
+
+	// LRU 按占用内存限制大小的LRU缓存, 并发安全
+	LRU struct {
+		mu       sync.Mutex
+		capacity int64                  //最大占用的字节数
+		size     int64                  //当前占用的字节数
+		ll       *list.List             //最近访问的在头部
+		items    map[Key]*list.Element
+		hits     uint64
+		misses   uint64
+	}
+
+	// Stats 缓存的统计信息
+	Stats struct {
+		Hits   uint64
+		Misses uint64
+		Len    int
+		Size   int64
+	}
+
+	item struct {
+		key   Key
+		value []byte
+	}
+)
+
+// NewLRU 新建一个最多占用capacity字节的LRU缓存
+func NewLRU(capacity int64) *LRU{
+	return &LRU{
+		capacity: capacity,
+		ll: list.New(),
+		items: make(map[Key]*list.Element),
+	}
+}
+
+// Get 获取缓存的值, 命中时将其移到头部
+func (c *LRU) Get(key Key)([]byte, bool){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ele, ok := c.items[key]; ok{
+		c.ll.MoveToFront(ele)
+		c.hits++
+		return ele.Value.(*item).value, true
+	}
+	c.misses++
+	return nil, false
+}
+
+// Set 添加缓存, 超出容量时淘汰最久未访问的值, 单个值超过容量时不缓存
+func (c *LRU) Set(key Key, value []byte){
+	size := itemSize(value)
+	if size > c.capacity{
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ele, ok := c.items[key]; ok{
+		c.ll.MoveToFront(ele)
+		it := ele.Value.(*item)
+		c.size += size - itemSize(it.value)
+		it.value = value
+	}else{
+		c.items[key] = c.ll.PushFront(&item{key: key, value: value})
+		c.size += size
+	}
+
+	for c.size > c.capacity{
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove 删除缓存
+func (c *LRU) Remove(key Key){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ele, ok := c.items[key]; ok{
+		c.removeElement(ele)
+	}
+}
+
+// Purge 清空所有缓存, 统计信息保留
+func (c *LRU) Purge(){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ll.Init()
+	c.items = make(map[Key]*list.Element)
+	c.size = 0
+}
+
+// Stats 返回缓存的统计信息
+func (c *LRU) Stats() Stats{
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{Hits: c.hits, Misses: c.misses, Len: c.ll.Len(), Size: c.size}
+}
+
+func (c *LRU) removeElement(ele *list.Element){
+	it := c.ll.Remove(ele).(*item)
+	delete(c.items, it.key)
+	c.size -= itemSize(it.value)
+}
+
+func itemSize(value []byte) int64{
+	return int64(len(value)) + entryOverhead
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"testing"
+)
+
+func TestLRU_Set(t *testing.T) {
+	c := NewLRU(3 * (entryOverhead + 10))
+	for i := 0; i < 3; i++{
+		c.Set(Key{FileId: 0, Offset: int64(i)}, make([]byte, 10))
+	}
+
+	//访问0之后淘汰的是1
+	if _, ok := c.Get(Key{Offset: 0}); !ok{
+		t.Error("key 0 should be cached")
+	}
+	c.Set(Key{Offset: 3}, make([]byte, 10))
+	if _, ok := c.Get(Key{Offset: 1}); ok{
+		t.Error("key 1 should be evicted")
+	}
+	if _, ok := c.Get(Key{Offset: 0}); !ok{
+		t.Error("key 0 should be cached")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Len != 3{
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	//超过容量的值不缓存
+	c.Set(Key{Offset: 4}, make([]byte, 1024))
+	if _, ok := c.Get(Key{Offset: 4}); ok{
+		t.Error("value larger than capacity should not be cached")
+	}
+}
+
+func TestLRU_Remove(t *testing.T) {
+	c := NewLRU(1024)
+	c.Set(Key{FileId: 1, Offset: 0}, []byte("a"))
+	c.Set(Key{FileId: 1, Offset: 10}, []byte("b"))
+
+	c.Remove(Key{FileId: 1, Offset: 0})
+	if _, ok := c.Get(Key{FileId: 1, Offset: 0}); ok{
+		t.Error("key should be removed")
+	}
+
+	c.Purge()
+	if stats := c.Stats(); stats.Len != 0 || stats.Size != 0{
+		t.Errorf("cache should be empty after purge, got %+v", stats)
+	}
+}
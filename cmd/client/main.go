@@ -11,7 +11,7 @@ import (
 )
 
 var commandList = [][]string{
-	{"SET", "key value", "STRING"},
+	{"SET", "key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|KEEPTTL]", "STRING"},
 	{"GET", "key", "STRING"},
 	{"SETNX", "key value", "STRING"},
 	{"GETSET", "key value", "STRING"},
@@ -24,6 +24,28 @@ var commandList = [][]string{
 	{"EXPIRE", "key seconds", "STRING"},
 	{"PERSIST", "key", "STRING"},
 	{"TTL", "key", "STRING"},
+	{"SETBIT", "key offset value", "STRING"},
+	{"GETBIT", "key offset", "STRING"},
+	{"BITCOUNT", "key [start end [BYTE|BIT]]", "STRING"},
+	{"BITPOS", "key bit [start [end [BYTE|BIT]]]", "STRING"},
+	{"BITOP", "AND|OR|XOR|NOT destkey key [key ...]", "STRING"},
+	{"PFADD", "key [element ...]", "STRING"},
+	{"PFCOUNT", "key [key ...]", "STRING"},
+	{"PFMERGE", "destkey [sourcekey ...]", "STRING"},
+	{"INCR", "key", "STRING"},
+	{"DECR", "key", "STRING"},
+	{"INCRBY", "key increment", "STRING"},
+	{"DECRBY", "key decrement", "STRING"},
+	{"INCRBYFLOAT", "key increment", "STRING"},
+	{"MSET", "key value [key value ...]", "STRING"},
+	{"MSETNX", "key value [key value ...]", "STRING"},
+	{"MGET", "key [key ...]", "STRING"},
+	{"SETEX", "key seconds value", "STRING"},
+	{"PSETEX", "key milliseconds value", "STRING"},
+	{"GETRANGE", "key start end", "STRING"},
+	{"SETRANGE", "key offset value", "STRING"},
+	{"GETDEL", "key", "STRING"},
+	{"GETEX", "key [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|PERSIST]", "STRING"},
 
 	{"LPUSH", "key value [value...]", "LIST"},
 	{"RPUSH", "key value [value...]", "LIST"},
@@ -38,6 +60,12 @@ var commandList = [][]string{
 	{"LLEN", "key", "LIST"},
 	{"LKEYEXISTS", "key", "LIST"},
 	{"LVALEXISTS", "key value", "LIST"},
+	{"LMOVE", "source destination LEFT|RIGHT LEFT|RIGHT", "LIST"},
+	{"RPOPLPUSH", "source destination", "LIST"},
+	{"LPOS", "key element [RANK rank] [COUNT num-matches] [MAXLEN len]", "LIST"},
+	{"BLPOP", "key [key...] timeout", "LIST"},
+	{"BRPOP", "key [key...] timeout", "LIST"},
+	{"BLMOVE", "source destination LEFT|RIGHT LEFT|RIGHT timeout", "LIST"},
 
 	{"HSET", "key field value", "HASH"},
 	{"HSETNX", "key field value", "HASH"},
@@ -48,6 +76,12 @@ var commandList = [][]string{
 	{"HLEN", "key", "HASH"},
 	{"HKEYS", "key", "HASH"},
 	{"HVALS", "key", "HASH"},
+	{"HINCRBY", "key field increment", "HASH"},
+	{"HMSET", "key field value [field value ...]", "HASH"},
+	{"HMGET", "key field [field ...]", "HASH"},
+	{"HINCRBYFLOAT", "key field increment", "HASH"},
+	{"HSTRLEN", "key field", "HASH"},
+	{"HRANDFIELD", "key [count [WITHVALUES]]", "HASH"},
 
 	{"SADD", "key members [members...]", "SET"},
 	{"SPOP", "key count", "SET"},
@@ -59,17 +93,63 @@ var commandList = [][]string{
 	{"SMEMBERS", "key", "SET"},
 	{"SUNION", "key [key...]", "SET"},
 	{"SDIFF", "key [key...]", "SET"},
+	{"SINTER", "key [key...]", "SET"},
+	{"SINTERCARD", "numkeys key [key...] [LIMIT limit]", "SET"},
+	{"SMISMEMBER", "key member [member...]", "SET"},
+	{"SUNIONSTORE", "destination key [key...]", "SET"},
+	{"SINTERSTORE", "destination key [key...]", "SET"},
+	{"SDIFFSTORE", "destination key [key...]", "SET"},
 
-	{"ZADD", "key score member", "ZSET"},
+	{"ZADD", "key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]", "ZSET"},
 	{"ZSCORE", "key member", "ZSET"},
+	{"ZMSCORE", "key member [member ...]", "ZSET"},
+	{"ZRANDMEMBER", "key [count [WITHSCORES]]", "ZSET"},
 	{"ZCARD", "key", "ZSET"},
 	{"ZRANK", "key member", "ZSET"},
 	{"ZREVRANK", "key member", "ZSET"},
 	{"ZREM", "key member", "ZSET"},
 	{"ZGETBYRANK", "key rank", "ZSET"},
 	{"ZREVGETBYRANk", "key rank", "ZSET"},
-	{"ZSCORERANGE", "key min max", "ZSET"},
-	{"ZREVSCORERANGE", "key max min", "ZSET"},
+	{"ZSCORERANGE", "key min max [LIMIT offset count]", "ZSET"},
+	{"ZREVSCORERANGE", "key max min [LIMIT offset count]", "ZSET"},
+	{"ZRANGE", "key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]", "ZSET"},
+	{"ZRANGEBYSCORE", "key min max [WITHSCORES] [LIMIT offset count]", "ZSET"},
+	{"ZREVRANGEBYSCORE", "key max min [WITHSCORES] [LIMIT offset count]", "ZSET"},
+	{"ZCOUNT", "key min max", "ZSET"},
+	{"ZRANGEBYLEX", "key min max [LIMIT offset count]", "ZSET"},
+	{"ZREVRANGEBYLEX", "key max min [LIMIT offset count]", "ZSET"},
+	{"ZLEXCOUNT", "key min max", "ZSET"},
+	{"ZREMRANGEBYLEX", "key min max", "ZSET"},
+	{"ZREMRANGEBYSCORE", "key min max", "ZSET"},
+	{"ZREMRANGEBYRANK", "key start stop", "ZSET"},
+	{"ZPOPMIN", "key [count]", "ZSET"},
+	{"ZPOPMAX", "key [count]", "ZSET"},
+	{"BZPOPMIN", "key [key ...] timeout", "ZSET"},
+	{"BZPOPMAX", "key [key ...] timeout", "ZSET"},
+	{"ZUNION", "numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]", "ZSET"},
+	{"ZINTER", "numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]", "ZSET"},
+	{"ZDIFF", "numkeys key [key ...] [WITHSCORES]", "ZSET"},
+	{"ZUNIONSTORE", "destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]", "ZSET"},
+	{"ZINTERSTORE", "destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]", "ZSET"},
+	{"ZDIFFSTORE", "destination numkeys key [key ...]", "ZSET"},
+	{"GEOADD", "key longitude latitude member [longitude latitude member ...]", "ZSET"},
+	{"GEOPOS", "key member [member ...]", "ZSET"},
+	{"GEODIST", "key member1 member2 [m|km|ft|mi]", "ZSET"},
+	{"GEOHASH", "key member [member ...]", "ZSET"},
+	{"GEOSEARCH", "key FROMMEMBER member|FROMLONLAT longitude latitude BYRADIUS radius m|km|ft|mi|BYBOX width height m|km|ft|mi [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]", "ZSET"},
+
+	{"XADD", "key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold] *|id field value [field value ...]", "STREAM"},
+	{"XRANGE", "key start end [COUNT count]", "STREAM"},
+	{"XREVRANGE", "key end start [COUNT count]", "STREAM"},
+	{"XLEN", "key", "STREAM"},
+	{"XDEL", "key id [id ...]", "STREAM"},
+	{"XTRIM", "key MAXLEN|MINID [=|~] threshold", "STREAM"},
+	{"XREAD", "[COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]", "STREAM"},
+	{"XGROUP", "CREATE key group id|$ [MKSTREAM] | DESTROY key group | DELCONSUMER key group consumer", "STREAM"},
+	{"XREADGROUP", "GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]", "STREAM"},
+	{"XACK", "key group id [id ...]", "STREAM"},
+	{"XPENDING", "key group [[IDLE min-idle-time] start end count [consumer]]", "STREAM"},
+	{"XCLAIM", "key group consumer min-idle-time id [id ...] [JUSTID]", "STREAM"},
 }
 
 var host = flag.String("h", "127.0.0.1", "the stardb server host, default 127.0.0.1")
@@ -3,6 +3,8 @@ package cmd
 import (
 	"stardb"
 	"github.com/tidwall/redcon"
+	"strconv"
+	"strings"
 )
 
 
@@ -118,6 +120,117 @@ func hVals(db *stardb.StarDB, args []string) (res interface{}, err error) {
 	return
 }
 
+func hIncrBy(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("hincrby")
+		return
+	}
+
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil{
+		err = stardb.ErrValueNotInteger
+		return
+	}
+	var val int64
+	if val, err = db.HIncrBy([]byte(args[0]), []byte(args[1]), delta); err == nil{
+		res = redcon.SimpleInt(val)
+	}
+	return
+}
+
+func hMSet(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 3 || len(args) % 2 != 1{
+		err = newWrongNumOfArgsError("hmset")
+		return
+	}
+
+	if err = db.HMSet([]byte(args[0]), toBytesSlice(args[1:])...); err == nil{
+		res = okResult
+	}
+	return
+}
+
+func hMGet(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("hmget")
+		return
+	}
+
+	vals := db.HMGet([]byte(args[0]), toBytesSlice(args[1:])...)
+	results := make([]interface{}, len(vals))
+	for i, v := range vals{
+		if v != nil{
+			results[i] = string(v)
+		}
+	}
+	res = results
+	return
+}
+
+func hIncrByFloat(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("hincrbyfloat")
+		return
+	}
+
+	delta, err := strconv.ParseFloat(args[2], 64)
+	if err != nil{
+		err = stardb.ErrValueNotFloat
+		return
+	}
+	var val float64
+	if val, err = db.HIncrByFloat([]byte(args[0]), []byte(args[1]), delta); err == nil{
+		res = strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return
+}
+
+func hStrLen(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 2{
+		err = newWrongNumOfArgsError("hstrlen")
+		return
+	}
+
+	res = redcon.SimpleInt(db.HStrLen([]byte(args[0]), []byte(args[1])))
+	return
+}
+
+// HRANDFIELD key [count [WITHVALUES]]
+func hRandField(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 1 || len(args) > 3{
+		err = newWrongNumOfArgsError("hrandfield")
+		return
+	}
+
+	if len(args) == 1{
+		if val := db.HRandField([]byte(args[0]), 1, false); len(val) > 0{
+			res = string(val[0])
+		}
+		return
+	}
+
+	count, err := strconv.Atoi(args[1])
+	if err != nil{
+		err = stardb.ErrValueNotInteger
+		return
+	}
+	withValues := false
+	if len(args) == 3{
+		if strings.ToLower(args[2]) != "withvalues"{
+			return nil, ErrSyntaxIncorrect
+		}
+		withValues = true
+	}
+
+	vals := db.HRandField([]byte(args[0]), count, withValues)
+	results := make([]string, len(vals))
+	for i, v := range vals{
+		results[i] = string(v)
+	}
+	res = results
+	return
+}
+
 func init() {
 	addExecCommand("hset", hSet)
 	addExecCommand("hsetnx", hSetNx)
@@ -128,4 +241,10 @@ func init() {
 	addExecCommand("hlen", hLen)
 	addExecCommand("hkeys", hKeys)
 	addExecCommand("hvals", hVals)
+	addExecCommand("hincrby", hIncrBy)
+	addExecCommand("hmset", hMSet)
+	addExecCommand("hmget", hMGet)
+	addExecCommand("hincrbyfloat", hIncrByFloat)
+	addExecCommand("hstrlen", hStrLen)
+	addExecCommand("hrandfield", hRandField)
 }
\ No newline at end of file
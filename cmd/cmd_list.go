@@ -4,7 +4,10 @@ import (
 	"github.com/tidwall/redcon"
 	"stardb"
 	"stardb/ds/list"
+	"stardb/utils"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func lPush(db *stardb.StarDB, args []string) (res interface{}, err error) {
@@ -226,6 +229,172 @@ func lValExists(db *stardb.StarDB, args []string) (res interface{}, err error) {
 	return
 }
 
+func lMove(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 4{
+		err = newWrongNumOfArgsError("lmove")
+		return
+	}
+	from, err := parseDirection(args[2])
+	if err != nil{
+		return
+	}
+	to, err := parseDirection(args[3])
+	if err != nil{
+		return
+	}
+
+	var val []byte
+	if val, err = db.LMove([]byte(args[0]), []byte(args[1]), from, to); err == nil && val != nil{
+		res = string(val)
+	}
+	return
+}
+
+func rPopLPush(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 2{
+		err = newWrongNumOfArgsError("rpoplpush")
+		return
+	}
+
+	var val []byte
+	if val, err = db.RPopLPush([]byte(args[0]), []byte(args[1])); err == nil && val != nil{
+		res = string(val)
+	}
+	return
+}
+
+func lPos(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2 || len(args) % 2 != 0{
+		err = newWrongNumOfArgsError("lpos")
+		return
+	}
+
+	rank, count, maxLen, withCount := 1, 1, 0, false
+	for i := 2; i < len(args); i += 2{
+		var n int
+		if n, err = strconv.Atoi(args[i+1]); err != nil{
+			err = ErrSyntaxIncorrect
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "RANK":
+			rank = n
+		case "COUNT":
+			count, withCount = n, true
+		case "MAXLEN":
+			maxLen = n
+		default:
+			err = ErrSyntaxIncorrect
+			return
+		}
+		if n < 0 && strings.ToUpper(args[i]) != "RANK"{
+			err = ErrSyntaxIncorrect
+			return
+		}
+	}
+
+	var pos []int
+	if pos, err = db.LPos([]byte(args[0]), []byte(args[1]), rank, count, maxLen); err != nil{
+		return
+	}
+	if withCount{
+		results := make([]redcon.SimpleInt, len(pos))
+		for i, p := range pos{
+			results[i] = redcon.SimpleInt(p)
+		}
+		res = results
+	}else if len(pos) > 0{
+		res = redcon.SimpleInt(pos[0])
+	}
+	return
+}
+
+func bLPop(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("blpop")
+		return
+	}
+	return bRawPop(db, args, list.Left)
+}
+
+func bRPop(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("brpop")
+		return
+	}
+	return bRawPop(db, args, list.Right)
+}
+
+func bRawPop(db *stardb.StarDB, args []string, from list.Direction)(res interface{}, err error){
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil{
+		return
+	}
+
+	var keys [][]byte
+	for _, k := range args[:len(args)-1]{
+		keys = append(keys, []byte(k))
+	}
+
+	var key, val []byte
+	if from == list.Left{
+		key, val, err = db.BLPop(timeout, keys...)
+	}else{
+		key, val, err = db.BRPop(timeout, keys...)
+	}
+	if err == nil && key != nil{
+		res = []string{string(key), string(val)}
+	}
+	return
+}
+
+func bLMove(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 5{
+		err = newWrongNumOfArgsError("blmove")
+		return
+	}
+	from, err := parseDirection(args[2])
+	if err != nil{
+		return
+	}
+	to, err := parseDirection(args[3])
+	if err != nil{
+		return
+	}
+	timeout, err := parseTimeout(args[4])
+	if err != nil{
+		return
+	}
+
+	var val []byte
+	if val, err = db.BLMove([]byte(args[0]), []byte(args[1]), from, to, timeout); err == nil && val != nil{
+		res = string(val)
+	}
+	return
+}
+
+func parseDirection(arg string)(list.Direction, error){
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return list.Left, nil
+	case "RIGHT":
+		return list.Right, nil
+	}
+	return list.Left, ErrSyntaxIncorrect
+}
+
+//阻塞命令的超时时间, 单位为秒, 可以是小数
+func parseTimeout(arg string)(time.Duration, error){
+	seconds, err := utils.StrToFloat64(arg)
+	if err != nil{
+		return 0, ErrTimeoutInvalid
+	}
+	if seconds < 0{
+		return 0, ErrTimeoutNegative
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
 func init(){
 	addExecCommand("lpush", lPush)
 	addExecCommand("rpush", rPush)
@@ -240,4 +409,10 @@ func init(){
 	addExecCommand("llen", lLen)
 	addExecCommand("lkeyexists", lKeyExists)
 	addExecCommand("lvalexists", lValExists)
+	addExecCommand("lmove", lMove)
+	addExecCommand("rpoplpush", rPopLPush)
+	addExecCommand("lpos", lPos)
+	addExecCommand("blpop", bLPop)
+	addExecCommand("brpop", bRPop)
+	addExecCommand("blmove", bLMove)
 }
\ No newline at end of file
@@ -4,6 +4,7 @@ import (
 	"github.com/tidwall/redcon"
 	"stardb"
 	"strconv"
+	"strings"
 )
 
 func sAdd(db *stardb.StarDB, args []string) (res interface{}, err error) {
@@ -141,6 +142,94 @@ func sDiff(db *stardb.StarDB, args []string) (res interface{}, err error) {
 	return
 }
 
+func sInter(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) <= 0{
+		err = newWrongNumOfArgsError("sinter")
+		return
+	}
+	res = db.SInter(toBytesSlice(args)...)
+	return
+}
+
+// SINTERCARD numkeys key [key ...] [LIMIT limit]
+func sInterCard(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("sintercard")
+		return
+	}
+
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys <= 0{
+		return nil, ErrNumKeys
+	}
+	if numKeys > len(args) - 1{
+		return nil, ErrSyntaxIncorrect
+	}
+
+	limit := 0
+	rest := args[1+numKeys:]
+	if len(rest) != 0{
+		if len(rest) != 2 || strings.ToLower(rest[0]) != "limit"{
+			return nil, ErrSyntaxIncorrect
+		}
+		if limit, err = strconv.Atoi(rest[1]); err != nil || limit < 0{
+			return nil, ErrLimitNegative
+		}
+	}
+	res = redcon.SimpleInt(db.SInterCard(limit, toBytesSlice(args[1:1+numKeys])...))
+	return
+}
+
+func sMIsMember(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("smismember")
+		return
+	}
+
+	flags := db.SMIsMember([]byte(args[0]), toBytesSlice(args[1:])...)
+	results := make([]interface{}, len(flags))
+	for i, ok := range flags{
+		results[i] = redcon.SimpleInt(0)
+		if ok{
+			results[i] = redcon.SimpleInt(1)
+		}
+	}
+	res = results
+	return
+}
+
+func sUnionStore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("sunionstore")
+		return
+	}
+	return sRawStore(args, db.SUnionStore)
+}
+
+func sInterStore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("sinterstore")
+		return
+	}
+	return sRawStore(args, db.SInterStore)
+}
+
+func sDiffStore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("sdiffstore")
+		return
+	}
+	return sRawStore(args, db.SDiffStore)
+}
+
+func sRawStore(args []string, store func(dst []byte, keys ...[]byte)(int, error))(res interface{}, err error){
+	var n int
+	if n, err = store([]byte(args[0]), toBytesSlice(args[1:])...); err == nil{
+		res = redcon.SimpleInt(n)
+	}
+	return
+}
+
 func init(){
 	addExecCommand("sadd", sAdd)
 	addExecCommand("spop", sPop)
@@ -152,4 +241,10 @@ func init(){
 	addExecCommand("smembers", sMembers)
 	addExecCommand("sunion", sUnion)
 	addExecCommand("sdiff", sDiff)
+	addExecCommand("sinter", sInter)
+	addExecCommand("sintercard", sInterCard)
+	addExecCommand("smismember", sMIsMember)
+	addExecCommand("sunionstore", sUnionStore)
+	addExecCommand("sinterstore", sInterStore)
+	addExecCommand("sdiffstore", sDiffStore)
 }
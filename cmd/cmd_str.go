@@ -4,15 +4,70 @@ import (
 	"github.com/tidwall/redcon"
 	"stardb"
 	"strconv"
+	"strings"
+	"time"
 )
+// SET key value [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|KEEPTTL]
 func set(db *stardb.StarDB, args []string) (res interface{}, err error) {
-	if len(args) != 2{
+	if len(args) < 2{
 		err = newWrongNumOfArgsError("set")
 		return
 	}
 
 	key, value := args[0], args[1]
-	if err = db.Set([]byte(key), []byte(value)); err == nil{
+	if len(args) == 2{
+		err = db.Set([]byte(key), []byte(value))
+		//超过MaxValueSize的值分块保存
+		if err == stardb.ErrValueTooLarge{
+			err = db.PutStream([]byte(key), strings.NewReader(value))
+		}
+		if err == nil{
+			res = okResult
+		}
+		return
+	}
+
+	var opt stardb.SetOption
+	var expireSet bool
+	for i := 2; i < len(args); i++{
+		switch name := strings.ToLower(args[i]); name {
+		case "nx":
+			opt.NX = true
+		case "xx":
+			opt.XX = true
+		case "get":
+			opt.Get = true
+		case "keepttl":
+			opt.KeepTTL = true
+		case "ex", "px", "exat", "pxat":
+			if expireSet || i + 1 >= len(args){
+				return nil, ErrSyntaxIncorrect
+			}
+			if opt.Expire, err = parseExpire(name, args[i+1]); err != nil{
+				return
+			}
+			expireSet = true
+			i++
+		default:
+			return nil, ErrSyntaxIncorrect
+		}
+	}
+	if (opt.NX && opt.XX) || (expireSet && opt.KeepTTL){
+		return nil, ErrSyntaxIncorrect
+	}
+
+	old, ok, err := db.SetWithOption([]byte(key), []byte(value), opt)
+	if err == stardb.ErrValueTooLarge{
+		old, ok, err = db.PutStreamWithOption([]byte(key), strings.NewReader(value), opt)
+	}
+	if err != nil{
+		return
+	}
+	if opt.Get{
+		if old != nil{
+			res = string(old)
+		}
+	}else if ok{
 		res = okResult
 	}
 	return
@@ -171,6 +226,480 @@ func ttl(db *stardb.StarDB, args []string) (res interface{}, err error) {
 	return
 }
 
+func setBit(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("setbit")
+		return
+	}
+	offset, err := strconv.Atoi(args[1])
+	if err != nil{
+		err = stardb.ErrBitOffsetInvalid
+		return
+	}
+	bit, err := strconv.Atoi(args[2])
+	if err != nil{
+		err = stardb.ErrBitValueInvalid
+		return
+	}
+
+	var old int
+	if old, err = db.SetBit([]byte(args[0]), offset, bit); err == nil{
+		res = redcon.SimpleInt(old)
+	}
+	return
+}
+
+func getBit(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 2{
+		err = newWrongNumOfArgsError("getbit")
+		return
+	}
+	offset, err := strconv.Atoi(args[1])
+	if err != nil{
+		err = stardb.ErrBitOffsetInvalid
+		return
+	}
+
+	var bit int
+	if bit, err = db.GetBit([]byte(args[0]), offset); err == nil{
+		res = redcon.SimpleInt(bit)
+	}
+	return
+}
+
+func bitCount(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 1 && len(args) != 3 && len(args) != 4{
+		err = newWrongNumOfArgsError("bitcount")
+		return
+	}
+
+	start, end, unit := 0, -1, stardb.BitUnitByte
+	if len(args) > 1{
+		if start, end, unit, err = parseBitRange(args[1:]); err != nil{
+			return
+		}
+	}
+
+	var count int
+	if count, err = db.BitCount([]byte(args[0]), start, end, unit); err == nil{
+		res = redcon.SimpleInt(count)
+	}
+	return
+}
+
+func bitPos(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2 || len(args) > 5{
+		err = newWrongNumOfArgsError("bitpos")
+		return
+	}
+	bit, err := strconv.Atoi(args[1])
+	if err != nil{
+		err = stardb.ErrBitValueInvalid
+		return
+	}
+
+	start, end, unit := 0, -1, stardb.BitUnitByte
+	switch len(args) {
+	case 3:
+		if start, err = strconv.Atoi(args[2]); err != nil{
+			err = ErrSyntaxIncorrect
+			return
+		}
+	case 4, 5:
+		if start, end, unit, err = parseBitRange(args[2:]); err != nil{
+			return
+		}
+	}
+
+	var pos int
+	if pos, err = db.BitPos([]byte(args[0]), bit, start, end, unit, len(args) > 3); err == nil{
+		res = redcon.SimpleInt(pos)
+	}
+	return
+}
+
+func bitOp(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 3{
+		err = newWrongNumOfArgsError("bitop")
+		return
+	}
+
+	var op stardb.BitOperation
+	switch strings.ToUpper(args[0]) {
+	case "AND":
+		op = stardb.BitAnd
+	case "OR":
+		op = stardb.BitOr
+	case "XOR":
+		op = stardb.BitXor
+	case "NOT":
+		op = stardb.BitNot
+	default:
+		err = ErrSyntaxIncorrect
+		return
+	}
+
+	var keys [][]byte
+	for _, k := range args[2:]{
+		keys = append(keys, []byte(k))
+	}
+
+	var length int
+	if length, err = db.BitOp(op, []byte(args[1]), keys...); err == nil{
+		res = redcon.SimpleInt(length)
+	}
+	return
+}
+
+func pfAdd(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 1{
+		err = newWrongNumOfArgsError("pfadd")
+		return
+	}
+
+	var elements [][]byte
+	for _, e := range args[1:]{
+		elements = append(elements, []byte(e))
+	}
+
+	var updated bool
+	if updated, err = db.PFAdd([]byte(args[0]), elements...); err == nil{
+		if updated{
+			res = redcon.SimpleInt(1)
+		}else{
+			res = redcon.SimpleInt(0)
+		}
+	}
+	return
+}
+
+func pfCount(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 1{
+		err = newWrongNumOfArgsError("pfcount")
+		return
+	}
+
+	var keys [][]byte
+	for _, k := range args{
+		keys = append(keys, []byte(k))
+	}
+
+	var count int
+	if count, err = db.PFCount(keys...); err == nil{
+		res = redcon.SimpleInt(count)
+	}
+	return
+}
+
+func pfMerge(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 1{
+		err = newWrongNumOfArgsError("pfmerge")
+		return
+	}
+
+	var keys [][]byte
+	for _, k := range args[1:]{
+		keys = append(keys, []byte(k))
+	}
+
+	if err = db.PFMerge([]byte(args[0]), keys...); err == nil{
+		res = okResult
+	}
+	return
+}
+
+func incr(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 1{
+		err = newWrongNumOfArgsError("incr")
+		return
+	}
+
+	var val int64
+	if val, err = db.Incr([]byte(args[0])); err == nil{
+		res = redcon.SimpleInt(val)
+	}
+	return
+}
+
+func decr(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 1{
+		err = newWrongNumOfArgsError("decr")
+		return
+	}
+
+	var val int64
+	if val, err = db.Decr([]byte(args[0])); err == nil{
+		res = redcon.SimpleInt(val)
+	}
+	return
+}
+
+func incrBy(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 2{
+		err = newWrongNumOfArgsError("incrby")
+		return
+	}
+
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil{
+		err = stardb.ErrValueNotInteger
+		return
+	}
+	var val int64
+	if val, err = db.IncrBy([]byte(args[0]), delta); err == nil{
+		res = redcon.SimpleInt(val)
+	}
+	return
+}
+
+func decrBy(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 2{
+		err = newWrongNumOfArgsError("decrby")
+		return
+	}
+
+	delta, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil{
+		err = stardb.ErrValueNotInteger
+		return
+	}
+	var val int64
+	if val, err = db.DecrBy([]byte(args[0]), delta); err == nil{
+		res = redcon.SimpleInt(val)
+	}
+	return
+}
+
+func incrByFloat(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 2{
+		err = newWrongNumOfArgsError("incrbyfloat")
+		return
+	}
+
+	delta, err := strconv.ParseFloat(args[1], 64)
+	if err != nil{
+		err = stardb.ErrValueNotFloat
+		return
+	}
+	var val float64
+	if val, err = db.IncrByFloat([]byte(args[0]), delta); err == nil{
+		res = strconv.FormatFloat(val, 'f', -1, 64)
+	}
+	return
+}
+
+func mSet(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) == 0 || len(args) % 2 != 0{
+		err = newWrongNumOfArgsError("mset")
+		return
+	}
+
+	if err = db.MSet(toBytesSlice(args)...); err == nil{
+		res = okResult
+	}
+	return
+}
+
+func mSetNx(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) == 0 || len(args) % 2 != 0{
+		err = newWrongNumOfArgsError("msetnx")
+		return
+	}
+
+	var ok bool
+	if ok, err = db.MSetNx(toBytesSlice(args)...); err == nil{
+		res = redcon.SimpleInt(0)
+		if ok{
+			res = redcon.SimpleInt(1)
+		}
+	}
+	return
+}
+
+func mGet(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) == 0{
+		err = newWrongNumOfArgsError("mget")
+		return
+	}
+
+	vals, err := db.MGet(toBytesSlice(args)...)
+	if err != nil{
+		return
+	}
+	results := make([]interface{}, len(vals))
+	for i, v := range vals{
+		if v != nil{
+			results[i] = string(v)
+		}
+	}
+	res = results
+	return
+}
+
+func setEx(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("setex")
+		return
+	}
+	return rawSetEx(db, args, "ex")
+}
+
+func pSetEx(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("psetex")
+		return
+	}
+	return rawSetEx(db, args, "px")
+}
+
+func rawSetEx(db *stardb.StarDB, args []string, unit string)(res interface{}, err error){
+	duration, err := parseExpire(unit, args[1])
+	if err != nil{
+		return
+	}
+	if err = db.SetEx([]byte(args[0]), []byte(args[2]), duration); err == nil{
+		res = okResult
+	}
+	return
+}
+
+func getRange(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("getrange")
+		return
+	}
+	start, err1 := strconv.Atoi(args[1])
+	end, err2 := strconv.Atoi(args[2])
+	if err1 != nil || err2 != nil{
+		err = stardb.ErrValueNotInteger
+		return
+	}
+
+	var val []byte
+	if val, err = db.GetRange([]byte(args[0]), start, end); err == nil{
+		res = string(val)
+	}
+	return
+}
+
+func setRange(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("setrange")
+		return
+	}
+	offset, err := strconv.Atoi(args[1])
+	if err != nil{
+		err = stardb.ErrValueNotInteger
+		return
+	}
+
+	var length int
+	if length, err = db.SetRange([]byte(args[0]), offset, []byte(args[2])); err == nil{
+		res = redcon.SimpleInt(length)
+	}
+	return
+}
+
+func getDel(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 1{
+		err = newWrongNumOfArgsError("getdel")
+		return
+	}
+
+	val, err := db.GetDel([]byte(args[0]))
+	if err == stardb.ErrKeyNotExist || err == stardb.ErrKeyExpired{
+		return nil, nil
+	}
+	if err == nil{
+		res = string(val)
+	}
+	return
+}
+
+// GETEX key [EX seconds|PX milliseconds|EXAT timestamp|PXAT milliseconds-timestamp|PERSIST]
+func getEx(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 1 && len(args) != 2 && len(args) != 3{
+		err = newWrongNumOfArgsError("getex")
+		return
+	}
+
+	var duration int64
+	var persist bool
+	if len(args) == 2{
+		if strings.ToLower(args[1]) != "persist"{
+			return nil, ErrSyntaxIncorrect
+		}
+		persist = true
+	}
+	if len(args) == 3{
+		if duration, err = parseExpire(strings.ToLower(args[1]), args[2]); err != nil{
+			return
+		}
+	}
+
+	val, err := db.GetEx([]byte(args[0]), duration, persist)
+	if err == stardb.ErrKeyNotExist || err == stardb.ErrKeyExpired{
+		return nil, nil
+	}
+	if err == nil{
+		res = string(val)
+	}
+	return
+}
+
+//将EX PX EXAT PXAT的参数转为以秒为单位的过期时长, 过期时间精确到秒, 毫秒向上取整
+func parseExpire(unit, arg string)(int64, error){
+	val, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil{
+		return 0, stardb.ErrValueNotInteger
+	}
+
+	now := time.Now()
+	switch unit {
+	case "px":
+		val = (val + 999) / 1000
+	case "exat":
+		val -= now.Unix()
+	case "pxat":
+		val = (val - now.UnixNano() / int64(time.Millisecond) + 999) / 1000
+	case "ex":
+	default:
+		return 0, ErrSyntaxIncorrect
+	}
+	if val <= 0{
+		return 0, ErrInvalidExpireTime
+	}
+	return val, nil
+}
+
+//解析 start end [BYTE|BIT]
+func parseBitRange(args []string)(start, end int, unit stardb.BitUnit, err error){
+	if len(args) < 2{
+		err = ErrSyntaxIncorrect
+		return
+	}
+	if start, err = strconv.Atoi(args[0]); err != nil{
+		err = ErrSyntaxIncorrect
+		return
+	}
+	if end, err = strconv.Atoi(args[1]); err != nil{
+		err = ErrSyntaxIncorrect
+		return
+	}
+
+	unit = stardb.BitUnitByte
+	if len(args) == 3{
+		switch strings.ToUpper(args[2]) {
+		case "BYTE":
+		case "BIT":
+			unit = stardb.BitUnitBit
+		default:
+			err = ErrSyntaxIncorrect
+		}
+	}
+	return
+}
+
 func init(){
 	addExecCommand("set", set)
 	addExecCommand("get", get)
@@ -185,4 +714,26 @@ func init(){
 	addExecCommand("expire", expire)
 	addExecCommand("persist", persist)
 	addExecCommand("ttl", ttl)
+	addExecCommand("setbit", setBit)
+	addExecCommand("getbit", getBit)
+	addExecCommand("bitcount", bitCount)
+	addExecCommand("bitpos", bitPos)
+	addExecCommand("bitop", bitOp)
+	addExecCommand("pfadd", pfAdd)
+	addExecCommand("pfcount", pfCount)
+	addExecCommand("pfmerge", pfMerge)
+	addExecCommand("incr", incr)
+	addExecCommand("decr", decr)
+	addExecCommand("incrby", incrBy)
+	addExecCommand("decrby", decrBy)
+	addExecCommand("incrbyfloat", incrByFloat)
+	addExecCommand("mset", mSet)
+	addExecCommand("msetnx", mSetNx)
+	addExecCommand("mget", mGet)
+	addExecCommand("setex", setEx)
+	addExecCommand("psetex", pSetEx)
+	addExecCommand("getrange", getRange)
+	addExecCommand("setrange", setRange)
+	addExecCommand("getdel", getDel)
+	addExecCommand("getex", getEx)
 }
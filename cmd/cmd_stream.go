@@ -0,0 +1,526 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/tidwall/redcon"
+	"stardb"
+	"stardb/ds/stream"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrXGroupSubcommand = errors.New("unknown subcommand for 'xgroup' command")
+
+func xAdd(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 4{
+		err = newWrongNumOfArgsError("xadd")
+		return
+	}
+
+	key, i := []byte(args[0]), 1
+	noMkStream, trimBy, threshold := false, "", ""
+	for ; i < len(args); i++{
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			continue
+		case "MAXLEN", "MINID":
+			if i + 1 >= len(args){
+				err = ErrSyntaxIncorrect
+				return
+			}
+			trimBy = strings.ToUpper(args[i])
+			i++
+			if args[i] == "=" || args[i] == "~"{
+				i++
+			}
+			if i >= len(args){
+				err = ErrSyntaxIncorrect
+				return
+			}
+			threshold = args[i]
+			continue
+		}
+		break
+	}
+
+	//剩余参数为 id field value [field value ...]
+	if i >= len(args) || (len(args) - i - 1) == 0 || (len(args) - i - 1) % 2 != 0{
+		err = newWrongNumOfArgsError("xadd")
+		return
+	}
+	if noMkStream && !db.XKeyExists(key){
+		return
+	}
+
+	var fields [][]byte
+	for _, f := range args[i+1:]{
+		fields = append(fields, []byte(f))
+	}
+
+	var id string
+	if id, err = db.XAdd(key, args[i], fields...); err != nil{
+		return
+	}
+	if err = xTrimBy(db, key, trimBy, threshold); err != nil{
+		return
+	}
+	res = id
+	return
+}
+
+func xRange(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	return xRawRange(db, args, "xrange")
+}
+
+func xRevRange(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	return xRawRange(db, args, "xrevrange")
+}
+
+func xRawRange(db *stardb.StarDB, args []string, cmd string) (res interface{}, err error) {
+	if len(args) != 3 && len(args) != 5{
+		err = newWrongNumOfArgsError(cmd)
+		return
+	}
+
+	count := 0
+	if len(args) == 5{
+		if strings.ToUpper(args[3]) != "COUNT"{
+			err = ErrSyntaxIncorrect
+			return
+		}
+		if count, err = strconv.Atoi(args[4]); err != nil{
+			err = ErrSyntaxIncorrect
+			return
+		}
+		//COUNT 0 不返回任何消息
+		if count <= 0{
+			res = []interface{}{}
+			return
+		}
+	}
+
+	var entries []*stream.Entry
+	if cmd == "xrange"{
+		entries, err = db.XRange([]byte(args[0]), args[1], args[2], count)
+	}else{
+		entries, err = db.XRevRange([]byte(args[0]), args[1], args[2], count)
+	}
+	if err == nil{
+		res = streamEntriesReply(entries)
+	}
+	return
+}
+
+func xLen(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 1{
+		err = newWrongNumOfArgsError("xlen")
+		return
+	}
+
+	res = redcon.SimpleInt(db.XLen([]byte(args[0])))
+	return
+}
+
+func xDel(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("xdel")
+		return
+	}
+
+	var val int
+	if val, err = db.XDel([]byte(args[0]), args[1:]...); err == nil{
+		res = redcon.SimpleInt(val)
+	}
+	return
+}
+
+func xTrim(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3 && len(args) != 4{
+		err = newWrongNumOfArgsError("xtrim")
+		return
+	}
+
+	threshold := args[2]
+	if len(args) == 4{
+		if args[2] != "=" && args[2] != "~"{
+			err = ErrSyntaxIncorrect
+			return
+		}
+		threshold = args[3]
+	}
+
+	key := []byte(args[0])
+	var val int
+	switch strings.ToUpper(args[1]) {
+	case "MAXLEN":
+		var maxLen int
+		if maxLen, err = strconv.Atoi(threshold); err != nil{
+			err = ErrSyntaxIncorrect
+			return
+		}
+		val, err = db.XTrim(key, maxLen)
+	case "MINID":
+		val, err = db.XTrimMinID(key, threshold)
+	default:
+		err = ErrSyntaxIncorrect
+	}
+	if err == nil{
+		res = redcon.SimpleInt(val)
+	}
+	return
+}
+
+func xRead(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 3{
+		err = newWrongNumOfArgsError("xread")
+		return
+	}
+
+	count, block, timeout := 0, false, time.Duration(0)
+	i := 0
+	for ; i < len(args) && strings.ToUpper(args[i]) != "STREAMS"; i += 2{
+		if i + 1 >= len(args){
+			err = ErrSyntaxIncorrect
+			return
+		}
+		switch strings.ToUpper(args[i]) {
+		case "COUNT":
+			if count, err = strconv.Atoi(args[i+1]); err != nil{
+				err = ErrSyntaxIncorrect
+				return
+			}
+		case "BLOCK":
+			if timeout, err = parseBlockTimeout(args[i+1]); err != nil{
+				return
+			}
+			block = true
+		default:
+			err = ErrSyntaxIncorrect
+			return
+		}
+	}
+
+	keys, ids, err := parseStreams(args[i:])
+	if err != nil{
+		return
+	}
+
+	var val []stardb.StreamEntries
+	if block{
+		val, err = db.XReadBlock(timeout, keys, ids, count)
+	}else{
+		val, err = db.XRead(keys, ids, count)
+	}
+	if err == nil && len(val) > 0{
+		res = streamsReply(val)
+	}
+	return
+}
+
+func xGroup(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 3{
+		err = newWrongNumOfArgsError("xgroup")
+		return
+	}
+
+	key, group := []byte(args[1]), []byte(args[2])
+	switch strings.ToUpper(args[0]) {
+	case "CREATE":
+		if len(args) != 4 && len(args) != 5{
+			err = newWrongNumOfArgsError("xgroup")
+			return
+		}
+		mkStream := false
+		if len(args) == 5{
+			if strings.ToUpper(args[4]) != "MKSTREAM"{
+				err = ErrSyntaxIncorrect
+				return
+			}
+			mkStream = true
+		}
+		if err = db.XGroupCreate(key, group, args[3], mkStream); err == nil{
+			res = okResult
+		}
+	case "DESTROY":
+		if len(args) != 3{
+			err = newWrongNumOfArgsError("xgroup")
+			return
+		}
+		var ok bool
+		if ok, err = db.XGroupDestroy(key, group); err == nil{
+			if ok{
+				res = redcon.SimpleInt(1)
+			}else{
+				res = redcon.SimpleInt(0)
+			}
+		}
+	case "DELCONSUMER":
+		if len(args) != 4{
+			err = newWrongNumOfArgsError("xgroup")
+			return
+		}
+		var val int
+		if val, err = db.XGroupDelConsumer(key, group, []byte(args[3])); err == nil{
+			res = redcon.SimpleInt(val)
+		}
+	default:
+		err = ErrXGroupSubcommand
+	}
+	return
+}
+
+func xReadGroup(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 6 || strings.ToUpper(args[0]) != "GROUP"{
+		err = newWrongNumOfArgsError("xreadgroup")
+		return
+	}
+
+	group, consumer := []byte(args[1]), []byte(args[2])
+	count, block, noAck, timeout := 0, false, false, time.Duration(0)
+	i := 3
+	for ; i < len(args) && strings.ToUpper(args[i]) != "STREAMS"; i++{
+		switch strings.ToUpper(args[i]) {
+		case "NOACK":
+			noAck = true
+		case "COUNT", "BLOCK":
+			if i + 1 >= len(args){
+				err = ErrSyntaxIncorrect
+				return
+			}
+			if strings.ToUpper(args[i]) == "COUNT"{
+				if count, err = strconv.Atoi(args[i+1]); err != nil{
+					err = ErrSyntaxIncorrect
+					return
+				}
+			}else{
+				if timeout, err = parseBlockTimeout(args[i+1]); err != nil{
+					return
+				}
+				block = true
+			}
+			i++
+		default:
+			err = ErrSyntaxIncorrect
+			return
+		}
+	}
+
+	keys, ids, err := parseStreams(args[i:])
+	if err != nil{
+		return
+	}
+
+	var val []stardb.StreamEntries
+	if block{
+		val, err = db.XReadGroupBlock(timeout, group, consumer, keys, ids, count, noAck)
+	}else{
+		val, err = db.XReadGroup(group, consumer, keys, ids, count, noAck)
+	}
+	if err == nil && len(val) > 0{
+		res = streamsReply(val)
+	}
+	return
+}
+
+func xAck(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 3{
+		err = newWrongNumOfArgsError("xack")
+		return
+	}
+
+	var val int
+	if val, err = db.XAck([]byte(args[0]), []byte(args[1]), args[2:]...); err == nil{
+		res = redcon.SimpleInt(val)
+	}
+	return
+}
+
+func xPending(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("xpending")
+		return
+	}
+	key, group := []byte(args[0]), []byte(args[1])
+
+	//汇总形式
+	if len(args) == 2{
+		var sum stream.PendingSummary
+		if sum, err = db.XPending(key, group); err != nil{
+			return
+		}
+		if sum.Count == 0{
+			res = []interface{}{redcon.SimpleInt(0), nil, nil, nil}
+			return
+		}
+
+		var consumers []interface{}
+		for name, cnt := range sum.Consumers{
+			consumers = append(consumers, []interface{}{name, strconv.Itoa(cnt)})
+		}
+		res = []interface{}{redcon.SimpleInt(sum.Count), sum.MinID.String(), sum.MaxID.String(), consumers}
+		return
+	}
+
+	//扩展形式: [IDLE min-idle-time] start end count [consumer]
+	rest, minIdle := args[2:], time.Duration(0)
+	if len(rest) > 0 && strings.ToUpper(rest[0]) == "IDLE"{
+		if len(rest) < 2{
+			err = ErrSyntaxIncorrect
+			return
+		}
+		if minIdle, err = parseBlockTimeout(rest[1]); err != nil{
+			return
+		}
+		rest = rest[2:]
+	}
+	if len(rest) != 3 && len(rest) != 4{
+		err = ErrSyntaxIncorrect
+		return
+	}
+	count, err := strconv.Atoi(rest[2])
+	if err != nil{
+		err = ErrSyntaxIncorrect
+		return
+	}
+	var consumer []byte
+	if len(rest) == 4{
+		consumer = []byte(rest[3])
+	}
+	if count <= 0{
+		res = []interface{}{}
+		return
+	}
+
+	var pending []*stream.PendingEntry
+	if pending, err = db.XPendingRange(key, group, rest[0], rest[1], count, consumer, minIdle); err != nil{
+		return
+	}
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	results := make([]interface{}, len(pending))
+	for i, p := range pending{
+		results[i] = []interface{}{p.ID.String(), p.Consumer, redcon.SimpleInt(now - p.DeliveryTime), redcon.SimpleInt(p.DeliveryCount)}
+	}
+	res = results
+	return
+}
+
+func xClaim(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 5{
+		err = newWrongNumOfArgsError("xclaim")
+		return
+	}
+
+	minIdle, err := parseBlockTimeout(args[3])
+	if err != nil{
+		return
+	}
+
+	var ids []string
+	justID := false
+	for _, arg := range args[4:]{
+		if strings.ToUpper(arg) == "JUSTID"{
+			justID = true
+			continue
+		}
+		ids = append(ids, arg)
+	}
+
+	var entries []*stream.Entry
+	if entries, err = db.XClaim([]byte(args[0]), []byte(args[1]), []byte(args[2]), minIdle, ids, justID); err != nil{
+		return
+	}
+	if justID{
+		results := make([]interface{}, len(entries))
+		for i, e := range entries{
+			results[i] = e.ID.String()
+		}
+		res = results
+	}else{
+		res = streamEntriesReply(entries)
+	}
+	return
+}
+
+//xAdd的MAXLEN和MINID选项
+func xTrimBy(db *stardb.StarDB, key []byte, trimBy, threshold string) (err error){
+	switch trimBy {
+	case "MAXLEN":
+		var maxLen int
+		if maxLen, err = strconv.Atoi(threshold); err != nil{
+			return ErrSyntaxIncorrect
+		}
+		_, err = db.XTrim(key, maxLen)
+	case "MINID":
+		_, err = db.XTrimMinID(key, threshold)
+	}
+	return
+}
+
+//解析 STREAMS key [key ...] id [id ...]
+func parseStreams(args []string)(keys [][]byte, ids []string, err error){
+	if len(args) < 3 || strings.ToUpper(args[0]) != "STREAMS" || (len(args) - 1) % 2 != 0{
+		err = ErrSyntaxIncorrect
+		return
+	}
+
+	n := (len(args) - 1) / 2
+	for _, k := range args[1:n+1]{
+		keys = append(keys, []byte(k))
+	}
+	ids = args[n+1:]
+	return
+}
+
+//stream阻塞命令的超时时间, 单位为毫秒
+func parseBlockTimeout(arg string)(time.Duration, error){
+	ms, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil{
+		return 0, ErrTimeoutInvalid
+	}
+	if ms < 0{
+		return 0, ErrTimeoutNegative
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+func streamEntriesReply(entries []*stream.Entry) []interface{}{
+	results := make([]interface{}, len(entries))
+	for i, e := range entries{
+		//已被删除的待确认消息只返回id
+		if e.Fields == nil{
+			results[i] = []interface{}{e.ID.String(), nil}
+			continue
+		}
+		fields := make([]string, len(e.Fields))
+		for j, f := range e.Fields{
+			fields[j] = string(f)
+		}
+		results[i] = []interface{}{e.ID.String(), fields}
+	}
+	return results
+}
+
+func streamsReply(val []stardb.StreamEntries) []interface{}{
+	results := make([]interface{}, len(val))
+	for i, v := range val{
+		results[i] = []interface{}{string(v.Key), streamEntriesReply(v.Entries)}
+	}
+	return results
+}
+
+func init(){
+	addExecCommand("xadd", xAdd)
+	addExecCommand("xrange", xRange)
+	addExecCommand("xrevrange", xRevRange)
+	addExecCommand("xlen", xLen)
+	addExecCommand("xdel", xDel)
+	addExecCommand("xtrim", xTrim)
+	addExecCommand("xread", xRead)
+	addExecCommand("xgroup", xGroup)
+	addExecCommand("xreadgroup", xReadGroup)
+	addExecCommand("xack", xAck)
+	addExecCommand("xpending", xPending)
+	addExecCommand("xclaim", xClaim)
+}
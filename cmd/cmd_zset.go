@@ -3,7 +3,9 @@ package cmd
 import (
 	"fmt"
 	"github.com/tidwall/redcon"
+	"math"
 	"stardb"
+	"stardb/ds/zset"
 	"stardb/utils"
 	"strconv"
 	"strings"
@@ -12,19 +14,68 @@ import (
 const(
 	withscores = "withscores"
 )
+//ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
 func zAdd(db *stardb.StarDB, args []string) (res interface{}, err error) {
-	if len(args) != 3 {
+	if len(args) < 3 {
 		err = newWrongNumOfArgsError("zadd")
 		return
 	}
 
-	score, err := utils.StrToFloat64(args[1])
-	if err != nil{
+	var opt stardb.ZAddOption
+	incr := false
+	i := 1
+	for ; i < len(args); i++{
+		isFlag := true
+		switch strings.ToLower(args[i]) {
+		case "nx":
+			opt.NX = true
+		case "xx":
+			opt.XX = true
+		case "gt":
+			opt.GT = true
+		case "lt":
+			opt.LT = true
+		case "ch":
+			opt.CH = true
+		case "incr":
+			incr = true
+		default:
+			isFlag = false
+		}
+		if !isFlag{
+			break
+		}
+	}
+	rest := args[i:]
+	if len(rest) == 0 || len(rest) % 2 != 0{
 		err = ErrSyntaxIncorrect
 		return
 	}
-	if err = db.ZAdd([]byte(args[0]), score, []byte(args[2])); err == nil{
-		res= okResult
+	if incr && len(rest) != 2{
+		err = ErrZAddIncrPair
+		return
+	}
+
+	members := make([]stardb.ZMember, len(rest) / 2)
+	for j := range members{
+		if members[j].Score, err = utils.StrToFloat64(rest[2*j]); err != nil{
+			err = stardb.ErrValueNotFloat
+			return
+		}
+		members[j].Member = []byte(rest[2*j+1])
+	}
+
+	if incr{
+		score, ok, err := db.ZAddIncr([]byte(args[0]), opt, members[0].Score, members[0].Member)
+		if err != nil || !ok{
+			return nil, err
+		}
+		return utils.Float64ToStr(score), nil
+	}
+
+	n, err := db.ZMAdd([]byte(args[0]), opt, members...)
+	if err == nil{
+		res = redcon.SimpleInt(n)
 	}
 	return
 }
@@ -39,6 +90,62 @@ func zScore(db *stardb.StarDB, args []string) (res interface{}, err error) {
 	return
 }
 
+func zMScore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("zmscore")
+		return
+	}
+
+	scores := db.ZMScore([]byte(args[0]), toBytesSlice(args[1:])...)
+	results := make([]interface{}, len(scores))
+	for i, score := range scores{
+		if score != nil{
+			results[i] = utils.Float64ToStr(*score)
+		}
+	}
+	res = results
+	return
+}
+
+func zRandMember(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 1 || len(args) > 3{
+		err = newWrongNumOfArgsError("zrandmember")
+		return
+	}
+
+	if len(args) == 1{
+		if val := db.ZRandMember([]byte(args[0]), 1, false); len(val) > 0{
+			res = val[0].(string)
+		}
+		return
+	}
+
+	count, err := strconv.Atoi(args[1])
+	if err != nil{
+		err = stardb.ErrValueNotInteger
+		return
+	}
+	withScores := false
+	if len(args) == 3{
+		if strings.ToLower(args[2]) != withscores{
+			return nil, ErrSyntaxIncorrect
+		}
+		withScores = true
+	}
+
+	val := db.ZRandMember([]byte(args[0]), count, withScores)
+	results := make([]string, len(val))
+	for i, v := range val{
+		if score, ok := v.(float64); ok{
+			results[i] = utils.Float64ToStr(score)
+		}else{
+			results[i] = v.(string)
+		}
+	}
+	res = results
+	return
+}
+
 func zCard(db *stardb.StarDB, args []string) (res interface{}, err error) {
 	if len(args) != 1{
 		err = newWrongNumOfArgsError("zcard")
@@ -85,12 +192,64 @@ func zIncrBy(db *stardb.StarDB, args []string) (res interface{}, err error) {
 	return
 }
 
+//ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+//BYSCORE和BYLEX时start和stop为区间的边界, REV时start为区间的最大值
 func zRange(db *stardb.StarDB, args []string) (res interface{}, err error) {
-	if len(args) != 3 && len(args) != 4{
+	if len(args) < 3{
 		err = newWrongNumOfArgsError("zrange")
 		return
 	}
-	return zRawRange(db, args, false)
+
+	var byScore, byLex, rev bool
+	var rest []string
+	for _, arg := range args[3:]{
+		switch strings.ToLower(arg) {
+		case "byscore":
+			byScore = true
+		case "bylex":
+			byLex = true
+		case "rev":
+			rev = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if byScore && byLex{
+		err = ErrSyntaxIncorrect
+		return
+	}
+	withScores, offset, count, err := parseRangeOptions(rest, true)
+	if err != nil{
+		return
+	}
+
+	key := []byte(args[0])
+	switch {
+	case byScore:
+		r, err := parseScoreRange(args[1], args[2], rev)
+		if err != nil{
+			return nil, err
+		}
+		if rev{
+			return pairsToStrings(db.ZRevRangeByScore(key, r, offset, count), withScores), nil
+		}
+		return pairsToStrings(db.ZRangeByScore(key, r, offset, count), withScores), nil
+	case byLex:
+		if withScores{
+			return nil, ErrSyntaxIncorrect
+		}
+		return zRawRangeByLex(db, key, args[1], args[2], rev, offset, count)
+	default:
+		//按索引查询时不支持LIMIT
+		if len(rest) > 0 && !(len(rest) == 1 && withScores){
+			return nil, ErrSyntaxIncorrect
+		}
+		rangeArgs := args[:3]
+		if withScores{
+			rangeArgs = append([]string{args[0], args[1], args[2]}, withscores)
+		}
+		return zRawRange(db, rangeArgs, rev)
+	}
 }
 
 func zrevRange(db *stardb.StarDB, args []string) (res interface{}, err error) {
@@ -200,7 +359,7 @@ func zRawGetByRank(db *stardb.StarDB, args []string, rev bool)(res interface{},
 }
 
 func zScoreRange(db *stardb.StarDB, args []string) (res interface{}, err error) {
-	if len(args) != 3{
+	if len(args) != 3 && len(args) != 6{
 		err = newWrongNumOfArgsError("zscorerange")
 		return
 	}
@@ -209,30 +368,30 @@ func zScoreRange(db *stardb.StarDB, args []string) (res interface{}, err error)
 }
 
 func zRevScoreRange(db *stardb.StarDB, args []string) (res interface{}, err error) {
-	if len(args) != 3{
-		err = newWrongNumOfArgsError("zsrevscorerange")
+	if len(args) != 3 && len(args) != 6{
+		err = newWrongNumOfArgsError("zrevscorerange")
 		return
 	}
 
-	return zRawScoreRange(db, args, false)
+	return zRawScoreRange(db, args, true)
 }
 
+//ZSCORERANGE key min max [LIMIT offset count], 返回成员和score
 func zRawScoreRange(db *stardb.StarDB, args []string, rev bool)(res interface{}, err error){
-	param1, err := utils.StrToFloat64(args[1])
+	r, err := parseScoreRange(args[1], args[2], rev)
 	if err != nil{
-		err = ErrSyntaxIncorrect
 		return
 	}
-	param2, err := utils.StrToFloat64(args[2])
+	_, offset, count, err := parseRangeOptions(args[3:], false)
 	if err != nil{
-		err = ErrSyntaxIncorrect
 		return
 	}
+
 	var val []interface{}
 	if rev{
-		val = db.ZRevScoreRange([]byte(args[0]), param1, param2)
+		val = db.ZRevRangeByScore([]byte(args[0]), r, offset, count)
 	}else{
-		db.ZScoreRange([]byte(args[0]), param1, param2)
+		val = db.ZRangeByScore([]byte(args[0]), r, offset, count)
 	}
 	results := make([]string, len(val))
 	for i, v := range val{
@@ -242,9 +401,690 @@ func zRawScoreRange(db *stardb.StarDB, args []string, rev bool)(res interface{},
 	return
 }
 
+func zRangeByScore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 3{
+		err = newWrongNumOfArgsError("zrangebyscore")
+		return
+	}
+	return zRawRangeByScore(db, args, false)
+}
+
+func zRevRangeByScore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 3{
+		err = newWrongNumOfArgsError("zrevrangebyscore")
+		return
+	}
+	return zRawRangeByScore(db, args, true)
+}
+
+//ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count], ZREVRANGEBYSCORE的max在min之前
+func zRawRangeByScore(db *stardb.StarDB, args []string, rev bool)(res interface{}, err error){
+	r, err := parseScoreRange(args[1], args[2], rev)
+	if err != nil{
+		return
+	}
+	withScores, offset, count, err := parseRangeOptions(args[3:], true)
+	if err != nil{
+		return
+	}
+
+	var val []interface{}
+	if rev{
+		val = db.ZRevRangeByScore([]byte(args[0]), r, offset, count)
+	}else{
+		val = db.ZRangeByScore([]byte(args[0]), r, offset, count)
+	}
+	res = pairsToStrings(val, withScores)
+	return
+}
+
+func zRangeByLex(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3 && len(args) != 6{
+		err = newWrongNumOfArgsError("zrangebylex")
+		return
+	}
+	_, offset, count, err := parseRangeOptions(args[3:], false)
+	if err != nil{
+		return
+	}
+	return zRawRangeByLex(db, []byte(args[0]), args[1], args[2], false, offset, count)
+}
+
+func zRevRangeByLex(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3 && len(args) != 6{
+		err = newWrongNumOfArgsError("zrevrangebylex")
+		return
+	}
+	_, offset, count, err := parseRangeOptions(args[3:], false)
+	if err != nil{
+		return
+	}
+	return zRawRangeByLex(db, []byte(args[0]), args[1], args[2], true, offset, count)
+}
+
+//rev为true时p1为区间的最大值
+func zRawRangeByLex(db *stardb.StarDB, key []byte, p1, p2 string, rev bool, offset, count int)(res interface{}, err error){
+	r, err := parseLexRange(p1, p2, rev)
+	if err != nil{
+		return
+	}
+
+	var val []interface{}
+	if rev{
+		val = db.ZRevRangeByLex(key, r, offset, count)
+	}else{
+		val = db.ZRangeByLex(key, r, offset, count)
+	}
+	results := make([]string, len(val))
+	for i, v := range val{
+		results[i] = v.(string)
+	}
+	res = results
+	return
+}
+
+func zLexCount(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("zlexcount")
+		return
+	}
+	r, err := parseLexRange(args[1], args[2], false)
+	if err != nil{
+		return
+	}
+	res = redcon.SimpleInt(db.ZLexCount([]byte(args[0]), r))
+	return
+}
+
+func zRemRangeByLex(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("zremrangebylex")
+		return
+	}
+	r, err := parseLexRange(args[1], args[2], false)
+	if err != nil{
+		return
+	}
+	n, err := db.ZRemRangeByLex([]byte(args[0]), r)
+	if err == nil{
+		res = redcon.SimpleInt(n)
+	}
+	return
+}
+
+func zCount(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("zcount")
+		return
+	}
+	r, err := parseScoreRange(args[1], args[2], false)
+	if err != nil{
+		return
+	}
+	res = redcon.SimpleInt(db.ZCount([]byte(args[0]), r))
+	return
+}
+
+func zRemRangeByScore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("zremrangebyscore")
+		return
+	}
+	r, err := parseScoreRange(args[1], args[2], false)
+	if err != nil{
+		return
+	}
+	n, err := db.ZRemRangeByScore([]byte(args[0]), r)
+	if err == nil{
+		res = redcon.SimpleInt(n)
+	}
+	return
+}
+
+func zRemRangeByRank(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3{
+		err = newWrongNumOfArgsError("zremrangebyrank")
+		return
+	}
+	start, err := strconv.Atoi(args[1])
+	if err != nil{
+		err = ErrSyntaxIncorrect
+		return
+	}
+	stop, err := strconv.Atoi(args[2])
+	if err != nil{
+		err = ErrSyntaxIncorrect
+		return
+	}
+	n, err := db.ZRemRangeByRank([]byte(args[0]), start, stop)
+	if err == nil{
+		res = redcon.SimpleInt(n)
+	}
+	return
+}
+
+func zPopMin(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 1 && len(args) != 2{
+		err = newWrongNumOfArgsError("zpopmin")
+		return
+	}
+	return zRawPop(db, args, false)
+}
+
+func zPopMax(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 1 && len(args) != 2{
+		err = newWrongNumOfArgsError("zpopmax")
+		return
+	}
+	return zRawPop(db, args, true)
+}
+
+//ZPOPMIN|ZPOPMAX key [count]
+func zRawPop(db *stardb.StarDB, args []string, max bool)(res interface{}, err error){
+	count := 1
+	if len(args) == 2{
+		if count, err = strconv.Atoi(args[1]); err != nil || count < 0{
+			err = ErrValueNotPositive
+			return
+		}
+	}
+
+	var val []interface{}
+	if max{
+		val, err = db.ZPopMax([]byte(args[0]), count)
+	}else{
+		val, err = db.ZPopMin([]byte(args[0]), count)
+	}
+	if err == nil{
+		res = pairsToStrings(val, true)
+	}
+	return
+}
+
+func bzPopMin(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("bzpopmin")
+		return
+	}
+	return bzRawPop(db, args, false)
+}
+
+func bzPopMax(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("bzpopmax")
+		return
+	}
+	return bzRawPop(db, args, true)
+}
+
+//BZPOPMIN|BZPOPMAX key [key ...] timeout
+func bzRawPop(db *stardb.StarDB, args []string, max bool)(res interface{}, err error){
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil{
+		return
+	}
+
+	keys := toBytesSlice(args[:len(args)-1])
+	var key, member []byte
+	var score float64
+	if max{
+		key, member, score, err = db.BZPopMax(timeout, keys...)
+	}else{
+		key, member, score, err = db.BZPopMin(timeout, keys...)
+	}
+	if err == nil && key != nil{
+		res = []string{string(key), string(member), utils.Float64ToStr(score)}
+	}
+	return
+}
+
+//解析score区间, 支持(表示不包含边界以及-inf和+inf, rev为true时先max后min
+func parseScoreRange(minArg, maxArg string, rev bool)(r zset.ScoreRange, err error){
+	if rev{
+		minArg, maxArg = maxArg, minArg
+	}
+	if r.Min, r.MinEx, err = parseScoreBound(minArg); err != nil{
+		return
+	}
+	r.Max, r.MaxEx, err = parseScoreBound(maxArg)
+	return
+}
+
+func parseScoreBound(arg string)(score float64, exclusive bool, err error){
+	if strings.HasPrefix(arg, "("){
+		exclusive = true
+		arg = arg[1:]
+	}
+	if score, err = utils.StrToFloat64(arg); err != nil || math.IsNaN(score){
+		err = ErrMinMaxNotFloat
+	}
+	return
+}
+
+//解析字典序区间, 边界为-, +, [member或者(member, rev为true时先max后min
+func parseLexRange(minArg, maxArg string, rev bool)(r zset.LexRange, err error){
+	if rev{
+		minArg, maxArg = maxArg, minArg
+	}
+	if r.Min, err = parseLexBound(minArg); err != nil{
+		return
+	}
+	r.Max, err = parseLexBound(maxArg)
+	return
+}
+
+func parseLexBound(arg string)(b zset.LexBound, err error){
+	switch {
+	case arg == "-":
+		b.Inf = -1
+	case arg == "+":
+		b.Inf = 1
+	case strings.HasPrefix(arg, "["):
+		b.Member = arg[1:]
+	case strings.HasPrefix(arg, "("):
+		b.Member, b.Exclusive = arg[1:], true
+	default:
+		err = ErrLexRange
+	}
+	return
+}
+
+//解析[WITHSCORES] [LIMIT offset count], count小于0时返回全部
+func parseRangeOptions(args []string, scores bool)(withScores bool, offset, count int, err error){
+	count = -1
+	for i := 0; i < len(args); i++{
+		switch strings.ToLower(args[i]) {
+		case withscores:
+			if !scores{
+				err = ErrSyntaxIncorrect
+				return
+			}
+			withScores = true
+		case "limit":
+			if i + 2 >= len(args){
+				err = ErrSyntaxIncorrect
+				return
+			}
+			if offset, err = strconv.Atoi(args[i+1]); err != nil{
+				err = ErrSyntaxIncorrect
+				return
+			}
+			if count, err = strconv.Atoi(args[i+2]); err != nil{
+				err = ErrSyntaxIncorrect
+				return
+			}
+			i += 2
+		default:
+			err = ErrSyntaxIncorrect
+			return
+		}
+	}
+	return
+}
+
+//将成员和score交替排列的结果转为字符串, withScores为false时只返回成员
+func pairsToStrings(val []interface{}, withScores bool) []string{
+	results := make([]string, 0, len(val))
+	for i := 0; i < len(val); i += 2{
+		results = append(results, val[i].(string))
+		if withScores{
+			results = append(results, utils.Float64ToStr(val[i+1].(float64)))
+		}
+	}
+	return results
+}
+
+func zUnion(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	return zRawOp(db, args, "zunion", true)
+}
+
+func zInter(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	return zRawOp(db, args, "zinter", true)
+}
+
+func zDiff(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	return zRawOp(db, args, "zdiff", false)
+}
+
+func zUnionStore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	return zRawStore(db, args, "zunionstore", true)
+}
+
+func zInterStore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	return zRawStore(db, args, "zinterstore", true)
+}
+
+func zDiffStore(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	return zRawStore(db, args, "zdiffstore", false)
+}
+
+//ZUNION|ZINTER|ZDIFF numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func zRawOp(db *stardb.StarDB, args []string, cmd string, weighted bool)(res interface{}, err error){
+	if len(args) < 2{
+		err = newWrongNumOfArgsError(cmd)
+		return
+	}
+	keys, opt, withScores, err := parseZStoreArgs(args, weighted, true)
+	if err != nil{
+		return
+	}
+
+	var val []interface{}
+	switch cmd {
+	case "zunion":
+		val, err = db.ZUnion(keys, opt)
+	case "zinter":
+		val, err = db.ZInter(keys, opt)
+	default:
+		val, err = db.ZDiff(keys)
+	}
+	if err != nil{
+		return
+	}
+
+	res = pairsToStrings(val, withScores)
+	return
+}
+
+//ZUNIONSTORE|ZINTERSTORE|ZDIFFSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM|MIN|MAX]
+func zRawStore(db *stardb.StarDB, args []string, cmd string, weighted bool)(res interface{}, err error){
+	if len(args) < 3{
+		err = newWrongNumOfArgsError(cmd)
+		return
+	}
+	keys, opt, _, err := parseZStoreArgs(args[1:], weighted, false)
+	if err != nil{
+		return
+	}
+
+	var n int
+	dst := []byte(args[0])
+	switch cmd {
+	case "zunionstore":
+		n, err = db.ZUnionStore(dst, keys, opt)
+	case "zinterstore":
+		n, err = db.ZInterStore(dst, keys, opt)
+	default:
+		n, err = db.ZDiffStore(dst, keys)
+	}
+	if err == nil{
+		res = redcon.SimpleInt(n)
+	}
+	return
+}
+
+//解析numkeys及之后的参数, weighted表示是否支持WEIGHTS和AGGREGATE
+func parseZStoreArgs(args []string, weighted, scores bool)(keys [][]byte, opt stardb.ZStoreOption, withScores bool, err error){
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil || numKeys <= 0{
+		err = ErrNumKeys
+		return
+	}
+	if numKeys > len(args) - 1{
+		err = ErrSyntaxIncorrect
+		return
+	}
+	keys = toBytesSlice(args[1:1+numKeys])
+
+	rest := args[1+numKeys:]
+	for i := 0; i < len(rest); i++{
+		switch strings.ToLower(rest[i]) {
+		case "weights":
+			if !weighted || i + numKeys >= len(rest){
+				err = ErrSyntaxIncorrect
+				return
+			}
+			opt.Weights = make([]float64, numKeys)
+			for j := 0; j < numKeys; j++{
+				if opt.Weights[j], err = utils.StrToFloat64(rest[i+1+j]); err != nil{
+					err = ErrWeightNotFloat
+					return
+				}
+			}
+			i += numKeys
+		case "aggregate":
+			if !weighted || i + 1 >= len(rest){
+				err = ErrSyntaxIncorrect
+				return
+			}
+			i++
+			switch strings.ToLower(rest[i]) {
+			case "sum":
+				opt.Aggregate = zset.AggregateSum
+			case "min":
+				opt.Aggregate = zset.AggregateMin
+			case "max":
+				opt.Aggregate = zset.AggregateMax
+			default:
+				err = ErrSyntaxIncorrect
+				return
+			}
+		case withscores:
+			if !scores{
+				err = ErrSyntaxIncorrect
+				return
+			}
+			withScores = true
+		default:
+			err = ErrSyntaxIncorrect
+			return
+		}
+	}
+	return
+}
+
+var geoUnits = map[string]float64{"m": 1, "km": 1000, "mi": 1609.34, "ft": 0.3048}
+
+func geoAdd(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 4 || (len(args) - 1) % 3 != 0{
+		err = newWrongNumOfArgsError("geoadd")
+		return
+	}
+
+	members := make([]stardb.GeoMember, 0, (len(args) - 1) / 3)
+	for i := 1; i < len(args); i += 3{
+		long, err1 := utils.StrToFloat64(args[i])
+		lat, err2 := utils.StrToFloat64(args[i+1])
+		if err1 != nil || err2 != nil{
+			err = ErrSyntaxIncorrect
+			return
+		}
+		members = append(members, stardb.GeoMember{Longitude: long, Latitude: lat, Member: []byte(args[i+2])})
+	}
+	if n, err := db.GeoAdd([]byte(args[0]), members...); err == nil{
+		res = redcon.SimpleInt(n)
+	}
+	return
+}
+
+func geoPos(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("geopos")
+		return
+	}
+
+	points := db.GeoPos([]byte(args[0]), toBytesSlice(args[1:])...)
+	results := make([]interface{}, len(points))
+	for i, p := range points{
+		if p != nil{
+			results[i] = []string{geoFloatToStr(p.Longitude), geoFloatToStr(p.Latitude)}
+		}
+	}
+	res = results
+	return
+}
+
+func geoDist(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) != 3 && len(args) != 4{
+		err = newWrongNumOfArgsError("geodist")
+		return
+	}
+
+	unit := 1.0
+	if len(args) == 4{
+		var ok bool
+		if unit, ok = geoUnits[strings.ToLower(args[3])]; !ok{
+			err = ErrGeoUnit
+			return
+		}
+	}
+	if dist, ok := db.GeoDist([]byte(args[0]), []byte(args[1]), []byte(args[2])); ok{
+		res = strconv.FormatFloat(dist / unit, 'f', 4, 64)
+	}
+	return
+}
+
+func geoHash(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 2{
+		err = newWrongNumOfArgsError("geohash")
+		return
+	}
+
+	hashes := db.GeoHash([]byte(args[0]), toBytesSlice(args[1:])...)
+	results := make([]interface{}, len(hashes))
+	for i, h := range hashes{
+		if h != ""{
+			results[i] = h
+		}
+	}
+	res = results
+	return
+}
+
+// GEOSEARCH key FROMMEMBER member|FROMLONLAT long lat BYRADIUS radius unit|BYBOX width height unit
+// [ASC|DESC] [COUNT count [ANY]] [WITHCOORD] [WITHDIST] [WITHHASH]
+func geoSearch(db *stardb.StarDB, args []string) (res interface{}, err error) {
+	if len(args) < 5{
+		err = newWrongNumOfArgsError("geosearch")
+		return
+	}
+
+	var opt stardb.GeoSearchOption
+	var from, by bool
+	var withCoord, withDist, withHash bool
+	unit := 1.0
+	for i := 1; i < len(args); i++{
+		left := len(args) - i - 1
+		switch strings.ToLower(args[i]) {
+		case "frommember":
+			if from || left < 1{
+				return nil, ErrSyntaxIncorrect
+			}
+			from, opt.FromMember = true, []byte(args[i+1])
+			i++
+		case "fromlonlat":
+			if from || left < 2{
+				return nil, ErrSyntaxIncorrect
+			}
+			long, err1 := utils.StrToFloat64(args[i+1])
+			lat, err2 := utils.StrToFloat64(args[i+2])
+			if err1 != nil || err2 != nil{
+				return nil, ErrSyntaxIncorrect
+			}
+			from, opt.Longitude, opt.Latitude = true, long, lat
+			i += 2
+		case "byradius":
+			if by || left < 2{
+				return nil, ErrSyntaxIncorrect
+			}
+			if opt.Radius, err = utils.StrToFloat64(args[i+1]); err != nil || opt.Radius < 0{
+				return nil, ErrSyntaxIncorrect
+			}
+			var ok bool
+			if unit, ok = geoUnits[strings.ToLower(args[i+2])]; !ok{
+				return nil, ErrGeoUnit
+			}
+			by = true
+			i += 2
+		case "bybox":
+			if by || left < 3{
+				return nil, ErrSyntaxIncorrect
+			}
+			width, err1 := utils.StrToFloat64(args[i+1])
+			height, err2 := utils.StrToFloat64(args[i+2])
+			if err1 != nil || err2 != nil || width < 0 || height < 0{
+				return nil, ErrSyntaxIncorrect
+			}
+			var ok bool
+			if unit, ok = geoUnits[strings.ToLower(args[i+3])]; !ok{
+				return nil, ErrGeoUnit
+			}
+			by, opt.Width, opt.Height = true, width, height
+			i += 3
+		case "asc":
+			opt.Sort = stardb.GeoSortAsc
+		case "desc":
+			opt.Sort = stardb.GeoSortDesc
+		case "count":
+			if left < 1{
+				return nil, ErrSyntaxIncorrect
+			}
+			if opt.Count, err = strconv.Atoi(args[i+1]); err != nil || opt.Count <= 0{
+				return nil, ErrGeoCount
+			}
+			i++
+			if left > 1 && strings.ToLower(args[i+1]) == "any"{
+				opt.Any = true
+				i++
+			}
+		case "withcoord":
+			withCoord = true
+		case "withdist":
+			withDist = true
+		case "withhash":
+			withHash = true
+		default:
+			return nil, ErrSyntaxIncorrect
+		}
+	}
+	if !from || !by{
+		return nil, ErrSyntaxIncorrect
+	}
+	opt.Radius, opt.Width, opt.Height = opt.Radius * unit, opt.Width * unit, opt.Height * unit
+
+	val, err := db.GeoSearch([]byte(args[0]), opt)
+	if err != nil{
+		return
+	}
+	results := make([]interface{}, len(val))
+	for i, v := range val{
+		if !withCoord && !withDist && !withHash{
+			results[i] = string(v.Member)
+			continue
+		}
+		item := []interface{}{string(v.Member)}
+		if withDist{
+			item = append(item, strconv.FormatFloat(v.Distance / unit, 'f', 4, 64))
+		}
+		if withHash{
+			item = append(item, redcon.SimpleInt(v.Hash))
+		}
+		if withCoord{
+			item = append(item, []string{geoFloatToStr(v.Longitude), geoFloatToStr(v.Latitude)})
+		}
+		results[i] = item
+	}
+	res = results
+	return
+}
+
+func geoFloatToStr(val float64) string{
+	return strconv.FormatFloat(val, 'f', 17, 64)
+}
+
+func toBytesSlice(args []string) [][]byte{
+	res := make([][]byte, len(args))
+	for i, a := range args{
+		res[i] = []byte(a)
+	}
+	return res
+}
+
 func init(){
 	addExecCommand("zadd", zAdd)
 	addExecCommand("zscore", zScore)
+	addExecCommand("zmscore", zMScore)
+	addExecCommand("zrandmember", zRandMember)
 	addExecCommand("zcard", zCard)
 	addExecCommand("zrank", zRank)
 	addExecCommand("zrevrank", zrevRank)
@@ -256,4 +1096,28 @@ func init(){
 	addExecCommand("zrevgetbyrank", zRevGetByRank)
 	addExecCommand("zscorerange", zScoreRange)
 	addExecCommand("zrevscorerange", zRevScoreRange)
-}
\ No newline at end of file
+	addExecCommand("zrangebyscore", zRangeByScore)
+	addExecCommand("zrevrangebyscore", zRevRangeByScore)
+	addExecCommand("zcount", zCount)
+	addExecCommand("zrangebylex", zRangeByLex)
+	addExecCommand("zrevrangebylex", zRevRangeByLex)
+	addExecCommand("zlexcount", zLexCount)
+	addExecCommand("zremrangebylex", zRemRangeByLex)
+	addExecCommand("zremrangebyscore", zRemRangeByScore)
+	addExecCommand("zremrangebyrank", zRemRangeByRank)
+	addExecCommand("zpopmin", zPopMin)
+	addExecCommand("zpopmax", zPopMax)
+	addExecCommand("bzpopmin", bzPopMin)
+	addExecCommand("bzpopmax", bzPopMax)
+	addExecCommand("zunion", zUnion)
+	addExecCommand("zinter", zInter)
+	addExecCommand("zdiff", zDiff)
+	addExecCommand("zunionstore", zUnionStore)
+	addExecCommand("zinterstore", zInterStore)
+	addExecCommand("zdiffstore", zDiffStore)
+	addExecCommand("geoadd", geoAdd)
+	addExecCommand("geopos", geoPos)
+	addExecCommand("geodist", geoDist)
+	addExecCommand("geohash", geoHash)
+	addExecCommand("geosearch", geoSearch)
+}
@@ -6,7 +6,21 @@ import (
 	"github.com/tidwall/redcon"
 )
 
-var ErrSyntaxIncorrect = errors.New("syntax err")
+var (
+	ErrSyntaxIncorrect = errors.New("syntax err")
+	ErrTimeoutInvalid = errors.New("timeout is not a float or out of range")
+	ErrTimeoutNegative = errors.New("timeout is negative")
+	ErrNumKeys = errors.New("numkeys should be greater than 0")
+	ErrLimitNegative = errors.New("LIMIT can't be negative")
+	ErrInvalidExpireTime = errors.New("invalid expire time")
+	ErrGeoUnit = errors.New("unsupported unit provided. please use m, km, ft, mi")
+	ErrGeoCount = errors.New("COUNT must be > 0")
+	ErrWeightNotFloat = errors.New("weight value is not a float")
+	ErrMinMaxNotFloat = errors.New("min or max is not a float")
+	ErrValueNotPositive = errors.New("value is out of range, must be positive")
+	ErrLexRange = errors.New("min or max not valid string range item")
+	ErrZAddIncrPair = errors.New("INCR option supports a single increment-element pair")
+)
 
 var okResult = redcon.SimpleString("OK")
 
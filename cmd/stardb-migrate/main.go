@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"stardb"
+)
+
+var dirPath = flag.String("dir_path", "", "the dirpath of the database to migrate")
+
+//离线把db目录下的数据文件重写为最新的格式版本, 迁移前需要关闭db
+func main(){
+	flag.Parse()
+	if *dirPath == ""{
+		log.Fatal("dir_path is required")
+	}
+
+	n, err := stardb.Migrate(*dirPath)
+	if err != nil{
+		log.Fatalf("migrate %s err: %v", *dirPath, err)
+	}
+	fmt.Printf("migrated %d data files in %s\n", n, *dirPath)
+}
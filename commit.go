@@ -0,0 +1,212 @@
+package stardb
+
+import (
+	"stardb/storage"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// syncBatch 一次fsync覆盖的一批写入
+	syncBatch struct {
+		files 	map[*storage.DBFile]struct{}  //这批写入涉及的文件
+		n       int
+		done    chan struct{}                 //fsync完成后关闭
+		err     error
+	}
+
+	// groupCommitter 组提交, 把并发写入各自的fsync合并成一次
+	// 写入方把entry写入文件后加入当前批次, 后台协程等待SyncMaxDelay或攒够SyncBatchSize条写入后统一刷盘
+	groupCommitter struct {
+		mu 			sync.Mutex
+		cur         *syncBatch     //正在收集写入的批次
+		ready       chan struct{}  //有新批次时通知
+		full        chan struct{}  //当前批次达到batchSize或者有写入要求立即刷盘时通知
+		closed      chan struct{}
+		wg          sync.WaitGroup
+		maxDelay    time.Duration
+		batchSize   int
+		err         error          //fsync失败之后拒绝后续的写入
+		syncs       uint64         //已执行的批次数
+	}
+
+	// idxMutex 索引的读写锁
+	// 写锁释放之后等待持有期间写入的entry持久化, 这样等待刷盘时不会阻塞同类型的其他写入, 它们可以加入同一批次
+	idxMutex struct {
+		sync.RWMutex
+		bmu 	sync.Mutex
+		batch   *syncBatch
+	}
+)
+
+func (b *syncBatch) wait() error{
+	<-b.done
+	return b.err
+}
+
+func newGroupCommitter(maxDelay time.Duration, batchSize int) *groupCommitter{
+	c := &groupCommitter{
+		ready: make(chan struct{}, 1),
+		full: make(chan struct{}, 1),
+		closed: make(chan struct{}),
+		maxDelay: maxDelay,
+		batchSize: batchSize,
+	}
+	c.wg.Add(1)
+	go c.run()
+	return c
+}
+
+// add 把一次对df的写入加入当前批次, 返回的批次刷盘完成后写入才算持久化
+// urgent为true时不再等待maxDelay, 立即刷盘
+func (c *groupCommitter) add(df *storage.DBFile, urgent bool) (*syncBatch, error){
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.err != nil{
+		return nil, c.err
+	}
+
+	select {
+	case <-c.closed:
+		//已经关闭, 直接同步刷盘
+		b := &syncBatch{done: make(chan struct{})}
+		b.err = df.Sync()
+		close(b.done)
+		return b, b.err
+	default:
+	}
+
+	if c.cur == nil{
+		c.cur = &syncBatch{files: make(map[*storage.DBFile]struct{}), done: make(chan struct{})}
+		notify(c.ready)
+	}
+	c.cur.files[df] = struct{}{}
+	c.cur.n++
+	if urgent || (c.batchSize > 0 && c.cur.n >= c.batchSize){
+		notify(c.full)
+	}
+	return c.cur, nil
+}
+
+func (c *groupCommitter) run(){
+	defer c.wg.Done()
+	for{
+		select {
+		case <-c.ready:
+		case <-c.closed:
+			c.flush()
+			return
+		}
+
+		if c.maxDelay > 0{
+			timer := time.NewTimer(c.maxDelay)
+			select {
+			case <-timer.C:
+			case <-c.full:
+			case <-c.closed:
+			}
+			timer.Stop()
+		}
+		c.flush()
+	}
+}
+
+// flush 对当前批次涉及的文件执行一次fsync, 并唤醒等待的写入方
+func (c *groupCommitter) flush(){
+	c.mu.Lock()
+	b := c.cur
+	c.cur = nil
+	select {
+	case <-c.full:
+	default:
+	}
+	c.mu.Unlock()
+
+	if b == nil{
+		return
+	}
+	for df := range b.files{
+		if err := df.Sync(); err != nil{
+			b.err = err
+			break
+		}
+	}
+	if b.err != nil{
+		c.mu.Lock()
+		c.err = b.err
+		c.mu.Unlock()
+	}
+	atomic.AddUint64(&c.syncs, 1)
+	close(b.done)
+}
+
+// close 刷完剩余的批次后停止后台协程
+func (c *groupCommitter) close(){
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		return
+	default:
+	}
+	close(c.closed)
+	c.mu.Unlock()
+	c.wg.Wait()
+}
+
+// notify 非阻塞地发送通知, 已有未处理的通知时直接忽略
+func notify(ch chan struct{}){
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// attach 记录持锁期间写入所在的批次, 批次按顺序刷盘, 只需要等待最后一个
+func (m *idxMutex) attach(b *syncBatch){
+	m.bmu.Lock()
+	m.batch = b
+	m.bmu.Unlock()
+}
+
+// Unlock 释放写锁, 并等待持锁期间的写入持久化
+// 刷盘的错误无法返回, 只用于没有错误返回值的操作, 如TTL中删除过期的key, 之后的写入会返回该错误
+func (m *idxMutex) Unlock(){
+	m.unlock(nil)
+}
+
+// unlock 同Unlock, 刷盘失败并且*err为nil时把错误写入*err
+// 写入操作使用命名的错误返回值: defer db.strIndex.mu.unlock(&err)
+func (m *idxMutex) unlock(err *error){
+	m.bmu.Lock()
+	b := m.batch
+	m.batch = nil
+	m.bmu.Unlock()
+
+	m.RWMutex.Unlock()
+	if b != nil{
+		if e := b.wait(); e != nil && err != nil && *err == nil{
+			*err = e
+		}
+	}
+}
+
+// idxLock 获取数据类型对应索引的锁
+func (db *StarDB) idxLock(dType DataType) *idxMutex{
+	switch dType{
+	case String:
+		return &db.strIndex.mu
+	case List:
+		return &db.listIndex.mu
+	case Hash:
+		return &db.hashIndex.mu
+	case Set:
+		return &db.setIndex.mu
+	case ZSet:
+		return &db.zsetIndex.mu
+	default:
+		return &db.streamIndex.mu
+	}
+}
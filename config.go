@@ -1,6 +1,28 @@
 package stardb
 
-import "stardb/storage"
+import (
+	"stardb/storage"
+	"stardb/vfs"
+	"time"
+)
+// SyncPolicy the policy of flushing db files to disk.
+type SyncPolicy string
+
+const (
+	// SyncAlways every write returns after its entry is synced to disk, concurrent writes are grouped into one fsync.
+	SyncAlways SyncPolicy = "always"
+
+	// SyncEverySec db files are synced by a background flusher once per second, at most one second of writes may be lost.
+	SyncEverySec SyncPolicy = "everysec"
+
+	// SyncNo never sync explicitly, leave it to the operating system.
+	SyncNo SyncPolicy = "no"
+)
+
+func (p SyncPolicy) valid() bool {
+	return p == SyncAlways || p == SyncEverySec || p == SyncNo
+}
+
 // DataIndexMode the data index mode.
 type DataIndexMode int
 
@@ -39,6 +61,29 @@ const (
 	// when a single db file`s reclaimable space reached the threshold, it can be reclaimed automatically.
 	// Only support String type now.
 	DefaultSingleReclaimThreshold = 4 * 1024 * 1024
+
+	// DefaultValueCacheSize default value cache size: 64MB.
+	// Only used in KeyOnlyMemMode, the value cache is disabled if the size is not positive.
+	DefaultValueCacheSize = 64 * 1024 * 1024
+
+	// DefaultSyncMaxDelay default max delay of a group commit: 0, flush as soon as the previous fsync finished.
+	// Writes arriving while an fsync is running are still committed together.
+	DefaultSyncMaxDelay = time.Duration(0)
+
+	// DefaultSyncBatchSize default max writes of a group commit: 128.
+	// The pending writes are flushed immediately when reaching the size, without waiting for SyncMaxDelay.
+	DefaultSyncBatchSize = 128
+
+	// DefaultCompressThreshold default min value size to compress: 256 bytes.
+	// Smaller values are stored uncompressed, since compressing them saves little space.
+	DefaultCompressThreshold = 256
+
+	// DefaultBlobChunkSize default chunk size of the values written by PutStream: 512KB.
+	// A chunk takes at most half of a db file, so it is reduced when BlockSize is small.
+	DefaultBlobChunkSize = uint32(512 * 1024)
+
+	// DefaultValueLogGCRatio default discard ratio to rewrite a value log file: 0.5.
+	DefaultValueLogGCRatio = 0.5
 )
 
 // Config the config options of rosedb.
@@ -50,9 +95,21 @@ type Config struct {
 	IdxMode                DataIndexMode        `json:"idx_mode" toml:"idx_mode"`     // data index mode
 	MaxKeySize             uint32               `json:"max_key_size" toml:"max_key_size"`
 	MaxValueSize           uint32               `json:"max_value_size" toml:"max_value_size"`
-	Sync                   bool                 `json:"sync" toml:"sync"`                           // sync to disk if necessary
+	Sync                   bool                 `json:"sync" toml:"sync"`                           // deprecated: the same as SyncPolicy always if true
+	SyncPolicy             SyncPolicy           `json:"sync_policy" toml:"sync_policy"`             // always, everysec or no
+	SyncMaxDelay           time.Duration        `json:"sync_max_delay" toml:"sync_max_delay"`       // max time to wait for more writes joining a group commit
+	SyncBatchSize          int                  `json:"sync_batch_size" toml:"sync_batch_size"`     // max writes of a group commit
 	ReclaimThreshold       int                  `json:"reclaim_threshold" toml:"reclaim_threshold"` // threshold to reclaim disk
 	SingleReclaimThreshold int64                `json:"single_reclaim_threshold"`                   // single reclaim threshold
+	ValueCacheSize         int64                `json:"value_cache_size" toml:"value_cache_size"`   // max bytes of cached values in KeyOnlyMemMode
+	Compression            storage.Compression  `json:"compression" toml:"compression"`             // value compression, 0:none 1:snappy 2:zstd 3:flate
+	CompressThreshold      int                  `json:"compress_threshold" toml:"compress_threshold"` // min value size to compress
+	EncryptionKeyFile      string               `json:"encryption_key_file" toml:"encryption_key_file"` // key file of AES-GCM encryption, disabled if empty
+	KeyProvider            storage.KeyProvider  `json:"-" toml:"-"`                                  // custom key provider, used instead of EncryptionKeyFile
+	BlobChunkSize          uint32               `json:"blob_chunk_size" toml:"blob_chunk_size"`      // chunk size of the values written by PutStream
+	ValueLogThreshold      uint32               `json:"value_log_threshold" toml:"value_log_threshold"` // min size of String values kept in the value log, disabled if 0
+	ValueLogGCRatio        float64              `json:"value_log_gc_ratio" toml:"value_log_gc_ratio"`   // min discard ratio of a value log file to be rewritten
+	FileSystem             vfs.FS               `json:"-" toml:"-"`                                      // file system of db files, vfs.OS if nil
 }
 
 // DefaultConfig get the default config.
@@ -66,7 +123,57 @@ func DefaultConfig() Config {
 		MaxKeySize:             DefaultMaxKeySize,
 		MaxValueSize:           DefaultMaxValueSize,
 		Sync:                   false,
+		SyncPolicy:             SyncNo,
+		SyncMaxDelay:           DefaultSyncMaxDelay,
+		SyncBatchSize:          DefaultSyncBatchSize,
 		ReclaimThreshold:       DefaultReclaimThreshold,
 		SingleReclaimThreshold: DefaultSingleReclaimThreshold,
+		ValueCacheSize:         DefaultValueCacheSize,
+		Compression:            storage.NoCompression,
+		CompressThreshold:      DefaultCompressThreshold,
+		BlobChunkSize:          DefaultBlobChunkSize,
+		ValueLogGCRatio:        DefaultValueLogGCRatio,
+	}
+}
+
+// syncPolicy the sync policy in effect, Sync is kept for compatibility.
+func (c Config) syncPolicy() SyncPolicy {
+	if c.Sync {
+		return SyncAlways
+	}
+	if c.SyncPolicy == "" {
+		return SyncNo
+	}
+	return c.SyncPolicy
+}
+
+// blobChunkSize the chunk size in effect, at most half of BlockSize.
+func (c Config) blobChunkSize() int {
+	size := int64(c.BlobChunkSize)
+	if size == 0 {
+		size = int64(DefaultBlobChunkSize)
+	}
+	if size > c.BlockSize/2 {
+		size = c.BlockSize / 2
+	}
+	if size < 1 {
+		size = 1
+	}
+	return int(size)
+}
+
+// valueLogGCRatio the gc ratio in effect.
+func (c Config) valueLogGCRatio() float64 {
+	if c.ValueLogGCRatio <= 0 {
+		return DefaultValueLogGCRatio
+	}
+	return c.ValueLogGCRatio
+}
+
+// fileSystem the file system in effect.
+func (c Config) fileSystem() vfs.FS {
+	if c.FileSystem == nil {
+		return vfs.OS
 	}
+	return c.FileSystem
 }
@@ -0,0 +1,354 @@
+package stardb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"stardb/index"
+	"stardb/storage"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrBlobModified = errors.New("stardb: blob was modified or removed while reading")
+	ErrBlobReaderClosed = errors.New("stardb: blob reader is closed")
+)
+
+/*
+ *blob是超过MaxValueSize的大value, 按BlobChunkSize拆分为多条分块日志, 最后写入一条manifest日志
+ *分块日志的extra为blob id和分块序号, manifest日志的extra为blob id, 总大小和分块数量
+ *重放时只有分块完整的manifest才会生效, 分块的位置只保存在内存中, 回收时随分块的移动而更新
+ */
+type (
+	blob struct {
+		id     uint64
+		size   int64
+		chunks []blobChunk
+	}
+
+	blobChunk struct {
+		fileId 	uint32
+		offset 	int64
+		size 	uint32  //entry在文件中的大小
+		length 	uint32  //分块中value的长度
+	}
+
+	//按顺序读取blob的分块
+	blobReader struct {
+		db      *StarDB
+		key     []byte
+		b       *blob
+		next    int
+		buf     []byte
+		closed  bool
+	}
+)
+
+// PutStream 从r中读取key的值并分块保存, 适用于超过MaxValueSize的大value, 会清除key原有的过期时间
+// 分块逐个写入, 写入期间不会阻塞其他String操作, 读取r出错时key的值保持不变
+func (db *StarDB) PutStream(key []byte, r io.Reader) error{
+	_, _, err := db.PutStreamWithOption(key, r, SetOption{})
+	return err
+}
+
+// PutStreamWithOption 同PutStream, 按opt设置key的值, 返回值同SetWithOption
+// opt的条件在所有分块写入之后检查, 不满足时已写入的分块在回收时清除
+func (db *StarDB) PutStreamWithOption(key []byte, r io.Reader, opt SetOption)(old []byte, ok bool, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	if (opt.NX && opt.XX) || (opt.Expire > 0 && opt.KeepTTL){
+		return nil, false, ErrInvalidSetOption
+	}
+	if opt.Expire < 0{
+		return nil, false, ErrInvalidTTL
+	}
+
+	db.strIndex.mu.Lock()
+	db.strIndex.blobSeq++
+	b := &blob{id: db.strIndex.blobSeq}
+	db.strIndex.writing[b.id] = b
+	db.strIndex.mu.Unlock()
+
+	defer func() {
+		db.strIndex.mu.Lock()
+		delete(db.strIndex.writing, b.id)
+		db.strIndex.mu.Unlock()
+	}()
+
+	chunkSize := db.config.blobChunkSize()
+	for{
+		buf := make([]byte, chunkSize)
+		n, err := io.ReadFull(r, buf)
+		if n > 0{
+			if err := db.putBlobChunk(key, b, buf[:n]); err != nil{
+				return nil, false, err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF{
+			break
+		}
+		if err != nil{
+			return nil, false, err
+		}
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	return db.setWithOption(key, opt, func() error{
+		//重放manifest日志会清除过期时间, 需要重新写入
+		deadline, exist := db.expires[String][string(key)]
+		if err := db.putBlobManifest(key, b); err != nil{
+			return err
+		}
+		if opt.KeepTTL && exist{
+			return db.expireVal(key, deadline)
+		}
+		return nil
+	})
+}
+
+// GetStream 返回读取key的值的reader, 对分块保存的值按分块依次读取, 使用完毕后需要Close
+func (db *StarDB) GetStream(key []byte)(io.ReadCloser, error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return nil, err
+	}
+
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	b, ok := db.strIndex.blobs[string(key)]
+	if !ok{
+		val, err := db.getVal(key)
+		if err != nil{
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(val)), nil
+	}
+	if db.checkExpired(key, String){
+		return nil, ErrKeyExpired
+	}
+	return &blobReader{db: db, key: key, b: b}, nil
+}
+
+func (r *blobReader) Read(p []byte)(int, error){
+	if r.closed{
+		return 0, ErrBlobReaderClosed
+	}
+	for len(r.buf) == 0{
+		if r.next >= len(r.b.chunks){
+			return 0, io.EOF
+		}
+		val, err := r.db.readBlobChunkSafe(r.key, r.b, r.next)
+		if err != nil{
+			return 0, err
+		}
+		r.buf = val
+		r.next++
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *blobReader) Close() error{
+	r.closed = true
+	r.buf = nil
+	return nil
+}
+
+//写入一个分块, 每个分块单独持有strIndex.mu
+func (db *StarDB) putBlobChunk(key []byte, b *blob, val []byte)(err error){
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	extra := strconv.FormatUint(b.id, 10) + ExtraSeparator + strconv.Itoa(len(b.chunks))
+	e := storage.NewEntry(key, val, []byte(extra), String, StringBlobChunk)
+	if err := db.store(e); err != nil{
+		return err
+	}
+
+	b.chunks = append(b.chunks, blobChunk{
+		fileId: db.activeFileIds[String],
+		offset: db.activeFile[String].Offset - int64(e.Size()),
+		size: e.Size(),
+		length: uint32(len(val)),
+	})
+	b.size += int64(len(val))
+	return nil
+}
+
+//写入blob的manifest日志并更新索引, 调用方需持有strIndex.mu
+//对已有的blob重新写入manifest可以移除它的过期时间, 分块保持不变
+func (db *StarDB) putBlobManifest(key []byte, b *blob) error{
+	extra := strconv.FormatUint(b.id, 10) + ExtraSeparator + strconv.FormatInt(b.size, 10) +
+		ExtraSeparator + strconv.Itoa(len(b.chunks))
+	e := storage.NewEntry(key, nil, []byte(extra), String, StringBlobManifest)
+	if err := db.store(e); err != nil{
+		return err
+	}
+
+	//分块仍然有效, 只有旧的manifest日志可以回收
+	if db.strIndex.blobs[string(key)] == b{
+		delete(db.strIndex.blobs, string(key))
+	}
+	db.putStrIndexer(e, db.activeFileIds[String], db.activeFile[String].Offset - int64(e.Size()))
+	db.strIndex.blobs[string(key)] = b
+	return nil
+}
+
+//读取blob的一个分块, 会自己持有strIndex.mu, blob已被修改或删除时返回ErrBlobModified
+func (db *StarDB) readBlobChunkSafe(key []byte, b *blob, i int)([]byte, error){
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	if db.strIndex.blobs[string(key)] != b{
+		return nil, ErrBlobModified
+	}
+	return db.readBlobChunk(b, i)
+}
+
+//调用方需持有strIndex.mu
+func (db *StarDB) readBlobChunk(b *blob, i int)([]byte, error){
+	c := b.chunks[i]
+	e, err := db.strFileById(c.fileId).ReadEntry(c.offset, c.size)
+	if err != nil{
+		return nil, err
+	}
+	return e.Meta.Value, nil
+}
+
+//读取blob完整的值, 调用方需持有strIndex.mu
+func (db *StarDB) readBlob(b *blob)([]byte, error){
+	val := make([]byte, 0, b.size)
+	for i := range b.chunks{
+		chunk, err := db.readBlobChunk(b, i)
+		if err != nil{
+			return nil, err
+		}
+		val = append(val, chunk...)
+	}
+	return val, nil
+}
+
+//读取blob从start开始的n个字节, 只读取涉及的分块, 调用方需持有strIndex.mu
+func (db *StarDB) readBlobRange(key []byte, b *blob, start, n int64)([]byte, error){
+	val := make([]byte, 0, n)
+	var pos int64
+	for _, c := range b.chunks{
+		if n == 0{
+			break
+		}
+		if start >= pos + int64(c.length){
+			pos += int64(c.length)
+			continue
+		}
+
+		from := start - pos
+		size := int64(c.length) - from
+		if size > n{
+			size = n
+		}
+		chunk, err := db.strFileById(c.fileId).ReadValue(c.offset, uint32(len(key)), from, size)
+		if err != nil{
+			return nil, err
+		}
+		val = append(val, chunk...)
+		start += size
+		n -= size
+		pos += int64(c.length)
+	}
+	return val, nil
+}
+
+//重放分块日志, 暂存到manifest读取之后
+func (db *StarDB) collectBlobChunk(idx *index.Indexer, e *storage.Entry){
+	id, seq, ok := parseBlobChunkExtra(e.Meta.Extra)
+	if !ok{
+		return
+	}
+	if id > db.strIndex.blobSeq{
+		db.strIndex.blobSeq = id
+	}
+
+	pending := db.strIndex.pending[id]
+	if seq != len(pending){
+		return
+	}
+	db.strIndex.pending[id] = append(pending, blobChunk{
+		fileId: idx.FileId,
+		offset: idx.Offset,
+		size: idx.EntrySize,
+		length: e.Meta.ValueSize,
+	})
+}
+
+//重放manifest日志, 分块完整时更新索引
+func (db *StarDB) buildBlobIndex(idx *index.Indexer, e *storage.Entry){
+	s := strings.Split(string(e.Meta.Extra), ExtraSeparator)
+	if len(s) != 3{
+		return
+	}
+	id, err1 := strconv.ParseUint(s[0], 10, 64)
+	size, err2 := strconv.ParseInt(s[1], 10, 64)
+	count, err3 := strconv.Atoi(s[2])
+	if err1 != nil || err2 != nil || err3 != nil{
+		return
+	}
+	if id > db.strIndex.blobSeq{
+		db.strIndex.blobSeq = id
+	}
+
+	key := string(e.Meta.Key)
+	chunks, ok := db.strIndex.pending[id]
+	delete(db.strIndex.pending, id)
+	//重新写入的manifest沿用已有的分块
+	if old, exist := db.strIndex.blobs[key]; !ok && exist && old.id == id{
+		chunks = old.chunks
+	}
+	if len(chunks) != count{
+		return
+	}
+
+	db.strIndex.idxList.Put(idx.Meta.Key, idx)
+	db.strIndex.blobs[key] = &blob{id: id, size: size, chunks: chunks}
+	delete(db.strIndex.bitmaps, key)
+	delete(db.expires[String], key)
+}
+
+//分块日志对应的分块, 回收时使用, 分块已失效时返回nil
+func (db *StarDB) blobChunkOf(e *storage.Entry) *blobChunk{
+	id, seq, ok := parseBlobChunkExtra(e.Meta.Extra)
+	if !ok{
+		return nil
+	}
+
+	b := db.strIndex.writing[id]
+	if cur, exist := db.strIndex.blobs[string(e.Meta.Key)]; exist && cur.id == id{
+		b = cur
+	}
+	if b == nil || seq >= len(b.chunks){
+		return nil
+	}
+	return &b.chunks[seq]
+}
+
+//分块日志是否仍被blob引用, 包括正在写入的blob
+func (db *StarDB) validBlobChunk(e *storage.Entry, offset int64, fileId uint32) bool{
+	c := db.blobChunkOf(e)
+	return c != nil && c.fileId == fileId && c.offset == offset
+}
+
+func parseBlobChunkExtra(extra []byte)(id uint64, seq int, ok bool){
+	s := strings.Split(string(extra), ExtraSeparator)
+	if len(s) != 2{
+		return
+	}
+	id, err1 := strconv.ParseUint(s[0], 10, 64)
+	seq, err2 := strconv.Atoi(s[1])
+	return id, seq, err1 == nil && err2 == nil
+}
@@ -0,0 +1,199 @@
+package stardb
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"stardb/vfs"
+	"testing"
+)
+
+func blobValue(n int) []byte{
+	val := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(val)
+	return val
+}
+
+func readStream(t *testing.T, db *StarDB, key []byte) []byte{
+	r, err := db.GetStream(key)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer r.Close()
+	val, err := ioutil.ReadAll(r)
+	if err != nil{
+		t.Fatal(err)
+	}
+	return val
+}
+
+func TestStarDB_PutStream(t *testing.T) {
+	for _, mode := range []DataIndexMode{KeyValueMemMode, KeyOnlyMemMode}{
+		dir, _ := ioutil.TempDir("", "stardb")
+		config := DefaultConfig()
+		config.DirPath = dir
+		config.IdxMode = mode
+		config.BlockSize = 64 * 1024
+		config.MaxValueSize = 1024
+		config.BlobChunkSize = 10 * 1024
+		config.ReclaimThreshold = 1
+
+		db, err := Open(config)
+		assert.Nil(t, err)
+
+		//值分布在多个数据文件中
+		key, value := []byte("artifact"), blobValue(200 * 1024 + 7)
+		assert.Equal(t, ErrValueTooLarge, db.Set(key, value))
+		assert.Nil(t, db.PutStream(key, bytes.NewReader(value)))
+		assert.Equal(t, value, readStream(t, db, key))
+		val, err := db.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, value, val)
+		assert.Equal(t, len(value), db.StrLen(key))
+		part, err := db.GetRange(key, 10 * 1024 - 3, 30 * 1024)
+		assert.Nil(t, err)
+		assert.Equal(t, value[10 * 1024 - 3:30 * 1024 + 1], part)
+
+		//普通的值同样可以按流读取
+		assert.Nil(t, db.Set([]byte("small"), []byte("v")))
+		assert.Equal(t, []byte("v"), readStream(t, db, []byte("small")))
+		assert.Nil(t, db.PutStream([]byte("empty"), bytes.NewReader(nil)))
+		assert.Equal(t, 0, len(readStream(t, db, []byte("empty"))))
+
+		//覆盖之后旧的分块可以回收, 回收后分块的位置随之更新
+		assert.Nil(t, db.PutStream(key, bytes.NewReader(value[:50 * 1024])))
+		other, otherVal := []byte("other"), blobValue(100 * 1024)
+		assert.Nil(t, db.PutStream(other, bytes.NewReader(otherVal)))
+		assert.Nil(t, db.Reclaim())
+		assert.Equal(t, value[:50 * 1024], readStream(t, db, key))
+		assert.Equal(t, otherVal, readStream(t, db, other))
+
+		assert.Nil(t, db.Expire(other, 100))
+		assert.Nil(t, db.Persist(other))
+		assert.Equal(t, int64(0), db.TTL(other))
+
+		db.Close()
+		db, err = Open(config)
+		assert.Nil(t, err)
+		assert.Equal(t, value[:50 * 1024], readStream(t, db, key))
+		assert.Equal(t, otherVal, readStream(t, db, other))
+		assert.Equal(t, []byte("v"), readStream(t, db, []byte("small")))
+
+		//覆盖或删除之后blob不再存在
+		assert.Nil(t, db.Set(key, []byte("plain")))
+		assert.Nil(t, db.StrRem(other))
+		db.Close()
+		db, err = Open(config)
+		assert.Nil(t, err)
+		val, _ = db.Get(key)
+		assert.Equal(t, []byte("plain"), val)
+		_, err = db.GetStream(other)
+		assert.Equal(t, ErrKeyNotExist, err)
+
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+type failingReader struct {
+	n int
+}
+
+func (r *failingReader) Read(p []byte)(int, error){
+	if r.n <= 0{
+		return 0, errors.New("read failed")
+	}
+	if len(p) > r.n{
+		p = p[:r.n]
+	}
+	r.n -= len(p)
+	return len(p), nil
+}
+
+func TestStarDB_PutStreamInterrupted(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.BlockSize = 64 * 1024
+	config.BlobChunkSize = 4 * 1024
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	key := []byte("artifact")
+	assert.Nil(t, db.Set(key, []byte("old")))
+
+	//读取出错时原来的值不变, 已经写入的分块在重启后被丢弃
+	assert.NotNil(t, db.PutStream(key, &failingReader{n: 10 * 1024}))
+	val, _ := db.Get(key)
+	assert.Equal(t, []byte("old"), val)
+
+	db.Close()
+
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	val, _ = db.Get(key)
+	assert.Equal(t, []byte("old"), val)
+
+	//读取期间值被修改
+	value := blobValue(20 * 1024)
+	assert.Nil(t, db.PutStream(key, bytes.NewReader(value)))
+	r, err := db.GetStream(key)
+	assert.Nil(t, err)
+	buf := make([]byte, 100)
+	_, err = io.ReadFull(r, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, value[:100], buf)
+	assert.Nil(t, db.Set(key, []byte("new")))
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, ErrBlobModified, err)
+	r.Close()
+	_, err = r.Read(buf)
+	assert.Equal(t, ErrBlobReaderClosed, err)
+}
+
+func TestStarDB_PutStreamWithOption(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.BlobChunkSize = 4 * 1024
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	key, value := []byte("artifact"), blobValue(10 * 1024)
+
+	//条件不满足时不写入
+	_, ok, err := db.PutStreamWithOption(key, bytes.NewReader(value), SetOption{XX: true})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotExist, err)
+
+	_, ok, err = db.PutStreamWithOption(key, bytes.NewReader(value), SetOption{NX: true, Expire: 100})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, db.TTL(key) > 0)
+
+	//返回原来的值并保留过期时间
+	newValue := blobValue(12 * 1024)
+	old, ok, err := db.PutStreamWithOption(key, bytes.NewReader(newValue), SetOption{XX: true, Get: true, KeepTTL: true})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, value, old)
+	assert.True(t, db.TTL(key) > 0)
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, newValue, readStream(t, db, key))
+	assert.True(t, db.TTL(key) > 0)
+
+	_, _, err = db.PutStreamWithOption(key, bytes.NewReader(value), SetOption{NX: true, XX: true})
+	assert.Equal(t, ErrInvalidSetOption, err)
+}
@@ -3,12 +3,14 @@ package stardb
 import (
 	"stardb/ds/hash"
 	"bytes"
-	"sync"
+	"math"
+	"math/rand"
+	"strconv"
 	"stardb/storage"
 )
 
 type HashIdx struct {
-	mu 		sync.RWMutex
+	mu 		idxMutex
 	indexes *hash.Hash
 }
 
@@ -27,7 +29,7 @@ func (db *StarDB) HSet(key []byte, field []byte, value []byte)(res int, err erro
 	}
 
 	db.hashIndex.mu.Lock()
-	defer db.hashIndex.mu.Unlock()
+	defer db.hashIndex.mu.unlock(&err)
 
 	e := storage.NewEntry(key, value, field, Hash, HashHSet)
 	if err = db.store(e); err != nil{
@@ -44,7 +46,7 @@ func (db *StarDB) HSetNx(key, field, value []byte)(res int, err error){
 	}
 
 	db.hashIndex.mu.Lock()
-	defer db.hashIndex.mu.Unlock()
+	defer db.hashIndex.mu.unlock(&err)
 
 	if res = db.hashIndex.indexes.HSetNx(string(key), string(field), value); res == 1{
 		e := storage.NewEntry(key, value, field, Hash, HashHSet)
@@ -95,7 +97,7 @@ func (db *StarDB) HDel(key []byte, field ...[]byte)(res int, err error){
 	}
 
 	db.hashIndex.mu.Lock()
-	defer db.hashIndex.mu.Unlock()
+	defer db.hashIndex.mu.unlock(&err)
 
 	for _, f := range field {
 		if ok := db.hashIndex.indexes.HDel(string(key), string(f));ok == 1{
@@ -167,4 +169,186 @@ func (db *StarDB) HVals(key []byte) (val [][]byte){
 	}
 
 	return db.hashIndex.indexes.HVals(string(key))
-}
\ No newline at end of file
+}
+// HIncrBy 将field的值加上incr并返回新值, field不存在时视为0
+func (db *StarDB) HIncrBy(key, field []byte, incr int64)(res int64, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.unlock(&err)
+
+	db.checkExpired(key, Hash)
+	if db.hashIndex.indexes.HExist(string(key), string(field)) == 1{
+		val := db.hashIndex.indexes.HGet(string(key), string(field))
+		if res, err = strconv.ParseInt(string(val), 10, 64); err != nil{
+			return 0, ErrHashValueNotInteger
+		}
+	}
+
+	if (incr > 0 && res > math.MaxInt64 - incr) || (incr < 0 && res < math.MinInt64 - incr){
+		return 0, ErrIncrOverflow
+	}
+	res += incr
+
+	value := []byte(strconv.FormatInt(res, 10))
+	e := storage.NewEntry(key, value, field, Hash, HashHSet)
+	if err = db.store(e); err != nil{
+		return
+	}
+	db.hashIndex.indexes.HSet(string(key), string(field), value)
+	return
+}
+
+// HMSet 同时设置多个field, pairs为field value交替排列, 所有field在一条日志中原子写入
+// 日志超出一个文件的大小时返回ErrEntryTooLarge, 不修改任何field
+func (db *StarDB) HMSet(key []byte, pairs ...[]byte)(err error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return err
+	}
+	if len(pairs) == 0 || len(pairs) % 2 != 0{
+		return ErrInvalidPairs
+	}
+	for i := 1; i < len(pairs); i += 2{
+		if err := db.checkKeyValue(key, pairs[i]); err != nil{
+			return err
+		}
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.unlock(&err)
+
+	db.checkExpired(key, Hash)
+	e := storage.NewEntryNoExtra(key, storage.EncodeValues(pairs), Hash, HashHMSet)
+	if err := db.store(e); err != nil{
+		return err
+	}
+
+	for i := 0; i < len(pairs); i += 2{
+		db.hashIndex.indexes.HSet(string(key), string(pairs[i]), pairs[i+1])
+	}
+	return nil
+}
+
+// HMGet 返回多个field的值, 不存在的field对应nil
+func (db *StarDB) HMGet(key []byte, fields ...[]byte) [][]byte{
+	res := make([][]byte, len(fields))
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return res
+	}
+
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	if db.checkExpired(key, Hash){
+		return res
+	}
+
+	for i, f := range fields{
+		res[i] = db.hashIndex.indexes.HGet(string(key), string(f))
+	}
+	return res
+}
+
+// HIncrByFloat 将field的值加上浮点数incr并返回新值, field不存在时视为0
+func (db *StarDB) HIncrByFloat(key, field []byte, incr float64)(res float64, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	if math.IsNaN(incr) || math.IsInf(incr, 0){
+		return 0, ErrIncrNaNOrInf
+	}
+
+	db.hashIndex.mu.Lock()
+	defer db.hashIndex.mu.unlock(&err)
+
+	db.checkExpired(key, Hash)
+	if db.hashIndex.indexes.HExist(string(key), string(field)) == 1{
+		val := db.hashIndex.indexes.HGet(string(key), string(field))
+		if res, err = parseFloat(val); err != nil{
+			return 0, ErrHashValueNotFloat
+		}
+	}
+
+	res += incr
+	if math.IsNaN(res) || math.IsInf(res, 0){
+		return 0, ErrIncrNaNOrInf
+	}
+
+	value := []byte(strconv.FormatFloat(res, 'f', -1, 64))
+	e := storage.NewEntry(key, value, field, Hash, HashHSet)
+	if err = db.store(e); err != nil{
+		return
+	}
+	db.hashIndex.indexes.HSet(string(key), string(field), value)
+	return
+}
+
+// HStrLen 返回field的值的长度, 不存在时返回0
+func (db *StarDB) HStrLen(key, field []byte) int{
+	return len(db.HGet(key, field))
+}
+
+/*
+ *随机返回field, withValues为true时每个field后跟着它的值
+ *count大于0时返回不重复的min(count, HLen)个field, 小于0时返回|count|个可能重复的field
+ */
+func (db *StarDB) HRandField(key []byte, count int, withValues bool) [][]byte{
+	if err := db.checkKeyValue(key, nil); err != nil || count == 0{
+		return nil
+	}
+
+	db.hashIndex.mu.RLock()
+	defer db.hashIndex.mu.RUnlock()
+
+	if db.checkExpired(key, Hash){
+		return nil
+	}
+
+	all := db.hashIndex.indexes.HGetAll(string(key))
+	n := len(all) / 2
+	if n == 0{
+		return nil
+	}
+
+	var picked []int
+	if count > 0{
+		picked = rand.Perm(n)
+		if count < n{
+			picked = picked[:count]
+		}
+	}else{
+		picked = make([]int, -count)
+		for i := range picked{
+			picked[i] = rand.Intn(n)
+		}
+	}
+
+	res := make([][]byte, 0, len(picked) * 2)
+	for _, i := range picked{
+		res = append(res, all[2*i])
+		if withValues{
+			res = append(res, all[2*i+1])
+		}
+	}
+	return res
+}
+
+//回收时将HMSET日志拆分为仍然有效的field的HSET日志
+func (db *StarDB) hmsetSnapshot(e *storage.Entry) (entries []*storage.Entry){
+	if e.GetMark() != HashHMSet{
+		return
+	}
+	pairs, err := storage.DecodeValues(e.Meta.Value)
+	if err != nil{
+		return
+	}
+
+	for i := 0; i + 1 < len(pairs); i += 2{
+		if db.HExists(e.Meta.Key, pairs[i]) == 1 && bytes.Equal(db.HGet(e.Meta.Key, pairs[i]), pairs[i+1]){
+			entries = append(entries, storage.NewEntry(e.Meta.Key, pairs[i+1], pairs[i], Hash, HashHSet))
+		}
+	}
+	return
+}
@@ -0,0 +1,196 @@
+package stardb
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math"
+	"os"
+	"stardb/vfs"
+	"strconv"
+	"testing"
+)
+
+func TestStarDB_HIncrBy(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key, field := []byte("limiter"), []byte("user:1")
+	val, err := db.HIncrBy(key, field, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), val)
+	val, err = db.HIncrBy(key, field, -7)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-2), val)
+
+	_, err = db.HIncrBy(key, field, math.MinInt64)
+	assert.Equal(t, ErrIncrOverflow, err)
+	_, err = db.HSet(key, []byte("name"), []byte("star"))
+	assert.Nil(t, err)
+	_, err = db.HIncrBy(key, []byte("name"), 1)
+	assert.Equal(t, ErrHashValueNotInteger, err)
+
+	//重新打开后从日志恢复
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+	assert.Equal(t, "-2", string(db.HGet(key, field)))
+}
+
+func TestStarDB_HMSet(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key := []byte("user:1")
+	err := db.HMSet(key, []byte("name"), []byte("star"), []byte("age"), []byte("3"), []byte("city"), []byte("sz"))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrInvalidPairs, db.HMSet(key, []byte("name")))
+
+	n, err := db.HDel(key, []byte("city"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	//重新打开后删除的field不会恢复
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+
+	vals := db.HMGet(key, []byte("name"), []byte("age"), []byte("city"))
+	assert.Equal(t, [][]byte{[]byte("star"), []byte("3"), nil}, vals)
+	assert.Equal(t, 4, db.HStrLen(key, []byte("name")))
+	assert.Equal(t, 0, db.HStrLen(key, []byte("city")))
+}
+
+//所有field一条日志放不下时返回错误, 已有的field保持不变
+func TestStarDB_HMSetTooLarge(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.BlockSize = 4096
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	key := []byte("user:1")
+	assert.Nil(t, db.HMSet(key, []byte("field-0"), []byte("old")))
+
+	pairs := make([][]byte, 0, 600)
+	for i := 0; i < 300; i++{
+		pairs = append(pairs, []byte(fmt.Sprintf("field-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	assert.Equal(t, ErrEntryTooLarge, db.HMSet(key, pairs...))
+	assert.Equal(t, 1, db.HLen(key))
+	assert.Equal(t, []byte("old"), db.HGet(key, []byte("field-0")))
+}
+
+func TestStarDB_HIncrByFloat(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	key, field := []byte("account"), []byte("balance")
+	val, err := db.HIncrByFloat(key, field, 10.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 10.5, val)
+	val, err = db.HIncrByFloat(key, field, 0.1)
+	assert.Nil(t, err)
+	assert.Equal(t, 10.6, val)
+	assert.Equal(t, "10.6", string(db.HGet(key, field)))
+
+	_, err = db.HSet(key, []byte("name"), []byte("star"))
+	assert.Nil(t, err)
+	_, err = db.HIncrByFloat(key, []byte("name"), 1)
+	assert.Equal(t, ErrHashValueNotFloat, err)
+}
+
+func TestStarDB_HRandField(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	key := []byte("colors")
+	assert.Nil(t, db.HMSet(key, []byte("r"), []byte("1"), []byte("g"), []byte("2"), []byte("b"), []byte("3")))
+
+	assert.Equal(t, 2, len(db.HRandField(key, 2, false)))
+	assert.Equal(t, 6, len(db.HRandField(key, 10, true)))
+	assert.Equal(t, 5, len(db.HRandField(key, -5, false)))
+	assert.Nil(t, db.HRandField(key, 0, false))
+	assert.Nil(t, db.HRandField([]byte("none"), 1, false))
+
+	fields := db.HRandField(key, 3, true)
+	for i := 0; i < len(fields); i += 2{
+		assert.Equal(t, db.HGet(key, fields[i]), fields[i+1])
+	}
+}
+
+func TestStarDB_HMSetReclaim(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	//回收时HMSET日志拆分为仍然有效的field
+	key := []byte("user:2")
+	assert.Nil(t, db.HMSet(key, []byte("a"), []byte("1"), []byte("b"), []byte("2"), []byte("c"), []byte("3")))
+	_, err = db.HDel(key, []byte("b"))
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++{
+		_, err = db.HSet(key, []byte("c"), []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Reclaim())
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), nil, []byte("9")}, db.HMGet(key, []byte("a"), []byte("b"), []byte("c")))
+	db.Close()
+}
+
+//HDEL日志重放时删除field, 单独的HSET日志在回收后仍然保留
+func TestStarDB_HSetHDelReclaim(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	key := []byte("user:3")
+	for i := 0; i < 10; i++{
+		_, err = db.HSet(key, []byte("f" + strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	_, err = db.HDel(key, []byte("f0"), []byte("f5"))
+	assert.Nil(t, err)
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.HExists(key, []byte("f0")))
+	assert.Nil(t, db.Reclaim())
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 10; i++{
+		val := db.HGet(key, []byte("f" + strconv.Itoa(i)))
+		if i == 0 || i == 5{
+			assert.Nil(t, val)
+		}else{
+			assert.Equal(t, []byte(strconv.Itoa(i)), val)
+		}
+	}
+}
@@ -6,17 +6,22 @@ import (
 	"stardb/storage"
 	"strconv"
 	"strings"
-	"sync"
+	"time"
 )
 
-// ListIdx list 索引
-type ListIdx struct {
-	mu 		 sync.RWMutex
-	indexes  *list.List
-}
+type (
+	// ListIdx list 索引
+	ListIdx struct {
+		mu 		 idxMutex
+		indexes  *list.List
+		blocked  *waitQueue  //阻塞在key上等待数据的客户端
+	}
+)
 
 func newListIdx() *ListIdx{
-	return &ListIdx{indexes: list.New()}
+	li := &ListIdx{indexes: list.New()}
+	li.blocked = newWaitQueue(&li.mu)
+	return li
 }
 
 func (db *StarDB) LPush(key []byte, values ...[]byte)(res int, err error){
@@ -24,17 +29,9 @@ func (db *StarDB) LPush(key []byte, values ...[]byte)(res int, err error){
 		return
 	}
 	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
-
-	for _, val := range values {
-		e := storage.NewEntryNoExtra(key, val, List, ListLPush)
-		if err = db.store(e); err != nil{
-			return
-		}
+	defer db.listIndex.mu.unlock(&err)
 
-		res = db.listIndex.indexes.LPush(string(key), val)
-	}
-	return
+	return db.push(key, list.Left, values...)
 }
 
 func (db *StarDB) RPush(key []byte, values ...[]byte)(res int, err error){
@@ -42,61 +39,119 @@ func (db *StarDB) RPush(key []byte, values ...[]byte)(res int, err error){
 		return
 	}
 	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	defer db.listIndex.mu.unlock(&err)
 
-	for _, val := range values {
-		e := storage.NewEntryNoExtra(key, val, List, ListRPush)
-		if err = db.store(e); err != nil{
-			return
-		}
+	return db.push(key, list.Right, values...)
+}
 
-		res = db.listIndex.indexes.RPush(string(key), val)
+func (db *StarDB) LPop(key []byte)(val []byte, err error){
+	if err = db.checkKeyValue(key, nil); err != nil {
+		return
 	}
-	return
+
+	db.listIndex.mu.Lock()
+	defer db.listIndex.mu.unlock(&err)
+
+	if db.checkExpired(key, List){
+		return nil, ErrKeyExpired
+	}
+
+	return db.pop(key, list.Left)
 }
 
-func (db *StarDB) LPop(key []byte)(val []byte, err error) {
+func (db *StarDB) RPop(key []byte)(val []byte, err error){
 	if err = db.checkKeyValue(key, nil); err != nil {
 		return
 	}
 
 	db.listIndex.mu.Lock()
-	db.listIndex.mu.Unlock()
+	defer db.listIndex.mu.unlock(&err)
 
 	if db.checkExpired(key, List){
 		return nil, ErrKeyExpired
 	}
 
-	val = db.listIndex.indexes.LPop(string(key))
-	if val != nil{
-		e := storage.NewEntryNoExtra(key, val, List, ListLPop)
-		if err := db.store(e); err != nil{
-			return nil, err
-		}
-	}
-	return val, nil
+	return db.pop(key, list.Right)
 }
 
-func (db *StarDB) RPop(key []byte)(val []byte, err error) {
-	if err = db.checkKeyValue(key, nil); err != nil {
+// LMove 从src的from端弹出元素并压入dst的to端, 只写入一条日志
+func (db *StarDB) LMove(src, dst []byte, from, to list.Direction)(val []byte, err error){
+	if err = db.checkKeyValue(src, nil); err != nil{
+		return
+	}
+	if err = db.checkKeyValue(dst, nil); err != nil{
 		return
 	}
 
 	db.listIndex.mu.Lock()
-	db.listIndex.mu.Unlock()
+	defer db.listIndex.mu.unlock(&err)
+
+	if db.checkExpired(src, List){
+		return nil, ErrKeyExpired
+	}
+
+	return db.move(src, dst, from, to)
+}
+
+// RPopLPush 从src尾部弹出元素并压入dst头部
+func (db *StarDB) RPopLPush(src, dst []byte)([]byte, error){
+	return db.LMove(src, dst, list.Right, list.Left)
+}
+
+// LPos 返回key中等于val的元素索引, rank为匹配的起始序号, 负数表示从尾部开始查找
+// count为0时返回所有匹配, maxLen为0时不限制比较的元素个数
+func (db *StarDB) LPos(key, val []byte, rank, count, maxLen int)(pos []int, err error){
+	if err = db.checkKeyValue(key, val); err != nil{
+		return
+	}
+	if rank == 0{
+		return nil, ErrInvalidRank
+	}
+
+	db.listIndex.mu.RLock()
+	defer db.listIndex.mu.RUnlock()
 
 	if db.checkExpired(key, List){
 		return nil, ErrKeyExpired
 	}
 
-	val = db.listIndex.indexes.RPop(string(key))
-	if val != nil{
-		e := storage.NewEntryNoExtra(key, val, List, ListRPop)
-		if err := db.store(e); err != nil{
-			return nil, err
-		}
+	return db.listIndex.indexes.LPos(string(key), val, rank, count, maxLen), nil
+}
+
+// BLPop 依次从keys中第一个非空list的头部弹出元素, 所有list都为空时阻塞直到有数据或超时
+// timeout为0时一直阻塞, 超时返回的key和val都为nil
+func (db *StarDB) BLPop(timeout time.Duration, keys ...[]byte)(key, val []byte, err error){
+	return db.blockingPop(timeout, list.Left, keys...)
+}
+
+// BRPop 同BLPop, 从list的尾部弹出元素
+func (db *StarDB) BRPop(timeout time.Duration, keys ...[]byte)(key, val []byte, err error){
+	return db.blockingPop(timeout, list.Right, keys...)
+}
+
+// BLMove 从src的from端弹出元素并压入dst的to端, src为空时阻塞直到有数据或超时
+func (db *StarDB) BLMove(src, dst []byte, from, to list.Direction, timeout time.Duration)(val []byte, err error){
+	if err = db.checkKeyValue(src, nil); err != nil{
+		return
+	}
+	if err = db.checkKeyValue(dst, nil); err != nil{
+		return
 	}
-	return val, nil
+
+	db.listIndex.mu.Lock()
+	if !db.checkExpired(src, List) && db.listIndex.indexes.LLen(string(src)) > 0{
+		defer db.listIndex.mu.unlock(&err)
+		return db.move(src, dst, from, to)
+	}
+
+	w := db.listIndex.blocked.block([][]byte{src}, func(key []byte) waitResult{
+		val, err := db.move(key, dst, from, to)
+		return waitResult{key: key, val: val, err: err}
+	})
+	db.listIndex.mu.Unlock()
+
+	res := db.listIndex.blocked.wait(w, timeout)
+	return res.val, res.err
 }
 
 func (db *StarDB) LIndex(key []byte, idx int)(val []byte){
@@ -110,13 +165,13 @@ func (db *StarDB) LIndex(key []byte, idx int)(val []byte){
 	return db.listIndex.indexes.LIndex(string(key), idx)
 }
 
-func (db *StarDB) LRem(key, value []byte, count int)(int, error){
+func (db *StarDB) LRem(key, value []byte, count int)(_ int, err error){
 	if err := db.checkKeyValue(key, value); err != nil{
 		return 0, nil
 	}
 
 	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	defer db.listIndex.mu.unlock(&err)
 
 	if db.checkExpired(key, List){
 		return 0, ErrKeyExpired
@@ -143,7 +198,7 @@ func (db *StarDB) LInsert(key []byte, option list.InsertOption, pivot, val []byt
 	}
 
 	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	defer db.listIndex.mu.unlock(&err)
 
 	count = db.listIndex.indexes.LInsert(string(key), option, pivot, val)
 	if count != -1{
@@ -167,7 +222,7 @@ func (db *StarDB) LSet(key []byte, idx int, val []byte)(ok bool, err error){
 	}
 
 	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	defer db.listIndex.mu.unlock(&err)
 
 	if ok = db.listIndex.indexes.LSet(string(key), idx, val); ok{
 		i := strconv.Itoa(idx)
@@ -184,7 +239,7 @@ func (db *StarDB) LTrim(key []byte, start, end int)(err error){
 		return
 	}
 	db.listIndex.mu.Lock()
-	defer db.listIndex.mu.Unlock()
+	defer db.listIndex.mu.unlock(&err)
 
 	if db.checkExpired(key, List){
 		return ErrKeyExpired
@@ -256,4 +311,107 @@ func (db *StarDB) LValExists(key, val []byte)(ok bool){
 
 	ok = db.listIndex.indexes.LValExists(string(key), val)
 	return
-}
\ No newline at end of file
+}
+func (db *StarDB) blockingPop(timeout time.Duration, from list.Direction, keys ...[]byte)(key, val []byte, err error){
+	if len(keys) == 0{
+		return nil, nil, ErrEmptyKey
+	}
+	for _, k := range keys{
+		if err = db.checkKeyValue(k, nil); err != nil{
+			return
+		}
+	}
+
+	db.listIndex.mu.Lock()
+	for _, k := range keys{
+		if db.checkExpired(k, List){
+			continue
+		}
+		if db.listIndex.indexes.LLen(string(k)) > 0{
+			defer db.listIndex.mu.unlock(&err)
+			val, err = db.pop(k, from)
+			return k, val, err
+		}
+	}
+
+	w := db.listIndex.blocked.block(keys, func(key []byte) waitResult{
+		val, err := db.pop(key, from)
+		return waitResult{key: key, val: val, err: err}
+	})
+	db.listIndex.mu.Unlock()
+
+	res := db.listIndex.blocked.wait(w, timeout)
+	return res.key, res.val, res.err
+}
+
+//push之后按阻塞的先后顺序唤醒等待key的客户端, 调用方需持有listIndex.mu
+func (db *StarDB) serveBlocked(key []byte) error{
+	return db.listIndex.blocked.serve(key, func() bool{
+		return db.listIndex.indexes.LLen(string(key)) > 0
+	})
+}
+
+//调用方需持有listIndex.mu
+func (db *StarDB) push(key []byte, to list.Direction, values ...[]byte)(res int, err error){
+	mark := ListLPush
+	if to == list.Right{
+		mark = ListRPush
+	}
+
+	for _, val := range values {
+		e := storage.NewEntryNoExtra(key, val, List, mark)
+		if err = db.store(e); err != nil{
+			return
+		}
+
+		if to == list.Left{
+			res = db.listIndex.indexes.LPush(string(key), val)
+		}else{
+			res = db.listIndex.indexes.RPush(string(key), val)
+		}
+	}
+
+	err = db.serveBlocked(key)
+	return
+}
+
+//调用方需持有listIndex.mu
+func (db *StarDB) pop(key []byte, from list.Direction)(val []byte, err error){
+	mark := ListLPop
+	if from == list.Left{
+		val = db.listIndex.indexes.LPop(string(key))
+	}else{
+		val = db.listIndex.indexes.RPop(string(key))
+		mark = ListRPop
+	}
+
+	if val != nil{
+		e := storage.NewEntryNoExtra(key, val, List, mark)
+		if err = db.store(e); err != nil{
+			return nil, err
+		}
+	}
+	return
+}
+
+//调用方需持有listIndex.mu
+func (db *StarDB) move(src, dst []byte, from, to list.Direction)(val []byte, err error){
+	if val = db.listIndex.indexes.LMove(string(src), string(dst), from, to); val == nil{
+		return
+	}
+
+	var buf bytes.Buffer
+	buf.Write([]byte(strconv.Itoa(int(from))))
+	buf.Write([]byte(ExtraSeparator))
+	buf.Write([]byte(strconv.Itoa(int(to))))
+	buf.Write([]byte(ExtraSeparator))
+	buf.Write(dst)
+
+	e := storage.NewEntry(src, val, buf.Bytes(), List, ListLMove)
+	if err = db.store(e); err != nil{
+		return nil, err
+	}
+
+	err = db.serveBlocked(dst)
+	return
+}
@@ -0,0 +1,120 @@
+package stardb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"stardb/ds/list"
+	"stardb/vfs"
+	"testing"
+	"time"
+)
+
+func TestStarDB_BLPop(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	t.Run("timeout", func(t *testing.T) {
+		key, val, err := db.BLPop(20*time.Millisecond, []byte("empty"))
+		assert.Nil(t, err)
+		assert.Nil(t, key)
+		assert.Nil(t, val)
+	})
+
+	t.Run("fifo", func(t *testing.T) {
+		first, second := make(chan string, 1), make(chan string, 1)
+		go func() {
+			_, val, _ := db.BLPop(0, []byte("other"), []byte("jobs"))
+			first <- string(val)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		go func() {
+			_, val, _ := db.BLPop(0, []byte("jobs"))
+			second <- string(val)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		_, err := db.RPush([]byte("jobs"), []byte("job1"), []byte("job2"))
+		assert.Nil(t, err)
+		assert.Equal(t, "job1", <-first)
+		assert.Equal(t, "job2", <-second)
+		assert.Equal(t, 0, db.LLen([]byte("jobs")))
+	})
+
+	t.Run("blmove", func(t *testing.T) {
+		res := make(chan string, 1)
+		go func() {
+			val, _ := db.BLMove([]byte("src"), []byte("dst"), list.Left, list.Right, time.Second)
+			res <- string(val)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		_, err := db.LPush([]byte("src"), []byte("a"))
+		assert.Nil(t, err)
+		assert.Equal(t, "a", <-res)
+		assert.Equal(t, []byte("a"), db.LIndex([]byte("dst"), 0))
+	})
+}
+
+func TestStarDB_LMove(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	_, err := db.RPush([]byte("src"), []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+
+	val, err := db.RPopLPush([]byte("src"), []byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), val)
+
+	val, err = db.LMove([]byte("src"), []byte("dst"), list.Left, list.Right)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), val)
+
+	pos, err := db.LPos([]byte("dst"), []byte("a"), 1, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1}, pos)
+
+	_, err = db.LPos([]byte("dst"), []byte("a"), 0, 0, 0)
+	assert.Equal(t, ErrInvalidRank, err)
+
+	//重新打开后从日志恢复
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+	r, _ := db.LRange([]byte("src"), 0, -1)
+	assert.Equal(t, [][]byte{[]byte("b")}, r)
+	r, _ = db.LRange([]byte("dst"), 0, -1)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("a")}, r)
+}
+
+func TestStarDB_LMoveReclaim(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	//回收时src中压入c的日志被丢弃, 恢复时不能从src弹出其他元素
+	_, err = db.RPush([]byte("src"), []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	_, err = db.RPopLPush([]byte("src"), []byte("dst"))
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++{
+		_, err = db.RPush([]byte("other"), []byte{byte('a' + i)})
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Reclaim())
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	r, _ := db.LRange([]byte("src"), 0, -1)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, r)
+	r, _ = db.LRange([]byte("dst"), 0, -1)
+	assert.Equal(t, [][]byte{[]byte("c")}, r)
+}
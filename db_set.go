@@ -2,13 +2,12 @@ package stardb
 
 import (
 	"stardb/ds/set"
-	"sync"
 	"stardb/storage"
 	"time"
 )
 
 type SetIdx struct {
-	mu	sync.RWMutex
+	mu	idxMutex
 	indexes *set.Set
 }
 
@@ -22,15 +21,17 @@ func (db *StarDB) SAdd(key []byte, members ...[]byte)(res int, err error){
 	}
 
 	db.setIndex.mu.Lock()
-	defer db.setIndex.mu.Unlock()
+	defer db.setIndex.mu.unlock(&err)
 
 	for _, m := range members{
 		exist := db.setIndex.indexes.SIsMember(string(key), m)
 		if !exist{
 			e := storage.NewEntryNoExtra(key, m, Set, SetSAdd)
 			if err = db.store(e); err != nil{
-				res = db.setIndex.indexes.SAdd(string(key), m)
+				return
 			}
+			db.setIndex.indexes.SAdd(string(key), m)
+			res++
 		}
 	}
 	return
@@ -42,7 +43,7 @@ func (db *StarDB) SPop(key []byte, count int)(values [][]byte, err error){
 	}
 
 	db.setIndex.mu.Lock()
-	defer db.setIndex.mu.Unlock()
+	defer db.setIndex.mu.unlock(&err)
 
 	if db.checkExpired(key, Set){
 		return nil, ErrKeyExpired
@@ -85,7 +86,7 @@ func (db *StarDB) SRem(key []byte, members ...[]byte)(res int, err error){
 	}
 
 	db.setIndex.mu.Lock()
-	defer db.setIndex.mu.Unlock()
+	defer db.setIndex.mu.unlock(&err)
 
 	if db.checkExpired(key, Set){
 		return
@@ -103,9 +104,9 @@ func (db *StarDB) SRem(key []byte, members ...[]byte)(res int, err error){
 	return
 }
 
-func (db *StarDB) SMove(src, dst, member []byte) error{
+func (db *StarDB) SMove(src, dst, member []byte)(err error){
 	db.setIndex.mu.Lock()
-	defer db.setIndex.mu.Unlock()
+	defer db.setIndex.mu.unlock(&err)
 
 	if db.checkExpired(src, Set){
 		return ErrKeyExpired
@@ -161,15 +162,7 @@ func (db *StarDB)SUnion(keys ...[]byte)(val [][]byte){
 	db.setIndex.mu.RLock()
 	defer db.setIndex.mu.RUnlock()
 
-	var validKeys []string
-	for _, k := range keys{
-		if db.checkExpired(k, Set){
-			continue
-		}
-		validKeys = append(validKeys, string(k))
-	}
-
-	return db.setIndex.indexes.SUnion(validKeys...)
+	return db.setIndex.indexes.SUnion(db.setKeys(keys)...)
 }
 
 func (db *StarDB)SDiff(keys ...[]byte)(val [][]byte){
@@ -180,15 +173,7 @@ func (db *StarDB)SDiff(keys ...[]byte)(val [][]byte){
 	db.setIndex.mu.RLock()
 	defer db.setIndex.mu.RUnlock()
 
-	var validKeys []string
-	for _, k := range keys{
-		if db.checkExpired(k, Set){
-			continue
-		}
-		validKeys = append(validKeys, string(k))
-	}
-
-	return db.setIndex.indexes.SDiff(validKeys...)
+	return db.setIndex.indexes.SDiff(db.setKeys(keys)...)
 }
 
 func (db *StarDB) SKeyExists(key []byte)(ok bool){
@@ -213,7 +198,7 @@ func (db *StarDB) SClear(key []byte)(err error){
 	}
 
 	db.setIndex.mu.Lock()
-	defer db.setIndex.mu.Unlock()
+	defer db.setIndex.mu.unlock(&err)
 
 	e := storage.NewEntryNoExtra(key, nil, Set, SetSClear)
 	if err = db.store(e); err != nil{
@@ -233,7 +218,7 @@ func (db *StarDB) SExpire(key []byte, duration int64)(err error){
 	}
 
 	db.setIndex.mu.Lock()
-	defer db.setIndex.mu.Unlock()
+	defer db.setIndex.mu.unlock(&err)
 
 	deadline := time.Now().Unix() + duration
 	e := storage.NewEntryWithExpire(key, nil, deadline, Set, SetSExpire)
@@ -257,4 +242,118 @@ func (db *StarDB) STTL(key []byte)(ttl int64){
 	}
 
 	return deadline - time.Now().Unix()
-}
\ No newline at end of file
+}
+
+// SInter 返回所有key的交集
+func (db *StarDB) SInter(keys ...[]byte)(val [][]byte){
+	if len(keys) == 0{
+		return
+	}
+
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	return db.setIndex.indexes.SInter(db.setKeys(keys)...)
+}
+
+// SInterCard 返回交集的元素个数, limit大于0时结果最多为limit
+func (db *StarDB) SInterCard(limit int, keys ...[]byte) int{
+	if len(keys) == 0{
+		return 0
+	}
+
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	return db.setIndex.indexes.SInterCard(limit, db.setKeys(keys)...)
+}
+
+// SMIsMember 返回每个member是否在集合中
+func (db *StarDB) SMIsMember(key []byte, members ...[]byte) []bool{
+	res := make([]bool, len(members))
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return res
+	}
+
+	db.setIndex.mu.RLock()
+	defer db.setIndex.mu.RUnlock()
+
+	if db.checkExpired(key, Set){
+		return res
+	}
+	for i, m := range members{
+		res[i] = db.setIndex.indexes.SIsMember(string(key), m)
+	}
+	return res
+}
+
+// SUnionStore 将所有key的并集保存到dst, 返回并集的元素个数
+func (db *StarDB) SUnionStore(dst []byte, keys ...[]byte)(int, error){
+	return db.sStore(dst, keys, db.setIndex.indexes.SUnion)
+}
+
+// SInterStore 将所有key的交集保存到dst, 返回交集的元素个数
+func (db *StarDB) SInterStore(dst []byte, keys ...[]byte)(int, error){
+	return db.sStore(dst, keys, db.setIndex.indexes.SInter)
+}
+
+// SDiffStore 将第一个key与其他key的差集保存到dst, 返回差集的元素个数
+func (db *StarDB) SDiffStore(dst []byte, keys ...[]byte)(int, error){
+	return db.sStore(dst, keys, db.setIndex.indexes.SDiff)
+}
+
+//计算结果并用一条日志替换dst, 结果为空时dst被删除
+func (db *StarDB) sStore(dst []byte, keys [][]byte, op func(keys ...string)[][]byte)(_ int, err error){
+	if err := db.checkKeyValue(dst, nil); err != nil{
+		return 0, err
+	}
+	if len(keys) == 0{
+		return 0, ErrEmptyKey
+	}
+
+	db.setIndex.mu.Lock()
+	defer db.setIndex.mu.unlock(&err)
+
+	members := op(db.setKeys(keys)...)
+	db.checkExpired(dst, Set)
+
+	e := storage.NewEntryNoExtra(dst, storage.EncodeValues(members), Set, SetSStore)
+	if err := db.store(e); err != nil{
+		return 0, err
+	}
+
+	db.setIndex.indexes.SClear(string(dst))
+	for _, m := range members{
+		db.setIndex.indexes.SAdd(string(dst), m)
+	}
+	delete(db.expires[Set], string(dst))
+	return len(members), nil
+}
+
+//清除已过期的key, 保留key的顺序, 已过期的key作为空集合参与计算, 调用方需持有setIndex.mu
+func (db *StarDB) setKeys(keys [][]byte) []string{
+	res := make([]string, len(keys))
+	for i, k := range keys{
+		db.checkExpired(k, Set)
+		res[i] = string(k)
+	}
+	return res
+}
+
+//回收时将STORE日志拆分为仍然在集合中的成员的SADD日志
+func (db *StarDB) sStoreSnapshot(e *storage.Entry) (entries []*storage.Entry){
+	if e.GetMark() != SetSStore{
+		return
+	}
+	members, err := storage.DecodeValues(e.Meta.Value)
+	if err != nil{
+		return
+	}
+
+	for _, m := range members{
+		if db.SIsMember(e.Meta.Key, m){
+			entries = append(entries, storage.NewEntryNoExtra(e.Meta.Key, m, Set, SetSAdd))
+		}
+	}
+	return
+}
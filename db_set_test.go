@@ -0,0 +1,194 @@
+package stardb
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"stardb/storage"
+	"stardb/vfs"
+	"testing"
+	"time"
+)
+
+func sortedMembers(members [][]byte) []string{
+	res := make([]string, len(members))
+	for i, m := range members{
+		res[i] = string(m)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestStarDB_SInter(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	n, err := db.SAdd([]byte("s1"), []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	_, err = db.SAdd([]byte("s2"), []byte("b"), []byte("c"), []byte("d"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"b", "c"}, sortedMembers(db.SInter([]byte("s1"), []byte("s2"))))
+	assert.Equal(t, 0, len(db.SInter([]byte("s1"), []byte("none"))))
+	assert.Equal(t, []string{"a", "b", "c", "d"}, sortedMembers(db.SUnion([]byte("s1"), []byte("s2"))))
+
+	assert.Equal(t, 2, db.SInterCard(0, []byte("s1"), []byte("s2")))
+	assert.Equal(t, 1, db.SInterCard(1, []byte("s1"), []byte("s2")))
+	assert.Equal(t, []bool{true, false}, db.SMIsMember([]byte("s1"), []byte("a"), []byte("d")))
+}
+
+func TestStarDB_SetExpiredKeys(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	_, err := db.SAdd([]byte("s1"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	_, err = db.SAdd([]byte("s2"), []byte("a"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.SExpire([]byte("s2"), 100))
+	db.expires[Set]["s2"] = time.Now().Unix() - 1
+
+	//已过期的key作为空集合, 而不是被忽略
+	assert.Equal(t, 0, len(db.SInter([]byte("s1"), []byte("s2"))))
+	assert.Equal(t, 0, len(db.SInter([]byte("s1"), []byte("s2"))))
+	assert.Equal(t, 0, db.SInterCard(0, []byte("s1"), []byte("s2")))
+	assert.Equal(t, 0, len(db.SDiff([]byte("s2"), []byte("s1"))))
+	assert.Equal(t, []string{"a", "b"}, sortedMembers(db.SDiff([]byte("s1"), []byte("s2"))))
+	assert.Equal(t, []string{"a", "b"}, sortedMembers(db.SUnion([]byte("s2"), []byte("s1"))))
+
+	n, err := db.SInterStore([]byte("dst"), []byte("s1"), []byte("s2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestStarDB_SStore(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	_, err := db.SAdd([]byte("s1"), []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	_, err = db.SAdd([]byte("s2"), []byte("b"), []byte("c"), []byte("d"))
+	assert.Nil(t, err)
+	_, err = db.SAdd([]byte("dst"), []byte("old"))
+	assert.Nil(t, err)
+
+	n, err := db.SInterStore([]byte("dst"), []byte("s1"), []byte("s2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.SDiffStore([]byte("diff"), []byte("s1"), []byte("s2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.SUnionStore([]byte("union"), []byte("s1"), []byte("s2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	n, err = db.SInterStore([]byte("empty"), []byte("s1"), []byte("none"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	//重新打开后目标集合被整体替换
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []string{"b", "c"}, sortedMembers(db.SMembers([]byte("dst"))))
+	assert.Equal(t, []string{"a"}, sortedMembers(db.SMembers([]byte("diff"))))
+	assert.Equal(t, 4, db.SCard([]byte("union")))
+	assert.False(t, db.SKeyExists([]byte("empty")))
+}
+
+func TestStarDB_SStoreReclaim(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	//回收时STORE日志拆分为仍然在集合中的成员
+	_, err = db.SAdd([]byte("src"), []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	_, err = db.SUnionStore([]byte("dst"), []byte("src"))
+	assert.Nil(t, err)
+	_, err = db.SRem([]byte("dst"), []byte("b"))
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++{
+		_, err = db.SAdd([]byte("other"), []byte{byte('a' + i)})
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Reclaim())
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "c"}, sortedMembers(db.SMembers([]byte("dst"))))
+	db.Close()
+}
+
+//写入成功后立即更新索引, 写入失败时返回错误且不修改索引
+func TestStarDB_SAddStoreError(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMemFS())
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = fs
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	n, err := db.SAdd([]byte("tags"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	assert.True(t, db.SIsMember([]byte("tags"), []byte("a")))
+
+	fs.SetShortWrite(true)
+	n, err = db.SAdd([]byte("tags"), []byte("c"))
+	assert.Equal(t, io.ErrShortWrite, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, db.SIsMember([]byte("tags"), []byte("c")))
+	fs.Reset()
+}
+
+//结果超出一个文件大小时返回错误, dst保持不变, 重新打开后数据也不会丢失
+func TestStarDB_SStoreTooLarge(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.RwMethod = storage.MMap
+	config.BlockSize = 4096
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	for i := 0; i < 500; i++{
+		_, err = db.SAdd([]byte("src"), []byte(fmt.Sprintf("member-%d", i)))
+		assert.Nil(t, err)
+	}
+	_, err = db.SAdd([]byte("dst"), []byte("old"))
+	assert.Nil(t, err)
+
+	n, err := db.SUnionStore([]byte("dst"), []byte("src"))
+	assert.Equal(t, ErrEntryTooLarge, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, []string{"old"}, sortedMembers(db.SMembers([]byte("dst"))))
+
+	_, err = db.SAdd([]byte("dst"), []byte("new"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 500, db.SCard([]byte("src")))
+	assert.Equal(t, []string{"new", "old"}, sortedMembers(db.SMembers([]byte("dst"))))
+}
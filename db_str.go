@@ -1,22 +1,66 @@
 package stardb
 
 import (
+	"stardb/cache"
+	"stardb/ds/hll"
 	"stardb/index"
 	"bytes"
+	"math"
+	"math/bits"
+	"strconv"
 	"strings"
-	"sync"
 	"stardb/storage"
 	"time"
 )
 
 // StrIdx 字符串索引
 type StrIdx struct {
-	mu		sync.RWMutex
+	mu		idxMutex
 	idxList *index.SkipList
+	bitmaps map[string]struct{}  //值由SETBIT日志累积而成的key, 完整的值只保存在内存中
+	blobs   map[string]*blob     //分块保存的key
+	writing map[uint64]*blob     //正在写入的blob, 回收时保留它们已经写入的分块
+	pending map[uint64][]blobChunk  //重放时暂存的分块, 等待manifest
+	blobSeq uint64               //已分配的最大blob id
+}
+
+// BitUnit BITCOUNT和BITPOS中start和end的单位
+type BitUnit uint8
+
+const (
+	// BitUnitByte 以字节为单位
+	BitUnitByte BitUnit = iota
+	// BitUnitBit 以bit为单位
+	BitUnitBit
+)
+
+// BitOperation BITOP的运算类型
+type BitOperation uint8
+
+const (
+	BitAnd BitOperation = iota
+	BitOr
+	BitXor
+	BitNot
+)
+
+// SetOption SET的可选参数
+type SetOption struct {
+	NX      bool   //key不存在时才设置
+	XX      bool   //key存在时才设置
+	Get     bool   //返回设置前的值
+	Expire  int64  //过期时间, 单位为秒, 大于0时生效
+	KeepTTL bool   //保留原有的过期时间
 }
 
 func newStrIdx()*StrIdx{
-	return &StrIdx{idxList: index.NewSkipList()}
+	return &StrIdx{
+		idxList: index.NewSkipList(),
+		bitmaps: make(map[string]struct{}),
+		blobs: make(map[string]*blob),
+		writing: make(map[uint64]*blob),
+		pending: make(map[uint64][]blobChunk),
+	}
 }
 
 func (db *StarDB)Set(key, value []byte) error{
@@ -42,38 +86,7 @@ func (db *StarDB)Get(key []byte)([]byte, error){
 	db.strIndex.mu.RLock()
 	defer db.strIndex.mu.RUnlock()
 
-	node := db.strIndex.idxList.Get(key)
-	if node == nil{
-		return nil, ErrKeyNotExist
-	}
-
-	idx := node.Value().(*index.Indexer)
-	if idx == nil{
-		return nil, ErrNilIndexer
-	}
-
-	if db.checkExpired(key, String){
-		return nil, ErrKeyExpired
-	}
-
-	if db.config.IdxMode == KeyValueMemMode {
-		return idx.Meta.Value, nil
-	}
-
-	if db.config.IdxMode == KeyOnlyMemMode {
-		df := db.activeFile[String]
-
-		if idx.FileId != db.activeFileIds[String]{
-			df = db.archFiles[String][idx.FileId]
-		}
-
-		e, err := df.Read(idx.Offset)
-		if err != nil{
-			return nil, err
-		}
-		return e.Meta.Value, nil
-	}
-	return nil, ErrKeyNotExist
+	return db.getVal(key)
 }
 
 func (db *StarDB) GetSet(key, val []byte)(res []byte, err error){
@@ -117,6 +130,9 @@ func (db *StarDB) StrLen(key []byte) int{
 		if db.checkExpired(key, String){
 			return 0
 		}
+		if b, ok := db.strIndex.blobs[string(key)]; ok{
+			return int(b.size)
+		}
 		idx := e.Value().(*index.Indexer)
 		return int(idx.Meta.ValueSize)
 	}
@@ -139,23 +155,15 @@ func (db *StarDB) StrExists(key []byte) bool{
 	return false
 }
 
-func (db *StarDB) StrRem(key []byte) error {
+func (db *StarDB) StrRem(key []byte)(err error){
 	if err := db.checkKeyValue(key, nil); err != nil{
 		return err
 	}
 
 	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
-
-	e := storage.NewEntryNoExtra(key, nil, String, StringRem)
-	if err := db.store(e); err != nil{
-		return err
-	}
+	defer db.strIndex.mu.unlock(&err)
 
-	db.incrReclaimableSpace(key)
-	db.strIndex.idxList.Remove(key)
-	delete(db.expires[String], string(key))
-	return nil
+	return db.remVal(key)
 }
 
 func (db *StarDB) PrefixScan(prefix string, limit, offset int)(val [][]byte, err error){
@@ -170,7 +178,7 @@ func (db *StarDB) PrefixScan(prefix string, limit, offset int)(val [][]byte, err
 	}
 
 	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	defer db.strIndex.mu.unlock(&err)
 
 	e := db.strIndex.idxList.FindPrefix([]byte(prefix))
 	if limit > 0 {
@@ -210,7 +218,7 @@ func (db *StarDB) RangeScan(start, end []byte)(val [][]byte, err error){
 	node := db.strIndex.idxList.Get(start)
 
 	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	defer db.strIndex.mu.unlock(&err)
 
 	for node != nil && bytes.Compare(node.Key(), end) <= 0{
 		if db.checkExpired(node.Key(), String){
@@ -243,17 +251,9 @@ func (db *StarDB)Expire(key []byte, duration int64)(err error){
 	}
 
 	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
-
-	deadline := time.Now().Unix() + duration
-
-	e := storage.NewEntryWithExpire(key, nil, deadline, String, StringExpire)
-	if err = db.store(e); err != nil{
-		return err
-	}
+	defer db.strIndex.mu.unlock(&err)
 
-	db.expires[String][string(key)] = deadline
-	return
+	return db.expireVal(key, time.Now().Unix() + duration)
 }
 
 func (db *StarDB) Persist(key []byte)(err error){
@@ -263,15 +263,9 @@ func (db *StarDB) Persist(key []byte)(err error){
 	}
 
 	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
-
-	e := storage.NewEntryNoExtra(key, val, String, StringPersist)
-	if err = db.store(e); err != nil{
-		return
-	}
+	defer db.strIndex.mu.unlock(&err)
 
-	delete(db.expires[String], string(key))
-	return
+	return db.persistVal(key, val)
 }
 
 func (db *StarDB) TTL(key []byte)(ttl int64){
@@ -288,58 +282,1017 @@ func (db *StarDB) TTL(key []byte)(ttl int64){
 	return deadline - time.Now().Unix()
 }
 
-//增加可回收空间
-func (db *StarDB) incrReclaimableSpace(key []byte){
-	oldIdx := db.strIndex.idxList.Get(key)
-	if oldIdx != nil {
-		indexer := oldIdx.Value().(*index.Indexer)
+// SetBit 设置key的值在offset处的bit, 返回原来的bit, 值的长度不足时用0填充
+func (db *StarDB) SetBit(key []byte, offset, bit int)(old int, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	if offset < 0 || offset >= int(db.config.MaxValueSize) << 3{
+		return 0, ErrBitOffsetInvalid
+	}
+	if bit != 0 && bit != 1{
+		return 0, ErrBitValueInvalid
+	}
 
-		if indexer != nil {
-			space := int64(indexer.EntrySize)
-			db.meta.ReclaimableSpace[indexer.FileId] += space
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	val, err := db.getVal(key)
+	if err != nil && err != ErrKeyNotExist && err != ErrKeyExpired{
+		return
+	}
+	err = nil
+
+	old = getBit(val, offset)
+	if old == bit && offset >> 3 < len(val){
+		return
+	}
+
+	//只记录变化的bit, 不重写整个值
+	e := storage.NewEntry(key, []byte(strconv.Itoa(bit)), []byte(strconv.Itoa(offset)), String, StringSetBit)
+	if err = db.store(e); err != nil{
+		return
+	}
+
+	db.incrReclaimableSpace(key)
+	val = setBit(val, offset, bit)
+	idx := &index.Indexer{
+		Meta: &storage.Meta{
+			KeySize: uint32(len(key)),
+			Key: key,
+			Value: val,
+			ValueSize: uint32(len(val)),
+		},
+		FileId: db.activeFileIds[String],
+		EntrySize: e.Size(),
+		Offset: db.activeFile[String].Offset - int64(e.Size()),
+	}
+	db.strIndex.idxList.Put(key, idx)
+	db.strIndex.bitmaps[string(key)] = struct{}{}
+	return
+}
+
+func (db *StarDB) GetBit(key []byte, offset int)(int, error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return 0, err
+	}
+	if offset < 0{
+		return 0, ErrBitOffsetInvalid
+	}
+
+	val, err := db.bitmapVal(key)
+	if err != nil{
+		return 0, err
+	}
+	return getBit(val, offset), nil
+}
+
+// BitCount 返回值在start和end之间(包含end)被设置为1的bit数量, start和end可以为负数
+func (db *StarDB) BitCount(key []byte, start, end int, unit BitUnit)(int, error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return 0, err
+	}
+
+	val, err := db.bitmapVal(key)
+	if err != nil{
+		return 0, err
+	}
+
+	start, end, ok := bitRange(len(val), start, end, unit)
+	if !ok{
+		return 0, nil
+	}
+	if unit == BitUnitByte{
+		count := 0
+		for _, b := range val[start:end+1]{
+			count += bits.OnesCount8(b)
 		}
+		return count, nil
 	}
+
+	count := 0
+	for i := start; i <= end; i++{
+		count += getBit(val, i)
+	}
+	return count, nil
 }
 
-func (db *StarDB) doSet(key, value []byte)(err error){
-	if err = db.checkKeyValue(key, value); err != nil{
-		return
+// BitPos 返回start和end之间第一个值为bit的位置, 没有找到时返回-1
+// 查找0且没有指定end时, 如果值的所有bit都为1, 返回值的bit长度
+func (db *StarDB) BitPos(key []byte, bit, start, end int, unit BitUnit, endGiven bool)(int, error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return 0, err
+	}
+	if bit != 0 && bit != 1{
+		return 0, ErrBitValueInvalid
 	}
 
-	if db.config.IdxMode == KeyValueMemMode{
-		if existVal, _ := db.Get(key); existVal != nil && bytes.Compare(existVal, value) == 0{
-			return
+	val, err := db.bitmapVal(key)
+	if err != nil{
+		return 0, err
+	}
+	if len(val) == 0{
+		if bit == 0{
+			return 0, nil
+		}
+		return -1, nil
+	}
+
+	start, end, ok := bitRange(len(val), start, end, unit)
+	if !ok{
+		return -1, nil
+	}
+	if unit == BitUnitByte{
+		start, end = start << 3, end << 3 + 7
+	}
+	for i := start; i <= end; i++{
+		if getBit(val, i) == bit{
+			return i, nil
+		}
+	}
+
+	if bit == 0 && !endGiven{
+		return len(val) << 3, nil
+	}
+	return -1, nil
+}
+
+// BitOp 对keys的值做位运算并将结果保存到destKey, 返回结果的长度
+// 长度不同的值以0补齐, 结果为空时destKey会被删除
+func (db *StarDB) BitOp(op BitOperation, destKey []byte, keys ...[]byte)(_ int, err error){
+	if err := db.checkKeyValue(destKey, nil); err != nil{
+		return 0, err
+	}
+	if len(keys) == 0 || (op == BitNot && len(keys) != 1){
+		return 0, ErrBitOpKeys
+	}
+	for _, k := range keys{
+		if err := db.checkKeyValue(k, nil); err != nil{
+			return 0, err
 		}
 	}
 
 	db.strIndex.mu.Lock()
-	defer db.strIndex.mu.Unlock()
+	defer db.strIndex.mu.unlock(&err)
 
-	e := storage.NewEntryNoExtra(key, value, String, StringSet)
-	if err := db.store(e); err != nil{
+	values, maxLen := make([][]byte, len(keys)), 0
+	for i, k := range keys{
+		val, err := db.getVal(k)
+		if err != nil && err != ErrKeyNotExist && err != ErrKeyExpired{
+			return 0, err
+		}
+		values[i] = val
+		if len(val) > maxLen{
+			maxLen = len(val)
+		}
+	}
+
+	res := make([]byte, maxLen)
+	for i := 0; i < maxLen; i++{
+		b := byteAt(values[0], i)
+		if op == BitNot{
+			res[i] = ^b
+			continue
+		}
+		for _, v := range values[1:]{
+			switch op {
+			case BitAnd:
+				b &= byteAt(v, i)
+			case BitOr:
+				b |= byteAt(v, i)
+			case BitXor:
+				b ^= byteAt(v, i)
+			}
+		}
+		res[i] = b
+	}
+
+	if maxLen == 0{
+		if db.strIndex.idxList.Exist(destKey){
+			return 0, db.remVal(destKey)
+		}
+		return 0, nil
+	}
+	return maxLen, db.setVal(destKey, res)
+}
+
+// PFAdd 将元素添加到key的HyperLogLog中, key不存在时会被创建
+// 有寄存器被修改或key被创建时返回true
+func (db *StarDB) PFAdd(key []byte, elements ...[]byte)(_ bool, err error){
+	if err := db.checkKeyValue(key, elements...); err != nil{
+		return false, err
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	h, created, err := db.getHLL(key)
+	if err != nil{
+		return false, err
+	}
+
+	updated := created
+	for _, e := range elements{
+		if h.Add(e){
+			updated = true
+		}
+	}
+	if !updated{
+		return false, nil
+	}
+	return true, db.setValKeepTTL(key, h.Encode())
+}
+
+// PFCount 返回keys的并集的近似基数, 不存在的key视为空集合
+func (db *StarDB) PFCount(keys ...[]byte)(int, error){
+	if len(keys) == 0{
+		return 0, ErrEmptyKey
+	}
+	for _, k := range keys{
+		if err := db.checkKeyValue(k, nil); err != nil{
+			return 0, err
+		}
+	}
+
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	var res *hll.HLL
+	for _, k := range keys{
+		h, _, err := db.getHLL(k)
+		if err != nil{
+			return 0, err
+		}
+		if res == nil{
+			res = h
+		}else{
+			res.Merge(h)
+		}
+	}
+	return int(res.Count()), nil
+}
+
+// PFMerge 将keys的HyperLogLog合并到destKey, destKey存在时也参与合并
+func (db *StarDB) PFMerge(destKey []byte, keys ...[]byte)(err error){
+	if err := db.checkKeyValue(destKey, nil); err != nil{
 		return err
 	}
+	for _, k := range keys{
+		if err := db.checkKeyValue(k, nil); err != nil{
+			return err
+		}
+	}
 
-	db.incrReclaimableSpace(key)
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
 
-	if _, ok := db.expires[String][string(key)]; ok{
-		delete(db.expires[String], string(key))
+	res, _, err := db.getHLL(destKey)
+	if err != nil{
+		return err
 	}
+	for _, k := range keys{
+		h, _, err := db.getHLL(k)
+		if err != nil{
+			return err
+		}
+		res.Merge(h)
+	}
+	//合并的结果使用dense编码, 同redis
+	res.ToDense()
+	return db.setValKeepTTL(destKey, res.Encode())
+}
 
-	idx := &index.Indexer{
-		Meta: &storage.Meta{
-			KeySize: uint32(len(e.Meta.Key)),
-			Key: e.Meta.Key,
-			ValueSize: uint32(len(e.Meta.Value)),
-		},
-		FileId: db.activeFileIds[String],
-		EntrySize: e.Size(),
-		Offset: db.activeFile[String].Offset - int64(e.Size()),
+// SetWithOption 按opt设置key的值, 返回设置前的值(opt.Get为true时)以及是否设置成功
+func (db *StarDB) SetWithOption(key, value []byte, opt SetOption)(old []byte, ok bool, err error){
+	if err = db.checkKeyValue(key, value); err != nil{
+		return
+	}
+	if (opt.NX && opt.XX) || (opt.Expire > 0 && opt.KeepTTL){
+		return nil, false, ErrInvalidSetOption
+	}
+	if opt.Expire < 0{
+		return nil, false, ErrInvalidTTL
 	}
 
-	if db.config.IdxMode == KeyValueMemMode{
-		idx.Meta.Value = e.Meta.Value
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	return db.setWithOption(key, opt, func() error{
+		if opt.KeepTTL{
+			return db.setValKeepTTL(key, value)
+		}
+		return db.setVal(key, value)
+	})
+}
+
+//按opt的条件调用write写入key的值, 之后按opt设置过期时间, 调用方需持有strIndex.mu
+//write需要自己处理opt.KeepTTL
+func (db *StarDB) setWithOption(key []byte, opt SetOption, write func() error)(old []byte, ok bool, err error){
+	exist := db.strIndex.idxList.Exist(key) && !db.checkExpired(key, String)
+	if exist && opt.Get{
+		if old, err = db.getVal(key); err != nil{
+			return nil, false, err
+		}
 	}
-	db.strIndex.idxList.Put(idx.Meta.Key, idx)
-	return
-}
\ No newline at end of file
+	if (opt.NX && exist) || (opt.XX && !exist){
+		return
+	}
+
+	if err = write(); err == nil && opt.Expire > 0{
+		err = db.expireVal(key, time.Now().Unix() + opt.Expire)
+	}
+	return old, err == nil, err
+}
+
+// SetEx 设置key的值以及过期时间, 单位为秒
+func (db *StarDB) SetEx(key, value []byte, duration int64) error{
+	if duration <= 0{
+		return ErrInvalidTTL
+	}
+	_, _, err := db.SetWithOption(key, value, SetOption{Expire: duration})
+	return err
+}
+
+// GetRange 返回值在[start, end]之间的部分, 负数表示从末尾开始计算, key不存在时返回空
+// KeyOnlyMemMode下只从数据文件读取需要的部分
+func (db *StarDB) GetRange(key []byte, start, end int)([]byte, error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return nil, err
+	}
+
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	node := db.strIndex.idxList.Get(key)
+	if node == nil || db.checkExpired(key, String){
+		return nil, nil
+	}
+	idx := node.Value().(*index.Indexer)
+
+	//blob只读取涉及的分块
+	if b, ok := db.strIndex.blobs[string(key)]; ok{
+		first, last, ok := bitRange(int(b.size), start, end, BitUnitByte)
+		if !ok{
+			return nil, nil
+		}
+		return db.readBlobRange(key, b, int64(first), int64(last - first + 1))
+	}
+
+	_, bitmap := db.strIndex.bitmaps[string(key)]
+	if db.config.IdxMode == KeyOnlyMemMode && !bitmap{
+		first, last, ok := bitRange(int(idx.Meta.ValueSize), start, end, BitUnitByte)
+		if !ok{
+			return nil, nil
+		}
+		if idx.ValuePtr != nil{
+			return db.vlog.ReadValue(*idx.ValuePtr, idx.Meta.KeySize, int64(first), int64(last - first + 1))
+		}
+		return db.strFile(idx).ReadValue(idx.Offset, idx.Meta.KeySize, int64(first), int64(last - first + 1))
+	}
+
+	val, err := db.readStrVal(idx)
+	if err != nil{
+		return nil, err
+	}
+	first, last, ok := bitRange(len(val), start, end, BitUnitByte)
+	if !ok{
+		return nil, nil
+	}
+	return val[first:last+1], nil
+}
+
+// SetRange 从offset开始用value覆盖原来的值, 原值不够长时用0补齐, 返回新值的长度
+func (db *StarDB) SetRange(key []byte, offset int, value []byte)(_ int, err error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return 0, err
+	}
+	if offset < 0{
+		return 0, ErrOffsetInvalid
+	}
+	if offset + len(value) > int(db.config.MaxValueSize){
+		return 0, ErrValueTooLarge
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	old, err := db.getVal(key)
+	if err != nil && err != ErrKeyNotExist && err != ErrKeyExpired{
+		return 0, err
+	}
+	if len(value) == 0{
+		return len(old), nil
+	}
+
+	length := len(old)
+	if offset + len(value) > length{
+		length = offset + len(value)
+	}
+	val := make([]byte, length)
+	copy(val, old)
+	copy(val[offset:], value)
+	return len(val), db.setValKeepTTL(key, val)
+}
+
+// GetDel 返回key的值并删除key
+func (db *StarDB) GetDel(key []byte)(_ []byte, err error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return nil, err
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	val, err := db.getVal(key)
+	if err != nil{
+		return nil, err
+	}
+	return val, db.remVal(key)
+}
+
+// GetEx 返回key的值, duration大于0时同时设置过期时间(秒), persist为true时移除过期时间
+func (db *StarDB) GetEx(key []byte, duration int64, persist bool)(_ []byte, err error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return nil, err
+	}
+	if duration < 0 || (duration > 0 && persist){
+		return nil, ErrInvalidTTL
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	val, err := db.getVal(key)
+	if err != nil{
+		return nil, err
+	}
+
+	if duration > 0{
+		err = db.expireVal(key, time.Now().Unix() + duration)
+	}else if _, exist := db.expires[String][string(key)]; persist && exist{
+		err = db.persistVal(key, val)
+	}
+	return val, err
+}
+
+// Incr 将key的值加1, key不存在时视为0
+func (db *StarDB) Incr(key []byte)(int64, error){
+	return db.IncrBy(key, 1)
+}
+
+// Decr 将key的值减1
+func (db *StarDB) Decr(key []byte)(int64, error){
+	return db.IncrBy(key, -1)
+}
+
+// DecrBy 将key的值减去decr
+func (db *StarDB) DecrBy(key []byte, decr int64)(int64, error){
+	if decr == math.MinInt64{
+		return 0, ErrIncrOverflow
+	}
+	return db.IncrBy(key, -decr)
+}
+
+// IncrBy 将key的值加上incr并返回新值, 值不是64位整数时返回ErrValueNotInteger
+func (db *StarDB) IncrBy(key []byte, incr int64)(res int64, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	val, err := db.getVal(key)
+	if err != nil && err != ErrKeyNotExist && err != ErrKeyExpired{
+		return
+	}
+	if err == nil{
+		if res, err = strconv.ParseInt(string(val), 10, 64); err != nil{
+			return 0, ErrValueNotInteger
+		}
+	}
+
+	if (incr > 0 && res > math.MaxInt64 - incr) || (incr < 0 && res < math.MinInt64 - incr){
+		return 0, ErrIncrOverflow
+	}
+	res += incr
+	err = db.setValKeepTTL(key, []byte(strconv.FormatInt(res, 10)))
+	return
+}
+
+// IncrByFloat 将key的值加上浮点数incr并返回新值
+func (db *StarDB) IncrByFloat(key []byte, incr float64)(res float64, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	if math.IsNaN(incr) || math.IsInf(incr, 0){
+		return 0, ErrIncrNaNOrInf
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	val, err := db.getVal(key)
+	if err != nil && err != ErrKeyNotExist && err != ErrKeyExpired{
+		return
+	}
+	if err == nil{
+		if res, err = parseFloat(val); err != nil{
+			return 0, ErrValueNotFloat
+		}
+	}
+
+	res += incr
+	if math.IsNaN(res) || math.IsInf(res, 0){
+		return 0, ErrIncrNaNOrInf
+	}
+	err = db.setValKeepTTL(key, []byte(strconv.FormatFloat(res, 'f', -1, 64)))
+	return
+}
+
+// MSet 同时设置多个key的值, pairs为key value交替排列, 所有key在日志中作为一组原子写入
+func (db *StarDB) MSet(pairs ...[]byte)(err error){
+	if err := db.checkPairs(pairs); err != nil{
+		return err
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	return db.setVals(pairs)
+}
+
+// MSetNx 所有key都不存在时才设置, 设置成功返回true
+func (db *StarDB) MSetNx(pairs ...[]byte)(_ bool, err error){
+	if err := db.checkPairs(pairs); err != nil{
+		return false, err
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	for i := 0; i < len(pairs); i += 2{
+		_, err := db.getVal(pairs[i])
+		if err == nil{
+			return false, nil
+		}
+		if err != ErrKeyNotExist && err != ErrKeyExpired{
+			return false, err
+		}
+	}
+	if err := db.setVals(pairs); err != nil{
+		return false, err
+	}
+	return true, nil
+}
+
+// MGet 返回多个key的值, 不存在或过期的key对应nil
+func (db *StarDB) MGet(keys ...[]byte)([][]byte, error){
+	for _, k := range keys{
+		if err := db.checkKeyValue(k, nil); err != nil{
+			return nil, err
+		}
+	}
+
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	res := make([][]byte, len(keys))
+	for i, k := range keys{
+		val, err := db.getVal(k)
+		if err == ErrKeyNotExist || err == ErrKeyExpired{
+			continue
+		}
+		if err != nil{
+			return nil, err
+		}
+		res[i] = val
+	}
+	return res, nil
+}
+
+//增加可回收空间, 旧的值同时从缓存中删除
+func (db *StarDB) incrReclaimableSpace(key []byte){
+	oldIdx := db.strIndex.idxList.Get(key)
+	if oldIdx != nil {
+		indexer := oldIdx.Value().(*index.Indexer)
+
+		if indexer != nil {
+			space := int64(indexer.EntrySize)
+			db.meta.ReclaimableSpace[indexer.FileId] += space
+			if p := indexer.ValuePtr; p != nil{
+				db.meta.ValueLogDiscard[p.FileId] += int64(p.Size)
+			}
+			if db.valueCache != nil{
+				db.valueCache.Remove(strCacheKey(indexer))
+			}
+		}
+	}
+
+	//blob的分块同样可以回收
+	if b, ok := db.strIndex.blobs[string(key)]; ok{
+		for _, c := range b.chunks{
+			db.meta.ReclaimableSpace[c.fileId] += int64(c.size)
+		}
+		delete(db.strIndex.blobs, string(key))
+	}
+}
+
+func (db *StarDB) doSet(key, value []byte)(err error){
+	if err = db.checkKeyValue(key, value); err != nil{
+		return
+	}
+
+	if db.config.IdxMode == KeyValueMemMode{
+		if existVal, _ := db.Get(key); existVal != nil && bytes.Compare(existVal, value) == 0{
+			return
+		}
+	}
+
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	return db.setVal(key, value)
+}
+
+//获取key的值, 调用方需持有strIndex.mu
+func (db *StarDB) getVal(key []byte)([]byte, error){
+	node := db.strIndex.idxList.Get(key)
+	if node == nil{
+		return nil, ErrKeyNotExist
+	}
+
+	idx := node.Value().(*index.Indexer)
+	if idx == nil{
+		return nil, ErrNilIndexer
+	}
+
+	if db.checkExpired(key, String){
+		return nil, ErrKeyExpired
+	}
+	return db.readStrVal(idx)
+}
+
+//读取索引对应的值, KeyOnlyMemMode下从磁盘读取
+func (db *StarDB) readStrVal(idx *index.Indexer)([]byte, error){
+	//blob的分块总是从磁盘读取
+	if b, ok := db.strIndex.blobs[string(idx.Meta.Key)]; ok{
+		return db.readBlob(b)
+	}
+
+	if db.config.IdxMode == KeyValueMemMode {
+		return idx.Meta.Value, nil
+	}
+
+	if db.config.IdxMode == KeyOnlyMemMode {
+		//bitmap的值由多条SETBIT日志累积而成, 只保存在内存中
+		if _, ok := db.strIndex.bitmaps[string(idx.Meta.Key)]; ok{
+			return idx.Meta.Value, nil
+		}
+
+		if db.valueCache != nil{
+			if val, ok := db.valueCache.Get(strCacheKey(idx)); ok{
+				return val, nil
+			}
+		}
+
+		var val []byte
+		if idx.ValuePtr != nil{
+			var err error
+			if val, err = db.readValueLog(idx.ValuePtr); err != nil{
+				return nil, err
+			}
+		}else{
+			e, err := db.strFile(idx).ReadEntry(idx.Offset, idx.EntrySize)
+			if err != nil{
+				return nil, err
+			}
+			val = e.Meta.Value
+		}
+		if db.valueCache != nil{
+			db.valueCache.Set(strCacheKey(idx), val)
+		}
+		return val, nil
+	}
+	return nil, ErrKeyNotExist
+}
+
+// ValueCacheStats 返回KeyOnlyMemMode下值缓存的命中次数等统计信息, 未开启缓存时返回零值
+func (db *StarDB) ValueCacheStats() cache.Stats{
+	if db.valueCache == nil{
+		return cache.Stats{}
+	}
+	return db.valueCache.Stats()
+}
+
+func (db *StarDB) purgeValueCache(){
+	if db.valueCache != nil{
+		db.valueCache.Purge()
+	}
+}
+
+func strCacheKey(idx *index.Indexer) cache.Key{
+	return cache.Key{FileId: idx.FileId, Offset: idx.Offset}
+}
+
+//索引所在的数据文件
+func (db *StarDB) strFile(idx *index.Indexer) *storage.DBFile{
+	return db.strFileById(idx.FileId)
+}
+
+func (db *StarDB) strFileById(fileId uint32) *storage.DBFile{
+	if fileId == db.activeFileIds[String]{
+		return db.activeFile[String]
+	}
+	return db.archFiles[String][fileId]
+}
+
+//获取key的HyperLogLog, key不存在时返回一个新的空HLL, 调用方需持有strIndex.mu
+func (db *StarDB) getHLL(key []byte)(h *hll.HLL, created bool, err error){
+	val, err := db.getVal(key)
+	if err == ErrKeyNotExist || err == ErrKeyExpired{
+		return hll.New(), true, nil
+	}
+	if err != nil{
+		return nil, false, err
+	}
+
+	if h, err = hll.Decode(val); err != nil{
+		return nil, false, ErrInvalidHLL
+	}
+	return
+}
+
+//bit相关的读操作, 不存在或过期的key视为空值
+func (db *StarDB) bitmapVal(key []byte)([]byte, error){
+	db.strIndex.mu.RLock()
+	defer db.strIndex.mu.RUnlock()
+
+	val, err := db.getVal(key)
+	if err == ErrKeyNotExist || err == ErrKeyExpired{
+		return nil, nil
+	}
+	return val, err
+}
+
+//调用方需持有strIndex.mu
+func (db *StarDB) setVal(key, value []byte)(err error){
+	e := storage.NewEntryNoExtra(key, value, String, StringSet)
+	if err := db.separateValue(e); err != nil{
+		return err
+	}
+	if err := db.store(e); err != nil{
+		return err
+	}
+
+	db.putStrIndexer(e, db.activeFileIds[String], db.activeFile[String].Offset - int64(e.Size()))
+	return
+}
+
+//写入一组MSET日志, 全部写入后才更新索引, 调用方需持有strIndex.mu
+//每条日志的extra为组内序号和组的大小, 重放时只有完整的一组才会生效
+func (db *StarDB) setVals(pairs [][]byte) error{
+	n := len(pairs) / 2
+	entries := make([]*storage.Entry, n)
+	fileIds := make([]uint32, n)
+	offsets := make([]int64, n)
+	for i := 0; i < n; i++{
+		extra := []byte(strconv.Itoa(i) + ExtraSeparator + strconv.Itoa(n))
+		e := storage.NewEntry(pairs[2*i], pairs[2*i+1], extra, String, StringMSet)
+		if err := db.separateValue(e); err != nil{
+			return err
+		}
+		if err := db.store(e); err != nil{
+			return err
+		}
+		entries[i] = e
+		fileIds[i] = db.activeFileIds[String]
+		offsets[i] = db.activeFile[String].Offset - int64(e.Size())
+	}
+
+	for i, e := range entries{
+		db.putStrIndexer(e, fileIds[i], offsets[i])
+	}
+	return nil
+}
+
+//更新key的索引为刚写入的set日志, 调用方需持有strIndex.mu
+func (db *StarDB) putStrIndexer(e *storage.Entry, fileId uint32, offset int64){
+	key := e.Meta.Key
+	db.incrReclaimableSpace(key)
+
+	if _, ok := db.expires[String][string(key)]; ok{
+		delete(db.expires[String], string(key))
+	}
+	delete(db.strIndex.bitmaps, string(key))
+
+	idx := &index.Indexer{
+		Meta: &storage.Meta{
+			KeySize: uint32(len(e.Meta.Key)),
+			Key: e.Meta.Key,
+			ValueSize: uint32(len(e.Meta.Value)),
+		},
+		FileId: fileId,
+		EntrySize: e.Size(),
+		Offset: offset,
+	}
+
+	if db.config.IdxMode == KeyValueMemMode{
+		idx.Meta.Value = e.Meta.Value
+	}
+	if p, ok := e.ValuePointer(); ok{
+		idx.ValuePtr = &p
+	}
+	db.strIndex.idxList.Put(idx.Meta.Key, idx)
+}
+
+//同setVal, 但保留key的过期时间, 重放set日志时会清除过期时间, 因此重新写入一条过期日志
+func (db *StarDB) setValKeepTTL(key, value []byte) error{
+	deadline, exist := db.expires[String][string(key)]
+	if err := db.setVal(key, value); err != nil{
+		return err
+	}
+	if exist{
+		return db.expireVal(key, deadline)
+	}
+	return nil
+}
+
+//解析浮点数, 不允许NaN和Inf以及首尾的空白
+func parseFloat(val []byte)(float64, error){
+	f, err := strconv.ParseFloat(string(val), 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0){
+		return 0, ErrValueNotFloat
+	}
+	return f, nil
+}
+
+//设置key的过期时间点, 调用方需持有strIndex.mu
+func (db *StarDB) expireVal(key []byte, deadline int64) error{
+	e := storage.NewEntryWithExpire(key, nil, deadline, String, StringExpire)
+	if err := db.store(e); err != nil{
+		return err
+	}
+
+	db.expires[String][string(key)] = deadline
+	return nil
+}
+
+//移除key的过期时间, 调用方需持有strIndex.mu
+func (db *StarDB) persistVal(key, val []byte) error{
+	if b, ok := db.strIndex.blobs[string(key)]; ok{
+		return db.putBlobManifest(key, b)
+	}
+
+	e := storage.NewEntryNoExtra(key, val, String, StringPersist)
+	if err := db.separateValue(e); err != nil{
+		return err
+	}
+	if err := db.store(e); err != nil{
+		return err
+	}
+
+	delete(db.expires[String], string(key))
+	return nil
+}
+
+//校验MSET的参数, pairs为key value交替排列
+func (db *StarDB) checkPairs(pairs [][]byte) error{
+	if len(pairs) == 0 || len(pairs) % 2 != 0{
+		return ErrInvalidPairs
+	}
+	for i := 0; i < len(pairs); i += 2{
+		if err := db.checkKeyValue(pairs[i], pairs[i+1]); err != nil{
+			return err
+		}
+	}
+	return nil
+}
+
+//回收时将MSET日志转为普通的set日志, 避免回收后剩余的日志因组不完整而在重放时被丢弃
+func msetToSet(e *storage.Entry) *storage.Entry{
+	if e.GetType() != String || e.GetMark() != StringMSet{
+		return e
+	}
+	set := storage.NewEntryNoExtra(e.Meta.Key, e.Meta.Value, String, StringSet)
+	if p, ok := e.ValuePointer(); ok{
+		set.SetValuePointer(p)
+	}
+	return set
+}
+
+//调用方需持有strIndex.mu
+func (db *StarDB) remVal(key []byte) error{
+	e := storage.NewEntryNoExtra(key, nil, String, StringRem)
+	if err := db.store(e); err != nil{
+		return err
+	}
+
+	db.incrReclaimableSpace(key)
+	db.strIndex.idxList.Remove(key)
+	delete(db.strIndex.bitmaps, string(key))
+	delete(db.expires[String], string(key))
+	return nil
+}
+
+//回收时将bitmap合并为一条完整的set日志, key不是bitmap时返回nil
+//合并后的日志包含最终的值, 之后的SETBIT日志重放时结果不变
+func (db *StarDB) bitmapSnapshot(e *storage.Entry) *storage.Entry{
+	//回收与写入同时进行, 修改bitmaps需要持有strIndex.mu
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	key := string(e.Meta.Key)
+	if _, ok := db.strIndex.bitmaps[key]; !ok{
+		return nil
+	}
+	if deadline, exist := db.expires[String][key]; exist && deadline <= time.Now().Unix(){
+		return nil
+	}
+
+	node := db.strIndex.idxList.Get(e.Meta.Key)
+	if node == nil{
+		return nil
+	}
+	delete(db.strIndex.bitmaps, key)
+	return storage.NewEntryNoExtra(e.Meta.Key, node.Value().(*index.Indexer).Meta.Value, String, StringSet)
+}
+
+//回收后更新string索引指向的位置
+func (db *StarDB) resetStrIndexer(e *storage.Entry, fileId uint32, offset int64){
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.Unlock()
+
+	if e.GetMark() == StringBlobChunk{
+		if c := db.blobChunkOf(e); c != nil{
+			c.fileId, c.offset, c.size = fileId, offset, e.Size()
+		}
+		return
+	}
+	if mark := e.GetMark(); mark != StringSet && mark != StringPersist && mark != StringMSet && mark != StringBlobManifest{
+		return
+	}
+
+	if item := db.strIndex.idxList.Get(e.Meta.Key); item != nil{
+		idx := item.Value().(*index.Indexer)
+		idx.FileId = fileId
+		idx.Offset = offset
+		idx.EntrySize = e.Size()
+	}
+}
+
+//bitmap按字节从高位到低位编号
+func getBit(val []byte, offset int) int{
+	if offset >> 3 >= len(val){
+		return 0
+	}
+	return int(val[offset >> 3] >> (7 - uint(offset & 7))) & 1
+}
+
+//返回设置bit后的新值, 不修改原来的值
+func setBit(val []byte, offset, bit int) []byte{
+	size := len(val)
+	if offset >> 3 >= size{
+		size = offset >> 3 + 1
+	}
+	newVal := make([]byte, size)
+	copy(newVal, val)
+
+	mask := byte(1) << (7 - uint(offset & 7))
+	if bit == 1{
+		newVal[offset >> 3] |= mask
+	}else{
+		newVal[offset >> 3] &^= mask
+	}
+	return newVal
+}
+
+func byteAt(val []byte, i int) byte{
+	if i < len(val){
+		return val[i]
+	}
+	return 0
+}
+
+/*
+ *将start和end转换为合法的位置, 单位为字节时返回字节位置, 否则返回bit位置
+ *范围为空时ok为false
+ */
+func bitRange(length, start, end int, unit BitUnit)(int, int, bool){
+	if unit == BitUnitBit{
+		length <<= 3
+	}
+	if start < 0{
+		start += length
+	}
+	if end < 0{
+		end += length
+	}
+	if start < 0{
+		start = 0
+	}
+	if end >= length{
+		end = length - 1
+	}
+	return start, end, length > 0 && end >= 0 && start <= end
+}
@@ -0,0 +1,636 @@
+package stardb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math"
+	"os"
+	"stardb/storage"
+	"stardb/vfs"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestStarDB_SetBit(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	key := []byte("dau")
+	old, err := db.SetBit(key, 7, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, old)
+	old, err = db.SetBit(key, 7, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, old)
+
+	_, err = db.SetBit(key, 20, 1)
+	assert.Nil(t, err)
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01, 0x00, 0x08}, val)
+	assert.Equal(t, 3, db.StrLen(key))
+
+	bit, err := db.GetBit(key, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, bit)
+	bit, _ = db.GetBit(key, 1000)
+	assert.Equal(t, 0, bit)
+
+	_, err = db.SetBit(key, -1, 1)
+	assert.Equal(t, ErrBitOffsetInvalid, err)
+	_, err = db.SetBit(key, 1, 2)
+	assert.Equal(t, ErrBitValueInvalid, err)
+}
+
+func TestStarDB_BitCount(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	key := []byte("foobar")
+	assert.Nil(t, db.Set(key, []byte("foobar")))
+
+	count, _ := db.BitCount(key, 0, -1, BitUnitByte)
+	assert.Equal(t, 26, count)
+	count, _ = db.BitCount(key, 1, 1, BitUnitByte)
+	assert.Equal(t, 6, count)
+	count, _ = db.BitCount(key, 5, 30, BitUnitBit)
+	assert.Equal(t, 17, count)
+	count, _ = db.BitCount([]byte("missing"), 0, -1, BitUnitByte)
+	assert.Equal(t, 0, count)
+}
+
+func TestStarDB_BitPos(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	key := []byte("bits")
+	assert.Nil(t, db.Set(key, []byte{0xff, 0xf0, 0x00}))
+
+	pos, _ := db.BitPos(key, 0, 0, -1, BitUnitByte, false)
+	assert.Equal(t, 12, pos)
+	pos, _ = db.BitPos(key, 1, 2, -1, BitUnitByte, false)
+	assert.Equal(t, -1, pos)
+	pos, _ = db.BitPos(key, 1, 7, 15, BitUnitBit, true)
+	assert.Equal(t, 7, pos)
+
+	assert.Nil(t, db.Set(key, []byte{0xff, 0xff}))
+	pos, _ = db.BitPos(key, 0, 0, -1, BitUnitByte, false)
+	assert.Equal(t, 16, pos)
+	pos, _ = db.BitPos(key, 0, 0, -1, BitUnitByte, true)
+	assert.Equal(t, -1, pos)
+	pos, _ = db.BitPos([]byte("missing"), 0, 0, -1, BitUnitByte, false)
+	assert.Equal(t, 0, pos)
+}
+
+func TestStarDB_BitOp(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	assert.Nil(t, db.Set([]byte("a"), []byte{0x0f, 0xff}))
+	assert.Nil(t, db.Set([]byte("b"), []byte{0xf1}))
+
+	n, err := db.BitOp(BitAnd, []byte("dest"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	val, _ := db.Get([]byte("dest"))
+	assert.Equal(t, []byte{0x01, 0x00}, val)
+
+	db.BitOp(BitOr, []byte("dest"), []byte("a"), []byte("b"))
+	val, _ = db.Get([]byte("dest"))
+	assert.Equal(t, []byte{0xff, 0xff}, val)
+
+	db.BitOp(BitXor, []byte("dest"), []byte("a"), []byte("b"))
+	val, _ = db.Get([]byte("dest"))
+	assert.Equal(t, []byte{0xfe, 0xff}, val)
+
+	db.BitOp(BitNot, []byte("dest"), []byte("b"))
+	val, _ = db.Get([]byte("dest"))
+	assert.Equal(t, []byte{0x0e}, val)
+
+	_, err = db.BitOp(BitNot, []byte("dest"), []byte("a"), []byte("b"))
+	assert.Equal(t, ErrBitOpKeys, err)
+
+	n, err = db.BitOp(BitAnd, []byte("dest"), []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, db.StrExists([]byte("dest")))
+}
+
+func TestStarDB_SetBitReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.IdxMode = KeyOnlyMemMode
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	key := []byte("dau")
+	assert.Nil(t, db.Set(key, []byte{0x80}))
+	for i := 8; i < 64; i += 3{
+		_, err = db.SetBit(key, i, 1)
+		assert.Nil(t, err)
+	}
+	_, err = db.SetBit(key, 0, 0)
+	assert.Nil(t, err)
+	want, _ := db.Get(key)
+
+	//从SETBIT日志恢复
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, want, val)
+
+	//回收后bitmap合并为完整的值
+	assert.Nil(t, db.Reclaim())
+	val, _ = db.Get(key)
+	assert.Equal(t, want, val)
+	_, err = db.SetBit(key, 1, 1)
+	assert.Nil(t, err)
+	want, _ = db.Get(key)
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	val, _ = db.Get(key)
+	assert.Equal(t, want, val)
+	db.Close()
+}
+
+//回收与读取同时进行, 用-race检查bitmaps的访问
+func TestStarDB_BitmapReclaimConcurrent(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	for i := 0; i < 20; i++{
+		_, err = db.SetBit([]byte("bm" + strconv.Itoa(i)), i, 1)
+		assert.Nil(t, err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++{
+			_, _ = db.GetRange([]byte("bm" + strconv.Itoa(i % 20)), 0, -1)
+		}
+	}()
+	assert.Nil(t, db.Reclaim())
+	wg.Wait()
+
+	for i := 0; i < 20; i++{
+		bit, err := db.GetBit([]byte("bm" + strconv.Itoa(i)), i)
+		assert.Nil(t, err)
+		assert.Equal(t, 1, bit)
+	}
+}
+
+func TestStarDB_PFAdd(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key := []byte("visitors")
+	updated, err := db.PFAdd(key)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+
+	updated, err = db.PFAdd(key, []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	updated, _ = db.PFAdd(key, []byte("a"))
+	assert.False(t, updated)
+
+	count, err := db.PFCount(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+
+	val, _ := db.Get(key)
+	assert.Equal(t, []byte("HYLL"), val[:4])
+
+	//修改寄存器不会清除过期时间, 重新打开后同样保留
+	assert.Nil(t, db.Expire(key, 100))
+	updated, err = db.PFAdd(key, []byte("d"))
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	assert.True(t, db.TTL(key) > 0)
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+	assert.True(t, db.TTL(key) > 0)
+
+	assert.Nil(t, db.Set([]byte("plain"), []byte("value")))
+	_, err = db.PFAdd([]byte("plain"), []byte("a"))
+	assert.Equal(t, ErrInvalidHLL, err)
+}
+
+func TestStarDB_PFMerge(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	db.PFAdd([]byte("h1"), []byte("a"), []byte("b"), []byte("c"))
+	db.PFAdd([]byte("h2"), []byte("c"), []byte("d"))
+
+	count, err := db.PFCount([]byte("h1"), []byte("h2"), []byte("missing"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, count)
+
+	assert.Nil(t, db.PFMerge([]byte("dest"), []byte("h1"), []byte("h2")))
+	count, _ = db.PFCount([]byte("dest"))
+	assert.Equal(t, 4, count)
+
+	//h1本身没有被PFCount修改
+	count, _ = db.PFCount([]byte("h1"))
+	assert.Equal(t, 3, count)
+
+	assert.Nil(t, db.Expire([]byte("dest"), 100))
+	assert.Nil(t, db.PFMerge([]byte("dest"), []byte("h1")))
+	assert.True(t, db.TTL([]byte("dest")) > 0)
+}
+
+func TestStarDB_IncrBy(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key := []byte("counter")
+	val, err := db.Incr(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), val)
+	val, err = db.IncrBy(key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), val)
+	val, err = db.Decr(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), val)
+
+	//并发自增不会丢失更新
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++{
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++{
+				_, _ = db.Incr(key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, err = db.IncrBy([]byte("max"), math.MaxInt64)
+	assert.Nil(t, err)
+	_, err = db.Incr([]byte("max"))
+	assert.Equal(t, ErrIncrOverflow, err)
+	_, err = db.DecrBy(key, math.MinInt64)
+	assert.Equal(t, ErrIncrOverflow, err)
+
+	assert.Nil(t, db.Set([]byte("name"), []byte("star")))
+	_, err = db.Incr([]byte("name"))
+	assert.Equal(t, ErrValueNotInteger, err)
+
+	//重新打开后从日志恢复
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+	v, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "510", string(v))
+}
+
+func TestStarDB_IncrByFloat(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	key := []byte("price")
+	assert.Nil(t, db.Set(key, []byte("10.50")))
+	assert.Nil(t, db.Expire(key, 100))
+
+	val, err := db.IncrByFloat(key, 0.1)
+	assert.Nil(t, err)
+	assert.Equal(t, 10.6, val)
+	val, err = db.IncrByFloat(key, -5)
+	assert.Nil(t, err)
+	assert.Equal(t, 5.6, val)
+	v, _ := db.Get(key)
+	assert.Equal(t, "5.6", string(v))
+	assert.True(t, db.TTL(key) > 0)
+
+	_, err = db.IncrByFloat(key, math.Inf(1))
+	assert.Equal(t, ErrIncrNaNOrInf, err)
+	assert.Nil(t, db.Set(key, []byte("abc")))
+	_, err = db.IncrByFloat(key, 1)
+	assert.Equal(t, ErrValueNotFloat, err)
+}
+
+func TestStarDB_MSet(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	err := db.MSet([]byte("k1"), []byte("v1"), []byte("k2"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.Equal(t, ErrInvalidPairs, db.MSet([]byte("k3")))
+
+	ok, err := db.MSetNx([]byte("k2"), []byte("x"), []byte("k3"), []byte("v3"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.MSetNx([]byte("k3"), []byte("v3"), []byte("k4"), []byte("v4"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	//模拟写入一组MSET日志的中途崩溃
+	for i := 0; i < 2; i++{
+		extra := []byte(strconv.Itoa(i) + ExtraSeparator + "3")
+		e := storage.NewEntry([]byte("torn" + strconv.Itoa(i)), []byte("v"), extra, String, StringMSet)
+		assert.Nil(t, db.store(e))
+	}
+	assert.Nil(t, db.Set([]byte("k1"), []byte("new")))
+
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+
+	vals, err := db.MGet([]byte("k1"), []byte("k2"), []byte("k3"), []byte("torn0"), []byte("none"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("new"), []byte("v2"), []byte("v3"), nil, nil}, vals)
+}
+
+func TestStarDB_MSetReclaim(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.IdxMode = KeyOnlyMemMode
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	//回收后组内剩余的日志仍然有效
+	assert.Nil(t, db.MSet([]byte("a"), []byte("1"), []byte("b"), []byte("2"), []byte("c"), []byte("3")))
+	for i := 0; i < 10; i++{
+		assert.Nil(t, db.Set([]byte("b"), []byte(strconv.Itoa(i))))
+	}
+	assert.Nil(t, db.Reclaim())
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	vals, err := db.MGet([]byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("9"), []byte("3")}, vals)
+	db.Close()
+}
+
+//回收保留没有过期时间的key, 回收后的索引指向写入的文件, 读取不依赖内存中的值
+func TestStarDB_StrReclaim(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.IdxMode = KeyOnlyMemMode
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	for i := 0; i < 20; i++{
+		assert.Nil(t, db.Set([]byte("key-" + strconv.Itoa(i)), []byte("value-" + strconv.Itoa(i))))
+	}
+	for i := 0; i < 20; i += 2{
+		assert.Nil(t, db.Set([]byte("key-" + strconv.Itoa(i)), []byte("new-" + strconv.Itoa(i))))
+	}
+	assert.Nil(t, db.Expire([]byte("key-1"), 100))
+	assert.Nil(t, db.Reclaim())
+
+	check := func() {
+		for i := 0; i < 20; i++{
+			expected := "value-" + strconv.Itoa(i)
+			if i % 2 == 0{
+				expected = "new-" + strconv.Itoa(i)
+			}
+			val, err := db.Get([]byte("key-" + strconv.Itoa(i)))
+			assert.Nil(t, err)
+			assert.Equal(t, expected, string(val))
+		}
+		assert.True(t, db.TTL([]byte("key-1")) > 0)
+	}
+	check()
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	check()
+}
+
+func TestStarDB_SetWithOption(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	key := []byte("lock")
+	old, ok, err := db.SetWithOption(key, []byte("a"), SetOption{XX: true})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, old)
+
+	_, ok, err = db.SetWithOption(key, []byte("a"), SetOption{NX: true, Expire: 100})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.True(t, db.TTL(key) > 0)
+
+	old, ok, err = db.SetWithOption(key, []byte("b"), SetOption{NX: true, Get: true})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, "a", string(old))
+
+	old, ok, err = db.SetWithOption(key, []byte("c"), SetOption{XX: true, Get: true, KeepTTL: true})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "a", string(old))
+	assert.True(t, db.TTL(key) > 0)
+
+	_, _, err = db.SetWithOption(key, []byte("d"), SetOption{NX: true, XX: true})
+	assert.Equal(t, ErrInvalidSetOption, err)
+
+	assert.Nil(t, db.SetEx([]byte("session"), []byte("s"), 10))
+	assert.True(t, db.TTL([]byte("session")) > 0)
+	assert.Equal(t, ErrInvalidTTL, db.SetEx([]byte("session"), []byte("s"), 0))
+}
+
+//重新打开后set清除过期时间, 保留过期时间的写入仍然保留
+func TestStarDB_SetTTLReopen(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	plain, keep, incr := []byte("plain"), []byte("keep"), []byte("counter")
+	for _, key := range [][]byte{plain, keep, incr}{
+		assert.Nil(t, db.Set(key, []byte("1")))
+		assert.Nil(t, db.Expire(key, 100))
+	}
+
+	assert.Nil(t, db.Set(plain, []byte("2")))
+	assert.Equal(t, int64(0), db.TTL(plain))
+	_, _, err := db.SetWithOption(keep, []byte("2"), SetOption{KeepTTL: true})
+	assert.Nil(t, err)
+	_, err = db.Incr(incr)
+	assert.Nil(t, err)
+
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+
+	assert.Equal(t, int64(0), db.TTL(plain))
+	assert.True(t, db.TTL(keep) > 0)
+	assert.True(t, db.TTL(incr) > 0)
+	val, err := db.Get(incr)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", string(val))
+}
+
+func TestStarDB_GetRange(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.IdxMode = KeyOnlyMemMode
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	key := []byte("greeting")
+	assert.Nil(t, db.Set(key, []byte("Hello World")))
+	n, err := db.SetRange(key, 6, []byte("Redis"))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, n)
+	n, err = db.SetRange([]byte("padded"), 3, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	_, err = db.SetRange(key, -1, []byte("x"))
+	assert.Equal(t, ErrOffsetInvalid, err)
+
+	//重新打开后只从数据文件读取需要的部分
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	val, err := db.GetRange(key, 0, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, "Hello", string(val))
+	val, _ = db.GetRange(key, -5, -1)
+	assert.Equal(t, "Redis", string(val))
+	val, _ = db.GetRange(key, 5, 100)
+	assert.Equal(t, " Redis", string(val))
+	val, _ = db.GetRange(key, 8, 3)
+	assert.Equal(t, 0, len(val))
+	val, _ = db.GetRange([]byte("padded"), 0, -1)
+	assert.Equal(t, []byte{0, 0, 0, 'x'}, val)
+	val, _ = db.GetRange([]byte("none"), 0, -1)
+	assert.Equal(t, 0, len(val))
+}
+
+func TestStarDB_GetEx(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key := []byte("token")
+	assert.Nil(t, db.Set(key, []byte("t1")))
+
+	val, err := db.GetEx(key, 100, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "t1", string(val))
+	assert.True(t, db.TTL(key) > 0)
+	_, err = db.GetEx(key, 0, true)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), db.TTL(key))
+
+	val, err = db.GetDel(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "t1", string(val))
+	_, err = db.GetDel(key)
+	assert.Equal(t, ErrKeyNotExist, err)
+
+	//重新打开后key仍然是删除的状态
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+	assert.False(t, db.StrExists(key))
+}
+
+func TestStarDB_ValueCache(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.IdxMode = KeyOnlyMemMode
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	key := []byte("hot")
+	assert.Nil(t, db.Set(key, []byte("v1")))
+	for i := 0; i < 3; i++{
+		val, err := db.Get(key)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("v1"), val)
+	}
+	stats := db.ValueCacheStats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, 1, stats.Len)
+
+	//覆盖后旧的值从缓存中删除
+	assert.Nil(t, db.Set(key, []byte("v2")))
+	assert.Equal(t, 0, db.ValueCacheStats().Len)
+	val, _ := db.Get(key)
+	assert.Equal(t, []byte("v2"), val)
+
+	//回收后文件id被复用, 缓存需要清空
+	for i := 0; i < 20; i++{
+		k := []byte(strconv.Itoa(i))
+		assert.Nil(t, db.Set(k, []byte("old")))
+		_, _ = db.Get(k)
+		assert.Nil(t, db.Set(k, []byte("new" + strconv.Itoa(i))))
+		_, _ = db.Get(k)
+	}
+	assert.Nil(t, db.Reclaim())
+	assert.Equal(t, 0, db.ValueCacheStats().Len)
+	for i := 0; i < 20; i++{
+		val, err := db.Get([]byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("new" + strconv.Itoa(i)), val)
+	}
+	val, _ = db.Get(key)
+	assert.Equal(t, []byte("v2"), val)
+}
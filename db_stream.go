@@ -0,0 +1,677 @@
+package stardb
+
+import (
+	"stardb/ds/stream"
+	"stardb/storage"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type (
+	// StreamIdx stream 索引
+	StreamIdx struct {
+		mu 		 idxMutex
+		indexes  *stream.Stream
+		blocked  map[string][]chan struct{}   //阻塞在每个key上等待新消息的客户端
+		closed   bool
+	}
+
+	// StreamEntries 从一个stream key中读到的消息
+	StreamEntries struct {
+		Key 	[]byte
+		Entries []*stream.Entry
+	}
+)
+
+func newStreamIdx() *StreamIdx{
+	return &StreamIdx{indexes: stream.New(), blocked: make(map[string][]chan struct{})}
+}
+
+// XAdd 向stream追加一条消息, id为"*"时自动生成, 为"ms-*"时自动生成序号
+// fields为field和value交替排列, 返回消息的id
+func (db *StarDB) XAdd(key []byte, id string, fields ...[]byte)(_ string, err error){
+	if err := db.checkKeyValue(key, fields...); err != nil{
+		return "", err
+	}
+	if len(fields) == 0 || len(fields) % 2 != 0{
+		return "", ErrStreamInvalidFields
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.unlock(&err)
+
+	var newID stream.ID
+	switch {
+	case id == "*":
+		newID = db.streamIndex.indexes.NextID(string(key), uint64(nowMilli()))
+	case strings.HasSuffix(id, "-*"):
+		ms, e := strconv.ParseUint(strings.TrimSuffix(id, "-*"), 10, 64)
+		if e != nil{
+			return "", ErrStreamInvalidID
+		}
+		var ok bool
+		if newID, ok = db.streamIndex.indexes.NextSeq(string(key), ms); !ok{
+			return "", ErrStreamIDTooSmall
+		}
+	default:
+		if newID, err = stream.ParseID(id); err != nil{
+			return "", ErrStreamInvalidID
+		}
+	}
+	if !db.streamIndex.indexes.LastID(string(key)).Less(newID){
+		return "", ErrStreamIDTooSmall
+	}
+
+	e := storage.NewEntry(key, storage.EncodeValues(fields), []byte(newID.String()), Stream, StreamXAdd)
+	if err = db.store(e); err != nil{
+		return "", err
+	}
+
+	db.streamIndex.indexes.XAdd(string(key), newID, fields)
+	db.streamIndex.notify(key)
+	return newID.String(), nil
+}
+
+func (db *StarDB) XLen(key []byte) int{
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return 0
+	}
+
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	return db.streamIndex.indexes.XLen(string(key))
+}
+
+func (db *StarDB) XKeyExists(key []byte) bool{
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return false
+	}
+
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	return db.streamIndex.indexes.XKeyExists(string(key))
+}
+
+// XRange 返回id在start和end之间的消息, 支持 - + 和 ( 开区间, count <= 0 时不限制数量
+func (db *StarDB) XRange(key []byte, start, end string, count int)([]*stream.Entry, error){
+	return db.xRange(key, start, end, count, false)
+}
+
+// XRevRange 同XRange, 按id从大到小返回
+func (db *StarDB) XRevRange(key []byte, end, start string, count int)([]*stream.Entry, error){
+	return db.xRange(key, start, end, count, true)
+}
+
+func (db *StarDB) XDel(key []byte, ids ...string)(res int, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	streamIDs, err := parseStreamIDs(ids)
+	if err != nil{
+		return
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.unlock(&err)
+
+	for _, id := range streamIDs{
+		if db.streamIndex.indexes.Get(string(key), id) == nil{
+			continue
+		}
+
+		e := storage.NewEntry(key, nil, []byte(id.String()), Stream, StreamXDel)
+		if err = db.store(e); err != nil{
+			return
+		}
+		db.streamIndex.indexes.XDel(string(key), id)
+		res++
+	}
+	return
+}
+
+// XTrim 只保留最新的maxLen条消息, 返回删除的消息数量
+func (db *StarDB) XTrim(key []byte, maxLen int)(res int, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	if maxLen < 0{
+		return 0, ErrStreamInvalidMaxLen
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.unlock(&err)
+
+	if db.streamIndex.indexes.XLen(string(key)) <= maxLen{
+		return
+	}
+
+	e := storage.NewEntry(key, nil, []byte(strconv.Itoa(maxLen)), Stream, StreamXTrim)
+	if err = db.store(e); err != nil{
+		return
+	}
+	return db.streamIndex.indexes.XTrim(string(key), maxLen), nil
+}
+
+// XTrimMinID 删除id小于minID的消息, 返回删除的消息数量
+func (db *StarDB) XTrimMinID(key []byte, minID string)(res int, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	id, err := stream.ParseID(minID)
+	if err != nil{
+		return 0, ErrStreamInvalidID
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.unlock(&err)
+
+	if len(db.streamIndex.indexes.XRange(string(key), stream.ID{}, id, 1)) == 0{
+		return
+	}
+
+	e := storage.NewEntry(key, nil, []byte(id.String()), Stream, StreamXTrimMinID)
+	if err = db.store(e); err != nil{
+		return
+	}
+	return db.streamIndex.indexes.XTrimMinID(string(key), id), nil
+}
+
+// XRead 读取每个key中id大于对应ids的消息, id为"$"表示stream当前最后的id
+func (db *StarDB) XRead(keys [][]byte, ids []string, count int)([]StreamEntries, error){
+	return db.xRead(keys, ids, count, false, 0)
+}
+
+// XReadBlock 同XRead, 没有消息时阻塞直到有新消息或超时, timeout为0时一直阻塞
+func (db *StarDB) XReadBlock(timeout time.Duration, keys [][]byte, ids []string, count int)([]StreamEntries, error){
+	return db.xRead(keys, ids, count, true, timeout)
+}
+
+// XGroupCreate 创建消费组, id为"$"表示只消费之后写入的消息, mkStream为true时stream不存在会被创建
+func (db *StarDB) XGroupCreate(key, group []byte, id string, mkStream bool)(err error){
+	if err = db.checkKeyValue(key, group); err != nil{
+		return
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.unlock(&err)
+
+	if !mkStream && !db.streamIndex.indexes.XKeyExists(string(key)){
+		return ErrKeyNotExist
+	}
+	if db.streamIndex.indexes.XGroupExists(string(key), string(group)){
+		return ErrStreamGroupExists
+	}
+
+	startID := db.streamIndex.indexes.LastID(string(key))
+	if id != "$"{
+		if startID, err = stream.ParseID(id); err != nil{
+			return ErrStreamInvalidID
+		}
+	}
+
+	e := storage.NewEntry(key, group, []byte(startID.String()), Stream, StreamXGroupCreate)
+	if err = db.store(e); err != nil{
+		return
+	}
+	db.streamIndex.indexes.XGroupCreate(string(key), string(group), startID)
+	return
+}
+
+func (db *StarDB) XGroupDestroy(key, group []byte)(ok bool, err error){
+	if err = db.checkKeyValue(key, group); err != nil{
+		return
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.unlock(&err)
+
+	if !db.streamIndex.indexes.XGroupExists(string(key), string(group)){
+		return
+	}
+
+	e := storage.NewEntryNoExtra(key, group, Stream, StreamXGroupDestroy)
+	if err = db.store(e); err != nil{
+		return
+	}
+	return db.streamIndex.indexes.XGroupDestroy(string(key), string(group)), nil
+}
+
+// XGroupDelConsumer 删除消费者, 返回它被删除的待确认消息数量
+func (db *StarDB) XGroupDelConsumer(key, group, consumer []byte)(res int, err error){
+	if err = db.checkKeyValue(key, group, consumer); err != nil{
+		return
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.unlock(&err)
+
+	if !db.streamIndex.indexes.XGroupExists(string(key), string(group)){
+		return 0, ErrStreamGroupNotExist
+	}
+
+	e := storage.NewEntry(key, group, consumer, Stream, StreamXGroupDelConsumer)
+	if err = db.store(e); err != nil{
+		return
+	}
+	return db.streamIndex.indexes.XGroupDelConsumer(string(key), string(group), string(consumer)), nil
+}
+
+// XReadGroup 以消费组的方式读取消息
+// id为">"时读取还未投递给组内任何消费者的消息, 否则读取该消费者已投递未确认且id大于指定id的消息
+// noAck为true时投递的消息不需要确认
+func (db *StarDB) XReadGroup(group, consumer []byte, keys [][]byte, ids []string, count int, noAck bool)([]StreamEntries, error){
+	return db.xReadGroup(group, consumer, keys, ids, count, noAck, false, 0)
+}
+
+// XReadGroupBlock 同XReadGroup, 所有id都为">"且没有新消息时阻塞直到有新消息或超时
+func (db *StarDB) XReadGroupBlock(timeout time.Duration, group, consumer []byte, keys [][]byte, ids []string, count int, noAck bool)([]StreamEntries, error){
+	return db.xReadGroup(group, consumer, keys, ids, count, noAck, true, timeout)
+}
+
+// XAck 确认消息已被处理, 返回确认成功的数量
+func (db *StarDB) XAck(key, group []byte, ids ...string)(res int, err error){
+	if err = db.checkKeyValue(key, group); err != nil{
+		return
+	}
+	streamIDs, err := parseStreamIDs(ids)
+	if err != nil{
+		return
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.unlock(&err)
+
+	var acked []stream.ID
+	for _, id := range streamIDs{
+		if db.streamIndex.indexes.XAck(string(key), string(group), id){
+			acked = append(acked, id)
+		}
+	}
+	if len(acked) > 0{
+		e := storage.NewEntry(key, stream.EncodeIDs(acked), group, Stream, StreamXAck)
+		if err = db.store(e); err != nil{
+			return
+		}
+	}
+	return len(acked), nil
+}
+
+// XPending 返回消费组待确认消息的汇总
+func (db *StarDB) XPending(key, group []byte)(sum stream.PendingSummary, err error){
+	if err = db.checkKeyValue(key, group); err != nil{
+		return
+	}
+
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	if !db.streamIndex.indexes.XGroupExists(string(key), string(group)){
+		return sum, ErrStreamGroupNotExist
+	}
+	return db.streamIndex.indexes.XPending(string(key), string(group)), nil
+}
+
+// XPendingRange 返回id在start和end之间且空闲时间不小于minIdle的待确认消息, consumer不为空时只返回该消费者的消息
+func (db *StarDB) XPendingRange(key, group []byte, start, end string, count int, consumer []byte, minIdle time.Duration)(val []*stream.PendingEntry, err error){
+	if err = db.checkKeyValue(key, group); err != nil{
+		return
+	}
+	startID, err := stream.ParseRangeID(start, false)
+	if err != nil{
+		return nil, ErrStreamInvalidID
+	}
+	endID, err := stream.ParseRangeID(end, true)
+	if err != nil{
+		return nil, ErrStreamInvalidID
+	}
+
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	if !db.streamIndex.indexes.XGroupExists(string(key), string(group)){
+		return nil, ErrStreamGroupNotExist
+	}
+	return db.streamIndex.indexes.XPendingRange(string(key), string(group), startID, endID, count,
+		string(consumer), int64(minIdle / time.Millisecond), nowMilli()), nil
+}
+
+// XClaim 将空闲时间不小于minIdle的待确认消息转移给consumer
+// justID为true时不增加投递次数, 返回的消息只有id
+func (db *StarDB) XClaim(key, group, consumer []byte, minIdle time.Duration, ids []string, justID bool)(val []*stream.Entry, err error){
+	if err = db.checkKeyValue(key, group, consumer); err != nil{
+		return
+	}
+	streamIDs, err := parseStreamIDs(ids)
+	if err != nil{
+		return
+	}
+
+	db.streamIndex.mu.Lock()
+	defer db.streamIndex.mu.unlock(&err)
+
+	if !db.streamIndex.indexes.XGroupExists(string(key), string(group)){
+		return nil, ErrStreamGroupNotExist
+	}
+
+	//只记录空闲时间满足条件的id, 重放时不再需要判断空闲时间
+	now, idle := nowMilli(), int64(minIdle / time.Millisecond)
+	var eligible []stream.ID
+	for _, id := range streamIDs{
+		if len(db.streamIndex.indexes.XPendingRange(string(key), string(group), id, id, 1, "", idle, now)) > 0{
+			eligible = append(eligible, id)
+		}
+	}
+	if len(eligible) == 0{
+		return
+	}
+
+	extra := storage.EncodeValues([][]byte{group, consumer, []byte(strconv.FormatInt(now, 10)), []byte(strconv.FormatBool(justID))})
+	e := storage.NewEntry(key, stream.EncodeIDs(eligible), extra, Stream, StreamXClaim)
+	if err = db.store(e); err != nil{
+		return
+	}
+	claimed := db.streamIndex.indexes.XClaim(string(key), string(group), string(consumer), eligible, 0, now, justID)
+
+	for _, id := range claimed{
+		if justID{
+			val = append(val, &stream.Entry{ID: id})
+		}else{
+			val = append(val, db.streamIndex.indexes.Get(string(key), id))
+		}
+	}
+	return
+}
+
+func (db *StarDB) xRange(key []byte, start, end string, count int, rev bool)(val []*stream.Entry, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	startID, err := stream.ParseRangeID(start, false)
+	if err != nil{
+		return nil, ErrStreamInvalidID
+	}
+	endID, err := stream.ParseRangeID(end, true)
+	if err != nil{
+		return nil, ErrStreamInvalidID
+	}
+
+	db.streamIndex.mu.RLock()
+	defer db.streamIndex.mu.RUnlock()
+
+	if rev{
+		return db.streamIndex.indexes.XRevRange(string(key), endID, startID, count), nil
+	}
+	return db.streamIndex.indexes.XRange(string(key), startID, endID, count), nil
+}
+
+func (db *StarDB) xRead(keys [][]byte, ids []string, count int, block bool, timeout time.Duration)(val []StreamEntries, err error){
+	if err = db.checkStreamKeys(keys, ids); err != nil{
+		return
+	}
+
+	db.streamIndex.mu.Lock()
+	//"$"需要在阻塞前解析为当前最后的id
+	afters := make([]stream.ID, len(ids))
+	for i, id := range ids{
+		if id == "$"{
+			afters[i] = db.streamIndex.indexes.LastID(string(keys[i]))
+		}else if afters[i], err = stream.ParseID(id); err != nil{
+			db.streamIndex.mu.Unlock()
+			return nil, ErrStreamInvalidID
+		}
+	}
+
+	read := func() (res []StreamEntries, err error){
+		for i, k := range keys{
+			if entries := db.streamIndex.indexes.XRead(string(k), afters[i], count); len(entries) > 0{
+				res = append(res, StreamEntries{Key: k, Entries: entries})
+			}
+		}
+		return
+	}
+	return db.readOrBlock(keys, read, block, timeout)
+}
+
+func (db *StarDB) xReadGroup(group, consumer []byte, keys [][]byte, ids []string, count int, noAck, block bool, timeout time.Duration)(val []StreamEntries, err error){
+	if err = db.checkKeyValue(group, consumer); err != nil{
+		return
+	}
+	if err = db.checkStreamKeys(keys, ids); err != nil{
+		return
+	}
+
+	afters := make([]stream.ID, len(ids))
+	for i, id := range ids{
+		if id == ">"{
+			continue
+		}
+		//读取历史消息时不阻塞
+		block = false
+		if afters[i], err = stream.ParseID(id); err != nil{
+			return nil, ErrStreamInvalidID
+		}
+	}
+
+	db.streamIndex.mu.Lock()
+	for _, k := range keys{
+		if !db.streamIndex.indexes.XGroupExists(string(k), string(group)){
+			db.streamIndex.mu.Unlock()
+			return nil, ErrStreamGroupNotExist
+		}
+	}
+
+	read := func() (res []StreamEntries, err error){
+		for i, k := range keys{
+			var entries []*stream.Entry
+			if ids[i] == ">"{
+				if entries, err = db.deliver(k, group, consumer, count, noAck); err != nil{
+					return
+				}
+			}else{
+				entries = db.streamIndex.indexes.XReadGroupPending(string(k), string(group), string(consumer), afters[i], count)
+			}
+			if len(entries) > 0 || ids[i] != ">"{
+				res = append(res, StreamEntries{Key: k, Entries: entries})
+			}
+		}
+		return
+	}
+	return db.readOrBlock(keys, read, block, timeout)
+}
+
+//将还未投递的消息投递给consumer, 调用方需持有streamIndex.mu
+func (db *StarDB) deliver(key, group, consumer []byte, count int, noAck bool)([]*stream.Entry, error){
+	//消费组可能在阻塞期间被删除
+	if !db.streamIndex.indexes.XGroupExists(string(key), string(group)){
+		return nil, ErrStreamGroupNotExist
+	}
+
+	now := nowMilli()
+	entries := db.streamIndex.indexes.XReadGroup(string(key), string(group), string(consumer), count, noAck, now)
+	if len(entries) == 0{
+		return nil, nil
+	}
+
+	ids := make([]stream.ID, len(entries))
+	for i, e := range entries{
+		ids[i] = e.ID
+	}
+	extra := storage.EncodeValues([][]byte{group, consumer, []byte(strconv.FormatInt(now, 10)), []byte(strconv.FormatBool(noAck))})
+	e := storage.NewEntry(key, stream.EncodeIDs(ids), extra, Stream, StreamXReadGroup)
+	if err := db.store(e); err != nil{
+		return nil, err
+	}
+	return entries, nil
+}
+
+//调用方需持有streamIndex.mu, 返回前会释放
+func (db *StarDB) readOrBlock(keys [][]byte, read func()([]StreamEntries, error), block bool, timeout time.Duration)(val []StreamEntries, err error){
+	var timer <-chan time.Time
+	if block && timeout > 0{
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	for {
+		if val, err = read(); err != nil || len(val) > 0 || !block{
+			db.streamIndex.mu.unlock(&err)
+			return
+		}
+		if db.streamIndex.closed{
+			db.streamIndex.mu.Unlock()
+			return nil, ErrDBClosed
+		}
+
+		ch := db.streamIndex.watch(keys)
+		db.streamIndex.mu.Unlock()
+
+		timeouted := false
+		select {
+		case <-ch:
+		case <-timer:
+			timeouted = true
+		}
+
+		db.streamIndex.mu.Lock()
+		db.streamIndex.unwatch(keys, ch)
+		if timeouted{
+			db.streamIndex.mu.Unlock()
+			return nil, nil
+		}
+	}
+}
+
+//回收时已归档的stream日志全部重放到indexes中, 再写成快照替换这些日志
+//快照为每个key仍然存在的消息, 最后的id, 以及每个消费组的投递位置和待确认消息
+//之后活跃文件中的日志在快照之上重放, 与回收之前的结果相同
+func streamSnapshot(indexes *stream.Stream) (entries []*storage.Entry){
+	for _, key := range indexes.Keys(){
+		for _, e := range indexes.XRange(key, stream.ID{}, stream.MaxID, 0){
+			entries = append(entries, storage.NewEntry([]byte(key), storage.EncodeValues(e.Fields), []byte(e.ID.String()), Stream, StreamXAdd))
+		}
+		lastID := indexes.LastID(key)
+		entries = append(entries, storage.NewEntry([]byte(key), nil, []byte(lastID.String()), Stream, StreamXSetID))
+
+		for _, group := range indexes.Groups(key){
+			extra := encodeGroupState(indexes.GroupState(key, group))
+			entries = append(entries, storage.NewEntry([]byte(key), []byte(group), extra, Stream, StreamXGroupSnapshot))
+		}
+	}
+	return
+}
+
+//消费组快照: 最后投递的id, 之后每条待确认消息依次为id consumer 投递时间 投递次数
+func encodeGroupState(lastID stream.ID, pending []*stream.PendingEntry) []byte{
+	fields := [][]byte{[]byte(lastID.String())}
+	for _, pe := range pending{
+		fields = append(fields, []byte(pe.ID.String()), []byte(pe.Consumer),
+			[]byte(strconv.FormatInt(pe.DeliveryTime, 10)), []byte(strconv.Itoa(pe.DeliveryCount)))
+	}
+	return storage.EncodeValues(fields)
+}
+
+func decodeGroupState(buf []byte) (lastID stream.ID, pending []*stream.PendingEntry, err error){
+	fields, err := storage.DecodeValues(buf)
+	if err != nil{
+		return
+	}
+	if len(fields) == 0 || (len(fields) - 1) % 4 != 0{
+		return lastID, nil, stream.ErrInvalidEncoding
+	}
+	if lastID, err = stream.ParseID(string(fields[0])); err != nil{
+		return
+	}
+
+	for i := 1; i < len(fields); i += 4{
+		pe := &stream.PendingEntry{Consumer: string(fields[i+1])}
+		if pe.ID, err = stream.ParseID(string(fields[i])); err != nil{
+			return
+		}
+		if pe.DeliveryTime, err = strconv.ParseInt(string(fields[i+2]), 10, 64); err != nil{
+			return
+		}
+		if pe.DeliveryCount, err = strconv.Atoi(string(fields[i+3])); err != nil{
+			return
+		}
+		pending = append(pending, pe)
+	}
+	return
+}
+
+func (db *StarDB) checkStreamKeys(keys [][]byte, ids []string) error{
+	if len(keys) == 0 || len(keys) != len(ids){
+		return ErrStreamKeysNotMatch
+	}
+	for _, k := range keys{
+		if err := db.checkKeyValue(k, nil); err != nil{
+			return err
+		}
+	}
+	return nil
+}
+
+func (si *StreamIdx) watch(keys [][]byte) chan struct{}{
+	ch := make(chan struct{}, 1)
+	for _, k := range keys{
+		si.blocked[string(k)] = append(si.blocked[string(k)], ch)
+	}
+	return ch
+}
+
+func (si *StreamIdx) unwatch(keys [][]byte, ch chan struct{}){
+	for _, k := range keys{
+		chs := si.blocked[string(k)]
+		for i := 0; i < len(chs); i++{
+			if chs[i] == ch{
+				chs = append(chs[:i], chs[i+1:]...)
+				break
+			}
+		}
+
+		if len(chs) == 0{
+			delete(si.blocked, string(k))
+		}else{
+			si.blocked[string(k)] = chs
+		}
+	}
+}
+
+//唤醒等待key的客户端, 调用方需持有streamIndex.mu
+func (si *StreamIdx) notify(key []byte){
+	for _, ch := range si.blocked[string(key)]{
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//唤醒所有阻塞的客户端
+func (si *StreamIdx) unblockAll(){
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	si.closed = true
+	for k := range si.blocked{
+		si.notify([]byte(k))
+	}
+}
+
+func parseStreamIDs(ids []string)([]stream.ID, error){
+	streamIDs := make([]stream.ID, len(ids))
+	for i, id := range ids{
+		var err error
+		if streamIDs[i], err = stream.ParseID(id); err != nil{
+			return nil, ErrStreamInvalidID
+		}
+	}
+	return streamIDs, nil
+}
+
+func nowMilli() int64{
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,192 @@
+package stardb
+
+import (
+	"github.com/stretchr/testify/assert"
+	"stardb/vfs"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestStarDB_XAdd(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key := []byte("events")
+	id, err := db.XAdd(key, "1-1", []byte("name"), []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1-1", id)
+
+	_, err = db.XAdd(key, "1-1", []byte("name"), []byte("b"))
+	assert.Equal(t, ErrStreamIDTooSmall, err)
+	_, err = db.XAdd(key, "2-1", []byte("name"))
+	assert.Equal(t, ErrStreamInvalidFields, err)
+
+	id, err = db.XAdd(key, "1-*", []byte("name"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, "1-2", id)
+	_, err = db.XAdd(key, "*", []byte("name"), []byte("c"))
+	assert.Nil(t, err)
+
+	entries, err := db.XRange(key, "-", "+", 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, [][]byte{[]byte("name"), []byte("b")}, entries[1].Fields)
+
+	n, err := db.XDel(key, "1-1")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.XTrim(key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	//重新打开后从日志恢复
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, db.XLen(key))
+	entries, _ = db.XRevRange(key, "+", "-", 0)
+	assert.Equal(t, [][]byte{[]byte("name"), []byte("c")}, entries[0].Fields)
+}
+
+func TestStarDB_XReadBlock(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	key := []byte("events")
+	val, err := db.XReadBlock(20*time.Millisecond, [][]byte{key}, []string{"$"}, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, val)
+
+	res := make(chan []StreamEntries, 1)
+	go func() {
+		val, _ := db.XReadBlock(0, [][]byte{key}, []string{"$"}, 0)
+		res <- val
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = db.XAdd(key, "5-0", []byte("k"), []byte("v"))
+	assert.Nil(t, err)
+	val = <-res
+	assert.Equal(t, 1, len(val))
+	assert.Equal(t, "5-0", val[0].Entries[0].ID.String())
+}
+
+func TestStarDB_XReadGroup(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key, group := []byte("jobs"), []byte("workers")
+	assert.Equal(t, ErrKeyNotExist, db.XGroupCreate(key, group, "$", false))
+	assert.Nil(t, db.XGroupCreate(key, group, "$", true))
+	assert.Equal(t, ErrStreamGroupExists, db.XGroupCreate(key, group, "0", false))
+
+	for _, id := range []string{"1-0", "2-0", "3-0"}{
+		_, err := db.XAdd(key, id, []byte("job"), []byte(id))
+		assert.Nil(t, err)
+	}
+
+	val, err := db.XReadGroup(group, []byte("alice"), [][]byte{key}, []string{">"}, 2, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(val[0].Entries))
+	val, err = db.XReadGroup(group, []byte("bob"), [][]byte{key}, []string{">"}, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(val[0].Entries))
+
+	n, err := db.XAck(key, group, "1-0")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	claimed, err := db.XClaim(key, group, []byte("bob"), 0, []string{"2-0"}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(claimed))
+
+	_, err = db.XReadGroup([]byte("none"), []byte("alice"), [][]byte{key}, []string{">"}, 0, false)
+	assert.Equal(t, ErrStreamGroupNotExist, err)
+
+	//重新打开后消费组状态从日志恢复
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+
+	sum, err := db.XPending(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, sum.Count)
+	assert.Equal(t, 2, sum.Consumers["bob"])
+
+	pending, err := db.XPendingRange(key, group, "-", "+", 10, []byte("bob"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pending[0].DeliveryCount)
+
+	val, err = db.XReadGroup(group, []byte("bob"), [][]byte{key}, []string{"0"}, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(val[0].Entries))
+}
+
+func TestStarDB_StreamReclaim(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.BlockSize = 512
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	key, group := []byte("jobs"), []byte("workers")
+	assert.Nil(t, db.XGroupCreate(key, group, "0", true))
+	//反复写入, 消费, 确认和裁剪, 回收之后只剩下快照
+	for i := 1; i <= 50; i++{
+		_, err = db.XAdd(key, strconv.Itoa(i) + "-0", []byte("job"), []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+		_, err = db.XReadGroup(group, []byte("alice"), [][]byte{key}, []string{">"}, 0, false)
+		assert.Nil(t, err)
+		if i % 5 != 0{
+			_, err = db.XAck(key, group, strconv.Itoa(i) + "-0")
+			assert.Nil(t, err)
+		}
+		_, err = db.XTrim(key, 20)
+		assert.Nil(t, err)
+	}
+	_, err = db.XClaim(key, group, []byte("bob"), 0, []string{"45-0"}, false)
+	assert.Nil(t, err)
+	_, err = db.XDel(key, "50-0")
+	assert.Nil(t, err)
+
+	archived := func() (size int64){
+		for _, f := range db.archFiles[Stream]{
+			size += f.Offset
+		}
+		return
+	}
+	before := archived()
+	assert.Nil(t, db.Reclaim())
+	assert.True(t, archived() < before / 4)
+
+	//回收之后的日志在快照之上重放
+	_, err = db.XClaim(key, group, []byte("bob"), 0, []string{"45-0"}, false)
+	assert.Nil(t, err)
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 19, db.XLen(key))
+	_, err = db.XAdd(key, "50-0", []byte("job"), []byte("50"))
+	assert.Equal(t, ErrStreamIDTooSmall, err)
+
+	sum, err := db.XPending(key, group)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, sum.Count)
+	assert.Equal(t, 1, sum.Consumers["bob"])
+	pending, err := db.XPendingRange(key, group, "-", "+", 10, []byte("bob"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, pending[0].DeliveryCount)
+	val, err := db.XReadGroup(group, []byte("alice"), [][]byte{key}, []string{">"}, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(val))
+}
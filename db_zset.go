@@ -2,42 +2,270 @@ package stardb
 
 import (
 	"math"
+	"math/rand"
+	"sort"
 	"stardb/ds/zset"
 	"stardb/storage"
 	"stardb/utils"
-	"sync"
 	"time"
 )
 
-type ZsetIdx struct {
-	mu 		sync.RWMutex
-	indexes *zset.SortedSet
-}
+type (
+	ZsetIdx struct {
+		mu 		idxMutex
+		indexes *zset.SortedSet
+		blocked *waitQueue  //阻塞在key上等待成员的客户端
+	}
+)
+
+// GeoSort GEOSEARCH结果的排序方式
+type GeoSort uint8
+
+const (
+	// GeoSortNone 不排序
+	GeoSortNone GeoSort = iota
+	// GeoSortAsc 按距离从近到远
+	GeoSortAsc
+	// GeoSortDesc 按距离从远到近
+	GeoSortDesc
+)
+
+type (
+	// GeoPoint 经纬度
+	GeoPoint struct {
+		Longitude float64
+		Latitude  float64
+	}
+
+	// GeoMember GEOADD添加的成员
+	GeoMember struct {
+		Longitude float64
+		Latitude  float64
+		Member    []byte
+	}
+
+	// GeoSearchOption GEOSEARCH的查询条件, 距离单位均为米
+	GeoSearchOption struct {
+		FromMember []byte     //以该成员为中心, 为nil时以Longitude和Latitude为中心
+		Longitude  float64
+		Latitude   float64
+		Radius     float64    //大于0时按圆形查询, 否则按Width和Height的矩形查询
+		Width      float64
+		Height     float64
+		Sort       GeoSort
+		Count      int        //大于0时限制返回的数量
+		Any        bool       //为true时找到Count个成员后停止查找, 找到的成员仍按Sort排序
+	}
+
+	// ZMember ZMAdd添加的成员
+	ZMember struct {
+		Score  float64
+		Member []byte
+	}
+
+	// ZAddOption ZADD的可选参数
+	ZAddOption struct {
+		NX bool   //只添加新成员
+		XX bool   //只更新已存在的成员
+		GT bool   //只在新score大于原score时更新, 不影响添加新成员
+		LT bool   //只在新score小于原score时更新, 不影响添加新成员
+		CH bool   //返回score被修改的成员数量, 包括新添加的成员
+	}
+
+	// ZStoreOption ZUNION和ZINTER的可选参数
+	ZStoreOption struct {
+		Weights   []float64      //每个key的score的权重, 为nil时均为1
+		Aggregate zset.Aggregate //同一成员的score的合并方式, 默认为SUM
+	}
+
+	// GeoResult GEOSEARCH的结果
+	GeoResult struct {
+		GeoPoint
+		Member   []byte
+		Distance float64      //到中心的距离, 单位为米
+		Hash     uint64
+	}
+)
 
 func newZsetIdx() *ZsetIdx{
-	return &ZsetIdx{indexes: zset.New()}
+	zi := &ZsetIdx{indexes: zset.New()}
+	zi.blocked = newWaitQueue(&zi.mu)
+	return zi
 }
 
 func (db *StarDB) ZAdd(key []byte, score float64, member []byte)error{
-	if err := db.checkKeyValue(key, member); err != nil{
-		return err
+	_, err := db.ZMAdd(key, ZAddOption{}, ZMember{Score: score, Member: member})
+	return err
+}
+
+// ZMAdd 添加多个成员, 所有修改写入一条日志, 返回新添加的成员数量, opt.CH为true时返回score被修改的成员数量
+// 日志超出一个文件的大小时返回ErrEntryTooLarge, 不添加任何成员
+func (db *StarDB) ZMAdd(key []byte, opt ZAddOption, members ...ZMember)(_ int, err error){
+	if err := opt.check(); err != nil{
+		return 0, err
+	}
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return 0, err
+	}
+	for _, m := range members{
+		if err := db.checkKeyValue(key, m.Member); err != nil{
+			return 0, err
+		}
+		if math.IsNaN(m.Score){
+			return 0, ErrZScoreNaN
+		}
 	}
 
-	if oldScore := db.ZScore(key, member); oldScore == score{
-		return nil
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.unlock(&err)
+
+	db.checkExpired(key, ZSet)
+
+	//同一个成员出现多次时以最后一次为准
+	var added int
+	var changes []ZMember
+	pending := make(map[string]float64)
+	for _, m := range members{
+		old, exist := pending[string(m.Member)]
+		if !exist{
+			old, exist = db.zsetIndex.indexes.ZMemberScore(string(key), string(m.Member))
+		}
+		if !opt.allow(exist, old, m.Score) || (exist && old == m.Score){
+			continue
+		}
+		if !exist{
+			added++
+		}
+		pending[string(m.Member)] = m.Score
+		changes = append(changes, m)
+	}
+	if len(changes) == 0{
+		return 0, nil
+	}
+
+	var e *storage.Entry
+	if len(changes) == 1{
+		extra := []byte(utils.Float64ToStr(changes[0].Score))
+		e = storage.NewEntry(key, changes[0].Member, extra, ZSet, ZSetZAdd)
+	}else{
+		fields := make([][]byte, 0, len(changes) * 2)
+		for _, m := range changes{
+			fields = append(fields, m.Member, []byte(utils.Float64ToStr(m.Score)))
+		}
+		e = storage.NewEntryNoExtra(key, storage.EncodeValues(fields), ZSet, ZSetZMAdd)
+	}
+	if err := db.store(e); err != nil{
+		return 0, err
+	}
+
+	for _, m := range changes{
+		db.zsetIndex.indexes.ZAdd(string(key), m.Score, string(m.Member))
+	}
+	n := added
+	if opt.CH{
+		//同一成员多次修改只计一次
+		n = len(pending)
+	}
+	return n, db.zServeBlocked(key)
+}
+
+// ZAddIncr 同ZADD的INCR选项, 给成员的score加上increment并返回新的score, 不满足opt的条件时ok为false
+func (db *StarDB) ZAddIncr(key []byte, opt ZAddOption, increment float64, member []byte)(score float64, ok bool, err error){
+	if err = opt.check(); err != nil{
+		return
+	}
+	if err = db.checkKeyValue(key, member); err != nil{
+		return
 	}
 
 	db.zsetIndex.mu.Lock()
-	defer db.zsetIndex.mu.Unlock()
+	defer db.zsetIndex.mu.unlock(&err)
+
+	db.checkExpired(key, ZSet)
+
+	old, exist := db.zsetIndex.indexes.ZMemberScore(string(key), string(member))
+	if score = old + increment; math.IsNaN(score){
+		return 0, false, ErrZScoreNaN
+	}
+	if !opt.allow(exist, old, score){
+		return 0, false, nil
+	}
+	if exist && old == score{
+		return score, true, nil
+	}
 
 	extra := []byte(utils.Float64ToStr(score))
 	e := storage.NewEntry(key, member, extra, ZSet, ZSetZAdd)
-	if err := db.store(e); err != nil{
-		return err
+	if err = db.store(e); err != nil{
+		return
 	}
 
 	db.zsetIndex.indexes.ZAdd(string(key), score, string(member))
-	return nil
+	return score, true, db.zServeBlocked(key)
+}
+
+// ZMScore 返回多个成员的score, 不存在的成员对应nil
+func (db *StarDB) ZMScore(key []byte, members ...[]byte) []*float64{
+	res := make([]*float64, len(members))
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return res
+	}
+
+	for i, m := range members{
+		if score, ok := db.zsetIndex.indexes.ZMemberScore(string(key), string(m)); ok{
+			res[i] = &score
+		}
+	}
+	return res
+}
+
+/*
+ *随机返回成员, withScores为true时每个成员后跟着它的score
+ *count大于0时返回不重复的min(count, ZCard)个成员, 小于0时返回|count|个可能重复的成员
+ */
+func (db *StarDB) ZRandMember(key []byte, count int, withScores bool) []interface{}{
+	if err := db.checkKeyValue(key, nil); err != nil || count == 0{
+		return nil
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return nil
+	}
+
+	all := db.zsetIndex.indexes.ZRangeWithScores(string(key), 0, -1)
+	n := len(all) / 2
+	if n == 0{
+		return nil
+	}
+
+	var picked []int
+	if count > 0{
+		picked = rand.Perm(n)
+		if count < n{
+			picked = picked[:count]
+		}
+	}else{
+		picked = make([]int, -count)
+		for i := range picked{
+			picked[i] = rand.Intn(n)
+		}
+	}
+
+	res := make([]interface{}, 0, len(picked) * 2)
+	for _, i := range picked{
+		res = append(res, all[2*i])
+		if withScores{
+			res = append(res, all[2*i+1])
+		}
+	}
+	return res
 }
 
 func (db *StarDB) ZCard(key []byte) int {
@@ -93,13 +321,13 @@ func (db *StarDB) ZRevRank(key, member []byte) int64{
 	return db.zsetIndex.indexes.ZRevRank(string(key), string(member))
 }
 
-func (db *StarDB) ZIncrBy(key []byte, increment float64, member[]byte)(float64, error){
+func (db *StarDB) ZIncrBy(key []byte, increment float64, member[]byte)(_ float64, err error){
 	if err := db.checkKeyValue(key, member); err != nil{
 		return increment, err
 	}
 
 	db.zsetIndex.mu.Lock()
-	defer db.zsetIndex.mu.Unlock()
+	defer db.zsetIndex.mu.unlock(&err)
 
 	increment = db.zsetIndex.indexes.ZIncrBy(string(key), increment, string(member))
 
@@ -109,7 +337,7 @@ func (db *StarDB) ZIncrBy(key []byte, increment float64, member[]byte)(float64,
 		return increment, err
 	}
 
-	return increment, nil
+	return increment, db.zServeBlocked(key)
 }
 
 func (db *StarDB) ZRange(key []byte, start, stop int)[]interface{}{
@@ -177,9 +405,8 @@ func (db *StarDB) ZRem(key, member []byte)(ok bool, err error){
 		return false, err
 	}
 
-	db.zsetIndex.mu.RLock()
-	defer db.zsetIndex.mu.RUnlock()
-
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.unlock(&err)
 
 	if  db.zsetIndex.indexes.ZRem(string(key), string(member)){
 		e := storage.NewEntryNoExtra(key, member, ZSet, ZSetZRem)
@@ -267,7 +494,7 @@ func (db *StarDB) ZKeyExists(key []byte)(ok bool){
 }
 
 func (db *StarDB) ZClear(key []byte)(err error){
-	if err := db.checkKeyValue(key, nil); err != nil{
+	if err = db.checkKeyValue(key, nil); err != nil{
 		return
 	}
 
@@ -276,8 +503,8 @@ func (db *StarDB) ZClear(key []byte)(err error){
 		return
 	}
 
-	db.zsetIndex.mu.RLock()
-	defer db.zsetIndex.mu.RUnlock()
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.unlock(&err)
 
 	e := storage.NewEntryNoExtra(key, nil, ZSet, ZSetZClear)
 	if err = db.store(e); err != nil{
@@ -297,7 +524,7 @@ func (db *StarDB) ZExpire(key []byte, duration int64)(err error){
 	}
 
 	db.zsetIndex.mu.Lock()
-	defer db.zsetIndex.mu.Unlock()
+	defer db.zsetIndex.mu.unlock(&err)
 
 	deadline := time.Now().Unix() + duration
 	e := storage.NewEntryWithExpire(key, nil, deadline, ZSet, ZSetZExpire)
@@ -324,4 +551,598 @@ func (db *StarDB) ZTTL(key []byte)(ttl int64){
 	}
 
 	return deadline - time.Now().Unix()
-}
\ No newline at end of file
+}
+
+// ZCount 返回score在区间r内的成员数量
+func (db *StarDB) ZCount(key []byte, r zset.ScoreRange) int{
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return 0
+	}
+
+	return db.zsetIndex.indexes.ZCount(string(key), r)
+}
+
+// ZRangeByScore 返回score在区间r内的成员和score, 按score从低到高排序
+// 跳过前offset个成员, 最多返回count个成员, count小于0时返回全部
+func (db *StarDB) ZRangeByScore(key []byte, r zset.ScoreRange, offset, count int)[]interface{}{
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return nil
+	}
+
+	return db.zsetIndex.indexes.ZRangeByScore(string(key), r, false, offset, count)
+}
+
+// ZRevRangeByScore 同ZRangeByScore, 按score从高到低排序
+func (db *StarDB) ZRevRangeByScore(key []byte, r zset.ScoreRange, offset, count int)[]interface{}{
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return nil
+	}
+
+	return db.zsetIndex.indexes.ZRangeByScore(string(key), r, true, offset, count)
+}
+
+// ZRemRangeByScore 删除score在区间r内的成员, 返回删除的数量
+func (db *StarDB) ZRemRangeByScore(key []byte, r zset.ScoreRange)(_ int, err error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return 0, err
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.unlock(&err)
+
+	if db.checkExpired(key, ZSet){
+		return 0, nil
+	}
+
+	pairs := db.zsetIndex.indexes.ZRangeByScore(string(key), r, false, 0, -1)
+	return len(pairs) / 2, db.zRemPairs(key, pairs)
+}
+
+// ZRemRangeByRank 删除排名在start和stop之间的成员, 支持负数索引, 返回删除的数量
+func (db *StarDB) ZRemRangeByRank(key []byte, start, stop int)(_ int, err error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return 0, err
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.unlock(&err)
+
+	if db.checkExpired(key, ZSet){
+		return 0, nil
+	}
+
+	pairs := db.zsetIndex.indexes.ZRangeWithScores(string(key), start, stop)
+	return len(pairs) / 2, db.zRemPairs(key, pairs)
+}
+
+// ZRangeByLex 返回字典序在区间r内的成员, 只在所有成员score相同时有意义
+// 跳过前offset个成员, 最多返回count个成员, count小于0时返回全部
+func (db *StarDB) ZRangeByLex(key []byte, r zset.LexRange, offset, count int)[]interface{}{
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return nil
+	}
+
+	return db.zsetIndex.indexes.ZRangeByLex(string(key), r, false, offset, count)
+}
+
+// ZRevRangeByLex 同ZRangeByLex, 按字典序从大到小排序
+func (db *StarDB) ZRevRangeByLex(key []byte, r zset.LexRange, offset, count int)[]interface{}{
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return nil
+	}
+
+	return db.zsetIndex.indexes.ZRangeByLex(string(key), r, true, offset, count)
+}
+
+// ZLexCount 返回字典序在区间r内的成员数量
+func (db *StarDB) ZLexCount(key []byte, r zset.LexRange) int{
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return 0
+	}
+
+	return db.zsetIndex.indexes.ZLexCount(string(key), r)
+}
+
+// ZRemRangeByLex 删除字典序在区间r内的成员, 返回删除的数量
+func (db *StarDB) ZRemRangeByLex(key []byte, r zset.LexRange)(_ int, err error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return 0, err
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.unlock(&err)
+
+	if db.checkExpired(key, ZSet){
+		return 0, nil
+	}
+
+	val := db.zsetIndex.indexes.ZRangeByLex(string(key), r, false, 0, -1)
+	members := make([][]byte, len(val))
+	for i, m := range val{
+		members[i] = []byte(m.(string))
+	}
+	return len(members), db.zRemMembers(key, members)
+}
+
+// ZPopMin 弹出count个score最小的成员, 返回成员和score交替排列的结果
+func (db *StarDB) ZPopMin(key []byte, count int)([]interface{}, error){
+	return db.zPopWithLock(key, count, false)
+}
+
+// ZPopMax 弹出count个score最大的成员, 返回成员和score交替排列的结果
+func (db *StarDB) ZPopMax(key []byte, count int)([]interface{}, error){
+	return db.zPopWithLock(key, count, true)
+}
+
+// BZPopMin 从keys中第一个非空的有序集合中弹出score最小的成员, 都为空时阻塞直到有数据或超时
+// timeout为0时一直阻塞, 超时返回的key和member都为nil
+func (db *StarDB) BZPopMin(timeout time.Duration, keys ...[]byte)(key, member []byte, score float64, err error){
+	return db.blockingZPop(timeout, false, keys...)
+}
+
+// BZPopMax 同BZPopMin, 弹出score最大的成员
+func (db *StarDB) BZPopMax(timeout time.Duration, keys ...[]byte)(key, member []byte, score float64, err error){
+	return db.blockingZPop(timeout, true, keys...)
+}
+
+func (db *StarDB) zPopWithLock(key []byte, count int, max bool)(_ []interface{}, err error){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return nil, err
+	}
+	if count <= 0{
+		return nil, nil
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.unlock(&err)
+
+	if db.checkExpired(key, ZSet){
+		return nil, nil
+	}
+	return db.zPop(key, count, max)
+}
+
+//调用方需持有zsetIndex.mu
+func (db *StarDB) zPop(key []byte, count int, max bool)(pairs []interface{}, err error){
+	if max{
+		pairs = db.zsetIndex.indexes.ZRevRangeWithScores(string(key), 0, count - 1)
+	}else{
+		pairs = db.zsetIndex.indexes.ZRangeWithScores(string(key), 0, count - 1)
+	}
+	if err = db.zRemPairs(key, pairs); err != nil{
+		return nil, err
+	}
+	return
+}
+
+//删除成员和score交替排列的pairs中的成员, 调用方需持有zsetIndex.mu
+func (db *StarDB) zRemPairs(key []byte, pairs []interface{}) error{
+	members := make([][]byte, 0, len(pairs) / 2)
+	for i := 0; i < len(pairs); i += 2{
+		members = append(members, []byte(pairs[i].(string)))
+	}
+	return db.zRemMembers(key, members)
+}
+
+//删除多个成员, 写入一条日志, 调用方需持有zsetIndex.mu
+func (db *StarDB) zRemMembers(key []byte, members [][]byte) error{
+	if len(members) == 0{
+		return nil
+	}
+
+	e := storage.NewEntryNoExtra(key, storage.EncodeValues(members), ZSet, ZSetZMRem)
+	if err := db.store(e); err != nil{
+		return err
+	}
+
+	for _, m := range members{
+		db.zsetIndex.indexes.ZRem(string(key), string(m))
+	}
+	return nil
+}
+
+func (db *StarDB) blockingZPop(timeout time.Duration, max bool, keys ...[]byte)(key, member []byte, score float64, err error){
+	if len(keys) == 0{
+		return nil, nil, 0, ErrEmptyKey
+	}
+	for _, k := range keys{
+		if err = db.checkKeyValue(k, nil); err != nil{
+			return
+		}
+	}
+
+	db.zsetIndex.mu.Lock()
+	for _, k := range keys{
+		if db.checkExpired(k, ZSet){
+			continue
+		}
+		if db.zsetIndex.indexes.ZCard(string(k)) > 0{
+			defer db.zsetIndex.mu.unlock(&err)
+			res := db.zPopOne(k, max)
+			return res.key, res.val, res.score, res.err
+		}
+	}
+
+	w := db.zsetIndex.blocked.block(keys, func(key []byte) waitResult{
+		return db.zPopOne(key, max)
+	})
+	db.zsetIndex.mu.Unlock()
+
+	res := db.zsetIndex.blocked.wait(w, timeout)
+	return res.key, res.val, res.score, res.err
+}
+
+//调用方需持有zsetIndex.mu
+func (db *StarDB) zPopOne(key []byte, max bool)(res waitResult){
+	res.key = key
+	pairs, err := db.zPop(key, 1, max)
+	if err != nil{
+		res.err = err
+		return
+	}
+	res.val, res.score = []byte(pairs[0].(string)), pairs[1].(float64)
+	return
+}
+
+//添加成员之后按阻塞的先后顺序唤醒等待key的客户端, 调用方需持有zsetIndex.mu
+func (db *StarDB) zServeBlocked(key []byte) error{
+	return db.zsetIndex.blocked.serve(key, func() bool{
+		return db.zsetIndex.indexes.ZCard(string(key)) > 0
+	})
+}
+
+func (opt ZAddOption) check() error{
+	if (opt.NX && opt.XX) || (opt.GT && opt.LT) || (opt.NX && (opt.GT || opt.LT)){
+		return ErrZAddOption
+	}
+	return nil
+}
+
+//判断成员是否满足opt的条件
+func (opt ZAddOption) allow(exist bool, old, score float64) bool{
+	switch {
+	case opt.NX && exist, opt.XX && !exist:
+		return false
+	case exist && opt.GT && score <= old, exist && opt.LT && score >= old:
+		return false
+	}
+	return true
+}
+
+// ZUnion 返回多个有序集合的并集, 成员和score交替排列
+func (db *StarDB) ZUnion(keys [][]byte, opt ZStoreOption)([]interface{}, error){
+	return db.zOp(keys, opt, db.zsetIndex.indexes.ZUnion)
+}
+
+// ZInter 返回多个有序集合的交集, 成员和score交替排列
+func (db *StarDB) ZInter(keys [][]byte, opt ZStoreOption)([]interface{}, error){
+	return db.zOp(keys, opt, db.zsetIndex.indexes.ZInter)
+}
+
+// ZDiff 返回第一个有序集合与其他集合的差集, 成员和score交替排列
+func (db *StarDB) ZDiff(keys [][]byte)([]interface{}, error){
+	return db.zOp(keys, ZStoreOption{}, zDiffOp(db.zsetIndex.indexes))
+}
+
+// ZUnionStore 将并集保存到dst中, dst原有的数据会被覆盖, 返回dst中的成员数量
+func (db *StarDB) ZUnionStore(dst []byte, keys [][]byte, opt ZStoreOption)(int, error){
+	return db.zStore(dst, keys, opt, db.zsetIndex.indexes.ZUnion)
+}
+
+// ZInterStore 将交集保存到dst中, dst原有的数据会被覆盖, 返回dst中的成员数量
+func (db *StarDB) ZInterStore(dst []byte, keys [][]byte, opt ZStoreOption)(int, error){
+	return db.zStore(dst, keys, opt, db.zsetIndex.indexes.ZInter)
+}
+
+// ZDiffStore 将差集保存到dst中, dst原有的数据会被覆盖, 返回dst中的成员数量
+func (db *StarDB) ZDiffStore(dst []byte, keys [][]byte)(int, error){
+	return db.zStore(dst, keys, ZStoreOption{}, zDiffOp(db.zsetIndex.indexes))
+}
+
+type zSetOp func(keys []string, weights []float64, agg zset.Aggregate) []interface{}
+
+func zDiffOp(z *zset.SortedSet) zSetOp{
+	return func(keys []string, _ []float64, _ zset.Aggregate) []interface{}{
+		return z.ZDiff(keys)
+	}
+}
+
+func (db *StarDB) zOp(keys [][]byte, opt ZStoreOption, op zSetOp)([]interface{}, error){
+	if err := checkZStoreArgs(keys, opt); err != nil{
+		return nil, err
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	return op(db.zsetKeys(keys), opt.Weights, opt.Aggregate), nil
+}
+
+//将计算结果写入一条日志, 保证dst的替换是原子的
+func (db *StarDB) zStore(dst []byte, keys [][]byte, opt ZStoreOption, op zSetOp)(_ int, err error){
+	if err := db.checkKeyValue(dst, nil); err != nil{
+		return 0, err
+	}
+	if err := checkZStoreArgs(keys, opt); err != nil{
+		return 0, err
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.unlock(&err)
+
+	pairs := op(db.zsetKeys(keys), opt.Weights, opt.Aggregate)
+	db.checkExpired(dst, ZSet)
+
+	fields := make([][]byte, 0, len(pairs))
+	for i := 0; i < len(pairs); i += 2{
+		fields = append(fields, []byte(pairs[i].(string)), []byte(utils.Float64ToStr(pairs[i+1].(float64))))
+	}
+	e := storage.NewEntryNoExtra(dst, storage.EncodeValues(fields), ZSet, ZSetZStore)
+	if err := db.store(e); err != nil{
+		return 0, err
+	}
+
+	key := string(dst)
+	db.zsetIndex.indexes.ZClear(key)
+	for i := 0; i < len(pairs); i += 2{
+		db.zsetIndex.indexes.ZAdd(key, pairs[i+1].(float64), pairs[i].(string))
+	}
+	delete(db.expires[ZSet], key)
+	return len(pairs) / 2, db.zServeBlocked(dst)
+}
+
+func checkZStoreArgs(keys [][]byte, opt ZStoreOption) error{
+	if len(keys) == 0{
+		return ErrEmptyKey
+	}
+	if opt.Weights != nil && len(opt.Weights) != len(keys){
+		return ErrZWeightsNum
+	}
+	return nil
+}
+
+//清除已过期的key, 保留key的顺序以对应权重和ZDIFF的第一个key, 调用方需持有zsetIndex.mu
+func (db *StarDB) zsetKeys(keys [][]byte) []string{
+	res := make([]string, len(keys))
+	for i, k := range keys{
+		db.checkExpired(k, ZSet)
+		res[i] = string(k)
+	}
+	return res
+}
+
+//回收时将STORE和多成员ZADD日志拆分为score未变化的成员的ZADD日志
+func (db *StarDB) zMultiSnapshot(e *storage.Entry)(entries []*storage.Entry){
+	if mark := e.GetMark(); mark != ZSetZStore && mark != ZSetZMAdd{
+		return
+	}
+	fields, err := storage.DecodeValues(e.Meta.Value)
+	if err != nil || len(fields) % 2 != 0{
+		return
+	}
+
+	for i := 0; i < len(fields); i += 2{
+		score, err := utils.StrToFloat64(string(fields[i+1]))
+		if err != nil{
+			continue
+		}
+		if db.ZScore(e.Meta.Key, fields[i]) == score{
+			entries = append(entries, storage.NewEntry(e.Meta.Key, fields[i], fields[i+1], ZSet, ZSetZAdd))
+		}
+	}
+	return
+}
+
+// GeoAdd 添加带经纬度的成员, score为成员的geohash, 返回新添加的成员数量
+func (db *StarDB) GeoAdd(key []byte, members ...GeoMember)(res int, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	for _, m := range members{
+		if err = db.checkKeyValue(key, m.Member); err != nil{
+			return
+		}
+		if !utils.GeoValid(m.Longitude, m.Latitude){
+			return 0, ErrGeoInvalidLonLat
+		}
+	}
+
+	db.zsetIndex.mu.Lock()
+	defer db.zsetIndex.mu.unlock(&err)
+
+	db.checkExpired(key, ZSet)
+	for _, m := range members{
+		score := float64(utils.GeoEncode(m.Longitude, m.Latitude))
+		oldScore := db.zsetIndex.indexes.ZScore(string(key), string(m.Member))
+		if oldScore == score{
+			continue
+		}
+
+		extra := []byte(utils.Float64ToStr(score))
+		e := storage.NewEntry(key, m.Member, extra, ZSet, ZSetZAdd)
+		if err = db.store(e); err != nil{
+			return
+		}
+		db.zsetIndex.indexes.ZAdd(string(key), score, string(m.Member))
+		if oldScore == math.MinInt64{
+			res++
+		}
+	}
+	err = db.zServeBlocked(key)
+	return
+}
+
+// GeoPos 返回成员的经纬度, 不存在的成员对应nil
+func (db *StarDB) GeoPos(key []byte, members ...[]byte) []*GeoPoint{
+	res := make([]*GeoPoint, len(members))
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return res
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return res
+	}
+	for i, m := range members{
+		if p, ok := db.geoPoint(key, m); ok{
+			res[i] = &p
+		}
+	}
+	return res
+}
+
+// GeoDist 返回两个成员之间的距离, 单位为米, 有成员不存在时ok为false
+func (db *StarDB) GeoDist(key, member1, member2 []byte)(dist float64, ok bool){
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return
+	}
+	p1, ok1 := db.geoPoint(key, member1)
+	p2, ok2 := db.geoPoint(key, member2)
+	if !ok1 || !ok2{
+		return
+	}
+	return utils.GeoDistance(p1.Longitude, p1.Latitude, p2.Longitude, p2.Latitude), true
+}
+
+// GeoHash 返回成员的11位geohash字符串, 不存在的成员对应空字符串
+func (db *StarDB) GeoHash(key []byte, members ...[]byte) []string{
+	res := make([]string, len(members))
+	if err := db.checkKeyValue(key, nil); err != nil{
+		return res
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return res
+	}
+	for i, m := range members{
+		score := db.zsetIndex.indexes.ZScore(string(key), string(m))
+		if score != math.MinInt64{
+			res[i] = utils.GeoHashString(uint64(score))
+		}
+	}
+	return res
+}
+
+// GeoSearch 返回在指定圆形或矩形区域内的成员
+func (db *StarDB) GeoSearch(key []byte, opt GeoSearchOption)(val []*GeoResult, err error){
+	if err = db.checkKeyValue(key, nil); err != nil{
+		return
+	}
+	if opt.Radius <= 0 && (opt.Width <= 0 || opt.Height <= 0){
+		return nil, ErrGeoInvalidShape
+	}
+
+	db.zsetIndex.mu.RLock()
+	defer db.zsetIndex.mu.RUnlock()
+
+	if db.checkExpired(key, ZSet){
+		return
+	}
+
+	center := GeoPoint{Longitude: opt.Longitude, Latitude: opt.Latitude}
+	if opt.FromMember != nil{
+		var ok bool
+		if center, ok = db.geoPoint(key, opt.FromMember); !ok{
+			return nil, ErrGeoMemberNotExist
+		}
+	}else if !utils.GeoValid(center.Longitude, center.Latitude){
+		return nil, ErrGeoInvalidLonLat
+	}
+
+	width, height := opt.Width, opt.Height
+	if opt.Radius > 0{
+		width, height = opt.Radius * 2, opt.Radius * 2
+	}
+
+	//指定了ANY时找到COUNT个成员就停止查找, 之后仍按指定的顺序排序
+	enough := func() bool{
+		return opt.Any && opt.Count > 0 && len(val) >= opt.Count
+	}
+
+	//先按geohash区域取出候选成员, 再计算精确的距离
+	for _, r := range utils.GeoScoreRanges(center.Longitude, center.Latitude, width, height){
+		if enough(){
+			break
+		}
+		members := db.zsetIndex.indexes.ZScoreRange(string(key), float64(r[0]), float64(r[1]))
+		for i := 0; i < len(members); i += 2{
+			score := uint64(members[i+1].(float64))
+			long, lat := utils.GeoDecode(score)
+
+			dist := utils.GeoDistance(center.Longitude, center.Latitude, long, lat)
+			if opt.Radius > 0 && dist > opt.Radius{
+				continue
+			}
+			if opt.Radius <= 0 && !utils.GeoInBox(center.Longitude, center.Latitude, width, height, long, lat){
+				continue
+			}
+
+			val = append(val, &GeoResult{
+				Member: []byte(members[i].(string)),
+				Distance: dist,
+				Hash: score,
+				GeoPoint: GeoPoint{Longitude: long, Latitude: lat},
+			})
+			if enough(){
+				break
+			}
+		}
+	}
+
+	//指定了COUNT但没有指定排序时按距离升序
+	sortBy := opt.Sort
+	if sortBy == GeoSortNone && opt.Count > 0 && !opt.Any{
+		sortBy = GeoSortAsc
+	}
+	switch sortBy {
+	case GeoSortAsc:
+		sort.SliceStable(val, func(i, j int) bool { return val[i].Distance < val[j].Distance })
+	case GeoSortDesc:
+		sort.SliceStable(val, func(i, j int) bool { return val[i].Distance > val[j].Distance })
+	}
+
+	if opt.Count > 0 && len(val) > opt.Count{
+		val = val[:opt.Count]
+	}
+	return
+}
+
+//调用方需持有zsetIndex.mu
+func (db *StarDB) geoPoint(key, member []byte)(p GeoPoint, ok bool){
+	score := db.zsetIndex.indexes.ZScore(string(key), string(member))
+	if score == math.MinInt64{
+		return
+	}
+	p.Longitude, p.Latitude = utils.GeoDecode(uint64(score))
+	return p, true
+}
@@ -0,0 +1,434 @@
+package stardb
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math"
+	"os"
+	"stardb/ds/zset"
+	"stardb/storage"
+	"stardb/vfs"
+	"testing"
+	"time"
+)
+
+func TestStarDB_GeoAdd(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key := []byte("Sicily")
+	n, err := db.GeoAdd(key,
+		GeoMember{Longitude: 13.361389, Latitude: 38.115556, Member: []byte("Palermo")},
+		GeoMember{Longitude: 15.087269, Latitude: 37.502669, Member: []byte("Catania")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	n, err = db.GeoAdd(key, GeoMember{Longitude: 13.361389, Latitude: 38.115556, Member: []byte("Palermo")})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = db.GeoAdd(key, GeoMember{Longitude: 13, Latitude: 89, Member: []byte("Pole")})
+	assert.Equal(t, ErrGeoInvalidLonLat, err)
+
+	dist, ok := db.GeoDist(key, []byte("Palermo"), []byte("Catania"))
+	assert.True(t, ok)
+	assert.InDelta(t, 166274.1516, dist, 0.01)
+	_, ok = db.GeoDist(key, []byte("Palermo"), []byte("Rome"))
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"sqc8b49rny0", "sqdtr74hyu0", ""},
+		db.GeoHash(key, []byte("Palermo"), []byte("Catania"), []byte("Rome")))
+
+	//重新打开后从日志恢复
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+
+	pos := db.GeoPos(key, []byte("Palermo"), []byte("Rome"))
+	assert.InDelta(t, 13.361389, pos[0].Longitude, 0.0001)
+	assert.InDelta(t, 38.115556, pos[0].Latitude, 0.0001)
+	assert.Nil(t, pos[1])
+}
+
+func TestStarDB_GeoSearch(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	key := []byte("Sicily")
+	_, err := db.GeoAdd(key,
+		GeoMember{Longitude: 13.361389, Latitude: 38.115556, Member: []byte("Palermo")},
+		GeoMember{Longitude: 15.087269, Latitude: 37.502669, Member: []byte("Catania")},
+		GeoMember{Longitude: 12.758489, Latitude: 38.788135, Member: []byte("edge1")},
+		GeoMember{Longitude: 17.241510, Latitude: 38.788135, Member: []byte("edge2")})
+	assert.Nil(t, err)
+
+	val, err := db.GeoSearch(key, GeoSearchOption{Longitude: 15, Latitude: 37, Radius: 200000, Sort: GeoSortAsc})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(val))
+	assert.Equal(t, "Catania", string(val[0].Member))
+	assert.InDelta(t, 56441.3, val[0].Distance, 0.1)
+	assert.Equal(t, "Palermo", string(val[1].Member))
+	assert.InDelta(t, 190442.4, val[1].Distance, 0.1)
+
+	val, err = db.GeoSearch(key, GeoSearchOption{Longitude: 15, Latitude: 37, Width: 400000, Height: 400000, Sort: GeoSortDesc})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(val))
+	assert.InDelta(t, val[0].Distance, val[1].Distance, 1)
+	assert.Equal(t, "Palermo", string(val[2].Member))
+	assert.Equal(t, "Catania", string(val[3].Member))
+
+	val, err = db.GeoSearch(key, GeoSearchOption{FromMember: []byte("Palermo"), Radius: 100000, Count: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(val))
+	assert.Equal(t, "Palermo", string(val[0].Member))
+
+	//ANY找到足够的成员后停止查找, 但结果仍然排序
+	val, err = db.GeoSearch(key, GeoSearchOption{Longitude: 15, Latitude: 37, Width: 400000, Height: 400000, Count: 4, Any: true, Sort: GeoSortAsc})
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(val))
+	assert.Equal(t, "Catania", string(val[0].Member))
+	assert.Equal(t, "Palermo", string(val[1].Member))
+	val, err = db.GeoSearch(key, GeoSearchOption{Longitude: 15, Latitude: 37, Width: 400000, Height: 400000, Count: 2, Any: true, Sort: GeoSortDesc})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(val))
+	assert.True(t, val[0].Distance >= val[1].Distance)
+
+	_, err = db.GeoSearch(key, GeoSearchOption{FromMember: []byte("Rome"), Radius: 1000})
+	assert.Equal(t, ErrGeoMemberNotExist, err)
+	_, err = db.GeoSearch(key, GeoSearchOption{Longitude: 15, Latitude: 37})
+	assert.Equal(t, ErrGeoInvalidShape, err)
+}
+
+func TestStarDB_ZStore(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	assert.Nil(t, db.ZAdd([]byte("z1"), 1, []byte("a")))
+	assert.Nil(t, db.ZAdd([]byte("z1"), 2, []byte("b")))
+	assert.Nil(t, db.ZAdd([]byte("z2"), 3, []byte("b")))
+	assert.Nil(t, db.ZAdd([]byte("z2"), 4, []byte("c")))
+	assert.Nil(t, db.ZAdd([]byte("dst"), 9, []byte("old")))
+
+	keys := [][]byte{[]byte("z1"), []byte("z2")}
+	val, err := db.ZUnion(keys, ZStoreOption{Weights: []float64{1, 2}})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", float64(1), "b", float64(8), "c", float64(8)}, val)
+	val, err = db.ZInter(keys, ZStoreOption{Aggregate: zset.AggregateMax})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", float64(3)}, val)
+	_, err = db.ZUnion(keys, ZStoreOption{Weights: []float64{1}})
+	assert.Equal(t, ErrZWeightsNum, err)
+
+	n, err := db.ZInterStore([]byte("dst"), keys, ZStoreOption{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.ZDiffStore([]byte("diff"), keys)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	n, err = db.ZUnionStore([]byte("union"), keys, ZStoreOption{Aggregate: zset.AggregateMin})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+
+	//重新打开后目标集合被整体替换
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []interface{}{"b", float64(5)}, db.ZRangeWithScores([]byte("dst"), 0, -1))
+	assert.Equal(t, []interface{}{"a", float64(1)}, db.ZRangeWithScores([]byte("diff"), 0, -1))
+	assert.Equal(t, float64(2), db.ZScore([]byte("union"), []byte("b")))
+	assert.Equal(t, 3, db.ZCard([]byte("union")))
+}
+
+func TestStarDB_ZStoreReclaim(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	//回收时STORE日志拆分为score未变化的成员
+	assert.Nil(t, db.ZAdd([]byte("src"), 1, []byte("a")))
+	assert.Nil(t, db.ZAdd([]byte("src"), 2, []byte("b")))
+	assert.Nil(t, db.ZAdd([]byte("src"), 3, []byte("c")))
+	_, err = db.ZUnionStore([]byte("dst"), [][]byte{[]byte("src")}, ZStoreOption{})
+	assert.Nil(t, err)
+	_, err = db.ZRem([]byte("dst"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.ZAdd([]byte("dst"), 10, []byte("c")))
+	for i := 0; i < 10; i++{
+		assert.Nil(t, db.ZAdd([]byte("other"), float64(i), []byte{byte('a' + i)}))
+	}
+	assert.Nil(t, db.Reclaim())
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", float64(1), "c", float64(10)}, db.ZRangeWithScores([]byte("dst"), 0, -1))
+	db.Close()
+}
+
+//结果超出一个文件大小时返回错误, dst保持不变
+func TestStarDB_ZStoreTooLarge(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.BlockSize = 4096
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	for i := 0; i < 300; i++{
+		assert.Nil(t, db.ZAdd([]byte("src"), float64(i), []byte(fmt.Sprintf("member-%d", i))))
+	}
+	assert.Nil(t, db.ZAdd([]byte("dst"), 1, []byte("old")))
+
+	n, err := db.ZUnionStore([]byte("dst"), [][]byte{[]byte("src")}, ZStoreOption{})
+	assert.Equal(t, ErrEntryTooLarge, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, []interface{}{"old", float64(1)}, db.ZRangeWithScores([]byte("dst"), 0, -1))
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 300, db.ZCard([]byte("src")))
+	assert.Equal(t, []interface{}{"old", float64(1)}, db.ZRangeWithScores([]byte("dst"), 0, -1))
+}
+
+func TestStarDB_ZRemRange(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key := []byte("z")
+	for i := 1; i <= 6; i++{
+		assert.Nil(t, db.ZAdd(key, float64(i), []byte{byte('a' + i - 1)}))
+	}
+
+	all := zset.ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}
+	assert.Equal(t, 6, db.ZCount(key, all))
+	assert.Equal(t, []interface{}{"e", float64(5), "d", float64(4)}, db.ZRevRangeByScore(key, all, 1, 2))
+
+	n, err := db.ZRemRangeByScore(key, zset.ScoreRange{Min: 1, Max: 3, MinEx: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.ZRemRangeByRank(key, -1, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+
+	val, err := db.ZPopMin(key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", float64(1)}, val)
+	val, err = db.ZPopMax(key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"e", float64(5), "d", float64(4)}, val)
+	assert.False(t, db.ZKeyExists(key))
+
+	assert.Nil(t, db.ZAdd(key, 7, []byte("g")))
+
+	//重新打开后删除的成员不再存在
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"g", float64(7)}, db.ZRangeWithScores(key, 0, -1))
+}
+
+func TestStarDB_BZPopMin(t *testing.T) {
+	db := openTmpDB(t)
+	defer closeTmpDB(db)
+
+	t.Run("timeout", func(t *testing.T) {
+		key, member, _, err := db.BZPopMin(20*time.Millisecond, []byte("empty"))
+		assert.Nil(t, err)
+		assert.Nil(t, key)
+		assert.Nil(t, member)
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		assert.Nil(t, db.ZAdd([]byte("ready"), 2, []byte("b")))
+		assert.Nil(t, db.ZAdd([]byte("ready"), 1, []byte("a")))
+		key, member, score, err := db.BZPopMax(0, []byte("empty"), []byte("ready"))
+		assert.Nil(t, err)
+		assert.Equal(t, []byte("ready"), key)
+		assert.Equal(t, []byte("b"), member)
+		assert.Equal(t, float64(2), score)
+	})
+
+	t.Run("fifo", func(t *testing.T) {
+		first, second := make(chan string, 1), make(chan string, 1)
+		go func() {
+			_, member, _, _ := db.BZPopMin(0, []byte("other"), []byte("jobs"))
+			first <- string(member)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		go func() {
+			_, member, _, _ := db.BZPopMin(0, []byte("jobs"))
+			second <- string(member)
+		}()
+		time.Sleep(20 * time.Millisecond)
+
+		assert.Nil(t, db.ZAdd([]byte("jobs"), 1, []byte("job1")))
+		assert.Nil(t, db.ZAdd([]byte("jobs"), 2, []byte("job2")))
+		assert.Equal(t, "job1", <-first)
+		assert.Equal(t, "job2", <-second)
+		assert.Equal(t, 0, db.ZCard([]byte("jobs")))
+	})
+}
+
+func TestStarDB_ZRangeByLex(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key := []byte("dict")
+	for _, m := range []string{"apple", "apricot", "banana", "blueberry", "cherry"}{
+		assert.Nil(t, db.ZAdd(key, 0, []byte(m)))
+	}
+
+	//前缀查询
+	prefix := zset.LexRange{Min: zset.LexBound{Member: "ap"}, Max: zset.LexBound{Member: "ap\xff", Exclusive: true}}
+	assert.Equal(t, []interface{}{"apple", "apricot"}, db.ZRangeByLex(key, prefix, 0, -1))
+	assert.Equal(t, 2, db.ZLexCount(key, prefix))
+
+	all := zset.LexRange{Min: zset.LexBound{Inf: -1}, Max: zset.LexBound{Inf: 1}}
+	assert.Equal(t, []interface{}{"cherry", "blueberry"}, db.ZRevRangeByLex(key, all, 0, 2))
+
+	n, err := db.ZRemRangeByLex(key, zset.LexRange{Min: zset.LexBound{Member: "b"}, Max: zset.LexBound{Member: "c", Exclusive: true}})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"apple", "apricot", "cherry"}, db.ZRangeByLex(key, all, 0, -1))
+}
+
+func TestStarDB_ZMAdd(t *testing.T) {
+	db := openTmpDB(t)
+	defer func() {
+		closeTmpDB(db)
+	}()
+
+	key := []byte("board")
+	offset := db.activeFile[ZSet].Offset
+	n, err := db.ZMAdd(key, ZAddOption{},
+		ZMember{Score: 10, Member: []byte("a")},
+		ZMember{Score: 20, Member: []byte("b")},
+		ZMember{Score: 30, Member: []byte("c")},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	//多个成员只写入一条日志
+	fields := [][]byte{[]byte("a"), []byte("10"), []byte("b"), []byte("20"), []byte("c"), []byte("30")}
+	e := storage.NewEntryNoExtra(key, storage.EncodeValues(fields), ZSet, ZSetZMAdd)
+	assert.Equal(t, offset + int64(e.Size()), db.activeFile[ZSet].Offset)
+
+	//GT只更新score变大的成员, CH返回修改的数量
+	n, err = db.ZMAdd(key, ZAddOption{GT: true, CH: true},
+		ZMember{Score: 5, Member: []byte("a")},
+		ZMember{Score: 25, Member: []byte("b")},
+		ZMember{Score: 1, Member: []byte("d")},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = db.ZMAdd(key, ZAddOption{XX: true}, ZMember{Score: 1, Member: []byte("e")})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = db.ZMAdd(key, ZAddOption{NX: true, GT: true}, ZMember{Score: 1, Member: []byte("a")})
+	assert.Equal(t, ErrZAddOption, err)
+
+	score, ok, err := db.ZAddIncr(key, ZAddOption{}, 5, []byte("c"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, float64(35), score)
+	_, ok, err = db.ZAddIncr(key, ZAddOption{NX: true}, 5, []byte("c"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, _, err = db.ZAddIncr([]byte("inf"), ZAddOption{}, math.Inf(1), []byte("x"))
+	assert.Nil(t, err)
+	_, _, err = db.ZAddIncr([]byte("inf"), ZAddOption{}, math.Inf(-1), []byte("x"))
+	assert.Equal(t, ErrZScoreNaN, err)
+
+	db.Close()
+	db, err = Open(db.config)
+	assert.Nil(t, err)
+
+	expected := []interface{}{"d", float64(1), "a", float64(10), "b", float64(25), "c", float64(35)}
+	assert.Equal(t, expected, db.ZRangeWithScores(key, 0, -1))
+	scores := db.ZMScore(key, []byte("a"), []byte("none"))
+	assert.Equal(t, float64(10), *scores[0])
+	assert.Nil(t, scores[1])
+
+	assert.Equal(t, 4, len(db.ZRandMember(key, 10, false)))
+	assert.Equal(t, 10, len(db.ZRandMember(key, -5, true)))
+}
+
+//一条日志放不下的批量添加返回错误, 所有成员都不会被添加
+func TestStarDB_ZMAddTooLarge(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.BlockSize = 4096
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	members := make([]ZMember, 300)
+	for i := range members{
+		members[i] = ZMember{Score: float64(i), Member: []byte(fmt.Sprintf("member-%d", i))}
+	}
+	n, err := db.ZMAdd([]byte("board"), ZAddOption{}, members...)
+	assert.Equal(t, ErrEntryTooLarge, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, 0, db.ZCard([]byte("board")))
+
+	n, err = db.ZMAdd([]byte("board"), ZAddOption{}, members[:10]...)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, n)
+}
+
+func TestStarDB_ZMAddReclaim(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.BlockSize = 256
+	config.ReclaimThreshold = 1
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+
+	//回收时多成员ZADD日志拆分为score未变化的成员
+	_, err = db.ZMAdd([]byte("z"), ZAddOption{},
+		ZMember{Score: 1, Member: []byte("a")},
+		ZMember{Score: 2, Member: []byte("b")},
+		ZMember{Score: 3, Member: []byte("c")},
+	)
+	assert.Nil(t, err)
+	_, err = db.ZRem([]byte("z"), []byte("b"))
+	assert.Nil(t, err)
+	assert.Nil(t, db.ZAdd([]byte("z"), 10, []byte("c")))
+	for i := 0; i < 10; i++{
+		assert.Nil(t, db.ZAdd([]byte("other"), float64(i), []byte{byte('a' + i)}))
+	}
+	assert.Nil(t, db.Reclaim())
+
+	db.Close()
+	db, err = Open(config)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", float64(1), "c", float64(10)}, db.ZRangeWithScores([]byte("z"), 0, -1))
+	db.Close()
+}
@@ -0,0 +1,338 @@
+package hll
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+//与redis兼容的HyperLogLog, 值的格式为16字节的头部加上sparse或dense编码的寄存器
+//头部: "HYLL" + 编码(1字节) + 3字节保留 + 8字节小端的基数缓存(最高位为1时缓存无效)
+
+const (
+	P = 14                    //寄存器索引的bit数
+	Q = 64 - P                //用于计算连续0的bit数
+	Registers = 1 << P        //寄存器数量
+	bitsPerReg = 6            //dense编码每个寄存器占用的bit数
+	regMax = 1 << bitsPerReg - 1
+
+	headerSize = 16
+	denseSize = headerSize + (Registers * bitsPerReg + 7) / 8
+
+	// SparseMaxBytes sparse编码超过该长度时转为dense编码, 同redis的hll-sparse-max-bytes
+	SparseMaxBytes = 3000
+
+	encodingDense = 0
+	encodingSparse = 1
+
+	sparseValMax = 32         //sparse编码能表示的寄存器最大值
+	sparseZeroMaxLen = 64
+	sparseXZeroMaxLen = 16384
+	sparseValMaxLen = 4
+
+	alphaInf = 0.721347520444481703680
+	hashSeed = 0xadc83b19
+)
+
+var ErrInvalidHLL = errors.New("hll: not a valid HyperLogLog string value")
+
+var magic = []byte("HYLL")
+
+type HLL struct {
+	registers [Registers]uint8
+	dense     bool
+	card      uint64
+	cardValid bool
+}
+
+// New 创建一个sparse编码的空HLL
+func New() *HLL{
+	return &HLL{cardValid: true}
+}
+
+// Decode 解析sparse或dense编码的值
+func Decode(val []byte) (*HLL, error){
+	if len(val) < headerSize || string(val[:4]) != string(magic){
+		return nil, ErrInvalidHLL
+	}
+
+	h := &HLL{}
+	cache := binary.LittleEndian.Uint64(val[8:headerSize])
+	h.cardValid = cache & (1 << 63) == 0
+	h.card = cache &^ (1 << 63)
+
+	switch val[4] {
+	case encodingDense:
+		if len(val) != denseSize{
+			return nil, ErrInvalidHLL
+		}
+		h.dense = true
+		for i := 0; i < Registers; i++{
+			h.registers[i] = getDenseRegister(val[headerSize:], i)
+		}
+	case encodingSparse:
+		if err := h.decodeSparse(val[headerSize:]); err != nil{
+			return nil, err
+		}
+	default:
+		return nil, ErrInvalidHLL
+	}
+	return h, nil
+}
+
+/*
+ *sparse编码的操作码
+ *ZERO:  00xxxxxx           连续xxxxxx+1个寄存器为0
+ *XZERO: 01xxxxxx yyyyyyyy  连续xxxxxxyyyyyyyy+1个寄存器为0
+ *VAL:   1vvvvvxx           连续xx+1个寄存器的值为vvvvv+1
+ */
+func (h *HLL) decodeSparse(buf []byte) error{
+	idx := 0
+	for i := 0; i < len(buf); i++{
+		b := buf[i]
+		var runLen int
+		var val uint8
+		switch {
+		case b & 0xc0 == 0:
+			runLen = int(b & 0x3f) + 1
+		case b & 0xc0 == 0x40:
+			if i + 1 >= len(buf){
+				return ErrInvalidHLL
+			}
+			i++
+			runLen = (int(b & 0x3f) << 8 | int(buf[i])) + 1
+		default:
+			val = (b >> 2) & 0x1f + 1
+			runLen = int(b & 0x3) + 1
+		}
+
+		if idx + runLen > Registers{
+			return ErrInvalidHLL
+		}
+		for j := 0; j < runLen; j++{
+			h.registers[idx+j] = val
+		}
+		idx += runLen
+	}
+
+	if idx != Registers{
+		return ErrInvalidHLL
+	}
+	return nil
+}
+
+// Add 添加元素, 有寄存器被修改时返回true
+func (h *HLL) Add(elem []byte) bool{
+	index, count := patLen(elem)
+	if h.registers[index] >= count{
+		return false
+	}
+
+	h.registers[index] = count
+	h.cardValid = false
+	return true
+}
+
+// Merge 合并other, 每个寄存器取较大的值
+func (h *HLL) Merge(other *HLL){
+	for i, v := range other.registers{
+		if v > h.registers[i]{
+			h.registers[i] = v
+			h.cardValid = false
+		}
+	}
+}
+
+// ToDense 之后的Encode都使用dense编码
+func (h *HLL) ToDense(){
+	h.dense = true
+}
+
+// Count 返回估算的基数
+func (h *HLL) Count() uint64{
+	if h.cardValid{
+		return h.card
+	}
+
+	//使用Ertl的改进估算方法, 同redis
+	var histogram [64]int
+	for _, v := range h.registers{
+		histogram[v]++
+	}
+
+	m := float64(Registers)
+	z := m * tau((m - float64(histogram[Q+1])) / m)
+	for j := Q; j >= 1; j--{
+		z += float64(histogram[j])
+		z *= 0.5
+	}
+	z += m * sigma(float64(histogram[0]) / m)
+
+	h.card = uint64(math.Round(alphaInf * m * m / z))
+	h.cardValid = true
+	return h.card
+}
+
+// Encode 编码为redis格式的值, sparse编码超过SparseMaxBytes或无法表示时转为dense编码
+func (h *HLL) Encode() []byte{
+	if !h.dense{
+		if buf := h.encodeSparse(); buf != nil{
+			return buf
+		}
+		h.dense = true
+	}
+
+	buf := make([]byte, denseSize)
+	h.writeHeader(buf, encodingDense)
+	for i, v := range h.registers{
+		setDenseRegister(buf[headerSize:], i, v)
+	}
+	return buf
+}
+
+func (h *HLL) encodeSparse() []byte{
+	buf := make([]byte, headerSize, SparseMaxBytes)
+	h.writeHeader(buf, encodingSparse)
+
+	for i := 0; i < Registers; {
+		v := h.registers[i]
+		runLen := 1
+		for i + runLen < Registers && h.registers[i+runLen] == v{
+			runLen++
+		}
+		i += runLen
+
+		if v > sparseValMax{
+			return nil
+		}
+		for runLen > 0{
+			n := runLen
+			switch {
+			case v == 0 && n <= sparseZeroMaxLen:
+				buf = append(buf, byte(n - 1))
+			case v == 0:
+				if n > sparseXZeroMaxLen{
+					n = sparseXZeroMaxLen
+				}
+				buf = append(buf, 0x40 | byte((n - 1) >> 8), byte(n - 1))
+			default:
+				if n > sparseValMaxLen{
+					n = sparseValMaxLen
+				}
+				buf = append(buf, 0x80 | (v - 1) << 2 | byte(n - 1))
+			}
+			runLen -= n
+		}
+
+		if len(buf) > SparseMaxBytes{
+			return nil
+		}
+	}
+	return buf
+}
+
+func (h *HLL) writeHeader(buf []byte, encoding byte){
+	copy(buf, magic)
+	buf[4] = encoding
+	cache := h.card
+	if !h.cardValid{
+		cache = 1 << 63
+	}
+	binary.LittleEndian.PutUint64(buf[8:headerSize], cache)
+}
+
+//dense编码中寄存器按6bit紧密排列, 低位在前
+func getDenseRegister(buf []byte, i int) uint8{
+	byteIdx, fb := i * bitsPerReg / 8, uint(i * bitsPerReg & 7)
+	b0 := uint16(buf[byteIdx])
+	var b1 uint16
+	if byteIdx + 1 < len(buf){
+		b1 = uint16(buf[byteIdx+1])
+	}
+	return uint8((b0 >> fb | b1 << (8 - fb)) & regMax)
+}
+
+func setDenseRegister(buf []byte, i int, val uint8){
+	byteIdx, fb := i * bitsPerReg / 8, uint(i * bitsPerReg & 7)
+	buf[byteIdx] &^= regMax << fb
+	buf[byteIdx] |= val << fb
+	if byteIdx + 1 < len(buf){
+		buf[byteIdx+1] &^= regMax >> (8 - fb)
+		buf[byteIdx+1] |= val >> (8 - fb)
+	}
+}
+
+//返回元素对应的寄存器索引和连续0的个数加1
+func patLen(elem []byte) (int, uint8){
+	hash := murmurHash64A(elem, hashSeed)
+	index := int(hash & (Registers - 1))
+	hash >>= P
+	hash |= 1 << Q
+
+	count := uint8(1)
+	for bit := uint64(1); hash & bit == 0; bit <<= 1{
+		count++
+	}
+	return index, count
+}
+
+func murmurHash64A(data []byte, seed uint64) uint64{
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+
+	h := seed ^ (uint64(len(data)) * m)
+	for len(data) >= 8{
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+
+	if len(data) > 0{
+		for i := len(data) - 1; i >= 0; i--{
+			h ^= uint64(data[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+func sigma(x float64) float64{
+	if x == 1{
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		zPrime := z
+		z += x * y
+		y += y
+		if zPrime == z{
+			return z
+		}
+	}
+}
+
+func tau(x float64) float64{
+	if x == 0 || x == 1{
+		return 0
+	}
+	y, z := 1.0, 1 - x
+	for {
+		x = math.Sqrt(x)
+		zPrime := z
+		y *= 0.5
+		z -= math.Pow(1 - x, 2) * y
+		if zPrime == z{
+			return z / 3
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package hll
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	buf := New().Encode()
+	//空HLL为一个覆盖所有寄存器的XZERO操作码, 与redis一致
+	assert.Equal(t, append([]byte("HYLL\x01\x00\x00\x00"), 0, 0, 0, 0, 0, 0, 0, 0, 0x7f, 0xff), buf)
+
+	h, err := Decode(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), h.Count())
+}
+
+func TestHLL_Add(t *testing.T) {
+	h := New()
+	for _, e := range []string{"a", "b", "c", "d", "e", "f", "g"}{
+		assert.True(t, h.Add([]byte(e)))
+	}
+	assert.False(t, h.Add([]byte("a")))
+	assert.Equal(t, uint64(7), h.Count())
+
+	decoded, err := Decode(h.Encode())
+	assert.Nil(t, err)
+	assert.False(t, decoded.dense)
+	assert.Equal(t, h.registers, decoded.registers)
+	assert.Equal(t, uint64(7), decoded.Count())
+}
+
+func TestHLL_Dense(t *testing.T) {
+	h := New()
+	for i := 0; i < 100000; i++{
+		h.Add([]byte(strconv.Itoa(i)))
+	}
+
+	buf := h.Encode()
+	assert.Equal(t, denseSize, len(buf))
+	decoded, err := Decode(buf)
+	assert.Nil(t, err)
+	assert.True(t, decoded.dense)
+	assert.Equal(t, h.registers, decoded.registers)
+
+	count := float64(decoded.Count())
+	assert.InDelta(t, 100000, count, 100000 * 0.02)
+}
+
+func TestHLL_Merge(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 1000; i++{
+		a.Add([]byte(strconv.Itoa(i)))
+		b.Add([]byte(strconv.Itoa(i + 500)))
+	}
+	a.Merge(b)
+	assert.InDelta(t, 1500, float64(a.Count()), 1500 * 0.02)
+
+	a.ToDense()
+	assert.Equal(t, denseSize, len(a.Encode()))
+}
+
+func TestDecode(t *testing.T) {
+	_, err := Decode([]byte("not a hll"))
+	assert.Equal(t, ErrInvalidHLL, err)
+
+	buf := New().Encode()
+	_, err = Decode(buf[:len(buf)-1])
+	assert.Equal(t, ErrInvalidHLL, err)
+}
@@ -1,6 +1,7 @@
 package list
 
 import (
+	"bytes"
 	"container/list"
 	"reflect"
 )
@@ -15,6 +16,16 @@ const (
 	After
 )
 
+// Direction 弹出或压入的方向
+type Direction uint8
+
+const (
+	// Left 链表头部
+	Left Direction = iota
+	// Right 链表尾部
+	Right
+)
+
 type (
 	List struct {
 		record Record
@@ -48,6 +59,74 @@ func (lis *List) RPop(key string) []byte{
 	return lis.pop(false, key)
 }
 
+/*
+ *从src的from端弹出元素并压入dst的to端, src为空时返回nil
+ */
+func (lis *List) LMove(src, dst string, from, to Direction) []byte{
+	val := lis.pop(from == Left, src)
+	if val != nil{
+		lis.push(to == Left, dst, val)
+	}
+	return val
+}
+
+/*
+ *将val压入dst的to端, src的from端的元素等于val时将其弹出
+ *用于从日志恢复, 回收之后src中压入val的日志可能已经被丢弃
+ */
+func (lis *List) LMoveValue(src, dst string, val []byte, from, to Direction){
+	index := 0
+	if from == Right{
+		index = -1
+	}
+	if bytes.Equal(lis.LIndex(src, index), val){
+		lis.pop(from == Left, src)
+	}
+	lis.push(to == Left, dst, val)
+}
+
+/*
+ *返回list中等于val的元素的索引
+ *rank > 0 从前向后查找, 跳过前rank-1个匹配的元素
+ *rank < 0 从后向前查找, 跳过前-rank-1个匹配的元素
+ *count = 0 返回所有匹配的索引, maxLen = 0 不限制比较的元素个数
+ */
+func (lis *List) LPos(key string, val []byte, rank, count, maxLen int)(pos []int){
+	item := lis.record[key]
+	if item == nil || rank == 0 || lis.values[key][string(val)] == 0{
+		return
+	}
+
+	skip, reverse := rank - 1, false
+	if rank < 0{
+		skip, reverse = -rank - 1, true
+	}
+
+	p, idx := item.Front(), 0
+	if reverse{
+		p, idx = item.Back(), item.Len() - 1
+	}
+	for compared := 0; p != nil && (maxLen == 0 || compared < maxLen); compared++{
+		if bytes.Equal(p.Value.([]byte), val){
+			if skip > 0{
+				skip--
+			}else{
+				pos = append(pos, idx)
+				if count > 0 && len(pos) == count{
+					break
+				}
+			}
+		}
+
+		if reverse{
+			p, idx = p.Prev(), idx - 1
+		}else{
+			p, idx = p.Next(), idx + 1
+		}
+	}
+	return
+}
+
 func (lis *List) LIndex(key string, index int) []byte{
 /*	ok, newIndex := lis.validIndex(key, index)
 	if !ok {
@@ -170,4 +170,41 @@ func TestList_LValExists(t *testing.T) {
 
 	ok2 := list.LValExists(key, []byte("bbb"))
 	t.Log(ok2)
-}
\ No newline at end of file
+}
+func TestList_LMove(t *testing.T) {
+	list := InitList()
+
+	val := list.LMove(key, "dst_list", Right, Left)
+	assert.Equal(t, string(val), "a")
+	assert.Equal(t, list.LLen(key), 5)
+	assert.Equal(t, string(list.LIndex("dst_list", 0)), "a")
+	assert.Equal(t, list.LValExists("dst_list", []byte("a")), true)
+	assert.Equal(t, list.LValExists(key, []byte("a")), false)
+
+	val = list.LMove("no key", key, Left, Left)
+	assert.Equal(t, val == nil, true)
+}
+
+func TestList_LMoveValue(t *testing.T) {
+	list := New()
+	list.RPush("src", []byte("a"), []byte("b"))
+
+	//from端的元素不等于val时只压入dst
+	list.LMoveValue("src", "dst", []byte("c"), Right, Left)
+	assert.Equal(t, list.LLen("src"), 2)
+	list.LMoveValue("src", "dst", []byte("b"), Right, Left)
+	assert.Equal(t, list.LLen("src"), 1)
+	assert.Equal(t, string(list.LIndex("dst", 0)), "b")
+	assert.Equal(t, string(list.LIndex("dst", 1)), "c")
+}
+
+func TestList_LPos(t *testing.T) {
+	list := New()
+	list.RPush(key, []byte("a"), []byte("b"), []byte("c"), []byte("b"), []byte("b"))
+
+	assert.Equal(t, list.LPos(key, []byte("b"), 1, 1, 0), []int{1})
+	assert.Equal(t, list.LPos(key, []byte("b"), 2, 0, 0), []int{3, 4})
+	assert.Equal(t, list.LPos(key, []byte("b"), -1, 2, 0), []int{4, 3})
+	assert.Equal(t, list.LPos(key, []byte("b"), 1, 0, 2), []int{1})
+	assert.Equal(t, len(list.LPos(key, []byte("x"), 1, 0, 0)), 0)
+}
@@ -136,16 +136,73 @@ func (s *Set) SMembers(key string) (val [][]byte){
 }
 
 func (s *Set) SUnion(keys ...string)(val [][]byte){
+	seen := make(map[string]struct{})
 	for _, k := range keys{
 		if s.exist(k){
 			for v := range s.record[k]{
-				val = append(val, []byte(v))
+				if _, ok := seen[v]; !ok{
+					seen[v] = existFlag
+					val = append(val, []byte(v))
+				}
 			}
 		}
 	}
 	return
 }
 
+// SInter 返回所有key的交集, 有key不存在时交集为空
+func (s *Set) SInter(keys ...string)(val [][]byte){
+	s.inter(keys, 0, func(v string){
+		val = append(val, []byte(v))
+	})
+	return
+}
+
+/*
+ *返回交集的元素个数, limit大于0时数到limit个就停止
+ */
+func (s *Set) SInterCard(limit int, keys ...string)(n int){
+	s.inter(keys, limit, func(string){
+		n++
+	})
+	return
+}
+
+//遍历交集中的元素, limit大于0时最多遍历limit个
+func (s *Set) inter(keys []string, limit int, fn func(v string)){
+	if len(keys) == 0{
+		return
+	}
+
+	//从最小的集合开始遍历
+	smallest := keys[0]
+	for _, k := range keys{
+		if !s.exist(k){
+			return
+		}
+		if len(s.record[k]) < len(s.record[smallest]){
+			smallest = k
+		}
+	}
+
+	n := 0
+	for v := range s.record[smallest]{
+		flag := true
+		for _, k := range keys{
+			if !s.fieldExist(k, v){
+				flag = false
+				break
+			}
+		}
+		if flag{
+			fn(v)
+			if n++; limit > 0 && n == limit{
+				return
+			}
+		}
+	}
+}
+
 func (s *Set)SDiff(keys ...string)(val [][]byte){
 	if len(keys) == 0 || !s.exist(keys[0]){
 		return
@@ -111,4 +111,37 @@ func TestSet_SDiff(t *testing.T) {
 	for _, v := range members{
 		fmt.Println(string(v))
 	}
-}
\ No newline at end of file
+}
+func TestSet_SInter(t *testing.T) {
+	set := NewSet()
+	var key2 = "my_key2"
+	set.SAdd(key2, []byte("aaa"))
+	set.SAdd(key2, []byte("zzz"))
+	members := set.SInter(key, key2)
+	if len(members) != 1 || string(members[0]) != "aaa"{
+		t.Errorf("expected [aaa], got %q", members)
+	}
+	if members = set.SInter(key, "none"); len(members) != 0{
+		t.Errorf("expected empty, got %q", members)
+	}
+}
+
+func TestSet_SInterCard(t *testing.T) {
+	set := NewSet()
+	var key2 = "my_key2"
+	for _, m := range []string{"aaa", "bbb", "ccc", "zzz"}{
+		set.SAdd(key2, []byte(m))
+	}
+	if n := set.SInterCard(0, key, key2); n != 3{
+		t.Errorf("expected 3, got %d", n)
+	}
+	if n := set.SInterCard(2, key, key2); n != 2{
+		t.Errorf("expected 2, got %d", n)
+	}
+	if n := set.SInterCard(5, key, key2); n != 3{
+		t.Errorf("expected 3, got %d", n)
+	}
+	if n := set.SInterCard(0, key, "none"); n != 0{
+		t.Errorf("expected 0, got %d", n)
+	}
+}
@@ -0,0 +1,697 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidID = errors.New("ds/stream: invalid stream id")
+
+	ErrInvalidEncoding = errors.New("ds/stream: invalid encoding")
+)
+
+// MaxID 最大的消息id
+var MaxID = ID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+type (
+	// ID 消息id, 由毫秒时间戳和序号组成
+	ID struct {
+		Ms  uint64
+		Seq uint64
+	}
+
+	// Entry 一条消息
+	Entry struct {
+		ID     ID
+		Fields [][]byte   //field和value交替排列, 消息被删除后为nil
+	}
+
+	// PendingEntry 已投递但还未确认的消息
+	PendingEntry struct {
+		ID            ID
+		Consumer      string
+		DeliveryTime  int64    //最后一次投递的时间, 单位毫秒
+		DeliveryCount int
+	}
+
+	// PendingSummary 消费组待确认消息的汇总
+	PendingSummary struct {
+		Count     int
+		MinID     ID
+		MaxID     ID
+		Consumers map[string]int
+	}
+
+	Stream struct {
+		record Record
+	}
+
+	// Record 存储stream记录
+	Record map[string]*streamItem
+
+	streamItem struct {
+		entries []*Entry               //按id升序排列
+		lastID  ID                     //最后写入的id, 删除消息后也不会回退
+		groups  map[string]*group
+	}
+
+	group struct {
+		lastID    ID                                //最后投递的id
+		pending   map[ID]*PendingEntry
+		consumers map[string]map[ID]*PendingEntry   //每个消费者的待确认消息
+	}
+)
+
+func (id ID) String() string{
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id ID) Less(other ID) bool{
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+func (id ID) next() (ID, bool){
+	if id.Seq < math.MaxUint64{
+		return ID{id.Ms, id.Seq + 1}, true
+	}
+	if id.Ms < math.MaxUint64{
+		return ID{id.Ms + 1, 0}, true
+	}
+	return id, false
+}
+
+func (id ID) prev() (ID, bool){
+	if id.Seq > 0{
+		return ID{id.Ms, id.Seq - 1}, true
+	}
+	if id.Ms > 0{
+		return ID{id.Ms - 1, math.MaxUint64}, true
+	}
+	return id, false
+}
+
+// ParseID 解析 ms-seq 或 ms 格式的id, 省略序号时为0
+func ParseID(s string) (ID, error){
+	return parseID(s, 0)
+}
+
+/*
+ *解析范围查询的边界
+ *"-" 最小id, "+" 最大id, "(" 开头表示开区间
+ *省略序号时, 起始边界取0, 结束边界取最大值
+ */
+func ParseRangeID(s string, isEnd bool) (ID, error){
+	switch s{
+	case "-":
+		return ID{}, nil
+	case "+":
+		return MaxID, nil
+	}
+
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+
+	var seq uint64
+	if isEnd{
+		seq = math.MaxUint64
+	}
+	id, err := parseID(s, seq)
+	if err != nil || !exclusive{
+		return id, err
+	}
+
+	ok := false
+	if isEnd{
+		id, ok = id.prev()
+	}else{
+		id, ok = id.next()
+	}
+	if !ok{
+		return id, ErrInvalidID
+	}
+	return id, nil
+}
+
+func parseID(s string, defaultSeq uint64) (id ID, err error){
+	parts := strings.SplitN(s, "-", 2)
+	if id.Ms, err = strconv.ParseUint(parts[0], 10, 64); err != nil{
+		return id, ErrInvalidID
+	}
+
+	id.Seq = defaultSeq
+	if len(parts) == 2{
+		if id.Seq, err = strconv.ParseUint(parts[1], 10, 64); err != nil{
+			return id, ErrInvalidID
+		}
+	}
+	return
+}
+
+func New() *Stream{
+	return &Stream{
+		make(Record),
+	}
+}
+
+/*
+ *追加一条消息, id必须大于stream中最后的id
+ *@return 是否添加成功
+ */
+func (s *Stream) XAdd(key string, id ID, fields [][]byte) bool{
+	item := s.getOrCreate(key)
+	if !item.lastID.Less(id){
+		return false
+	}
+
+	item.entries = append(item.entries, &Entry{ID: id, Fields: fields})
+	item.lastID = id
+	return true
+}
+
+/*
+ *根据当前的毫秒时间生成下一个id
+ */
+func (s *Stream) NextID(key string, ms uint64) ID{
+	last := s.LastID(key)
+	if ms > last.Ms{
+		return ID{ms, 0}
+	}
+
+	id, _ := last.next()
+	return id
+}
+
+/*
+ *id为 ms-* 时生成序号, ms小于最后的id时返回false
+ */
+func (s *Stream) NextSeq(key string, ms uint64) (ID, bool){
+	last := s.LastID(key)
+	if ms > last.Ms{
+		return ID{ms, 0}, true
+	}
+	if ms < last.Ms || last.Seq == math.MaxUint64{
+		return last, false
+	}
+	return ID{ms, last.Seq + 1}, true
+}
+
+func (s *Stream) LastID(key string) ID{
+	if !s.exist(key){
+		return ID{}
+	}
+	return s.record[key].lastID
+}
+
+func (s *Stream) XLen(key string) int{
+	if !s.exist(key){
+		return 0
+	}
+	return len(s.record[key].entries)
+}
+
+/*
+ *设置stream最后的id, 只能增大, stream不存在时会创建
+ */
+func (s *Stream) XSetID(key string, id ID){
+	item := s.getOrCreate(key)
+	if item.lastID.Less(id){
+		item.lastID = id
+	}
+}
+
+// Keys 返回所有stream的key, 按key排序
+func (s *Stream) Keys() (keys []string){
+	for k := range s.record{
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return
+}
+
+func (s *Stream) XKeyExists(key string) bool{
+	return s.exist(key)
+}
+
+func (s *Stream) XClear(key string){
+	delete(s.record, key)
+}
+
+// Get 返回指定id的消息
+func (s *Stream) Get(key string, id ID) *Entry{
+	if !s.exist(key){
+		return nil
+	}
+
+	item := s.record[key]
+	if i, ok := item.search(id); ok{
+		return item.entries[i]
+	}
+	return nil
+}
+
+/*
+ *返回id在[start, end]之间的消息, count <= 0 时不限制数量
+ */
+func (s *Stream) XRange(key string, start, end ID, count int) (val []*Entry){
+	if !s.exist(key) || end.Less(start){
+		return
+	}
+
+	entries := s.record[key].entries
+	i, _ := s.record[key].search(start)
+	for ; i < len(entries) && !end.Less(entries[i].ID); i++{
+		val = append(val, entries[i])
+		if count > 0 && len(val) == count{
+			break
+		}
+	}
+	return
+}
+
+/*
+ *返回id在[start, end]之间的消息, 按id从大到小排列
+ */
+func (s *Stream) XRevRange(key string, end, start ID, count int) (val []*Entry){
+	if !s.exist(key) || end.Less(start){
+		return
+	}
+
+	entries := s.record[key].entries
+	i := sort.Search(len(entries), func(i int) bool {
+		return end.Less(entries[i].ID)
+	}) - 1
+	for ; i >= 0 && !entries[i].ID.Less(start); i--{
+		val = append(val, entries[i])
+		if count > 0 && len(val) == count{
+			break
+		}
+	}
+	return
+}
+
+/*
+ *返回id大于after的消息
+ */
+func (s *Stream) XRead(key string, after ID, count int) []*Entry{
+	start, ok := after.next()
+	if !ok{
+		return nil
+	}
+	return s.XRange(key, start, MaxID, count)
+}
+
+func (s *Stream) XDel(key string, id ID) bool{
+	if !s.exist(key){
+		return false
+	}
+
+	item := s.record[key]
+	i, ok := item.search(id)
+	if ok{
+		item.entries = append(item.entries[:i], item.entries[i+1:]...)
+	}
+	return ok
+}
+
+/*
+ *只保留最新的maxLen条消息
+ *@return 删除的消息数量
+ */
+func (s *Stream) XTrim(key string, maxLen int) int{
+	if !s.exist(key) || maxLen < 0{
+		return 0
+	}
+
+	item := s.record[key]
+	n := len(item.entries) - maxLen
+	if n <= 0{
+		return 0
+	}
+
+	item.entries = append([]*Entry(nil), item.entries[n:]...)
+	return n
+}
+
+/*
+ *删除id小于minID的消息
+ *@return 删除的消息数量
+ */
+func (s *Stream) XTrimMinID(key string, minID ID) int{
+	if !s.exist(key){
+		return 0
+	}
+
+	item := s.record[key]
+	n, _ := item.search(minID)
+	if n > 0{
+		item.entries = append([]*Entry(nil), item.entries[n:]...)
+	}
+	return n
+}
+
+/*
+ *创建消费组, 从id之后开始投递, stream不存在时会创建
+ *@return 消费组已存在时返回false
+ */
+func (s *Stream) XGroupCreate(key, name string, id ID) bool{
+	item := s.getOrCreate(key)
+	if _, exist := item.groups[name]; exist{
+		return false
+	}
+
+	item.groups[name] = &group{
+		lastID:    id,
+		pending:   make(map[ID]*PendingEntry),
+		consumers: make(map[string]map[ID]*PendingEntry),
+	}
+	return true
+}
+
+// Groups 返回stream的所有消费组名称, 按名称排序
+func (s *Stream) Groups(key string) (names []string){
+	if !s.exist(key){
+		return
+	}
+	for name := range s.record[key].groups{
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+/*
+ *返回消费组最后投递的id和按id排序的待确认消息
+ */
+func (s *Stream) GroupState(key, name string) (lastID ID, pending []*PendingEntry){
+	g := s.group(key, name)
+	if g == nil{
+		return
+	}
+
+	var ids []ID
+	for id := range g.pending{
+		ids = append(ids, id)
+	}
+	sortIDs(ids)
+	for _, id := range ids{
+		pe := *g.pending[id]
+		pending = append(pending, &pe)
+	}
+	return g.lastID, pending
+}
+
+/*
+ *按GroupState的结果恢复消费组, 已存在的消费组会被替换
+ */
+func (s *Stream) XGroupRestore(key, name string, lastID ID, pending []*PendingEntry){
+	s.XGroupDestroy(key, name)
+	s.XGroupCreate(key, name, lastID)
+
+	g := s.group(key, name)
+	for _, p := range pending{
+		pe := *p
+		g.pending[pe.ID] = &pe
+		g.consumer(pe.Consumer)[pe.ID] = &pe
+	}
+}
+
+func (s *Stream) XGroupExists(key, name string) bool{
+	return s.group(key, name) != nil
+}
+
+func (s *Stream) XGroupDestroy(key, name string) bool{
+	if s.group(key, name) == nil{
+		return false
+	}
+
+	delete(s.record[key].groups, name)
+	return true
+}
+
+/*
+ *删除消费者, 同时删除它的待确认消息
+ *@return 删除的待确认消息数量
+ */
+func (s *Stream) XGroupDelConsumer(key, name, consumer string) int{
+	g := s.group(key, name)
+	if g == nil{
+		return 0
+	}
+
+	pending := g.consumers[consumer]
+	for id := range pending{
+		delete(g.pending, id)
+	}
+	delete(g.consumers, consumer)
+	return len(pending)
+}
+
+/*
+ *将消费组中还未投递过的消息投递给consumer
+ */
+func (s *Stream) XReadGroup(key, name, consumer string, count int, noAck bool, now int64) []*Entry{
+	g := s.group(key, name)
+	if g == nil{
+		return nil
+	}
+
+	entries := s.XRead(key, g.lastID, count)
+	ids := make([]ID, len(entries))
+	for i, e := range entries{
+		ids[i] = e.ID
+	}
+	s.Deliver(key, name, consumer, ids, noAck, now)
+	return entries
+}
+
+/*
+ *记录消息已投递给consumer, noAck为true时不加入待确认列表
+ */
+func (s *Stream) Deliver(key, name, consumer string, ids []ID, noAck bool, now int64){
+	g := s.group(key, name)
+	if g == nil{
+		return
+	}
+
+	cons := g.consumer(consumer)
+	for _, id := range ids{
+		if g.lastID.Less(id){
+			g.lastID = id
+		}
+		if noAck{
+			continue
+		}
+
+		if pe, exist := g.pending[id]; exist{
+			delete(g.consumers[pe.Consumer], id)
+		}
+		pe := &PendingEntry{ID: id, Consumer: consumer, DeliveryTime: now, DeliveryCount: 1}
+		g.pending[id] = pe
+		cons[id] = pe
+	}
+}
+
+/*
+ *返回已投递给consumer但还未确认, 且id大于after的消息
+ */
+func (s *Stream) XReadGroupPending(key, name, consumer string, after ID, count int) (val []*Entry){
+	g := s.group(key, name)
+	if g == nil{
+		return
+	}
+
+	var ids []ID
+	for id := range g.consumers[consumer]{
+		if after.Less(id){
+			ids = append(ids, id)
+		}
+	}
+	sortIDs(ids)
+
+	for _, id := range ids{
+		e := s.Get(key, id)
+		if e == nil{
+			e = &Entry{ID: id}
+		}
+		val = append(val, e)
+		if count > 0 && len(val) == count{
+			break
+		}
+	}
+	return
+}
+
+func (s *Stream) XAck(key, name string, id ID) bool{
+	g := s.group(key, name)
+	if g == nil{
+		return false
+	}
+
+	pe, exist := g.pending[id]
+	if !exist{
+		return false
+	}
+	delete(g.pending, id)
+	delete(g.consumers[pe.Consumer], id)
+	return true
+}
+
+func (s *Stream) XPending(key, name string) (sum PendingSummary){
+	g := s.group(key, name)
+	if g == nil || len(g.pending) == 0{
+		return
+	}
+
+	sum.Count = len(g.pending)
+	sum.MinID = MaxID
+	sum.Consumers = make(map[string]int)
+	for id, pe := range g.pending{
+		if id.Less(sum.MinID){
+			sum.MinID = id
+		}
+		if sum.MaxID.Less(id){
+			sum.MaxID = id
+		}
+		sum.Consumers[pe.Consumer]++
+	}
+	return
+}
+
+/*
+ *返回id在[start, end]之间的待确认消息
+ *consumer不为空时只返回该消费者的消息, minIdle为最小空闲时间, 单位毫秒
+ */
+func (s *Stream) XPendingRange(key, name string, start, end ID, count int, consumer string, minIdle, now int64) (val []*PendingEntry){
+	g := s.group(key, name)
+	if g == nil || end.Less(start){
+		return
+	}
+
+	pending := g.pending
+	if consumer != ""{
+		pending = g.consumers[consumer]
+	}
+
+	var ids []ID
+	for id := range pending{
+		if !id.Less(start) && !end.Less(id){
+			ids = append(ids, id)
+		}
+	}
+	sortIDs(ids)
+
+	for _, id := range ids{
+		pe := pending[id]
+		if now - pe.DeliveryTime < minIdle{
+			continue
+		}
+		val = append(val, pe)
+		if count > 0 && len(val) == count{
+			break
+		}
+	}
+	return
+}
+
+/*
+ *将空闲时间不小于minIdle的待确认消息转移给consumer
+ *已删除的消息会从待确认列表中移除, justID为true时不增加投递次数
+ *@return 转移成功的id
+ */
+func (s *Stream) XClaim(key, name, consumer string, ids []ID, minIdle, now int64, justID bool) (claimed []ID){
+	g := s.group(key, name)
+	if g == nil{
+		return
+	}
+
+	cons := g.consumer(consumer)
+	for _, id := range ids{
+		pe, exist := g.pending[id]
+		if !exist || now - pe.DeliveryTime < minIdle{
+			continue
+		}
+
+		delete(g.consumers[pe.Consumer], id)
+		if s.Get(key, id) == nil{
+			delete(g.pending, id)
+			continue
+		}
+
+		pe.Consumer = consumer
+		pe.DeliveryTime = now
+		if !justID{
+			pe.DeliveryCount++
+		}
+		cons[id] = pe
+		claimed = append(claimed, id)
+	}
+	return
+}
+
+// EncodeIDs 编码一组id, 每个id占16字节
+func EncodeIDs(ids []ID) []byte{
+	buf := make([]byte, 16*len(ids))
+	for i, id := range ids{
+		binary.BigEndian.PutUint64(buf[i*16:], id.Ms)
+		binary.BigEndian.PutUint64(buf[i*16+8:], id.Seq)
+	}
+	return buf
+}
+
+func DecodeIDs(buf []byte) ([]ID, error){
+	if len(buf) % 16 != 0{
+		return nil, ErrInvalidEncoding
+	}
+
+	ids := make([]ID, len(buf) / 16)
+	for i := range ids{
+		ids[i].Ms = binary.BigEndian.Uint64(buf[i*16:])
+		ids[i].Seq = binary.BigEndian.Uint64(buf[i*16+8:])
+	}
+	return ids, nil
+}
+
+func (s *Stream) exist(key string) bool{
+	_, exist := s.record[key]
+	return exist
+}
+
+func (s *Stream) getOrCreate(key string) *streamItem{
+	if !s.exist(key){
+		s.record[key] = &streamItem{groups: make(map[string]*group)}
+	}
+	return s.record[key]
+}
+
+func (s *Stream) group(key, name string) *group{
+	if !s.exist(key){
+		return nil
+	}
+	return s.record[key].groups[name]
+}
+
+func (g *group) consumer(name string) map[ID]*PendingEntry{
+	if g.consumers[name] == nil{
+		g.consumers[name] = make(map[ID]*PendingEntry)
+	}
+	return g.consumers[name]
+}
+
+//二分查找第一个不小于id的位置
+func (item *streamItem) search(id ID) (int, bool){
+	i := sort.Search(len(item.entries), func(i int) bool {
+		return !item.entries[i].ID.Less(id)
+	})
+	return i, i < len(item.entries) && item.entries[i].ID == id
+}
+
+func sortIDs(ids []ID){
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Less(ids[j])
+	})
+}
@@ -0,0 +1,135 @@
+package stream
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+var key = "my_stream"
+
+func InitStream() *Stream{
+	s := New()
+	for i := uint64(1); i <= 5; i++{
+		s.XAdd(key, ID{Ms: 100, Seq: i}, [][]byte{[]byte("field"), []byte("value")})
+	}
+	return s
+}
+
+func TestParseRangeID(t *testing.T) {
+	id, err := ParseRangeID("-", false)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{}, id)
+
+	id, err = ParseRangeID("100", true)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Ms: 100, Seq: MaxID.Seq}, id)
+
+	id, err = ParseRangeID("(100-3", false)
+	assert.Nil(t, err)
+	assert.Equal(t, ID{Ms: 100, Seq: 4}, id)
+
+	_, err = ParseRangeID("(0-0", true)
+	assert.Equal(t, ErrInvalidID, err)
+
+	_, err = ParseID("abc")
+	assert.Equal(t, ErrInvalidID, err)
+}
+
+func TestStream_XAdd(t *testing.T) {
+	s := InitStream()
+	assert.Equal(t, 5, s.XLen(key))
+	assert.False(t, s.XAdd(key, ID{Ms: 100, Seq: 5}, nil))
+	assert.Equal(t, ID{Ms: 100, Seq: 6}, s.NextID(key, 99))
+	assert.Equal(t, ID{Ms: 101, Seq: 0}, s.NextID(key, 101))
+
+	_, ok := s.NextSeq(key, 99)
+	assert.False(t, ok)
+}
+
+func TestStream_XRange(t *testing.T) {
+	s := InitStream()
+
+	entries := s.XRange(key, ID{Ms: 100, Seq: 2}, MaxID, 2)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, ID{Ms: 100, Seq: 2}, entries[0].ID)
+
+	entries = s.XRevRange(key, ID{Ms: 100, Seq: 4}, ID{}, 0)
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, ID{Ms: 100, Seq: 4}, entries[0].ID)
+
+	entries = s.XRead(key, ID{Ms: 100, Seq: 4}, 0)
+	assert.Equal(t, 1, len(entries))
+}
+
+func TestStream_XDelAndTrim(t *testing.T) {
+	s := InitStream()
+
+	assert.True(t, s.XDel(key, ID{Ms: 100, Seq: 3}))
+	assert.False(t, s.XDel(key, ID{Ms: 100, Seq: 3}))
+	assert.Equal(t, 2, s.XTrim(key, 2))
+	assert.Equal(t, 1, s.XTrimMinID(key, ID{Ms: 100, Seq: 5}))
+	assert.Equal(t, 1, s.XLen(key))
+	assert.Equal(t, ID{Ms: 100, Seq: 5}, s.LastID(key))
+}
+
+func TestStream_XReadGroup(t *testing.T) {
+	s := InitStream()
+	assert.True(t, s.XGroupCreate(key, "g", ID{}))
+	assert.False(t, s.XGroupCreate(key, "g", ID{}))
+
+	entries := s.XReadGroup(key, "g", "alice", 2, false, 1000)
+	assert.Equal(t, 2, len(entries))
+	entries = s.XReadGroup(key, "g", "bob", 0, false, 1000)
+	assert.Equal(t, 3, len(entries))
+
+	sum := s.XPending(key, "g")
+	assert.Equal(t, 5, sum.Count)
+	assert.Equal(t, 2, sum.Consumers["alice"])
+
+	assert.True(t, s.XAck(key, "g", ID{Ms: 100, Seq: 1}))
+	assert.Equal(t, 1, len(s.XReadGroupPending(key, "g", "alice", ID{}, 0)))
+
+	claimed := s.XClaim(key, "g", "alice", []ID{{Ms: 100, Seq: 3}}, 500, 1200, false)
+	assert.Equal(t, 0, len(claimed))
+	claimed = s.XClaim(key, "g", "alice", []ID{{Ms: 100, Seq: 3}}, 500, 1600, false)
+	assert.Equal(t, []ID{{Ms: 100, Seq: 3}}, claimed)
+
+	pending := s.XPendingRange(key, "g", ID{}, MaxID, 0, "alice", 0, 1600)
+	assert.Equal(t, 2, len(pending))
+	assert.Equal(t, 2, pending[1].DeliveryCount)
+
+	assert.Equal(t, 2, s.XGroupDelConsumer(key, "g", "bob"))
+	assert.True(t, s.XGroupDestroy(key, "g"))
+}
+
+func TestStream_GroupRestore(t *testing.T) {
+	s := InitStream()
+	s.XGroupCreate(key, "g", ID{})
+	s.XReadGroup(key, "g", "alice", 2, false, 1000)
+	s.XClaim(key, "g", "bob", []ID{{Ms: 100, Seq: 2}}, 0, 1500, false)
+	s.XDel(key, ID{Ms: 100, Seq: 5})
+	lastID, pending := s.GroupState(key, "g")
+
+	//按快照恢复到新的stream中
+	r := New()
+	for _, e := range s.XRange(key, ID{}, MaxID, 0){
+		r.XAdd(key, e.ID, e.Fields)
+	}
+	r.XSetID(key, s.LastID(key))
+	r.XGroupRestore(key, "g", lastID, pending)
+
+	assert.Equal(t, []string{key}, r.Keys())
+	assert.Equal(t, []string{"g"}, r.Groups(key))
+	assert.Equal(t, ID{Ms: 100, Seq: 5}, r.LastID(key))
+	assert.Equal(t, 4, r.XLen(key))
+	assert.Equal(t, s.XPending(key, "g"), r.XPending(key, "g"))
+	assert.Equal(t, s.XPendingRange(key, "g", ID{}, MaxID, 0, "bob", 0, 2000), r.XPendingRange(key, "g", ID{}, MaxID, 0, "bob", 0, 2000))
+	assert.Equal(t, 2, len(r.XReadGroup(key, "g", "alice", 0, false, 2000)))
+}
+
+func TestEncodeIDs(t *testing.T) {
+	ids := []ID{{Ms: 1, Seq: 2}, {Ms: 3, Seq: 4}}
+	decoded, err := DecodeIDs(EncodeIDs(ids))
+	assert.Nil(t, err)
+	assert.Equal(t, ids, decoded)
+}
@@ -3,6 +3,7 @@ package zset
 import (
 	"math"
 	"math/rand"
+	"sort"
 )
 
 const (
@@ -40,6 +41,42 @@ type (
 	}
 )
 
+// ScoreRange score区间, MinEx和MaxEx为true时不包含对应的边界
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+type (
+	// LexBound 字典序区间的边界, Inf为-1和1时分别表示负无穷(-)和正无穷(+), 此时忽略Member
+	LexBound struct {
+		Member    string
+		Exclusive bool
+		Inf       int8
+	}
+
+	// LexRange 成员的字典序区间, 只在所有成员score相同时有意义
+	LexRange struct {
+		Min, Max LexBound
+	}
+)
+
+//score区间或者字典序区间
+type rangeSpec interface {
+	empty() bool
+	gteMin(n *sklNode) bool
+	lteMax(n *sklNode) bool
+}
+
+// Aggregate 多个集合中同一成员的score的合并方式
+type Aggregate uint8
+
+const (
+	AggregateSum Aggregate = iota
+	AggregateMin
+	AggregateMax
+)
+
 func New() *SortedSet {
 	return &SortedSet{
 		make(map[string]*SortedSetNode),
@@ -82,6 +119,10 @@ func (z *SortedSet) ZRem(key, member string) bool{
 	if exist {
 		z.record[key].skl.sklDelete(v.score, member)
 		delete(z.record[key].dict, member)
+		//成员全部删除后key不再存在
+		if len(z.record[key].dict) == 0{
+			delete(z.record, key)
+		}
 		return true
 	}
 
@@ -110,6 +151,19 @@ func (z *SortedSet) ZScore(key string, member string) float64{
 	return node.score
 }
 
+// ZMemberScore 返回成员的score, 成员不存在时ok为false
+func (z *SortedSet) ZMemberScore(key, member string)(score float64, ok bool){
+	if !z.exist(key){
+		return
+	}
+
+	node, ok := z.record[key].dict[member]
+	if !ok{
+		return
+	}
+	return node.score, true
+}
+
 func (z *SortedSet) ZCard(key string) int{
 	if !z.exist(key){
 		return 0
@@ -235,79 +289,127 @@ func (z *SortedSet) ZRevGetByRank(key string, rank int)(val []interface{}){
  *通过score返回成员member和score
  */
 func (z *SortedSet) ZScoreRange(key string, min, max float64)(val []interface{}){
-	if !z.exist(key) || min > max{
-		return
-	}
+	return z.ZRangeByScore(key, ScoreRange{Min: min, Max: max}, false, 0, -1)
+}
 
-	item := z.record[key].skl
-	minScore := item.head.level[0].forward.score
-	if min < minScore{
-		min = minScore
-	}
+/*
+ *通过score返回成员member和score 成员按score从高到低排序
+ */
+func (z *SortedSet) ZRevScoreRange(key string, max, min float64)(val []interface{}){
+	return z.ZRangeByScore(key, ScoreRange{Min: min, Max: max}, true, 0, -1)
+}
 
-	maxScore  := item.tail.score
-	if max > maxScore{
-		max = maxScore
-	}
+/*
+ *返回score在区间r内的成员member和score, reverse为true时按score从高到低排序
+ *跳过前offset个成员, 最多返回count个成员, count小于0时返回全部
+ */
+func (z *SortedSet) ZRangeByScore(key string, r ScoreRange, reverse bool, offset, count int)(val []interface{}){
+	return z.rangeBySpec(key, r, reverse, offset, count, true)
+}
 
-	p := item.head
-	for i := item.level - 1; i >= 0; i--{
-		for p.level[i].forward != nil && p.level[i].forward.score < min{
-			p = p.level[i].forward
-		}
-	}
+// ZCount 返回score在区间r内的成员数量
+func (z *SortedSet) ZCount(key string, r ScoreRange) int{
+	return z.countBySpec(key, r)
+}
 
-	p = p.level[0].forward
-	for p != nil{
-		if p.score > max{
-			break
-		}
+/*
+ *返回字典序在区间r内的成员member, reverse为true时按字典序从大到小排序
+ *offset和count同ZRangeByScore
+ */
+func (z *SortedSet) ZRangeByLex(key string, r LexRange, reverse bool, offset, count int)(val []interface{}){
+	return z.rangeBySpec(key, r, reverse, offset, count, false)
+}
 
-		val = append(val, p.member, p.score)
-		p = p.level[0].forward
-	}
-	return
+// ZLexCount 返回字典序在区间r内的成员数量
+func (z *SortedSet) ZLexCount(key string, r LexRange) int{
+	return z.countBySpec(key, r)
 }
 
 /*
- *通过索引返回成员member和score 成员按score从高到低排序
+ *返回所有key的并集, 成员和score交替排列, 按score从低到高排序
+ *weights为每个key的score的权重, 为nil时均为1
  */
-func (z *SortedSet) ZRevScoreRange(key string, max, min float64)(val []interface{}){
-	if !z.exist(key) || max < min{
-		return
-	}
-
-	item := z.record[key].skl
-	minScore := item.head.level[0].forward.score
-	if min < minScore{
-		min = minScore
+func (z *SortedSet) ZUnion(keys []string, weights []float64, agg Aggregate) []interface{}{
+	res := make(map[string]float64)
+	for i, k := range keys{
+		if !z.exist(k){
+			continue
+		}
+		for member, node := range z.record[k].dict{
+			score := weightedScore(node.score, weights, i)
+			if old, ok := res[member]; ok{
+				score = aggregate(old, score, agg)
+			}
+			res[member] = score
+		}
 	}
+	return sortedPairs(res)
+}
 
-	maxScore := item.tail.score
-	if max > maxScore{
-		max = maxScore
+// ZInter 返回所有key的交集, 参数同ZUnion
+func (z *SortedSet) ZInter(keys []string, weights []float64, agg Aggregate) []interface{}{
+	if len(keys) == 0{
+		return nil
 	}
 
-	p := item.head
-	for i := item.level - 1; i >= 0; i--{
-		for p.level[i].forward != nil && p.level[i].forward.score <= max{
-			p = p.level[i].forward
+	//从最小的集合开始遍历
+	smallest := 0
+	for i, k := range keys{
+		if !z.exist(k){
+			return nil
+		}
+		if len(z.record[k].dict) < len(z.record[keys[smallest]].dict){
+			smallest = i
 		}
 	}
 
-	for p != nil{
-		if p.score < min{
-			break
+	res := make(map[string]float64)
+	for member := range z.record[keys[smallest]].dict{
+		var score float64
+		found := true
+		for i, k := range keys{
+			node, ok := z.record[k].dict[member]
+			if !ok{
+				found = false
+				break
+			}
+			if i == 0{
+				score = weightedScore(node.score, weights, i)
+			}else{
+				score = aggregate(score, weightedScore(node.score, weights, i), agg)
+			}
+		}
+		if found{
+			res[member] = score
 		}
+	}
+	return sortedPairs(res)
+}
 
-		val = append(val, p.member, p.score)
-		p = p.backward
+// ZDiff 返回第一个key中不在其他key中的成员, score为第一个key中的score
+func (z *SortedSet) ZDiff(keys []string) []interface{}{
+	if len(keys) == 0 || !z.exist(keys[0]){
+		return nil
 	}
 
-	return
+	res := make(map[string]float64)
+	for member, node := range z.record[keys[0]].dict{
+		found := false
+		for _, k := range keys[1:]{
+			if z.exist(k){
+				if _, ok := z.record[k].dict[member]; ok{
+					found = true
+					break
+				}
+			}
+		}
+		if !found{
+			res[member] = node.score
+		}
+	}
+	return sortedPairs(res)
 }
 
-
 func (z *SortedSet) exist(key string) bool{
 	_, exist := z.record[key]
 	return exist
@@ -339,6 +441,51 @@ func (z *SortedSet) getByRank(key string, rank int64, reverse bool)(string, floa
 }
 
 
+func (z *SortedSet) rangeBySpec(key string, r rangeSpec, reverse bool, offset, count int, withScores bool)(val []interface{}){
+	if !z.exist(key) || r.empty() || offset < 0{
+		return
+	}
+
+	skl := z.record[key].skl
+	var p *sklNode
+	if reverse{
+		p = skl.lastInRange(r)
+	}else{
+		p = skl.firstInRange(r)
+	}
+
+	for ; p != nil && offset > 0; offset--{
+		p = p.next(reverse)
+	}
+	for p != nil && count != 0{
+		if !r.gteMin(p) || !r.lteMax(p){
+			break
+		}
+		if withScores{
+			val = append(val, p.member, p.score)
+		}else{
+			val = append(val, p.member)
+		}
+		p = p.next(reverse)
+		count--
+	}
+	return
+}
+
+func (z *SortedSet) countBySpec(key string, r rangeSpec) int{
+	if !z.exist(key) || r.empty(){
+		return 0
+	}
+
+	skl := z.record[key].skl
+	first := skl.firstInRange(r)
+	if first == nil{
+		return 0
+	}
+	last := skl.lastInRange(r)
+	return int(skl.sklGetRank(last.score, last.member) - skl.sklGetRank(first.score, first.member) + 1)
+}
+
 func (z *SortedSet) findRange(key string, start, stop int64, reverse bool, withScores bool)(val []interface{}){
 	skl := z.record[key].skl
 	length := skl.length
@@ -393,6 +540,101 @@ func (z *SortedSet) findRange(key string, start, stop int64, reverse bool, withS
 	return
 }
 
+//0乘以无穷大时结果为0, 同redis
+func weightedScore(score float64, weights []float64, i int) float64{
+	if weights == nil{
+		return score
+	}
+	if res := score * weights[i]; !math.IsNaN(res){
+		return res
+	}
+	return 0
+}
+
+func aggregate(a, b float64, agg Aggregate) float64{
+	switch agg {
+	case AggregateMin:
+		return math.Min(a, b)
+	case AggregateMax:
+		return math.Max(a, b)
+	default:
+		//正负无穷大相加时结果为0, 同redis
+		if res := a + b; !math.IsNaN(res){
+			return res
+		}
+		return 0
+	}
+}
+
+//按score和member排序, 返回成员和score交替排列的结果
+func sortedPairs(scores map[string]float64) []interface{}{
+	members := make([]string, 0, len(scores))
+	for m := range scores{
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		si, sj := scores[members[i]], scores[members[j]]
+		return si < sj || (si == sj && members[i] < members[j])
+	})
+
+	val := make([]interface{}, 0, len(members) * 2)
+	for _, m := range members{
+		val = append(val, m, scores[m])
+	}
+	return val
+}
+
+func (r ScoreRange) empty() bool{
+	return r.Min > r.Max || (r.Min == r.Max && (r.MinEx || r.MaxEx))
+}
+
+func (r ScoreRange) gteMin(n *sklNode) bool{
+	if r.MinEx{
+		return n.score > r.Min
+	}
+	return n.score >= r.Min
+}
+
+func (r ScoreRange) lteMax(n *sklNode) bool{
+	if r.MaxEx{
+		return n.score < r.Max
+	}
+	return n.score <= r.Max
+}
+
+func (r LexRange) empty() bool{
+	if r.Min.Inf > 0 || r.Max.Inf < 0{
+		return true
+	}
+	if r.Min.Inf < 0 || r.Max.Inf > 0{
+		return false
+	}
+	return r.Min.Member > r.Max.Member ||
+		(r.Min.Member == r.Max.Member && (r.Min.Exclusive || r.Max.Exclusive))
+}
+
+func (r LexRange) gteMin(n *sklNode) bool{
+	switch {
+	case r.Min.Inf != 0:
+		return r.Min.Inf < 0
+	case r.Min.Exclusive:
+		return n.member > r.Min.Member
+	default:
+		return n.member >= r.Min.Member
+	}
+}
+
+func (r LexRange) lteMax(n *sklNode) bool{
+	switch {
+	case r.Max.Inf != 0:
+		return r.Max.Inf > 0
+	case r.Max.Exclusive:
+		return n.member < r.Max.Member
+	default:
+		return n.member <= r.Max.Member
+	}
+}
+
 //跳跃表新结点
 func sklNewNode(level int16, score float64, member string) *sklNode{
 	node := &sklNode{
@@ -534,6 +776,45 @@ func (skl *skipList) sklDelete(score float64, member string){
 	}
 }
 
+//返回第一个在区间r内的结点, 不存在时返回nil
+func (skl *skipList) firstInRange(r rangeSpec) *sklNode{
+	p := skl.head
+	for i := skl.level - 1; i >= 0; i--{
+		for p.level[i].forward != nil && !r.gteMin(p.level[i].forward){
+			p = p.level[i].forward
+		}
+	}
+
+	p = p.level[0].forward
+	if p == nil || !r.lteMax(p){
+		return nil
+	}
+	return p
+}
+
+//返回最后一个在区间r内的结点, 不存在时返回nil
+func (skl *skipList) lastInRange(r rangeSpec) *sklNode{
+	p := skl.head
+	for i := skl.level - 1; i >= 0; i--{
+		for p.level[i].forward != nil && r.lteMax(p.level[i].forward){
+			p = p.level[i].forward
+		}
+	}
+
+	if p == skl.head || !r.gteMin(p){
+		return nil
+	}
+	return p
+}
+
+//按顺序返回下一个结点, reverse为true时返回前一个结点
+func (n *sklNode) next(reverse bool) *sklNode{
+	if reverse{
+		return n.backward
+	}
+	return n.level[0].forward
+}
+
 func (skl *skipList) sklGetRank(score float64, member string) int64{
 	var rank uint64 = 0
 	p := skl.head
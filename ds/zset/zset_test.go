@@ -2,6 +2,7 @@ package zset
 
 import (
 	"fmt"
+	"math"
 	"testing"
 )
 
@@ -111,4 +112,140 @@ func TestSortedSet_ZRevScoreRange(t *testing.T) {
 	for _, v := range data{
 		fmt.Printf("%+v\n", v)
 	}
-}
\ No newline at end of file
+}
+func TestSortedSet_ZUnion(t *testing.T) {
+	zSet := New()
+	zSet.ZAdd("z1", 1, "a")
+	zSet.ZAdd("z1", 2, "b")
+	zSet.ZAdd("z2", 3, "b")
+	zSet.ZAdd("z2", 4, "c")
+
+	data := zSet.ZUnion([]string{"z1", "z2", "none"}, nil, AggregateSum)
+	expected := []interface{}{"a", float64(1), "c", float64(4), "b", float64(5)}
+	if fmt.Sprint(data) != fmt.Sprint(expected){
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+
+	data = zSet.ZUnion([]string{"z1", "z2"}, []float64{2, 1}, AggregateMax)
+	expected = []interface{}{"a", float64(2), "b", float64(4), "c", float64(4)}
+	if fmt.Sprint(data) != fmt.Sprint(expected){
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestSortedSet_ZInter(t *testing.T) {
+	zSet := New()
+	zSet.ZAdd("z1", 1, "a")
+	zSet.ZAdd("z1", 2, "b")
+	zSet.ZAdd("z2", 3, "b")
+	zSet.ZAdd("z2", 4, "c")
+
+	data := zSet.ZInter([]string{"z1", "z2"}, nil, AggregateMin)
+	expected := []interface{}{"b", float64(2)}
+	if fmt.Sprint(data) != fmt.Sprint(expected){
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+	if data = zSet.ZInter([]string{"z1", "none"}, nil, AggregateSum); len(data) != 0{
+		t.Errorf("expected empty, got %v", data)
+	}
+}
+
+func TestSortedSet_ZDiff(t *testing.T) {
+	zSet := New()
+	zSet.ZAdd("z1", 1, "a")
+	zSet.ZAdd("z1", 2, "b")
+	zSet.ZAdd("z2", 3, "b")
+
+	data := zSet.ZDiff([]string{"z1", "z2"})
+	expected := []interface{}{"a", float64(1)}
+	if fmt.Sprint(data) != fmt.Sprint(expected){
+		t.Errorf("expected %v, got %v", expected, data)
+	}
+}
+
+func TestSortedSet_ZRangeByScore(t *testing.T) {
+	zSet := New()
+	for i := 1; i <= 5; i++{
+		zSet.ZAdd("z", float64(i), fmt.Sprintf("m%d", i))
+	}
+
+	tests := []struct{
+		r        ScoreRange
+		reverse  bool
+		offset   int
+		count    int
+		expected []interface{}
+	}{
+		{ScoreRange{Min: 2, Max: 4}, false, 0, -1, []interface{}{"m2", float64(2), "m3", float64(3), "m4", float64(4)}},
+		{ScoreRange{Min: 2, Max: 4, MinEx: true, MaxEx: true}, false, 0, -1, []interface{}{"m3", float64(3)}},
+		{ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}, true, 1, 2, []interface{}{"m4", float64(4), "m3", float64(3)}},
+		{ScoreRange{Min: 2, Max: 4, MaxEx: true}, true, 0, -1, []interface{}{"m3", float64(3), "m2", float64(2)}},
+		{ScoreRange{Min: -10, Max: -5}, true, 0, -1, nil},
+		{ScoreRange{Min: 3, Max: 3, MinEx: true}, false, 0, -1, nil},
+		{ScoreRange{Min: 1, Max: 5}, false, 5, -1, nil},
+	}
+	for _, tt := range tests{
+		data := zSet.ZRangeByScore("z", tt.r, tt.reverse, tt.offset, tt.count)
+		if fmt.Sprint(data) != fmt.Sprint(tt.expected){
+			t.Errorf("range %+v reverse %v: expected %v, got %v", tt.r, tt.reverse, tt.expected, data)
+		}
+	}
+}
+
+func TestSortedSet_ZCount(t *testing.T) {
+	zSet := New()
+	for i := 1; i <= 5; i++{
+		zSet.ZAdd("z", float64(i), fmt.Sprintf("m%d", i))
+	}
+
+	if n := zSet.ZCount("z", ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}); n != 5{
+		t.Errorf("expected 5, got %d", n)
+	}
+	if n := zSet.ZCount("z", ScoreRange{Min: 1, Max: 4, MinEx: true}); n != 3{
+		t.Errorf("expected 3, got %d", n)
+	}
+	if n := zSet.ZCount("z", ScoreRange{Min: 6, Max: 10}); n != 0{
+		t.Errorf("expected 0, got %d", n)
+	}
+}
+
+func TestSortedSet_ZRemLast(t *testing.T) {
+	zSet := New()
+	zSet.ZAdd("z", 1, "a")
+	if !zSet.ZRem("z", "a") || zSet.ZKeyExists("z"){
+		t.Error("key should not exist after all members are removed")
+	}
+}
+
+func TestSortedSet_ZRangeByLex(t *testing.T) {
+	zSet := New()
+	for _, m := range []string{"a", "b", "c", "d", "e"}{
+		zSet.ZAdd("z", 0, m)
+	}
+
+	minusInf, plusInf := LexBound{Inf: -1}, LexBound{Inf: 1}
+	tests := []struct{
+		r        LexRange
+		reverse  bool
+		offset   int
+		count    int
+		expected []interface{}
+	}{
+		{LexRange{minusInf, plusInf}, false, 0, -1, []interface{}{"a", "b", "c", "d", "e"}},
+		{LexRange{LexBound{Member: "b"}, LexBound{Member: "d", Exclusive: true}}, false, 0, -1, []interface{}{"b", "c"}},
+		{LexRange{LexBound{Member: "b", Exclusive: true}, plusInf}, true, 1, 2, []interface{}{"d", "c"}},
+		{LexRange{minusInf, LexBound{Member: "c"}}, true, 0, -1, []interface{}{"c", "b", "a"}},
+		{LexRange{plusInf, minusInf}, false, 0, -1, nil},
+		{LexRange{LexBound{Member: "c", Exclusive: true}, LexBound{Member: "c"}}, false, 0, -1, nil},
+	}
+	for _, tt := range tests{
+		data := zSet.ZRangeByLex("z", tt.r, tt.reverse, tt.offset, tt.count)
+		if fmt.Sprint(data) != fmt.Sprint(tt.expected){
+			t.Errorf("range %+v reverse %v: expected %v, got %v", tt.r, tt.reverse, tt.expected, data)
+		}
+	}
+
+	if n := zSet.ZLexCount("z", LexRange{LexBound{Member: "aa"}, plusInf}); n != 4{
+		t.Errorf("expected 4, got %d", n)
+	}
+}
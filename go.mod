@@ -3,7 +3,9 @@ module stardb
 go 1.15
 
 require (
+	github.com/golang/snappy v0.0.4
 	github.com/gomodule/redigo v1.8.5
+	github.com/klauspost/compress v1.13.6
 	github.com/magiconair/properties v1.8.5
 	github.com/pelletier/go-toml v1.9.3
 	github.com/peterh/liner v1.2.1
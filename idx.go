@@ -2,6 +2,7 @@ package stardb
 
 import (
 	"stardb/ds/list"
+	"stardb/ds/stream"
 	"stardb/index"
 	"stardb/storage"
 	"stardb/utils"
@@ -12,13 +13,14 @@ import (
 
 type DataType = uint16
 
-//五种不同的数据类型
+//六种不同的数据类型
 const (
 	String DataType = iota
 	List
 	Hash
 	Set
 	ZSet
+	Stream
 )
 
 //字符串类型操作方式
@@ -27,6 +29,10 @@ const (
 	StringRem						//移除
 	StringExpire					//过期
 	StringPersist					//移动
+	StringSetBit					//设置bit
+	StringMSet						//MSET中的一条, 整组写入后才生效
+	StringBlobChunk					//blob的一个分块
+	StringBlobManifest				//blob的manifest, 分块完整时才生效
 )
 
 //链表操作方式(这些操作会改变数据)
@@ -41,6 +47,7 @@ const (
 	ListLTrim
 	ListLClear
 	ListLExpire
+	ListLMove
 )
 
 const (
@@ -48,6 +55,7 @@ const (
 	HashHDel
 	HashHClear
 	HashHExpire
+	HashHMSet                       //多个field的HSET, value为编码后的field和value
 )
 
 const (
@@ -56,6 +64,7 @@ const (
 	SetSMove
 	SetSClear
 	SetSExpire
+	SetSStore                       //STORE命令替换整个集合, value为编码后的成员
 )
 
 const (
@@ -63,6 +72,24 @@ const (
 	ZSetZRem
 	ZSetZClear
 	ZSetZExpire
+	ZSetZStore                      //STORE命令替换整个有序集合, value为编码后的成员和score
+	ZSetZMRem                       //按区间删除或弹出多个成员, value为编码后的成员
+	ZSetZMAdd                       //一次添加多个成员, value为编码后的成员和score
+)
+
+const (
+	StreamXAdd uint16 = iota
+	StreamXDel
+	StreamXTrim
+	StreamXTrimMinID
+	StreamXGroupCreate
+	StreamXGroupDestroy
+	StreamXGroupDelConsumer
+	StreamXReadGroup
+	StreamXAck
+	StreamXClaim
+	StreamXSetID
+	StreamXGroupSnapshot
 )
 
 func (db *StarDB) buildStringIndex(idx *index.Indexer, entry *storage.Entry){
@@ -70,21 +97,113 @@ func (db *StarDB) buildStringIndex(idx *index.Indexer, entry *storage.Entry){
 		return
 	}
 
+	key := string(idx.Meta.Key)
 	switch entry.GetMark() {
 	case StringSet:
 		db.strIndex.idxList.Put(idx.Meta.Key, idx)
+		delete(db.strIndex.bitmaps, key)
+		delete(db.strIndex.blobs, key)
+		delete(db.expires[String], key)
+	case StringMSet:
+		db.strIndex.idxList.Put(idx.Meta.Key, idx)
+		delete(db.strIndex.bitmaps, key)
+		delete(db.strIndex.blobs, key)
+		delete(db.expires[String], key)
 	case StringRem:
 		db.strIndex.idxList.Remove(idx.Meta.Key)
+		delete(db.strIndex.bitmaps, key)
+		delete(db.strIndex.blobs, key)
 	case StringExpire:
 		if entry.Timestamp < uint64(time.Now().Unix()){ //已过期的数据
 			db.strIndex.idxList.Remove(idx.Meta.Key)
+			delete(db.strIndex.bitmaps, key)
+			delete(db.strIndex.blobs, key)
 		}else{										    //设置过期时间
-			db.expires[String][string(idx.Meta.Key)] = int64(entry.Timestamp)
+			db.expires[String][key] = int64(entry.Timestamp)
 		}
 	case StringPersist:               //将过期数据移到跳表中
 		db.strIndex.idxList.Put(idx.Meta.Key, idx)
-		delete(db.expires[String], string(idx.Meta.Key))
+		delete(db.strIndex.bitmaps, key)
+		delete(db.strIndex.blobs, key)
+		delete(db.expires[String], key)
+	case StringSetBit:                //在之前的值上设置bit
+		offset, err := strconv.Atoi(string(idx.Meta.Extra))
+		if err != nil{
+			return
+		}
+		bit, _ := strconv.Atoi(string(idx.Meta.Value))
+
+		var val []byte
+		if node := db.strIndex.idxList.Get(idx.Meta.Key); node != nil{
+			if val, err = db.readStrVal(node.Value().(*index.Indexer)); err != nil{
+				return
+			}
+		}
+		val = setBit(val, offset, bit)
+		idx.Meta = &storage.Meta{
+			KeySize: uint32(len(idx.Meta.Key)),
+			Key: idx.Meta.Key,
+			Value: val,
+			ValueSize: uint32(len(val)),
+		}
+		db.strIndex.idxList.Put(idx.Meta.Key, idx)
+		db.strIndex.bitmaps[key] = struct{}{}
+		delete(db.strIndex.blobs, key)
+	case StringBlobChunk:
+		db.collectBlobChunk(idx, entry)
+	case StringBlobManifest:
+		db.buildBlobIndex(idx, entry)
+	}
+}
+
+//重放时暂存的一组MSET日志
+type strBatch struct {
+	entries  []*storage.Entry
+	indexers []*index.Indexer
+}
+
+func (b *strBatch) reset(){
+	b.entries, b.indexers = nil, nil
+}
+
+/*
+ *收集MSET日志, 整组读取完成后重建索引, 返回false表示entry不是MSET日志
+ *写入中途崩溃时组不完整, 已收集的日志会在遇到下一条日志时被丢弃
+ */
+func (db *StarDB) collectStrBatch(b *strBatch, e *storage.Entry, idx *index.Indexer) bool{
+	if e.GetMark() != StringMSet{
+		b.reset()
+		return false
+	}
+
+	s := strings.Split(string(e.Meta.Extra), ExtraSeparator)
+	if len(s) != 2{
+		b.reset()
+		return true
+	}
+	i, err1 := strconv.Atoi(s[0])
+	n, err2 := strconv.Atoi(s[1])
+	if err1 != nil || err2 != nil{
+		b.reset()
+		return true
+	}
+	//新的一组开始, 或序号不连续时丢弃之前收集的日志
+	if i != len(b.entries){
+		b.reset()
+		if i != 0{
+			return true
+		}
+	}
+
+	b.entries = append(b.entries, e)
+	b.indexers = append(b.indexers, idx)
+	if len(b.entries) == n{
+		for j := range b.entries{
+			_ = db.buildIndex(b.entries[j], b.indexers[j])
+		}
+		b.reset()
 	}
+	return true
 }
 
 func (db *StarDB) buildListIndex(idx *index.Indexer, entry *storage.Entry){
@@ -136,6 +255,14 @@ func (db *StarDB) buildListIndex(idx *index.Indexer, entry *storage.Entry){
 		}
 	case ListLClear:
 		db.listIndex.indexes.LClear(key)
+	case ListLMove:
+		//extra: from\0to\0dst
+		s := strings.SplitN(string(idx.Meta.Extra), ExtraSeparator, 3)
+		if len(s) == 3{
+			from, _ := strconv.Atoi(s[0])
+			to, _ := strconv.Atoi(s[1])
+			db.listIndex.indexes.LMoveValue(key, s[2], idx.Meta.Value, list.Direction(from), list.Direction(to))
+		}
 	}
 }
 
@@ -149,7 +276,15 @@ func (db *StarDB) buildHashIndex(idx *index.Indexer, entry *storage.Entry){
 	case HashHSet:
 		db.hashIndex.indexes.HSet(key, string(idx.Meta.Extra), idx.Meta.Value)
 	case HashHDel:
-		db.hashIndex.indexes.HGet(key, string(idx.Meta.Extra))
+		db.hashIndex.indexes.HDel(key, string(idx.Meta.Extra))
+	case HashHMSet:
+		pairs, err := storage.DecodeValues(idx.Meta.Value)
+		if err != nil{
+			return
+		}
+		for i := 0; i + 1 < len(pairs); i += 2{
+			db.hashIndex.indexes.HSet(key, string(pairs[i]), pairs[i+1])
+		}
 	case HashHClear:
 		db.hashIndex.indexes.HClear(key)
 	case HashHExpire:
@@ -177,6 +312,16 @@ func (db *StarDB) buildSetIndex(idx *index.Indexer, entry *storage.Entry){
 		db.setIndex.indexes.SMove(key, string(extra), idx.Meta.Value)
 	case SetSClear:
 		db.setIndex.indexes.SClear(key)
+	case SetSStore:
+		members, err := storage.DecodeValues(idx.Meta.Value)
+		if err != nil{
+			return
+		}
+		db.setIndex.indexes.SClear(key)
+		for _, m := range members{
+			db.setIndex.indexes.SAdd(key, m)
+		}
+		delete(db.expires[Set], key)
 	case SetSExpire:
 		if entry.Timestamp < uint64(time.Now().Unix()){
 			db.setIndex.indexes.SClear(key)
@@ -207,5 +352,107 @@ func (db *StarDB) buildZsetIndex(idx *index.Indexer, entry *storage.Entry){
 		} else {
 			db.expires[ZSet][key] = int64(entry.Timestamp)
 		}
+	case ZSetZStore:
+		fields, err := storage.DecodeValues(idx.Meta.Value)
+		if err != nil || len(fields) % 2 != 0{
+			return
+		}
+		db.zsetIndex.indexes.ZClear(key)
+		for i := 0; i < len(fields); i += 2{
+			if score, err := utils.StrToFloat64(string(fields[i+1])); err == nil{
+				db.zsetIndex.indexes.ZAdd(key, score, string(fields[i]))
+			}
+		}
+		delete(db.expires[ZSet], key)
+	case ZSetZMAdd:
+		fields, err := storage.DecodeValues(idx.Meta.Value)
+		if err != nil || len(fields) % 2 != 0{
+			return
+		}
+		for i := 0; i < len(fields); i += 2{
+			if score, err := utils.StrToFloat64(string(fields[i+1])); err == nil{
+				db.zsetIndex.indexes.ZAdd(key, score, string(fields[i]))
+			}
+		}
+	case ZSetZMRem:
+		members, err := storage.DecodeValues(idx.Meta.Value)
+		if err != nil{
+			return
+		}
+		for _, m := range members{
+			db.zsetIndex.indexes.ZRem(key, string(m))
+		}
+	}
+}
+func (db *StarDB) buildStreamIndex(idx *index.Indexer, entry *storage.Entry){
+	if db.streamIndex == nil || idx == nil{
+		return
+	}
+	applyStreamEntry(db.streamIndex.indexes, idx, entry)
+}
+
+//将一条stream日志重放到indexes中, 回收时也用它在临时的索引中重放已归档的日志
+func applyStreamEntry(indexes *stream.Stream, idx *index.Indexer, entry *storage.Entry){
+	key := string(idx.Meta.Key)
+	switch entry.GetMark() {
+	case StreamXAdd:
+		id, err := stream.ParseID(string(idx.Meta.Extra))
+		if err != nil{
+			return
+		}
+		if fields, err := storage.DecodeValues(idx.Meta.Value); err == nil{
+			indexes.XAdd(key, id, fields)
+		}
+	case StreamXDel:
+		if id, err := stream.ParseID(string(idx.Meta.Extra)); err == nil{
+			indexes.XDel(key, id)
+		}
+	case StreamXTrim:
+		if maxLen, err := strconv.Atoi(string(idx.Meta.Extra)); err == nil{
+			indexes.XTrim(key, maxLen)
+		}
+	case StreamXTrimMinID:
+		if id, err := stream.ParseID(string(idx.Meta.Extra)); err == nil{
+			indexes.XTrimMinID(key, id)
+		}
+	case StreamXGroupCreate:
+		if id, err := stream.ParseID(string(idx.Meta.Extra)); err == nil{
+			indexes.XGroupCreate(key, string(idx.Meta.Value), id)
+		}
+	case StreamXGroupDestroy:
+		indexes.XGroupDestroy(key, string(idx.Meta.Value))
+	case StreamXGroupDelConsumer:
+		indexes.XGroupDelConsumer(key, string(idx.Meta.Value), string(idx.Meta.Extra))
+	case StreamXReadGroup, StreamXClaim:
+		ids, err := stream.DecodeIDs(idx.Meta.Value)
+		if err != nil{
+			return
+		}
+		//extra: group consumer 投递时间 noAck(justID)
+		args, err := storage.DecodeValues(idx.Meta.Extra)
+		if err != nil || len(args) != 4{
+			return
+		}
+		now, _ := strconv.ParseInt(string(args[2]), 10, 64)
+		flag, _ := strconv.ParseBool(string(args[3]))
+		if entry.GetMark() == StreamXReadGroup{
+			indexes.Deliver(key, string(args[0]), string(args[1]), ids, flag, now)
+		}else{
+			indexes.XClaim(key, string(args[0]), string(args[1]), ids, 0, now, flag)
+		}
+	case StreamXAck:
+		if ids, err := stream.DecodeIDs(idx.Meta.Value); err == nil{
+			for _, id := range ids{
+				indexes.XAck(key, string(idx.Meta.Extra), id)
+			}
+		}
+	case StreamXSetID:
+		if id, err := stream.ParseID(string(idx.Meta.Extra)); err == nil{
+			indexes.XSetID(key, id)
+		}
+	case StreamXGroupSnapshot:
+		if lastID, pending, err := decodeGroupState(idx.Meta.Extra); err == nil{
+			indexes.XGroupRestore(key, string(idx.Meta.Value), lastID, pending)
+		}
 	}
-}
\ No newline at end of file
+}
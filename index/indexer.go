@@ -10,4 +10,6 @@ type Indexer struct {
 	FileId 		uint32
 	EntrySize 	uint32
 	Offset    	int64
+	//value保存在值日志中时的位置, 此时Get string从值日志加载数据
+	ValuePtr    *storage.ValuePointer
 }
\ No newline at end of file
@@ -87,6 +87,11 @@ func (t *SkipList) Put(key []byte, value interface{}) *Element{
 		value: value,
 	}
 
+	for i := range element.next{
+		element.next[i] = prev[i].next[i]
+		prev[i].next[i] = element
+	}
+
 	t.Len++
 	return element
 }
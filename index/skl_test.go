@@ -62,4 +62,32 @@ func TestSkipList_Get(t *testing.T) {
 		t.Log("list.Get error")
 	}
 
-}
\ No newline at end of file
+}
+func TestSkipList_PutOrder(t *testing.T) {
+	list := NewSkipList()
+	for _, k := range []string{"ec", "dc", "ac", "ae", "bc"}{
+		list.Put([]byte(k), k)
+	}
+	list.Put([]byte("dc"), "new")
+
+	if list.Len != 5{
+		t.Errorf("expected len 5, got %d", list.Len)
+	}
+	if e := list.Get([]byte("dc")); e == nil || e.Value() != "new"{
+		t.Error("list.Get returned wrong element")
+	}
+
+	var keys []string
+	list.Foreach(func(e *Element) bool {
+		keys = append(keys, string(e.Key()))
+		return true
+	})
+	if fmt.Sprint(keys) != "[ac ae bc dc ec]"{
+		t.Errorf("unexpected order: %v", keys)
+	}
+
+	list.Remove([]byte("bc"))
+	if list.Exist([]byte("bc")) || list.Len != 4{
+		t.Error("list.Remove failed")
+	}
+}
@@ -0,0 +1,60 @@
+package stardb
+
+import (
+	"stardb/storage"
+	"stardb/vfs"
+)
+
+// Migrate 离线把目录下的数据文件重写为最新的格式版本, 返回重写的文件数量
+// 迁移时db不能处于打开状态, 没有保存配置的目录按默认配置处理
+func Migrate(path string) (int, error){
+	fs, config := vfs.OS, DefaultConfig()
+	if vfs.Exist(fs, path + configSaveFile){
+		var err error
+		if config, err = loadConfig(fs, path); err != nil{
+			return 0, err
+		}
+	}
+
+	c, err := newCipher(config)
+	if err != nil{
+		return 0, err
+	}
+	//meta无法解密时不能迁移, 否则会丢失活跃文件的写偏移
+	if b, err := vfs.ReadFile(fs, path + dbMetaSaveFile); err == nil{
+		if _, err = c.UnsealFile(b); err != nil{
+			return 0, err
+		}
+	}
+	fileIds, err := storage.DataFileIds(fs, path)
+	if err != nil{
+		return 0, err
+	}
+
+	var count int
+	meta := storage.LoadMeta(fs, path + dbMetaSaveFile, c)
+	for dataType, ids := range fileIds{
+		for i, id := range ids{
+			shift, err := storage.MigrateFile(fs, path, id, dataType)
+			if err != nil{
+				return count, err
+			}
+			if shift == 0{
+				continue
+			}
+			count++
+
+			//活跃文件的写偏移随文件头后移
+			if i == len(ids) - 1 && meta.ActiveWriteOff[dataType] > 0{
+				meta.ActiveWriteOff[dataType] += shift
+			}
+		}
+	}
+
+	if count > 0{
+		if err = meta.Store(fs, path + dbMetaSaveFile, c); err != nil{
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,102 @@
+package stardb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"stardb/storage"
+	"stardb/vfs"
+	"testing"
+)
+
+//去掉数据文件的文件头, 模拟旧版本写入的目录
+func stripFileHeaders(t *testing.T, dir string){
+	files, _ := filepath.Glob(filepath.Join(dir, "*.data.*"))
+	for _, f := range files{
+		b, err := ioutil.ReadFile(f)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(f, b[16:], storage.FilePerm); err != nil{
+			t.Fatal(err)
+		}
+	}
+
+	meta := storage.LoadMeta(vfs.OS, dir + dbMetaSaveFile, nil)
+	for dataType, off := range meta.ActiveWriteOff{
+		meta.ActiveWriteOff[dataType] = off - 16
+	}
+	if err := meta.Store(vfs.OS, dir + dbMetaSaveFile, nil); err != nil{
+		t.Fatal(err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.BlockSize = 4 * 1024
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++{
+		if err = db.Set([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if _, err = db.HSet([]byte("hash"), []byte("field"), []byte("hval")); err != nil{
+		t.Fatal(err)
+	}
+	db.Close()
+	stripFileHeaders(t, dir)
+
+	check := func(db *StarDB, n int){
+		for i := 0; i < n; i++{
+			val, err := db.Get([]byte(fmt.Sprintf("key-%d", i)))
+			if err != nil || string(val) != fmt.Sprintf("value-%d", i){
+				t.Errorf("get key-%d fail, val:%s err:%v", i, val, err)
+			}
+		}
+		if val := db.HGet([]byte("hash"), []byte("field")); string(val) != "hval"{
+			t.Errorf("hget fail, val:%s", val)
+		}
+	}
+
+	//旧格式的目录可以直接打开并继续写入
+	if db, err = Reopen(dir); err != nil{
+		t.Fatal(err)
+	}
+	check(db, 100)
+	for i := 100; i < 120; i++{
+		if err = db.Set([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil{
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	n, err := Migrate(dir)
+	if err != nil || n == 0{
+		t.Fatalf("migrate fail, n:%d err:%v", n, err)
+	}
+	if n, err = Migrate(dir); err != nil || n != 0{
+		t.Errorf("migrate twice, n:%d err:%v", n, err)
+	}
+
+	if db, err = Reopen(dir); err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check(db, 120)
+	if err = db.Set([]byte("key-120"), []byte("value-120")); err != nil{
+		t.Fatal(err)
+	}
+	check(db, 121)
+	if err = db.Reclaim(); err != nil && err != ErrReclaimUnreached{
+		t.Error(err)
+	}
+	check(db, 121)
+}
@@ -7,13 +7,16 @@ import (
 	"fmt"
 	_ "google.golang.org/genproto/googleapis/cloud/accessapproval/v1"
 	"io"
-	"io/ioutil"
 	"log"
 	"os"
 	"sort"
+	"stardb/cache"
+	"stardb/ds/stream"
 	"stardb/index"
 	"stardb/storage"
 	"stardb/utils"
+	"stardb/vfs"
+	"strings"
 	"sync"
 	"time"
 )
@@ -30,6 +33,38 @@ var (
 	ErrInvalidTTL = errors.New("stardb: invalid ttl")
 	ErrKeyExpired = errors.New("stardb: key is expired")
 	ErrDBisReclaiming = errors.New("stardb: can't do reclaim and single reclaim at the same time")
+	ErrDBClosed = errors.New("stardb: db is closed")
+	ErrInvalidRank = errors.New("stardb: rank can't be zero")
+	ErrStreamInvalidID = errors.New("stardb: invalid stream id specified")
+	ErrStreamIDTooSmall = errors.New("stardb: the id specified is equal or smaller than the target stream top item")
+	ErrStreamInvalidFields = errors.New("stardb: wrong number of stream fields")
+	ErrStreamInvalidMaxLen = errors.New("stardb: stream maxlen can't be negative")
+	ErrStreamKeysNotMatch = errors.New("stardb: number of stream keys and ids not match")
+	ErrStreamGroupExists = errors.New("stardb: consumer group name already exists")
+	ErrStreamGroupNotExist = errors.New("stardb: no such key or consumer group")
+	ErrBitOffsetInvalid = errors.New("stardb: bit offset is not an integer or out of range")
+	ErrBitValueInvalid = errors.New("stardb: bit is not an integer or out of range")
+	ErrBitOpKeys = errors.New("stardb: BITOP NOT must be called with a single source key")
+	ErrInvalidHLL = errors.New("stardb: key is not a valid HyperLogLog string value")
+	ErrInvalidSetOption = errors.New("stardb: NX and XX, or EX and KEEPTTL, can not be used together")
+	ErrOffsetInvalid = errors.New("stardb: offset is out of range")
+	ErrInvalidPairs = errors.New("stardb: key value pairs are empty or not paired")
+	ErrHashValueNotFloat = errors.New("stardb: hash value is not a float")
+	ErrValueNotInteger = errors.New("stardb: value is not an integer or out of range")
+	ErrValueNotFloat = errors.New("stardb: value is not a valid float")
+	ErrIncrOverflow = errors.New("stardb: increment or decrement would overflow")
+	ErrIncrNaNOrInf = errors.New("stardb: increment would produce NaN or Infinity")
+	ErrHashValueNotInteger = errors.New("stardb: hash value is not an integer")
+	ErrGeoInvalidLonLat = errors.New("stardb: invalid longitude,latitude pair")
+	ErrGeoMemberNotExist = errors.New("stardb: could not decode requested zset member")
+	ErrGeoInvalidShape = errors.New("stardb: radius, width and height must be positive")
+	ErrZWeightsNum = errors.New("stardb: the number of weights must match the number of keys")
+	ErrZAddOption = errors.New("stardb: XX and NX, or GT, LT and NX options at the same time are not compatible")
+	ErrZScoreNaN = errors.New("stardb: resulting score is not a number (NaN)")
+	ErrEntryTooLarge = errors.New("stardb: entry exceeded the block size")
+	ErrInvalidSyncPolicy = errors.New("stardb: sync policy must be always, everysec or no")
+	ErrCfgEncrypted = errors.New("stardb: the config file is encrypted by a custom key provider, use Open instead")
+	ErrValueLogGCUnreached = errors.New("stardb: no value log file reached the gc ratio")
 )
 
 const (
@@ -41,11 +76,22 @@ const (
 
 	ExtraSeparator = "\\0"
 
-	DataStructureNum = 5       //五种类型数据结构体数量
+	DataStructureNum = 6       //六种类型数据结构体数量
 )
 
 type  (
+	// StarDB 数据库句柄, WithOptions返回的句柄与原句柄共享同一份数据
 	StarDB struct {
+		*dbCore
+		writeOpts 				*WriteOptions  //为nil时按照SyncPolicy持久化
+	}
+
+	// WriteOptions 单次写入的选项, 覆盖配置中的持久化策略
+	WriteOptions struct {
+		Sync 	bool    //为true时写入返回前entry已经刷盘, 为false时不等待刷盘
+	}
+
+	dbCore struct {
 		activeFile 				ActiveFiles   //活跃文件
 		activeFileIds 			ActiveFileIds //活跃文件id
 		archFiles  				ArchivedFiles //已归档文件
@@ -54,10 +100,17 @@ type  (
 		hashIndex				*HashIdx     //Hash   index
 		setIndex				*SetIdx      //Set    index
 		zsetIndex               *ZsetIdx     //ZSet   index
+		streamIndex             *StreamIdx   //Stream index
 		config 					Config
+		fs                      vfs.FS       //数据文件所在的文件系统
 		mu 						sync.RWMutex
 		meta					*storage.DBMeta
+		metaMu                  sync.Mutex   //不同类型的写入并发更新meta中的偏移量
 		expires                 Expires      //过期目录
+		valueCache              *cache.LRU   //KeyOnlyMemMode下String值的缓存, 未开启时为nil
+		committer               *groupCommitter //合并并发写入的fsync, 也负责everysec策略的后台刷盘
+		cipher                  *storage.Cipher //加密entry和元数据, 未开启加密时为nil
+		vlog                    *storage.ValueLog //分离保存的String value, 未开启值分离时为nil
 		isReclaiming            bool
 		isSingleReclaiming      bool
 	}
@@ -77,51 +130,87 @@ type  (
 
 // Open 打开一个stardb实例
 func Open(config Config) (*StarDB, error){
-	if !utils.Exist(config.DirPath){
-		if err := os.MkdirAll(config.DirPath, os.ModePerm); err != nil {
+	if !config.syncPolicy().valid(){
+		return nil, ErrInvalidSyncPolicy
+	}
+	if !config.Compression.Valid(){
+		return nil, storage.ErrUnknownCompression
+	}
+
+	fs := config.fileSystem()
+	if !vfs.Exist(fs, config.DirPath){
+		if err := fs.MkdirAll(config.DirPath, os.ModePerm); err != nil {
 			return nil, err
 		}
 	}
 
-	archFiles, activeFileIds, err := storage.Build(config.DirPath, config.RwMethod, config.BlockSize)
+	c, err := newCipher(config)
+	if err != nil{
+		return nil, err
+	}
+
+	archFiles, activeFileIds, err := storage.Build(fs, config.DirPath, config.RwMethod, config.BlockSize)
 	if err != nil {
 		return nil, err
 	}
+	for _, files := range archFiles{
+		for _, file := range files{
+			file.SetCipher(c)
+		}
+	}
 
 	//加载活跃文件
 	activeFiles := make(ActiveFiles)
 	for dataType, fileId := range activeFileIds {
-		file, err := storage.NewDBFile(config.DirPath, fileId, config.RwMethod, config.BlockSize, dataType)
+		file, err := storage.NewDBFile(fs, config.DirPath, fileId, config.RwMethod, config.BlockSize, dataType)
 		if err != nil {
 			return nil, err
 		}
+		file.SetCipher(c)
 		activeFiles[dataType] = file
 	}
 
-	//加载db meta  得到活跃文件的偏移量
-	meta := storage.LoadMeta(config.DirPath + dbMetaSaveFile)
-	for dataType, file := range activeFiles{
-		file.Offset = meta.ActiveWriteOff[dataType]
+	vlog, err := openValueLog(config, c)
+	if err != nil{
+		return nil, err
 	}
 
-	db := &StarDB{
+	//加载db meta, 活跃文件的偏移量在加载索引时根据文件内容确定
+	meta := storage.LoadMeta(fs, config.DirPath + dbMetaSaveFile, c)
+
+	db := &StarDB{dbCore: &dbCore{
 		activeFile: activeFiles,
 		activeFileIds: activeFileIds,
 		archFiles: archFiles,
 		config: config,
+		fs: fs,
 		strIndex: newStrIdx(),
 		meta: meta,
 		listIndex: newListIdx(),
 		hashIndex: newHashIdx(),
 		setIndex: newSetIdx(),
 		zsetIndex: newZsetIdx(),
+		streamIndex: newStreamIdx(),
 		expires: make(Expires),
+		cipher: c,
+		vlog: vlog,
+	}}
+
+	//everysec策略下后台每秒刷盘一次
+	if config.syncPolicy() == SyncEverySec{
+		db.committer = newGroupCommitter(time.Second, 0)
+	}else{
+		db.committer = newGroupCommitter(config.SyncMaxDelay, config.SyncBatchSize)
 	}
 
 	for i := 0; i < DataStructureNum; i++ {
 		db.expires[uint16(i)] = make(map[string]int64)
 	}
 
+	if config.IdxMode == KeyOnlyMemMode && config.ValueCacheSize > 0{
+		db.valueCache = cache.NewLRU(config.ValueCacheSize)
+	}
+
 	//加载索引
 	if err := db.loadIdxFromFiles(); err != nil {
 		return nil, err
@@ -130,25 +219,71 @@ func Open(config Config) (*StarDB, error){
 	return db, nil
 }
 
+// WithOptions 返回使用指定写入选项的句柄, 与db共享同一份数据
+func (db *StarDB) WithOptions(opts WriteOptions) *StarDB{
+	return &StarDB{dbCore: db.dbCore, writeOpts: &opts}
+}
+
 func Reopen(path string)(*StarDB, error){
 	if exist := utils.Exist(path + configSaveFile); !exist{
 		return nil, ErrCfgNotExist
 	}
 
-	var config Config
-	b, err := ioutil.ReadFile(path + configSaveFile)
+	config, err := loadConfig(vfs.OS, path)
 	if err != nil{
 		return nil, err
 	}
-	if err := json.Unmarshal(b, &config); err != nil{
-		return nil, err
+	return Open(config)
+}
+
+//读取保存在目录下的配置
+func loadConfig(fs vfs.FS, path string) (Config, error){
+	var config Config
+	b, err := vfs.ReadFile(fs, path + configSaveFile)
+	if err != nil{
+		return config, err
 	}
 
-	return Open(config)
+	//加密的配置文件中明文保存了密钥文件的路径
+	if keyFile, ok := storage.SealedFileAux(b); ok{
+		if len(keyFile) == 0{
+			return config, ErrCfgEncrypted
+		}
+		kp, err := storage.NewFileKeyProvider(string(keyFile))
+		if err != nil{
+			return config, err
+		}
+		if b, err = storage.NewCipher(kp).UnsealFile(b); err != nil{
+			return config, err
+		}
+	}
+	err = json.Unmarshal(b, &config)
+	return config, err
+}
+
+//根据配置创建加密使用的Cipher, 没有配置密钥时不加密
+func newCipher(config Config) (*storage.Cipher, error){
+	if config.KeyProvider != nil{
+		return storage.NewCipher(config.KeyProvider), nil
+	}
+	if config.EncryptionKeyFile == ""{
+		return nil, nil
+	}
+	kp, err := storage.NewFileKeyProvider(config.EncryptionKeyFile)
+	if err != nil{
+		return nil, err
+	}
+	return storage.NewCipher(kp), nil
 }
 
 
 func (db *StarDB) Close() error {
+	//唤醒阻塞在list上的客户端
+	db.listIndex.blocked.unblockAll(ErrDBClosed)
+	db.streamIndex.unblockAll()
+	db.zsetIndex.blocked.unblockAll(ErrDBClosed)
+	db.committer.close()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
@@ -165,6 +300,11 @@ func (db *StarDB) Close() error {
 			return err
 		}
 	}
+	if db.vlog != nil{
+		if err := db.vlog.Close(true); err != nil{
+			return err
+		}
+	}
 	//关闭已归档的文件
 	for _, archFile := range db.archFiles{
 		for _, file := range archFile{
@@ -190,6 +330,9 @@ func (db *StarDB) Sync() error {
 			return err
 		}
 	}
+	if db.vlog != nil{
+		return db.vlog.Sync()
+	}
 	return nil
 }
 /*
@@ -211,10 +354,10 @@ func (db *StarDB) Reclaim()(err error){
 	}
 
 	reclaimPath := db.config.DirPath + reclaimPath
-	if err := os.MkdirAll(reclaimPath, os.ModePerm); err != nil{
+	if err := db.fs.MkdirAll(reclaimPath, os.ModePerm); err != nil{
 		return err
 	}
-	defer os.RemoveAll(reclaimPath)
+	defer db.fs.RemoveAll(reclaimPath)
 
 	db.mu.Lock()
 	defer func() {
@@ -243,6 +386,7 @@ func (db *StarDB) Reclaim()(err error){
 				fileId uint32
 				archFiles = make(map[uint32]*storage.DBFile)
 				fileIds []int
+				streams = stream.New()
 			)
 
 			for _, file := range db.archFiles[dType]{
@@ -252,15 +396,37 @@ func (db *StarDB) Reclaim()(err error){
 
 			for _, fid := range fileIds{
 				file := db.archFiles[dType][uint32(fid)]
-				var offset int64
 				var reclaimEntries []*storage.Entry
 
+				//回收不保留读出的entry, 可以直接引用映射的内存
+				//stream的日志重放到临时的索引中, 需要复制
+				scanner := storage.NewScanner(file, storage.DefaultScanBufferSize)
+				if dType != Stream{
+					scanner.NoCopy()
+				}
 				for{
-					if e, err := file.Read(offset); err == nil{
+					if e, offset, err := scanner.Next(); err == nil{
+						if dType == Stream{
+							applyStreamEntry(streams, &index.Indexer{Meta: e.Meta}, e)
+							continue
+						}
+						if dType == String{
+							if snapshot := db.bitmapSnapshot(e); snapshot != nil{
+								reclaimEntries = append(reclaimEntries, snapshot)
+							}
+						}
+						if dType == Hash{
+							reclaimEntries = append(reclaimEntries, db.hmsetSnapshot(e)...)
+						}
+						if dType == Set{
+							reclaimEntries = append(reclaimEntries, db.sStoreSnapshot(e)...)
+						}
+						if dType == ZSet{
+							reclaimEntries = append(reclaimEntries, db.zMultiSnapshot(e)...)
+						}
 						if db.validEntry(e, offset, file.Id){
-							reclaimEntries = append(reclaimEntries, e)
+							reclaimEntries = append(reclaimEntries, msetToSet(e))
 						}
-						offset += int64(e.Size())
 					}else{
 						if err == io.EOF{
 							break
@@ -269,10 +435,19 @@ func (db *StarDB) Reclaim()(err error){
 						return
 					}
 				}
+				//所有已归档的stream日志重放完成后写入快照
+				if dType == Stream && fid == fileIds[len(fileIds) - 1]{
+					reclaimEntries = streamSnapshot(streams)
+				}
 
 				for _, entry := range reclaimEntries{
+					//按当前配置重新压缩, 并使用当前的密钥重新加密
+					if err = db.prepareEntry(entry); err != nil{
+						log.Fatalf("err occurred when encode the entry:%+v", err)
+						return
+					}
 					if df == nil || int64(entry.Size()) + df.Offset > db.config.BlockSize{
-						df, err = storage.NewDBFile(reclaimPath, fileId, db.config.RwMethod, db.config.BlockSize, dType)
+						df, err = db.newDBFile(reclaimPath, fileId, dType)
 						if err != nil{
 							log.Fatalf("err occurred when create new db file:%+v", err)
 							return
@@ -287,11 +462,7 @@ func (db *StarDB) Reclaim()(err error){
 					}
 
 					if dType == String {
-						item := db.strIndex.idxList.Get(entry.Meta.Key)
-						idx := item.Value().(*index.Indexer)
-						idx.Offset = df.Offset - int64(entry.Size())
-						idx.FileId = fileId
-						db.strIndex.idxList.Put(idx.Meta.Key, idx)
+						db.resetStrIndexer(entry, df.Id, df.Offset - int64(entry.Size()))
 					}
 				}
 			}
@@ -315,7 +486,7 @@ func (db *StarDB) Reclaim()(err error){
 	for dataType, files := range db.archFiles{
 		if _, exist := reclaimedTypes.Load(dataType); exist{
 			for _, f := range files{
-				_ = os.Remove(f.File.Name())
+				_ = db.fs.Remove(f.Name())
 			}
 		}
 	}
@@ -324,12 +495,14 @@ func (db *StarDB) Reclaim()(err error){
 		if _, exist := reclaimedTypes.Load(dataType); exist{
 			for _, f := range files{
 				name := storage.PathSeparator + fmt.Sprintf(storage.DBFileFormatNames[dataType], f.Id)
-				os.Rename(reclaimPath + name, db.config.DirPath + name)
+				db.fs.Rename(reclaimPath + name, db.config.DirPath + name)
 			}
 		}
 	}
 
 	db.archFiles = dbArchivedFiles
+	//回收后的文件复用了原来的文件id, 缓存的偏移量已经失效
+	db.purgeValueCache()
 	return
 }
 
@@ -339,10 +512,10 @@ func (db *StarDB) SingleReclaim()(err error){
 	}
 
 	reclaimPath := db.config.DirPath + reclaimPath
-	if err := os.MkdirAll(reclaimPath, os.ModePerm); err != nil {
+	if err := db.fs.MkdirAll(reclaimPath, os.ModePerm); err != nil {
 		return err
 	}
-	defer os.RemoveAll(reclaimPath)
+	defer db.fs.RemoveAll(reclaimPath)
 
 	db.mu.Lock()
 	defer func() {
@@ -363,64 +536,63 @@ func (db *StarDB) SingleReclaim()(err error){
 			continue
 		}
 
-		var(
-			readOff int64
-			validEntries []*storage.Entry
-		)
-
+		var validEntries []*storage.Entry
+		scanner := storage.NewScanner(file, storage.DefaultScanBufferSize).NoCopy()
 		for{
-			entry, err := file.Read(readOff)
+			entry, readOff, err := scanner.Next()
 			if err != nil{
 				if err == io.EOF{
 					break
 				}
 				return err
 			}
+			if snapshot := db.bitmapSnapshot(entry); snapshot != nil{
+				validEntries = append(validEntries, snapshot)
+			}
 			if db.validEntry(entry, readOff, uint32(fid)){
-				validEntries = append(validEntries, entry)
+				validEntries = append(validEntries, msetToSet(entry))
 			}
-			readOff += int64(entry.Size())
 		}
 
 		if len(validEntries) == 0{
-			os.Remove(file.File.Name())
+			db.fs.Remove(file.Name())
 			delete(db.meta.ReclaimableSpace, uint32(fid))
 			delete(db.archFiles[String], uint32(fid))
 			continue
 		}
 
-		df, err := storage.NewDBFile(reclaimPath, uint32(fid), db.config.RwMethod, db.config.BlockSize, String)
+		df, err := db.newDBFile(reclaimPath, uint32(fid), String)
 		if err != nil{
 			return err
 		}
 		for _, e := range validEntries{
+			if err := db.prepareEntry(e); err != nil{
+				return err
+			}
 			if err := df.Write(e); err != nil{
 				return err
 			}
 
-			item := db.strIndex.idxList.Get(e.Meta.Key)
-			idx := item.Value().(*index.Indexer)
-			idx.Offset = df.Offset - int64(e.Size())
-			idx.FileId = uint32(fid)
-			db.strIndex.idxList.Put(idx.Meta.Key, idx)
+			db.resetStrIndexer(e, uint32(fid), df.Offset - int64(e.Size()))
 		}
 
-		os.Remove(file.File.Name())
+		db.fs.Remove(file.Name())
 
 		name := storage.PathSeparator + fmt.Sprintf(storage.DBFileFormatNames[String], fid)
-		os.Rename(reclaimPath + name, db.config.DirPath)
+		db.fs.Rename(reclaimPath + name, db.config.DirPath)
 
 		db.meta.ReclaimableSpace[uint32(fid)] = 0
 		db.archFiles[String][uint32(fid)] = df
 	}
+	db.purgeValueCache()
 
 
 	return
 }
 
 func (db *StarDB) Backup(dir string)(err error){
-	if utils.Exist(db.config.DirPath){
-		err = utils.CopyDir(db.config.DirPath, dir)
+	if vfs.Exist(db.fs, db.config.DirPath){
+		err = utils.CopyDir(db.fs, db.config.DirPath, dir)
 	}
 	return
 }
@@ -451,22 +623,27 @@ func (db *StarDB) loadIdxFromFiles()(err error) {
 			fileIds = append(fileIds, int(db.activeFileIds[dType]))
 
 			sort.Ints(fileIds)
+			batch := &strBatch{}
 			for i := 0; i < len(fileIds); i++ {
 				fid := uint32(fileIds[i])
-				df := dbFile[fid]
-				var offset int64 = 0
+				scanner := storage.NewScanner(dbFile[fid], storage.DefaultScanBufferSize)
+				end := dbFile[fid].DataOffset()
 
-				for offset <= db.config.BlockSize {
-					if e, err := df.Read(offset); err == nil {
+				for {
+					if e, offset, err := scanner.Next(); err == nil {
+						end = offset + int64(e.Size())
 						idx := &index.Indexer{
 							Meta: 		e.Meta,
 							FileId: 	fid,
 							EntrySize: 	e.Size(),
 							Offset: 	offset,
 						}
-						offset += int64(e.Size())
 						//根据entry重建索引  将每个entry都执行一遍
 						if len(e.Meta.Key) > 0 {
+							//MSET日志在整组读取完成后才重建索引
+							if dType == String && db.collectStrBatch(batch, e, idx){
+								continue
+							}
 							if err := db.buildIndex(e, idx); err != nil{
 								log.Fatalf("a fatal error occured, the db can't open:[%v]", err)
 							}
@@ -478,12 +655,24 @@ func (db *StarDB) loadIdxFromFiles()(err error) {
 						log.Fatalf("a fatal err occured, , the db can't open:[%v]", err)
 					}
 				}
+
+				//meta只在关闭时保存, 崩溃之后其中的偏移量可能落后, 从最后一个完整entry的结尾继续写入
+				if fid == db.activeFileIds[dType]{
+					if err := db.activeFile[dType].Resume(end); err != nil{
+						log.Fatalf("a fatal err occured, , the db can't open:[%v]", err)
+					}
+					db.metaMu.Lock()
+					db.meta.ActiveWriteOff[dType] = end
+					db.metaMu.Unlock()
+				}
 			}
 
 		}(uint16(dataType))
 	}
 
 	wg.Wait()
+	//没有manifest的分块属于写入中途崩溃的blob, 直接丢弃
+	db.strIndex.pending = make(map[uint64][]blobChunk)
 	return nil
 }
 
@@ -511,21 +700,46 @@ func (db *StarDB) checkKeyValue(key []byte, value ...[]byte) error{
  */
 func (db *StarDB) saveConfig()(err error){
 	path := db.config.DirPath + configSaveFile
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)  //O_TRUNC 文件截断为0 会清空文件
-
 	b, err := json.Marshal(db.config)
-	_, err = file.Write(b)
-	err = file.Close()
+	if err != nil{
+		return err
+	}
+	//加密时明文保存密钥文件的路径, Reopen据此解密
+	if b, err = db.cipher.SealFile(b, []byte(db.keyFile())); err != nil{
+		return err
+	}
 
-	return
+	file, err := db.fs.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)  //O_TRUNC 文件截断为0 会清空文件
+	if err != nil{
+		return err
+	}
+	if _, err = file.Write(b); err != nil{
+		file.Close()
+		return err
+	}
+	return file.Close()
 }
 
+//Reopen时可以使用的密钥文件, 使用自定义的KeyProvider时为空
+func (db *StarDB) keyFile() string{
+	if db.config.KeyProvider != nil{
+		return ""
+	}
+	return db.config.EncryptionKeyFile
+}
 func (db *StarDB) saveMeta() error{
 	metaPath := db.config.DirPath + dbMetaSaveFile
-	return db.meta.Store(metaPath)
+	db.metaMu.Lock()
+	defer db.metaMu.Unlock()
+	return db.meta.Store(db.fs, metaPath, db.cipher)
 }
 
 func (db *StarDB)buildIndex(entry *storage.Entry, idx *index.Indexer) error {
+	//值分离的entry中只有value在值日志中的位置
+	if p, ok := entry.ValuePointer(); ok && !db.loadValuePointer(entry, idx, p){
+		return nil
+	}
+
 	//key value都保存在内存中
 	if db.config.IdxMode == KeyValueMemMode {
 		idx.Meta.Value = entry.Meta.Value
@@ -543,14 +757,43 @@ func (db *StarDB)buildIndex(entry *storage.Entry, idx *index.Indexer) error {
 		db.buildSetIndex(idx, entry)
 	case storage.ZSet:
 		db.buildZsetIndex(idx, entry)
+	case storage.Stream:
+		db.buildStreamIndex(idx, entry)
 	}
 	return nil
 }
 
+//按当前配置压缩并加密entry, 写入数据文件之前调用
+func (db *StarDB) prepareEntry(e *storage.Entry) error{
+	if err := e.Compress(db.config.Compression, db.config.CompressThreshold); err != nil{
+		return err
+	}
+	e.Encrypt(db.cipher)
+	return nil
+}
+
+//新建一个数据文件, 读取时使用db的Cipher解密
+func (db *StarDB) newDBFile(path string, fileId uint32, dType DataType) (*storage.DBFile, error){
+	df, err := storage.NewDBFile(db.fs, path, fileId, db.config.RwMethod, db.config.BlockSize, dType)
+	if err != nil{
+		return nil, err
+	}
+	df.SetCipher(db.cipher)
+	return df, nil
+}
+
 //保存entry到db file
 func (db *StarDB) store(e *storage.Entry) error{
-	// 如果文件大小不够，刷新数据到磁盘  再打开一个新的文件
 	config := db.config
+	if err := db.prepareEntry(e); err != nil{
+		return err
+	}
+	//一个文件也放不下的entry无法写入
+	if int64(e.Size()) > config.BlockSize - db.activeFile[e.GetType()].DataOffset(){
+		return ErrEntryTooLarge
+	}
+
+	// 如果文件大小不够，刷新数据到磁盘  再打开一个新的文件
 	if db.activeFile[e.GetType()].Offset + int64(e.Size()) > config.BlockSize{
 		if err := db.activeFile[e.GetType()].Sync(); err != nil{
 			return err
@@ -560,30 +803,51 @@ func (db *StarDB) store(e *storage.Entry) error{
 		db.archFiles[e.GetType()][activeFileId] = db.activeFile[e.GetType()]
 		activeFileId = activeFileId + 1
 
-		//打开一个新的db文件
-		newDbFile, err := storage.NewDBFile(config.DirPath, activeFileId, config.RwMethod, config.BlockSize, e.GetType())
+		//打开一个新的db文件, 并刷新目录保证新文件本身持久化
+		newDbFile, err := db.newDBFile(config.DirPath, activeFileId, e.GetType())
 		if err != nil{
 			return err
 		}
+		if err = db.fs.SyncDir(config.DirPath); err != nil{
+			return err
+		}
 		db.activeFile[e.GetType()] = newDbFile
 		db.activeFileIds[e.GetType()] = activeFileId
-		db.meta.ActiveWriteOff[e.GetType()] = 0
 	}
 
 	if err := db.activeFile[e.GetType()].Write(e); err != nil{
 		return err
 	}
+	db.metaMu.Lock()
 	db.meta.ActiveWriteOff[e.GetType()] = db.activeFile[e.GetType()].Offset
+	db.metaMu.Unlock()
 
-	if config.Sync {
-		if err := db.activeFile[e.GetType()].Sync(); err != nil{
-			return err
-		}
+	policy := config.syncPolicy()
+	wait := db.syncRequired()
+	if !wait && policy != SyncEverySec && policy != SyncAlways{
+		return nil
 	}
 
+	//交给组提交统一刷盘, 需要等待时在释放索引写锁之后等待刷盘完成
+	//不按always策略分组的写入要求立即刷盘
+	b, err := db.committer.add(db.activeFile[e.GetType()], wait && policy != SyncAlways)
+	if err != nil{
+		return err
+	}
+	if wait{
+		db.idxLock(e.GetType()).attach(b)
+	}
 	return nil
 }
 
+//写入是否需要在返回前刷盘
+func (db *StarDB) syncRequired() bool{
+	if db.writeOpts != nil{
+		return db.writeOpts.Sync
+	}
+	return db.config.syncPolicy() == SyncAlways
+}
+
 /*
  *校验entry的有效性
  */
@@ -596,19 +860,19 @@ func (db *StarDB)validEntry(e *storage.Entry, offset int64, fileId uint32) bool{
 	switch e.GetType(){
 	case String:
 		deadline, exist := db.expires[String][string(e.Meta.Key)]
-		if !exist{
-			return false
-		}
-
 		now := time.Now().Unix()
 
 		if mark == StringExpire{
-			if deadline > now {
+			if exist && deadline > now {
 				return true
 			}
 		}
-		if mark == StringSet || mark == StringPersist{
-			if deadline <= now {
+		//SETBIT日志在回收时由bitmapSnapshot合并, 单独的SETBIT日志都无效
+		if mark == StringBlobChunk{
+			return db.validBlobChunk(e, offset, fileId)
+		}
+		if mark == StringSet || mark == StringPersist || mark == StringMSet || mark == StringBlobManifest{
+			if exist && deadline <= now {
 				return false
 			}
 
@@ -635,16 +899,23 @@ func (db *StarDB)validEntry(e *storage.Entry, offset int64, fileId uint32) bool{
 				return true
 			}
 		}
+		if mark == ListLMove{
+			s := strings.SplitN(string(e.Meta.Extra), ExtraSeparator, 3)
+			if len(s) == 3 && db.LValExists([]byte(s[2]), e.Meta.Value){
+				return true
+			}
+		}
 	case Hash:
 		if mark == HashHExpire{
 			deadline, exist := db.expires[Hash][string(e.Meta.Key)]
 			if exist && deadline > time.Now().Unix(){
 				return true
 			}
-			if mark == HashHSet {
-				if val := db.HGet(e.Meta.Key, e.Meta.Extra); string(val) == string(e.Meta.Value){
-					return true
-				}
+		}
+		//HMSET日志在回收时由hmsetSnapshot拆分
+		if mark == HashHSet {
+			if db.HExists(e.Meta.Key, e.Meta.Extra) == 1 && bytes.Equal(db.HGet(e.Meta.Key, e.Meta.Extra), e.Meta.Value){
+				return true
 			}
 		}
 	case Set:
@@ -700,6 +971,7 @@ func (db *StarDB)checkExpired(key []byte, dType DataType)(expired bool){
 			if ele := db.strIndex.idxList.Remove(key); ele != nil{
 				db.incrReclaimableSpace(key)
 			}
+			delete(db.strIndex.bitmaps, string(key))
 		case List:
 			e = storage.NewEntryNoExtra(key, nil, List, ListLClear)
 			db.listIndex.indexes.LClear(string(key))
@@ -1,11 +1,22 @@
 package stardb
 
 import(
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"stardb/storage"
+	"stardb/vfs"
 	"log"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 )
 var dbPath = "D:\\github\\stardb\\dbFile"
 
@@ -77,3 +88,759 @@ func Test_SaveMeta(t *testing.T) {
 	_ = json.Unmarshal(bytes, &cfg)
 	t.Logf("%+v", cfg)
 }
+
+//在内存文件系统中打开db, 不读写磁盘
+func openTmpDB(t *testing.T) *StarDB {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	return db
+}
+
+//关闭openTmpDB打开的db并删除目录, 测试中重新打开db时需要用defer func(){ closeTmpDB(db) }()关闭最后打开的db
+func closeTmpDB(db *StarDB) {
+	db.Close()
+	db.fs.RemoveAll(db.config.DirPath)
+}
+
+func TestStarDB_ReopenMMap(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.RwMethod = storage.MMap
+	config.IdxMode = KeyOnlyMemMode
+	config.BlockSize = 1024 * 1024
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++{
+		if err = db.Set([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil{
+			t.Fatal(err)
+		}
+	}
+	_, err = db.LPush([]byte("list"), []byte("a"), []byte("b"))
+	if err != nil{
+		t.Fatal(err)
+	}
+	db.Close()
+
+	//重放时在映射文件末尾填充的0处停止
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 100; i++{
+		val, err := db.Get([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil || string(val) != fmt.Sprintf("value-%d", i){
+			t.Errorf("get key-%d fail, val:%s err:%v", i, val, err)
+		}
+	}
+	if n := db.LLen([]byte("list")); n != 2{
+		t.Errorf("expected list length 2, got %d", n)
+	}
+}
+
+//MMap模式下返回的值不引用映射的内存, 修改它不会破坏数据文件
+func TestStarDB_MMapValueCopy(t *testing.T) {
+	for _, mode := range []DataIndexMode{KeyValueMemMode, KeyOnlyMemMode}{
+		dir, _ := ioutil.TempDir("", "stardb")
+		config := DefaultConfig()
+		config.DirPath = dir
+		config.RwMethod = storage.MMap
+		config.IdxMode = mode
+		config.BlockSize = 1024 * 1024
+
+		db, err := Open(config)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if err = db.Set([]byte("k"), []byte("hello")); err != nil{
+			t.Fatal(err)
+		}
+		db.Close()
+
+		//分别修改重放和读取数据文件得到的值
+		for i := 0; i < 2; i++{
+			if db, err = Open(config); err != nil{
+				t.Fatal(err)
+			}
+			val, err := db.Get([]byte("k"))
+			if err != nil || string(val) != "hello"{
+				t.Fatalf("get k fail, val:%s err:%v", val, err)
+			}
+			val[0] = 'J'
+			db.Close()
+		}
+
+		if db, err = Open(config); err != nil{
+			t.Fatal(err)
+		}
+		if val, err := db.Get([]byte("k")); err != nil || string(val) != "hello"{
+			t.Errorf("get k after reopen fail, val:%s err:%v", val, err)
+		}
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStarDB_GroupCommit(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.Sync = true
+	config.SyncMaxDelay = 5 * time.Millisecond
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+
+	//写入返回时所在的批次已经刷盘
+	syncs := atomic.LoadUint64(&db.committer.syncs)
+	if err = db.Set([]byte("key"), []byte("value")); err != nil{
+		t.Fatal(err)
+	}
+	if n := atomic.LoadUint64(&db.committer.syncs); n <= syncs{
+		t.Errorf("write returned before its entry was synced")
+	}
+
+	//并发写入合并为少量的fsync
+	syncs = atomic.LoadUint64(&db.committer.syncs)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++{
+		wg.Add(2)
+		go func(i int){
+			defer wg.Done()
+			if err := db.Set([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i))); err != nil{
+				t.Error(err)
+			}
+		}(i)
+		go func(i int){
+			defer wg.Done()
+			if _, err := db.HSet([]byte("hash"), []byte(fmt.Sprintf("field-%d", i)), []byte("v")); err != nil{
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := atomic.LoadUint64(&db.committer.syncs) - syncs; n == 0 || n >= 100{
+		t.Errorf("expected the 100 writes grouped into fewer fsyncs, got %d", n)
+	}
+	db.Close()
+
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 50; i++{
+		val, err := db.Get([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil || string(val) != fmt.Sprintf("value-%d", i){
+			t.Errorf("get key-%d fail, val:%s err:%v", i, val, err)
+		}
+	}
+	if n := db.HLen([]byte("hash")); n != 50{
+		t.Errorf("expected hash length 50, got %d", n)
+	}
+}
+
+func TestStarDB_GroupCommitBatchSize(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.Sync = true
+	config.SyncMaxDelay = time.Hour
+	config.SyncBatchSize = 1
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	//攒够批次大小时不再等待SyncMaxDelay
+	done := make(chan error)
+	go func(){
+		done <- db.Set([]byte("key"), []byte("value"))
+	}()
+	select {
+	case err = <-done:
+		if err != nil{
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("write waited for the max delay although the batch was full")
+	}
+}
+
+func TestStarDB_SyncPolicy(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.SyncPolicy = "sometimes"
+	if _, err := Open(config); err != ErrInvalidSyncPolicy{
+		t.Fatalf("expected ErrInvalidSyncPolicy, got %v", err)
+	}
+
+	syncs := func(db *StarDB) uint64{
+		return atomic.LoadUint64(&db.committer.syncs)
+	}
+
+	//no: 不主动刷盘, 除非单次写入要求
+	config.SyncPolicy = SyncNo
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err = db.Set([]byte("k1"), []byte("v1")); err != nil{
+		t.Fatal(err)
+	}
+	if n := syncs(db); n != 0{
+		t.Errorf("expected no fsync, got %d", n)
+	}
+	if _, err = db.WithOptions(WriteOptions{Sync: true}).LPush([]byte("list"), []byte("a")); err != nil{
+		t.Fatal(err)
+	}
+	if n := syncs(db); n != 1{
+		t.Errorf("expected the sync write to be synced before returning, got %d fsyncs", n)
+	}
+	db.Close()
+
+	//everysec: 写入不等待刷盘, 由后台每秒刷盘一次
+	config.SyncPolicy = SyncEverySec
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++{
+		if err = db.Set([]byte(fmt.Sprintf("key-%d", i)), []byte("v")); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if n := syncs(db); n != 0{
+		t.Errorf("expected the writes not waiting for fsync, got %d", n)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if n := syncs(db); n != 1{
+		t.Errorf("expected one background fsync, got %d", n)
+	}
+
+	//要求刷盘的写入不等待后台的一秒
+	start := time.Now()
+	if err = db.WithOptions(WriteOptions{Sync: true}).Set([]byte("k2"), []byte("v2")); err != nil{
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 500 * time.Millisecond || syncs(db) != 2{
+		t.Errorf("expected the sync write flushed immediately, took %v", d)
+	}
+	db.Close()
+
+	//always: 单次写入可以选择不等待刷盘
+	config.SyncPolicy = SyncAlways
+	config.SyncMaxDelay = time.Hour
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err = db.WithOptions(WriteOptions{Sync: false}).Set([]byte("k3"), []byte("v3")); err != nil{
+		t.Fatal(err)
+	}
+	if n := syncs(db); n != 0{
+		t.Errorf("expected the write not waiting for fsync, got %d", n)
+	}
+	db.Close()
+
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for k, v := range map[string]string{"k1": "v1", "k2": "v2", "k3": "v3"}{
+		if val, err := db.Get([]byte(k)); err != nil || string(val) != v{
+			t.Errorf("get %s fail, val:%s err:%v", k, val, err)
+		}
+	}
+	if n := db.LLen([]byte("list")); n != 1{
+		t.Errorf("expected list length 1, got %d", n)
+	}
+}
+
+//没有Close就重新打开, 模拟崩溃, 之前返回的写入不能被之后的写入覆盖
+func TestStarDB_CrashRecovery(t *testing.T) {
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = vfs.NewMemFS()
+	config.SyncPolicy = SyncAlways
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err = db.Set([]byte("a"), []byte("1")); err != nil{
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err = db.Set([]byte("b"), []byte("2")); err != nil{
+		t.Fatal(err)
+	}
+	if _, err = db.RPush([]byte("list"), []byte("x")); err != nil{
+		t.Fatal(err)
+	}
+
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err = db.Set([]byte("c"), []byte("3")); err != nil{
+		t.Fatal(err)
+	}
+	if _, err = db.RPush([]byte("list"), []byte("y")); err != nil{
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for k, v := range map[string]string{"a": "1", "b": "2", "c": "3"}{
+		if val, err := db.Get([]byte(k)); err != nil || string(val) != v{
+			t.Errorf("get %s fail, val:%s err:%v", k, val, err)
+		}
+	}
+	if vals, err := db.LRange([]byte("list"), 0, -1); err != nil || len(vals) != 2 || string(vals[0]) != "x" || string(vals[1]) != "y"{
+		t.Errorf("unexpected list %q, err:%v", vals, err)
+	}
+}
+
+//刷盘失败时等待刷盘的写入返回错误
+func TestStarDB_SyncError(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMemFS())
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = fs
+	config.SyncPolicy = SyncNo
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	syncErr := errors.New("sync failed")
+	fs.SetSyncError(syncErr)
+	if _, err = db.WithOptions(WriteOptions{Sync: true}).HSet([]byte("hash"), []byte("f"), []byte("v")); err != syncErr{
+		t.Fatalf("expected sync error, got %v", err)
+	}
+	//之后要求刷盘的写入同样失败
+	fs.Reset()
+	if err = db.WithOptions(WriteOptions{Sync: true}).Set([]byte("k"), []byte("v")); err != syncErr{
+		t.Fatalf("expected sync error for the following write, got %v", err)
+	}
+}
+
+//写入不完整的entry之后崩溃, 重新打开时丢弃它, 之后的写入从最后一个完整entry的结尾开始
+func TestStarDB_FaultFSCrash(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMemFS())
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = fs
+	config.SyncPolicy = SyncAlways
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err = db.Set([]byte("k1"), []byte("v1")); err != nil{
+		t.Fatal(err)
+	}
+	if _, err = db.RPush([]byte("list"), []byte("a")); err != nil{
+		t.Fatal(err)
+	}
+
+	fs.SetShortWrite(true)
+	if err = db.Set([]byte("k2"), bytes.Repeat([]byte("v"), 100)); err != io.ErrShortWrite{
+		t.Fatalf("expected short write, got %v", err)
+	}
+	fs.Reset()
+	fs.SetSpaceLimit(10)
+	if _, err = db.RPush([]byte("list"), []byte("b")); !errors.Is(err, syscall.ENOSPC){
+		t.Fatalf("expected ENOSPC, got %v", err)
+	}
+	fs.Reset()
+
+	//没有Close直接重新打开
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err = db.Get([]byte("k2")); err != ErrKeyNotExist{
+		t.Fatalf("expected ErrKeyNotExist, got %v", err)
+	}
+	if err = db.Set([]byte("k3"), []byte("v3")); err != nil{
+		t.Fatal(err)
+	}
+	if _, err = db.RPush([]byte("list"), []byte("c")); err != nil{
+		t.Fatal(err)
+	}
+
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for k, v := range map[string]string{"k1": "v1", "k3": "v3"}{
+		if val, err := db.Get([]byte(k)); err != nil || string(val) != v{
+			t.Errorf("get %s fail, val:%s err:%v", k, val, err)
+		}
+	}
+	if _, err = db.Get([]byte("k2")); err != ErrKeyNotExist{
+		t.Errorf("expected ErrKeyNotExist, got %v", err)
+	}
+	if vals, err := db.LRange([]byte("list"), 0, -1); err != nil || len(vals) != 2 || string(vals[0]) != "a" || string(vals[1]) != "c"{
+		t.Errorf("unexpected list %q, err:%v", vals, err)
+	}
+}
+
+func TestStarDB_Compression(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.IdxMode = KeyOnlyMemMode
+	config.BlockSize = 4 * 1024
+	config.ReclaimThreshold = 1
+	config.Compression = storage.Compression(10)
+	if _, err := Open(config); err != storage.ErrUnknownCompression{
+		t.Fatalf("expected ErrUnknownCompression, got %v", err)
+	}
+
+	value := func(i int) []byte{
+		return bytes.Repeat([]byte(fmt.Sprintf(`{"id":%d,"name":"stardb"}`, i)), 30)
+	}
+
+	//先写入未压缩的数据
+	config.Compression = storage.NoCompression
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++{
+		if err = db.Set([]byte(fmt.Sprintf("key-%d", i)), value(i)); err != nil{
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	//开启压缩后旧的文件仍然可以读取
+	config.Compression = storage.Zstd
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 20; i < 40; i++{
+		if err = db.Set([]byte(fmt.Sprintf("key-%d", i)), value(i)); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if _, err = db.HSet([]byte("hash"), []byte("field"), value(0)); err != nil{
+		t.Fatal(err)
+	}
+	check := func(){
+		for i := 0; i < 40; i++{
+			val, err := db.Get([]byte(fmt.Sprintf("key-%d", i)))
+			if err != nil || !bytes.Equal(val, value(i)){
+				t.Errorf("get key-%d fail, err:%v", i, err)
+			}
+		}
+		if val, err := db.GetRange([]byte("key-1"), 1, 4); err != nil || string(val) != `"id"`{
+			t.Errorf("get range fail, val:%s err:%v", val, err)
+		}
+		if val := db.HGet([]byte("hash"), []byte("field")); !bytes.Equal(val, value(0)){
+			t.Errorf("hget fail")
+		}
+	}
+	check()
+
+	//回收时按当前配置重新压缩旧的数据
+	if err = db.Reclaim(); err != nil{
+		t.Fatal(err)
+	}
+	check()
+	for _, file := range db.archFiles[String]{
+		scanner := storage.NewScanner(file, storage.DefaultScanBufferSize)
+		for{
+			e, _, err := scanner.Next()
+			if err == io.EOF{
+				break
+			}
+			if err != nil{
+				t.Fatal(err)
+			}
+			if e.Compression() != storage.Zstd{
+				t.Errorf("entry %s not recompressed", e.Meta.Key)
+			}
+		}
+	}
+
+	db.Close()
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	check()
+}
+
+func TestStarDB_Encryption(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+	keyDir, _ := ioutil.TempDir("", "stardb-keys")
+	defer os.RemoveAll(keyDir)
+
+	key1 := "1:" + strings.Repeat("11", 32)
+	key2 := "2:" + strings.Repeat("22", 32)
+	keyFile := keyDir + string(os.PathSeparator) + "keys"
+	if err := ioutil.WriteFile(keyFile, []byte(key1), 0600); err != nil{
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.BlockSize = 1024
+	config.ReclaimThreshold = 1
+	config.EncryptionKeyFile = keyFile
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++{
+		if err = db.Set([]byte(fmt.Sprintf("secret-key-%d", i)), []byte(fmt.Sprintf("secret-value-%d", i))); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if _, err = db.HSet([]byte("secret-hash"), []byte("secret-field"), []byte("secret-value")); err != nil{
+		t.Fatal(err)
+	}
+	db.Close()
+
+	//数据文件和元数据文件中都不能出现明文
+	files, _ := ioutil.ReadDir(dir)
+	for _, f := range files{
+		b, _ := ioutil.ReadFile(dir + string(os.PathSeparator) + f.Name())
+		if bytes.Contains(b, []byte("secret")) || bytes.Contains(b, []byte("active_write_off")) || bytes.Contains(b, []byte("block_size")){
+			t.Errorf("plain text found in %s", f.Name())
+		}
+	}
+
+	check := func(db *StarDB){
+		for i := 0; i < 50; i++{
+			val, err := db.Get([]byte(fmt.Sprintf("secret-key-%d", i)))
+			if err != nil || string(val) != fmt.Sprintf("secret-value-%d", i){
+				t.Errorf("get secret-key-%d fail, val:%s err:%v", i, val, err)
+			}
+		}
+		if val := db.HGet([]byte("secret-hash"), []byte("secret-field")); string(val) != "secret-value"{
+			t.Errorf("hget fail, val:%s", val)
+		}
+	}
+
+	//Reopen根据配置文件中明文保存的路径加载密钥
+	db, err = Reopen(dir)
+	if err != nil{
+		t.Fatal(err)
+	}
+	check(db)
+	db.Close()
+
+	//轮换密钥, 回收时使用新的密钥重新加密
+	if err = ioutil.WriteFile(keyFile, []byte(key1 + "\n" + key2), 0600); err != nil{
+		t.Fatal(err)
+	}
+	db, err = Reopen(dir)
+	if err != nil{
+		t.Fatal(err)
+	}
+	check(db)
+	if err = db.Reclaim(); err != nil{
+		t.Fatal(err)
+	}
+	check(db)
+
+	kp, err := storage.NewFileKeyProvider(keyFile)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, []byte(key2), 0600); err != nil{
+		t.Fatal(err)
+	}
+	onlyKey2, err := storage.NewFileKeyProvider(keyFile)
+	if err != nil{
+		t.Fatal(err)
+	}
+	//只有回收过的归档文件使用新的密钥重新加密, 活跃文件和值日志中仍有旧密钥加密的数据
+	for _, archFiles := range db.archFiles{
+		for _, file := range archFiles{
+			file.SetCipher(storage.NewCipher(onlyKey2))
+			scanner := storage.NewScanner(file, storage.DefaultScanBufferSize)
+			for{
+				if _, _, err := scanner.Next(); err == io.EOF{
+					break
+				}else if err != nil{
+					t.Fatalf("archived file %d not re-encrypted: %v", file.Id, err)
+				}
+			}
+			file.SetCipher(storage.NewCipher(kp))
+		}
+	}
+	db.Close()
+}
+
+func TestStarDB_MemFS(t *testing.T) {
+	fs := vfs.NewMemFS()
+	config := DefaultConfig()
+	config.DirPath = "/stardb-memfs"
+	config.FileSystem = fs
+	config.BlockSize = 4 * 1024
+	config.ReclaimThreshold = 2
+
+	config.RwMethod = storage.MMap
+	if _, err := Open(config); err != storage.ErrMMapNotSupported{
+		t.Fatalf("expected ErrMMapNotSupported, got %v", err)
+	}
+	config.RwMethod = storage.FileIO
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++{
+		if err = db.Set([]byte(fmt.Sprintf("key-%d", i % 100)), []byte(fmt.Sprintf("value-%d", i))); err != nil{
+			t.Fatal(err)
+		}
+	}
+	if _, err = db.LPush([]byte("list"), []byte("a"), []byte("b")); err != nil{
+		t.Fatal(err)
+	}
+	if err = db.Reclaim(); err != nil{
+		t.Fatal(err)
+	}
+	if err = db.Backup("/backup"); err != nil{
+		t.Fatal(err)
+	}
+	db.Close()
+	if _, err = os.Stat(config.DirPath); !os.IsNotExist(err){
+		t.Fatalf("expected no files on disk, got %v", err)
+	}
+
+	for _, dir := range []string{config.DirPath, "/backup"}{
+		config.DirPath = dir
+		db, err = Open(config)
+		if err != nil{
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++{
+			val, err := db.Get([]byte(fmt.Sprintf("key-%d", i)))
+			if err != nil || string(val) != fmt.Sprintf("value-%d", i + 900){
+				t.Errorf("get key-%d in %s fail, val:%s err:%v", i, dir, val, err)
+			}
+		}
+		if n := db.LLen([]byte("list")); n != 2{
+			t.Errorf("expected list length 2 in %s, got %d", dir, n)
+		}
+		db.Close()
+	}
+}
+
+func TestStarDB_FaultFS(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMemFS())
+	config := DefaultConfig()
+	config.DirPath = "/stardb"
+	config.FileSystem = fs
+	config.SyncPolicy = SyncAlways
+
+	db, err := Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err = db.Set([]byte("k1"), []byte("v1")); err != nil{
+		t.Fatal(err)
+	}
+
+	//写入失败时索引不变, 之后的写入覆盖不完整的entry
+	fs.SetSpaceLimit(10)
+	if err = db.Set([]byte("k2"), []byte("v2")); !errors.Is(err, syscall.ENOSPC){
+		t.Fatalf("expected ENOSPC, got %v", err)
+	}
+	fs.Reset()
+	fs.SetShortWrite(true)
+	if _, err = db.LPush([]byte("list"), []byte("a")); err != io.ErrShortWrite{
+		t.Fatalf("expected short write, got %v", err)
+	}
+	fs.Reset()
+	if _, err = db.Get([]byte("k2")); err != ErrKeyNotExist{
+		t.Fatalf("expected ErrKeyNotExist, got %v", err)
+	}
+	if err = db.Set([]byte("k3"), []byte("v3")); err != nil{
+		t.Fatal(err)
+	}
+	if _, err = db.LPush([]byte("list"), []byte("b")); err != nil{
+		t.Fatal(err)
+	}
+
+	//刷盘失败之后拒绝后续的写入, 重新打开后恢复
+	syncErr := errors.New("sync failed")
+	fs.SetSyncError(syncErr)
+	if err = db.Set([]byte("k4"), []byte("v4")); err != syncErr{
+		t.Fatalf("expected sync error, got %v", err)
+	}
+	fs.Reset()
+	if err = db.Set([]byte("k5"), []byte("v5")); err != syncErr{
+		t.Fatalf("expected sync error, got %v", err)
+	}
+	db.Close()
+
+	db, err = Open(config)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err = db.Set([]byte("k5"), []byte("v5")); err != nil{
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{"k1": "v1", "k3": "v3", "k5": "v5"}{
+		if val, err := db.Get([]byte(k)); err != nil || string(val) != v{
+			t.Errorf("get %s fail, val:%s err:%v", k, val, err)
+		}
+	}
+	if _, err = db.Get([]byte("k2")); err != ErrKeyNotExist{
+		t.Errorf("expected ErrKeyNotExist, got %v", err)
+	}
+	if vals, err := db.LRange([]byte("list"), 0, -1); err != nil || len(vals) != 1 || string(vals[0]) != "b"{
+		t.Errorf("unexpected list %q, err:%v", vals, err)
+	}
+}
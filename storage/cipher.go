@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrKeyNotFound = errors.New("storage/cipher: encryption key not found")
+	ErrNoCipher = errors.New("storage/cipher: data is encrypted but no key provider is configured")
+	ErrDecrypt = errors.New("storage/cipher: message authentication failed")
+)
+
+const (
+	keyIdSize = 4
+	nonceSize = 12
+	tagSize = 16
+
+	//加密后的entry在key, value和extra之外增加的大小: 密钥id, nonce和GCM的认证标签
+	sealOverhead = keyIdSize + nonceSize + tagSize
+)
+
+//加密的元数据文件(DB.META, DB.CFG)以此开头, 没有此前缀的按明文读取
+var sealedFileMagic = []byte("STARENC1")
+
+// KeyProvider 提供AES-GCM使用的密钥, 密钥长度为16, 24或32字节
+type KeyProvider interface {
+	// CurrentKey 返回加密新数据使用的密钥和它的id
+	CurrentKey() (id uint32, key []byte, err error)
+
+	// Key 根据id返回密钥, 用于解密旧的数据, 轮换密钥之后旧的密钥仍需保留
+	Key(id uint32) ([]byte, error)
+}
+
+// FileKeyProvider 从文件读取密钥, 用于本地测试
+// 文件每行是一个"id:十六进制编码的密钥", id是正整数, 空行和#开头的行被忽略, id最大的密钥用于加密新数据
+// 轮换密钥时追加一个id更大的密钥, 回收只会用新的密钥重新加密回收过的归档文件,
+// 活跃文件, 未达到ReclaimThreshold的数据类型的文件以及值日志中仍有旧密钥加密的数据, 因此旧的密钥需要一直保留
+type FileKeyProvider struct {
+	keys    map[uint32][]byte
+	current uint32
+}
+
+// NewFileKeyProvider 加载密钥文件
+func NewFileKeyProvider(path string) (*FileKeyProvider, error){
+	file, err := os.Open(path)
+	if err != nil{
+		return nil, err
+	}
+	defer file.Close()
+
+	p := &FileKeyProvider{keys: make(map[uint32][]byte)}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan(){
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#"){
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0{
+			return nil, fmt.Errorf("storage/cipher: invalid key line in %s: %s", path, line)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(line[:i]), 10, 32)
+		if err != nil || id == 0{
+			return nil, fmt.Errorf("storage/cipher: invalid key id in %s: %s", path, line[:i])
+		}
+		if _, ok := p.keys[uint32(id)]; ok{
+			return nil, fmt.Errorf("storage/cipher: duplicate key id %d in %s", id, path)
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(line[i+1:]))
+		if err != nil{
+			return nil, fmt.Errorf("storage/cipher: invalid key in %s: %v", path, err)
+		}
+		if _, err = aes.NewCipher(key); err != nil{
+			return nil, err
+		}
+		p.keys[uint32(id)] = key
+		if uint32(id) > p.current{
+			p.current = uint32(id)
+		}
+	}
+	if err = scanner.Err(); err != nil{
+		return nil, err
+	}
+	if p.current == 0{
+		return nil, ErrKeyNotFound
+	}
+	return p, nil
+}
+
+func (p *FileKeyProvider) CurrentKey() (uint32, []byte, error){
+	return p.current, p.keys[p.current], nil
+}
+
+func (p *FileKeyProvider) Key(id uint32) ([]byte, error){
+	key, ok := p.keys[id]
+	if !ok{
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// Cipher 使用KeyProvider提供的密钥进行AES-GCM加解密, 可以并发使用
+// 密文格式: 密钥id(4) + nonce(12) + 密文 + 认证标签(16)
+type Cipher struct {
+	kp 		KeyProvider
+	mu      sync.RWMutex
+	aeads   map[uint32]cipher.AEAD
+}
+
+// NewCipher 新建一个Cipher
+func NewCipher(kp KeyProvider) *Cipher{
+	return &Cipher{kp: kp, aeads: make(map[uint32]cipher.AEAD)}
+}
+
+//加密plain, aad只参与认证不加密
+func (c *Cipher) seal(plain, aad []byte) ([]byte, error){
+	id, key, err := c.kp.CurrentKey()
+	if err != nil{
+		return nil, err
+	}
+	aead, err := c.aead(id, key)
+	if err != nil{
+		return nil, err
+	}
+
+	buf := make([]byte, keyIdSize + nonceSize, keyIdSize + nonceSize + len(plain) + tagSize)
+	binary.BigEndian.PutUint32(buf[:keyIdSize], id)
+	nonce := buf[keyIdSize:]
+	if _, err = rand.Read(nonce); err != nil{
+		return nil, err
+	}
+	return aead.Seal(buf, nonce, plain, aad), nil
+}
+
+//解密seal的结果
+func (c *Cipher) open(sealed, aad []byte) ([]byte, error){
+	if len(sealed) < sealOverhead{
+		return nil, ErrDecrypt
+	}
+	id := binary.BigEndian.Uint32(sealed[:keyIdSize])
+	aead, err := c.aead(id, nil)
+	if err != nil{
+		return nil, err
+	}
+
+	nonce := sealed[keyIdSize:keyIdSize+nonceSize]
+	plain, err := aead.Open(nil, nonce, sealed[keyIdSize+nonceSize:], aad)
+	if err != nil{
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
+
+//获取密钥id对应的AEAD, key为nil时从KeyProvider获取
+func (c *Cipher) aead(id uint32, key []byte) (cipher.AEAD, error){
+	c.mu.RLock()
+	aead, ok := c.aeads[id]
+	c.mu.RUnlock()
+	if ok{
+		return aead, nil
+	}
+
+	if key == nil{
+		var err error
+		if key, err = c.kp.Key(id); err != nil{
+			return nil, err
+		}
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil{
+		return nil, err
+	}
+	if aead, err = cipher.NewGCM(block); err != nil{
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.aeads[id] = aead
+	c.mu.Unlock()
+	return aead, nil
+}
+
+// SealFile 加密元数据文件的内容, aux以明文保存并参与认证, c为nil时返回原始内容
+func (c *Cipher) SealFile(data, aux []byte) ([]byte, error){
+	if c == nil{
+		return data, nil
+	}
+
+	head := make([]byte, len(sealedFileMagic) + 4 + len(aux))
+	copy(head, sealedFileMagic)
+	binary.BigEndian.PutUint32(head[len(sealedFileMagic):], uint32(len(aux)))
+	copy(head[len(sealedFileMagic)+4:], aux)
+
+	sealed, err := c.seal(data, head)
+	if err != nil{
+		return nil, err
+	}
+	return append(head, sealed...), nil
+}
+
+// UnsealFile 解密SealFile的结果, 没有加密的内容原样返回
+func (c *Cipher) UnsealFile(data []byte) ([]byte, error){
+	aux, ok := SealedFileAux(data)
+	if !ok{
+		return data, nil
+	}
+	if c == nil{
+		return nil, ErrNoCipher
+	}
+	n := len(sealedFileMagic) + 4 + len(aux)
+	return c.open(data[n:], data[:n])
+}
+
+// SealedFileAux 返回加密文件中明文保存的aux, 内容没有加密时返回false
+func SealedFileAux(data []byte) ([]byte, bool){
+	if !bytes.HasPrefix(data, sealedFileMagic){
+		return nil, false
+	}
+	data = data[len(sealedFileMagic):]
+	if len(data) < 4{
+		return nil, false
+	}
+	n := binary.BigEndian.Uint32(data)
+	if uint32(len(data) - 4) < n{
+		return nil, false
+	}
+	return data[4:4+n], true
+}
@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"stardb/vfs"
+	"testing"
+)
+
+//keys按id排列, 为nil的密钥不写入
+func writeKeyFile(t *testing.T, path string, keys ...[]byte){
+	var buf bytes.Buffer
+	buf.WriteString("# stardb keys\n")
+	for i, key := range keys{
+		if key != nil{
+			buf.WriteString(fmt.Sprintf("%d:%s\n", i + 1, hex.EncodeToString(key)))
+		}
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0600); err != nil{
+		t.Fatal(err)
+	}
+}
+
+func newTestCipher(t *testing.T, path string, keys ...[]byte) *Cipher{
+	writeKeyFile(t, path, keys...)
+	kp, err := NewFileKeyProvider(path)
+	if err != nil{
+		t.Fatal(err)
+	}
+	return NewCipher(kp)
+}
+
+func TestDBFile_Encryption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 16)
+	keyFile := filepath.Join(dir, "keys")
+	c1 := newTestCipher(t, keyFile, key1)
+
+	value := bytes.Repeat([]byte("secret value "), 30)
+	for i, method := range []FileRWMethod{FileIO, MMap}{
+		df, err := NewDBFile(vfs.OS, dir, uint32(i), method, defaultBlockSize, 2)
+		if err != nil{
+			t.Fatal(err)
+		}
+		df.SetCipher(c1)
+
+		plain := NewEntryNoExtra([]byte("plain"), []byte("v"), 2, 0)
+		enc := NewEntry([]byte("secret key"), value, []byte("extra"), 2, 3)
+		if err = enc.Compress(Zstd, 0); err != nil{
+			t.Fatal(err)
+		}
+		enc.Encrypt(c1)
+		for _, e := range []*Entry{plain, enc}{
+			if err = df.Write(e); err != nil{
+				t.Fatal(err)
+			}
+		}
+		if !enc.Encrypted() || enc.GetType() != 2 || enc.GetMark() != 3 || enc.Compression() != Zstd{
+			t.Errorf("unexpected state, encrypted:%v type:%d mark:%d", enc.Encrypted(), enc.GetType(), enc.GetMark())
+		}
+
+		//文件中不能出现明文
+		raw, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf(DBFileFormatNames[2], i)))
+		if err != nil{
+			t.Fatal(err)
+		}
+		if !bytes.Contains(raw, []byte("plain")) || bytes.Contains(raw, []byte("secret")) || bytes.Contains(raw, []byte("extra")){
+			t.Errorf("plain text found in the encrypted file")
+		}
+
+		offset := df.DataOffset() + int64(plain.Size())
+		e, err := df.ReadEntry(offset, enc.Size())
+		if err != nil || string(e.Meta.Key) != "secret key" || !bytes.Equal(e.Meta.Value, value) || string(e.Meta.Extra) != "extra"{
+			t.Errorf("read entry fail, err:%v", err)
+		}
+		if val, err := df.ReadValue(offset, enc.Meta.KeySize, 0, 6); err != nil || string(val) != "secret"{
+			t.Errorf("read value fail, val:%s err:%v", val, err)
+		}
+
+		//没有Cipher或者密钥不对时无法读取
+		df.SetCipher(nil)
+		if _, err = df.Read(offset); err != ErrNoCipher{
+			t.Errorf("expected ErrNoCipher, got %v", err)
+		}
+		df.SetCipher(newTestCipher(t, filepath.Join(dir, "wrong"), key2))
+		if _, err = df.Read(offset); err != ErrDecrypt{
+			t.Errorf("expected ErrDecrypt, got %v", err)
+		}
+
+		//篡改头部同样无法通过认证
+		df.SetCipher(c1)
+		if method == FileIO{
+			tampered := NewEntry([]byte("secret key"), value, []byte("extra"), 2, 3)
+			tampered.Encrypt(c1)
+			buf, _ := tampered.Encode()
+			buf[25]++ //timestamp
+			if _, err = df.File.WriteAt(buf, df.Offset); err != nil{
+				t.Fatal(err)
+			}
+			if _, err = df.Read(df.Offset); err != ErrDecrypt{
+				t.Errorf("expected ErrDecrypt for a tampered header, got %v", err)
+			}
+		}
+		df.Close(false)
+	}
+}
+
+func TestCipher_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key1 := bytes.Repeat([]byte{1}, 32)
+	key2 := bytes.Repeat([]byte{2}, 32)
+	keyFile := filepath.Join(dir, "keys")
+	df, err := NewDBFile(vfs.OS, dir, 0, FileIO, defaultBlockSize, 0)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer df.Close(false)
+
+	old := NewEntryNoExtra([]byte("k1"), []byte("v1"), 0, 0)
+	old.Encrypt(newTestCipher(t, keyFile, key1))
+	if err = df.Write(old); err != nil{
+		t.Fatal(err)
+	}
+
+	//追加新的密钥后, 旧的数据仍然可以读取, 新的数据使用新的密钥
+	c := newTestCipher(t, keyFile, key1, key2)
+	df.SetCipher(c)
+	e, err := df.Read(df.DataOffset())
+	if err != nil || string(e.Meta.Value) != "v1"{
+		t.Fatalf("read old entry fail, err:%v", err)
+	}
+	e.Encrypt(c)
+	offset := df.Offset
+	if err = df.Write(e); err != nil{
+		t.Fatal(err)
+	}
+
+	df.SetCipher(newTestCipher(t, keyFile, nil, key2))
+	if e, err = df.Read(offset); err != nil || string(e.Meta.Value) != "v1"{
+		t.Errorf("read rotated entry fail, err:%v", err)
+	}
+	if _, err = df.Read(df.DataOffset()); err != ErrKeyNotFound{
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+
+	scanner := NewScanner(df, 16)
+	if _, _, err = scanner.Next(); err != ErrKeyNotFound{
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+	if _, _, err = scanner.Next(); err != nil && err != io.EOF{
+		t.Errorf("unexpected err %v", err)
+	}
+}
+
+func TestNewFileKeyProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keys")
+	key := hex.EncodeToString(bytes.Repeat([]byte{1}, 16))
+	for content, ok := range map[string]bool{
+		"3:" + key + "\n\n# old\n1:" + key: true,
+		"": false,
+		key: false,
+		"0:" + key: false,
+		"1:" + key + "\n1:" + key: false,
+		"1:abcd": false,
+	}{
+		if err = ioutil.WriteFile(path, []byte(content), 0600); err != nil{
+			t.Fatal(err)
+		}
+		kp, err := NewFileKeyProvider(path)
+		if (err == nil) != ok{
+			t.Errorf("%q: unexpected err %v", content, err)
+		}
+		if ok{
+			if id, _, _ := kp.CurrentKey(); id != 3{
+				t.Errorf("expected current key 3, got %d", id)
+			}
+		}
+	}
+}
+
+func TestCipher_SealFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newTestCipher(t, filepath.Join(dir, "keys"), bytes.Repeat([]byte{1}, 24))
+	sealed, err := c.SealFile([]byte(`{"dir_path":"/data"}`), []byte("/keys"))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, []byte("dir_path")){
+		t.Errorf("plain text found in the sealed file")
+	}
+	if aux, ok := SealedFileAux(sealed); !ok || string(aux) != "/keys"{
+		t.Errorf("unexpected aux %s", aux)
+	}
+	if data, err := c.UnsealFile(sealed); err != nil || string(data) != `{"dir_path":"/data"}`{
+		t.Errorf("unseal fail, data:%s err:%v", data, err)
+	}
+
+	//明文保存的旧文件原样返回
+	if data, err := c.UnsealFile([]byte("{}")); err != nil || string(data) != "{}"{
+		t.Errorf("unseal plain data fail, data:%s err:%v", data, err)
+	}
+	var nilCipher *Cipher
+	if _, err = nilCipher.UnsealFile(sealed); err != ErrNoCipher{
+		t.Errorf("expected ErrNoCipher, got %v", err)
+	}
+
+	sealed[len(sealed) - 1]++
+	if _, err = c.UnsealFile(sealed); err != ErrDecrypt{
+		t.Errorf("expected ErrDecrypt, got %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var ErrInvalidValues = errors.New("storage/codec: invalid encoded values")
+
+// EncodeValues 将多个值编码到一条entry中, 每一项为uvarint长度加内容
+func EncodeValues(values [][]byte) []byte{
+	size := 0
+	for _, v := range values{
+		size += binary.MaxVarintLen64 + len(v)
+	}
+
+	buf := make([]byte, size)
+	n := 0
+	for _, v := range values{
+		n += binary.PutUvarint(buf[n:], uint64(len(v)))
+		n += copy(buf[n:], v)
+	}
+	return buf[:n]
+}
+
+// DecodeValues 解码EncodeValues的结果, 返回的值引用buf
+func DecodeValues(buf []byte) (values [][]byte, err error){
+	for len(buf) > 0{
+		size, n := binary.Uvarint(buf)
+		if n <= 0 || uint64(len(buf) - n) < size{
+			return nil, ErrInvalidValues
+		}
+		buf = buf[n:]
+		values = append(values, buf[:size])
+		buf = buf[size:]
+	}
+	return
+}
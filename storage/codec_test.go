@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeValues(t *testing.T) {
+	values := [][]byte{[]byte("a"), []byte(""), []byte("ccc")}
+	decoded, err := DecodeValues(EncodeValues(values))
+	if err != nil{
+		t.Fatal(err)
+	}
+	if len(decoded) != len(values){
+		t.Fatalf("expected %d values, got %d", len(values), len(decoded))
+	}
+	for i := range values{
+		if !bytes.Equal(values[i], decoded[i]){
+			t.Fatalf("value %d: expected %q, got %q", i, values[i], decoded[i])
+		}
+	}
+
+	//长度超出剩余的数据
+	if _, err = DecodeValues([]byte{5, 'a'}); err != ErrInvalidValues{
+		t.Fatalf("expected ErrInvalidValues, got %v", err)
+	}
+}
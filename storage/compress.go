@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"io/ioutil"
+	"sync"
+)
+
+var ErrUnknownCompression = errors.New("storage/compress: unknown compression")
+
+// Compression value的压缩算法, 记录在entry头部state的高4位
+type Compression uint8
+
+const (
+	NoCompression Compression = iota
+	Snappy
+	Zstd
+	Flate
+)
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// Valid 是否是支持的压缩算法
+func (c Compression) Valid() bool{
+	return c <= Flate
+}
+
+func (c Compression) compress(src []byte)([]byte, error){
+	switch c {
+	case Snappy:
+		return snappy.Encode(nil, src), nil
+	case Zstd:
+		if err := initZstd(); err != nil{
+			return nil, err
+		}
+		return zstdEncoder.EncodeAll(src, nil), nil
+	case Flate:
+		var buf bytes.Buffer
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil{
+			return nil, err
+		}
+		if _, err = w.Write(src); err != nil{
+			return nil, err
+		}
+		if err = w.Close(); err != nil{
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, ErrUnknownCompression
+}
+
+func (c Compression) decompress(src []byte)([]byte, error){
+	switch c {
+	case Snappy:
+		return snappy.Decode(nil, src)
+	case Zstd:
+		if err := initZstd(); err != nil{
+			return nil, err
+		}
+		return zstdDecoder.DecodeAll(src, nil)
+	case Flate:
+		r := flate.NewReader(bytes.NewReader(src))
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+	return nil, ErrUnknownCompression
+}
+
+//zstd的编解码器可以并发使用, 只创建一次
+func initZstd() error{
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil{
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdErr
+}
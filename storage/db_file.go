@@ -6,12 +6,9 @@ import (
 	"github.com/pkg/errors"
 	"github.com/roseduan/mmap-go"
 	_ "go/types"
-	"hash/crc32"
-	"io/ioutil"
+	"io"
 	"os"
-	"sort"
-	"strconv"
-	"strings"
+	"stardb/vfs"
 )
 
 const (
@@ -28,14 +25,22 @@ var (
 		2: "%09d.data.hash",
 		3: "%09d.data.set",
 		4: "%09d.data.zset",
+		5: "%09d.data.stream",
+		ValueLogType: "%09d.vlog",
 	}
 
-	DBFileSuffixName = []string{"str", "list", "hash", "set", "zset"}
+	DBFileSuffixName = []string{"str", "list", "hash", "set", "zset", "stream"}
 )
 
 var (
 	// the entry is empty
 	ErrEmptyEntry = errors.New("storage/db_file: entry or the Key of entry is empty")
+
+	// MMap只能用于操作系统的文件
+	ErrMMapNotSupported = errors.New("storage/db_file: mmap is not supported by the file system")
+
+	// MMap模式下entry超出了映射的文件大小
+	ErrEntryTooLarge = errors.New("storage/db_file: entry exceeded the mapped file size")
 )
 
 // FileRWMethod 文件数据读写方式
@@ -52,30 +57,55 @@ const (
 type DBFile struct {
 	Id uint32
 	path string
-	File *os.File
+	name string      //文件的完整路径
+	File vfs.File
 	mmap mmap.MMap
 	Offset int64
 	method FileRWMethod
+	cipher *Cipher   //解密entry使用, 为nil时无法读取加密的entry
+	version uint16   //文件格式版本, 旧格式的文件没有文件头
+}
+
+// Name 文件的完整路径, MMap模式下File为nil, 删除文件时使用
+func (df *DBFile) Name() string{
+	return df.name
 }
 
-// NewDBFile 新建一个数据读写文件， 如果是MMap, 则需要Truncate文件并进行加载
-func NewDBFile(path string, fileId uint32, method FileRWMethod, blockSize int64, eType uint16)(*DBFile, error){
+// SetCipher 设置解密entry使用的Cipher
+func (df *DBFile) SetCipher(c *Cipher){
+	df.cipher = c
+}
+
+// NewDBFile 在fs中新建一个数据读写文件， 如果是MMap, 则需要Truncate文件并进行加载
+func NewDBFile(fs vfs.FS, path string, fileId uint32, method FileRWMethod, blockSize int64, eType uint16)(*DBFile, error){
 	filePath := path + PathSeparator + fmt.Sprintf(DBFileFormatNames[eType], fileId)
 
-	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_RDWR, FilePerm)
+	file, err := fs.OpenFile(filePath, os.O_CREATE|os.O_RDWR, FilePerm)
 	if err != nil{
 		return nil, err
 	}
 
-	df := &DBFile{Id: fileId, path: path, Offset: 0, method: method}
+	//新文件写入文件头, 已有的文件根据文件头判断格式版本
+	version, err := initFileHeader(file, eType)
+	if err != nil{
+		file.Close()
+		return nil, err
+	}
+	df := &DBFile{Id: fileId, path: path, name: filePath, method: method, version: version}
+	df.Offset = df.DataOffset()
 
 	if method == FileIO {
 		df.File = file
 	} else {
+		osFile, ok := file.(*os.File)
+		if !ok{
+			file.Close()
+			return nil, ErrMMapNotSupported
+		}
 		if err = file.Truncate(blockSize); err != nil {   //Truncate 修改文件大小
 			return nil, err
 		}
-		m, err := mmap.Map(file, os.O_RDWR, 0)
+		m, err := mmap.Map(osFile, os.O_RDWR, 0)
 		if err != nil {
 			return nil, err
 		}
@@ -85,6 +115,7 @@ func NewDBFile(path string, fileId uint32, method FileRWMethod, blockSize int64,
 }
 
 //从数据文件读数据， offset是读的起始位置
+//先读出头部得到entry的大小, 再一次读出key, value和extra
 func (df *DBFile)Read(offset int64)(e *Entry,  err error){
 	var buf []byte
 	//读出头部信息 (crc, keysize, valuesize, extrasize, state, timestamp)
@@ -95,42 +126,60 @@ func (df *DBFile)Read(offset int64)(e *Entry,  err error){
 	if e, err = Decode(buf); err != nil {
 		return
 	}
-    //读key
-	offset += entryHeaderSize
-	if e.Meta.KeySize > 0 {
-		var key []byte
-		if key, err = df.readBuf(offset, int64(e.Meta.KeySize)); err != nil {
-			return
-		}
-		e.Meta.Key = key
-	}
-    //读value
-	offset += int64(e.Meta.KeySize)
-	if e.Meta.ValueSize > 0 {
-		var val []byte
-		if val, err = df.readBuf(offset, int64(e.Meta.ValueSize)); err != nil {
-			return
-		}
-		e.Meta.Value = val
-	}
-    //读extra
-	offset += int64(e.Meta.ValueSize)
-	if e.Meta.ExtraSize > 0 {
-		var val []byte
-		if val, err = df.readBuf(offset, int64(e.Meta.ExtraSize)); err != nil {
-			return
-		}
-		e.Meta.Extra = val
+
+	body := int64(e.Size() - entryHeaderSize)
+	if body == 0{
+		err = e.check()
+		return
 	}
-    //校验crc
-	checkCrc := crc32.ChecksumIEEE(e.Meta.Value)
-	if checkCrc != e.crc32 {
-		return nil, ErrInvalidCrc
+	if buf, err = df.readBuf(offset + entryHeaderSize, body); err != nil{
+		return
 	}
-
+	err = e.decodeBody(buf, df.cipher)
 	return
 }
 
+// ReadEntry 根据已知的entry大小(如Indexer.EntrySize)一次读出整个entry
+// MMap模式下同样拷贝映射的内存, 返回的entry可以在文件关闭之后继续使用和修改
+func (df *DBFile) ReadEntry(offset int64, size uint32)(*Entry, error){
+	if size < entryHeaderSize{
+		return nil, ErrInvalidEntry
+	}
+	buf, err := df.readBuf(offset, int64(size))
+	if err != nil{
+		return nil, err
+	}
+
+	e, err := Decode(buf)
+	if err != nil{
+		return nil, err
+	}
+	if e.Size() != size{
+		return nil, ErrInvalidEntry
+	}
+	if err = e.decodeBody(buf[entryHeaderSize:], df.cipher); err != nil{
+		return nil, err
+	}
+	return e, nil
+}
+
+// Resume 从offset处继续写入, offset是最后一个完整entry的结尾
+// FileIO模式下同时截掉其后崩溃时没有写完的数据
+func (df *DBFile) Resume(offset int64) error{
+	df.Offset = offset
+	if df.method != FileIO{
+		return nil
+	}
+	info, err := df.File.Stat()
+	if err != nil{
+		return err
+	}
+	if info.Size() > offset{
+		return df.File.Truncate(offset)
+	}
+	return nil
+}
+
 //从文件的offset处开始写数据
 func (df *DBFile) Write(e *Entry) error {
 	if e == nil || e.Meta.KeySize == 0{
@@ -146,16 +195,57 @@ func (df *DBFile) Write(e *Entry) error {
 
 	if method == FileIO{
 		if _, err := df.File.WriteAt(encVal, writeOff); err != nil{
+			//去掉只写入了一部分的entry, 否则之后较短的entry只能覆盖它的开头, 重放时会读到残留的数据
+			_ = df.File.Truncate(writeOff)
 			return err
 		}
 	}
 	if method == MMap{
+		//映射的内存放不下时不能只写入一部分, 否则Offset越过了实际数据, 重新打开后数据丢失
+		if writeOff + int64(len(encVal)) > int64(len(df.mmap)){
+			return ErrEntryTooLarge
+		}
 		copy(df.mmap[writeOff:], encVal)
 	}
 	df.Offset += int64(e.Size())
 	return nil
 }
 
+// ReadValue 读取offset处entry的value中从start开始的n个字节, 只读取部分value时无法校验crc
+// value压缩或者加密时需要读出整个entry
+func (df *DBFile) ReadValue(offset int64, keySize uint32, start, n int64)([]byte, error){
+	header, err := df.readAt(offset, entryHeaderSize)
+	if err != nil{
+		return nil, err
+	}
+	e, err := Decode(header)
+	if err != nil{
+		return nil, err
+	}
+	if e.Compression() == NoCompression && !e.Encrypted(){
+		return df.readBuf(offset + entryHeaderSize + int64(keySize) + start, n)
+	}
+
+	if e, err = df.Read(offset); err != nil{
+		return nil, err
+	}
+	if start + n > int64(len(e.Meta.Value)){
+		return nil, ErrInvalidEntry
+	}
+	return e.Meta.Value[start:start+n], nil
+}
+
+//读出offset处的n个字节, MMap模式下直接返回映射内存的切片, 只能用于不保留数据的读取
+func (df *DBFile) readAt(offset int64, n int64)([]byte, error){
+	if df.method == MMap{
+		if offset + n > int64(len(df.mmap)){
+			return nil, io.EOF
+		}
+		return df.mmap[offset:offset+n:offset+n], nil
+	}
+	return df.readBuf(offset, n)
+}
+
 func (df *DBFile) readBuf(offset int64, n int64)([]byte, error) {
 	buf := make([]byte, n)
 
@@ -173,54 +263,32 @@ func (df *DBFile) readBuf(offset int64, n int64)([]byte, error) {
 	return buf, nil
 }
 
-// Build 加载数据文件
-func Build(path string, method FileRWMethod, blockSize int64)(map[uint16]map[uint32]*DBFile, map[uint16]uint32, error){
-	dir, err := ioutil.ReadDir(path)  //读取目录下的所有文件
+// Build 加载fs中的数据文件
+func Build(fs vfs.FS, path string, method FileRWMethod, blockSize int64)(map[uint16]map[uint32]*DBFile, map[uint16]uint32, error){
+	fileIdsMap, err := DataFileIds(fs, path)  //存储不同文件类型id集合
 	if err != nil{
 		return nil, nil, err
 	}
 
-	fileIdsMap := make(map[uint16][]int)  //存储不同文件类型id集合
-	for _, d := range dir {
-		if strings.Contains(d.Name(), ".data"){
-			splitNames := strings.Split(d.Name(), ".")
-			id, _ := strconv.Atoi(splitNames[0])
-
-			switch splitNames[2] {
-			case DBFileSuffixName[0]:
-				fileIdsMap[0] = append(fileIdsMap[0], id)
-			case DBFileSuffixName[1]:
-				fileIdsMap[1] = append(fileIdsMap[1], id)
-			case DBFileSuffixName[2]:
-				fileIdsMap[2] = append(fileIdsMap[2], id)
-			case DBFileSuffixName[3]:
-				fileIdsMap[3] = append(fileIdsMap[3], id)
-			case DBFileSuffixName[4]:
-				fileIdsMap[4] = append(fileIdsMap[4], id)
-			}
-		}
-	}
-
 	activeFileIds := make(map[uint16]uint32)     //map[dataType]fileID
 	archFiles := make(map[uint16]map[uint32]*DBFile)  //map[dataType]map[fileID]*DBFile
 	var dataType uint16 = 0
-	for ; dataType < 5; dataType++ {
+	for ; dataType < uint16(len(DBFileSuffixName)); dataType++ {
 		fileIDs := fileIdsMap[dataType]
-		sort.Ints(fileIDs)
 		files := make(map[uint32]*DBFile)  //保存需要创建的文件句柄
 		var activeFileId uint32 = 0
 
 		if len(fileIDs) > 0 {
-			activeFileId = uint32(fileIDs[len(fileIDs) - 1])  //最后一个id文件为活跃文件 最后一个文件没写满，前面都已经写满
+			activeFileId = fileIDs[len(fileIDs) - 1]  //最后一个id文件为活跃文件 最后一个文件没写满，前面都已经写满
 
 			for i := 0; i < len(fileIDs) - 1; i++ {
 				id := fileIDs[i]
 
-				file, err := NewDBFile(path, uint32(id), method, blockSize, dataType)
+				file, err := NewDBFile(fs, path, id, method, blockSize, dataType)
 				if err != nil {
 					return nil, nil, err
 				}
-				files[uint32(id)] = file
+				files[id] = file
 			}
 		}
 		archFiles[dataType] = files
@@ -1,8 +1,12 @@
 package storage
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"stardb/vfs"
 	"testing"
 	"time"
 )
@@ -30,7 +34,7 @@ func init(){
 func TestNewDBFile(t *testing.T) {
 	os.MkdirAll(path1, os.ModePerm)
 	newOne := func(method FileRWMethod, dataType uint16){
-		_, err := NewDBFile(path1, fileID1, method, defaultBlockSize, dataType)
+		_, err := NewDBFile(vfs.OS, path1, fileID1, method, defaultBlockSize, dataType)
 		if err != nil{
 			t.Error("new db file error", err)
 		}
@@ -51,7 +55,7 @@ func TestNewDBFile(t *testing.T) {
 }
 
 func TestDBFile_Sync(t *testing.T) {
-	df, err :=  NewDBFile(path1, fileID1, FileIO, defaultBlockSize, 1)
+	df, err :=  NewDBFile(vfs.OS, path1, fileID1, FileIO, defaultBlockSize, 1)
 	if err != nil{
 		t.Error(err)
 	}
@@ -59,7 +63,7 @@ func TestDBFile_Sync(t *testing.T) {
 }
 
 func TestDBFile_Close(t *testing.T) {
-	df, err :=  NewDBFile(path1, fileID1, FileIO, defaultBlockSize, 3)
+	df, err :=  NewDBFile(vfs.OS, path1, fileID1, FileIO, defaultBlockSize, 3)
 	if err != nil{
 		t.Error(err)
 	}
@@ -67,7 +71,7 @@ func TestDBFile_Close(t *testing.T) {
 }
 
 func TestDBFile_Write(t *testing.T) {
-	df, err :=  NewDBFile(path1, 1, FileIO, defaultBlockSize, 3)
+	df, err :=  NewDBFile(vfs.OS, path1, 1, FileIO, defaultBlockSize, 3)
 	if err != nil{
 		t.Error(err)
 	}
@@ -95,7 +99,7 @@ func TestDBFile_Write(t *testing.T) {
 	df.Write(entry1)
 	df.Write(entry2)
 
-	entry, err := df.Read(int64(entry1.Size()))
+	entry, err := df.Read(df.DataOffset() + int64(entry1.Size()))
 	if err != nil{
 		t.Error("read entry fail", err)
 	}
@@ -103,10 +107,298 @@ func TestDBFile_Write(t *testing.T) {
 }
 
 func TestBuild(t *testing.T) {
-	archFile, activeFile, err := Build(path1, FileIO, defaultBlockSize)
+	archFile, activeFile, err := Build(vfs.OS, path1, FileIO, defaultBlockSize)
 	if err != nil{
 		t.Error("build file fail", err)
 	}
 	fmt.Println(len(archFile[3]), activeFile[3])
 }
 
+func TestBuild_MemFS(t *testing.T) {
+	fs := vfs.NewMemFS()
+	if err := fs.MkdirAll("/db", 0755); err != nil{
+		t.Fatal(err)
+	}
+	if _, err := NewDBFile(fs, "/db", 0, MMap, defaultBlockSize, 0); err != ErrMMapNotSupported{
+		t.Fatalf("expected ErrMMapNotSupported, got %v", err)
+	}
+
+	for i := 0; i < 3; i++{
+		df, err := NewDBFile(fs, "/db", uint32(i), FileIO, defaultBlockSize, 0)
+		if err != nil{
+			t.Fatal(err)
+		}
+		if err = df.Write(NewEntryNoExtra([]byte(fmt.Sprintf("key-%d", i)), []byte("value"), 0, 0)); err != nil{
+			t.Fatal(err)
+		}
+		df.Close(true)
+	}
+
+	archFiles, activeFileIds, err := Build(fs, "/db", FileIO, defaultBlockSize)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if len(archFiles[0]) != 2 || activeFileIds[0] != 2{
+		t.Fatalf("unexpected files %d, active id %d", len(archFiles[0]), activeFileIds[0])
+	}
+	e, err := archFiles[0][1].Read(archFiles[0][1].DataOffset())
+	if err != nil || string(e.Meta.Key) != "key-1"{
+		t.Fatalf("read entry fail, err:%v", err)
+	}
+}
+
+//写入失败或者崩溃留下的不完整entry被截掉, 之后较短的entry不会在其后留下残留的数据
+func TestDBFile_TornWrite(t *testing.T) {
+	fs := vfs.NewFaultFS(vfs.NewMemFS())
+	df, err := NewDBFile(fs, "/", 0, FileIO, defaultBlockSize, 0)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if err = df.Write(NewEntryNoExtra([]byte("k1"), []byte("v1"), 0, 0)); err != nil{
+		t.Fatal(err)
+	}
+	fs.SetShortWrite(true)
+	if err = df.Write(NewEntryNoExtra([]byte("k2"), bytes.Repeat([]byte("v"), 200), 0, 0)); err == nil{
+		t.Fatal("expected short write")
+	}
+	fs.Reset()
+	if err = df.Write(NewEntryNoExtra([]byte("k3"), []byte("v3"), 0, 0)); err != nil{
+		t.Fatal(err)
+	}
+
+	//模拟崩溃时只写入了一部分的entry
+	end := df.Offset
+	if _, err = df.File.WriteAt(bytes.Repeat([]byte("v"), 100), end); err != nil{
+		t.Fatal(err)
+	}
+	if err = df.Resume(end); err != nil{
+		t.Fatal(err)
+	}
+	if info, _ := df.File.Stat(); info.Size() != end{
+		t.Fatalf("expected file size %d, got %d", end, info.Size())
+	}
+
+	var keys []string
+	scanner := NewScanner(df, DefaultScanBufferSize)
+	for{
+		e, _, err := scanner.Next()
+		if err == io.EOF{
+			break
+		}
+		if err != nil{
+			t.Fatal(err)
+		}
+		keys = append(keys, string(e.Meta.Key))
+	}
+	if len(keys) != 2 || keys[0] != "k1" || keys[1] != "k3"{
+		t.Fatalf("unexpected entries %v", keys)
+	}
+}
+
+//MMap模式下超出映射大小的entry返回错误, 不能只写入一部分
+func TestDBFile_WriteMMapOverflow(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	df, err := NewDBFile(vfs.OS, dir, 0, MMap, 256, 0)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer df.Close(false)
+
+	offset := df.Offset
+	e := NewEntryNoExtra([]byte("key"), make([]byte, 512), 0, 0)
+	if err = df.Write(e); err != ErrEntryTooLarge{
+		t.Fatalf("expected ErrEntryTooLarge, got %v", err)
+	}
+	if df.Offset != offset{
+		t.Fatalf("offset moved from %d to %d", offset, df.Offset)
+	}
+
+	e = NewEntryNoExtra([]byte("key"), []byte("value"), 0, 0)
+	if err = df.Write(e); err != nil{
+		t.Fatal(err)
+	}
+	if e, err = df.Read(offset); err != nil || string(e.Meta.Value) != "value"{
+		t.Fatalf("read entry fail, err:%v", err)
+	}
+}
+
+func TestDBFile_ReadValue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, method := range []FileRWMethod{FileIO, MMap}{
+		df, err := NewDBFile(vfs.OS, dir, uint32(i), method, defaultBlockSize, 0)
+		if err != nil{
+			t.Fatal(err)
+		}
+
+		e := NewEntryNoExtra([]byte("key"), []byte("hello world"), 0, 0)
+		if err = df.Write(e); err != nil{
+			t.Fatal(err)
+		}
+		val, err := df.ReadValue(df.DataOffset(), e.Meta.KeySize, 6, 5)
+		if err != nil || string(val) != "world"{
+			t.Errorf("read value fail, val:%s err:%v", val, err)
+		}
+		df.Close(false)
+	}
+}
+
+func TestDBFile_ReadEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, method := range []FileRWMethod{FileIO, MMap}{
+		df, err := NewDBFile(vfs.OS, dir, uint32(i), method, defaultBlockSize, 0)
+		if err != nil{
+			t.Fatal(err)
+		}
+
+		e1 := NewEntry([]byte("k1"), []byte("v1"), []byte("extra"), 0, 0)
+		e2 := NewEntryNoExtra([]byte("k2"), nil, 0, 1)
+		for _, e := range []*Entry{e1, e2}{
+			if err = df.Write(e); err != nil{
+				t.Fatal(err)
+			}
+		}
+
+		base := df.DataOffset()
+		e, err := df.ReadEntry(base + int64(e1.Size()), e2.Size())
+		if err != nil || string(e.Meta.Key) != "k2" || e.Meta.Value != nil || e.GetMark() != 1{
+			t.Errorf("read entry fail, entry:%+v err:%v", e, err)
+		}
+		if _, err = df.ReadEntry(base, e1.Size() + 1); err != ErrInvalidEntry{
+			t.Errorf("expected ErrInvalidEntry, got %v", err)
+		}
+
+		//返回的值不能通过append覆盖后面的数据
+		e, _ = df.ReadEntry(base, e1.Size())
+		_ = append(e.Meta.Value, 'x')
+		if e, _ = df.Read(base); string(e.Meta.Extra) != "extra"{
+			t.Errorf("extra was overwritten: %s", e.Meta.Extra)
+		}
+		df.Close(false)
+	}
+}
+
+func TestScanner_Next(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, method := range []FileRWMethod{FileIO, MMap}{
+		df, err := NewDBFile(vfs.OS, dir, uint32(i), method, defaultBlockSize, 0)
+		if err != nil{
+			t.Fatal(err)
+		}
+
+		var offsets []int64
+		for j := 0; j < 100; j++{
+			offsets = append(offsets, df.Offset)
+			e := NewEntry([]byte(fmt.Sprintf("key-%d", j)), []byte(fmt.Sprintf("value-%d", j)), nil, 0, 0)
+			if err = df.Write(e); err != nil{
+				t.Fatal(err)
+			}
+		}
+
+		//使用很小的缓冲区, entry会跨越多次读取
+		scanner := NewScanner(df, 16)
+		for j := 0; ; j++{
+			e, offset, err := scanner.Next()
+			if err == io.EOF{
+				if j != 100{
+					t.Errorf("expected 100 entries, got %d", j)
+				}
+				break
+			}
+			if err != nil{
+				t.Fatal(err)
+			}
+			if offset != offsets[j] || string(e.Meta.Value) != fmt.Sprintf("value-%d", j){
+				t.Errorf("unexpected entry %d at %d: %s", j, offset, e.Meta.Value)
+			}
+		}
+		df.Close(false)
+	}
+}
+
+func TestDBFile_Compression(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	value := bytes.Repeat([]byte(`{"name":"stardb","tags":["kv","redis"]}`), 20)
+	for i, method := range []FileRWMethod{FileIO, MMap}{
+		for _, c := range []Compression{NoCompression, Snappy, Zstd, Flate}{
+			df, err := NewDBFile(vfs.OS, dir, uint32(i * 4) + uint32(c), method, defaultBlockSize, 0)
+			if err != nil{
+				t.Fatal(err)
+			}
+
+			//小于阈值的value不压缩
+			small := NewEntryNoExtra([]byte("small"), []byte("tiny"), 0, 0)
+			big := NewEntry([]byte("big"), value, []byte("extra"), 0, 1)
+			for _, e := range []*Entry{small, big}{
+				if err = e.Compress(c, 64); err != nil{
+					t.Fatal(err)
+				}
+				if err = df.Write(e); err != nil{
+					t.Fatal(err)
+				}
+			}
+			if small.Compression() != NoCompression{
+				t.Errorf("%d: small value should not be compressed", c)
+			}
+			if big.Compression() != c || (c != NoCompression && big.Size() >= uint32(len(value))){
+				t.Errorf("%d: big value not compressed, size %d", c, big.Size())
+			}
+			if big.GetType() != 0 || big.GetMark() != 1{
+				t.Errorf("%d: type or mark changed: %d %d", c, big.GetType(), big.GetMark())
+			}
+
+			offset := df.DataOffset() + int64(small.Size())
+			if e, err := df.Read(offset); err != nil || !bytes.Equal(e.Meta.Value, value) || string(e.Meta.Extra) != "extra"{
+				t.Errorf("%d: read fail, err:%v", c, err)
+			}
+			e, err := df.ReadEntry(offset, big.Size())
+			if err != nil || !bytes.Equal(e.Meta.Value, value) || e.Meta.ValueSize != uint32(len(value)) || e.Size() != big.Size(){
+				t.Errorf("%d: read entry fail, err:%v", c, err)
+			}
+			if val, err := df.ReadValue(offset, big.Meta.KeySize, 2, 4); err != nil || string(val) != "name"{
+				t.Errorf("%d: read value fail, val:%s err:%v", c, val, err)
+			}
+
+			scanner := NewScanner(df, 16)
+			for _, want := range []*Entry{small, big}{
+				e, _, err := scanner.Next()
+				if err != nil || !bytes.Equal(e.Meta.Value, want.Meta.Value) || e.Size() != want.Size(){
+					t.Errorf("%d: scan fail, err:%v", c, err)
+				}
+			}
+			if _, _, err = scanner.Next(); err != io.EOF{
+				t.Errorf("%d: expected io.EOF, got %v", c, err)
+			}
+
+			//解码之后可以换一种算法重新压缩
+			if err = e.Compress(Snappy, 0); err != nil || e.Compression() != Snappy{
+				t.Errorf("%d: recompress fail, err:%v", c, err)
+			}
+			df.Close(false)
+		}
+	}
+}
@@ -4,39 +4,51 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"stardb/vfs"
 )
 
 type DBMeta struct {
 	ActiveWriteOff 		 map[uint16]int64 		 `json:"active_write_off"`     //当前活跃db的写偏移
 	ReclaimableSpace     map[uint32]int64        `json:"reclaimable_space"`    //每个db文件的可回收空间
+	ValueLogDiscard      map[uint32]int64        `json:"value_log_discard"`    //每个值日志文件中已经失效的大小
 }
 
-// LoadMeta 加载meta
-func LoadMeta(path string)(m *DBMeta){
+// LoadMeta 从fs加载meta, 加密的meta使用c解密
+func LoadMeta(fs vfs.FS, path string, c *Cipher)(m *DBMeta){
 	m = &DBMeta{
 		ActiveWriteOff: make(map[uint16]int64),
 		ReclaimableSpace: make(map[uint32]int64),
+		ValueLogDiscard: make(map[uint32]int64),
 	}
 
-	file, err := os.OpenFile(path, os.O_RDONLY, 0600)
+	file, err := fs.OpenFile(path, os.O_RDONLY, 0600)
 	if err != nil{
 		return
 	}
 	defer file.Close()
 
 	b, _ := ioutil.ReadAll(file)
+	if b, err = c.UnsealFile(b); err != nil{
+		return
+	}
 	_ = json.Unmarshal(b, m)
 	return
 }
 
-func (m *DBMeta) Store(path string) error{
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0600)
+// Store 保存meta到fs, c不为nil时加密保存
+func (m *DBMeta) Store(fs vfs.FS, path string, c *Cipher) error{
+	b, _ := json.Marshal(m)
+	b, err := c.SealFile(b, nil)
+	if err != nil{
+		return err
+	}
+
+	file, err := fs.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil{
 		return err
 	}
 	defer file.Close()
 
-	b, _ := json.Marshal(m)
 	_, err = file.Write(b)
 	return err
 }
\ No newline at end of file
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"stardb/vfs"
 	"testing"
 )
 
@@ -14,7 +15,7 @@ func TestDBMeta_Store(t *testing.T) {
 		ActiveWriteOff: writeOff,
 		ReclaimableSpace: reclaimableSpace,
 	}
-	err := m.Store(path)
+	err := m.Store(vfs.OS, path, nil)
 	if err != nil{
 		t.Error("store file err:", err)
 	}
@@ -22,6 +23,6 @@ func TestDBMeta_Store(t *testing.T) {
 
 func TestLoadMeta(t *testing.T) {
 	path := "D:\\github\\stardb\\testFile\\test.Meta"
-	meta := LoadMeta(path)
+	meta := LoadMeta(vfs.OS, path, nil)
 	fmt.Printf("%+v", meta)
 }
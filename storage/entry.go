@@ -17,6 +17,12 @@ const (
 	//Timestamp takes 8 bytes, state takes 2 bytes
 	//4 * 4 + 8 + 2 = 26
 	entryHeaderSize = 26
+
+	//state中的加密标记
+	encryptedFlag uint16 = 1 << 15
+
+	//state中的值分离标记, value保存在值日志中, 文件中只保存它的位置
+	valuePointerFlag uint16 = 1 << 7
 )
 
 const (
@@ -25,14 +31,17 @@ const (
 	Hash
 	Set
 	ZSet
+	Stream
 )
 
 type (
 	Entry struct {
 		Meta 		*Meta
-		state       uint16
-		crc32       uint32
+		state       uint16     //最高位是加密标记, 接着3位是压缩算法, 再4位是数据类型, 然后是值分离标记, 低7位是操作标记
+		crc32       uint32     //加密时是整个密文的crc
 		Timestamp   uint64
+		stored      []byte     //压缩后或者值分离时写入文件的value, 否则为nil
+		cipher      *Cipher    //加密使用的Cipher
 	}
 
 	Meta struct {
@@ -81,8 +90,95 @@ func NewEntryWithExpire(key, value []byte, deadline int64, t, mark uint16) *Entr
 	return newInternal(key, value, nil, state, uint64(deadline))
 }
 
+// Size entry在文件中占用的大小, value压缩时按压缩后的大小计算
 func (e *Entry) Size() uint32 {
-	return entryHeaderSize + e.Meta.KeySize + e.Meta.ValueSize + e.Meta.ExtraSize
+	size := entryHeaderSize + e.Meta.KeySize + e.storedSize() + e.Meta.ExtraSize
+	if e.Encrypted(){
+		size += sealOverhead
+	}
+	return size
+}
+
+// Encrypt 设置加密key, value和extra使用的Cipher, c为nil时不加密
+// 使用Cipher当前的密钥, 回收时重新设置即可用轮换后的密钥重新加密
+func (e *Entry) Encrypt(c *Cipher){
+	e.cipher = c
+	if c != nil{
+		e.state |= encryptedFlag
+	}else{
+		e.state &^= encryptedFlag
+	}
+}
+
+// Encrypted entry在文件中是否加密
+func (e *Entry) Encrypted() bool{
+	return e.state & encryptedFlag != 0
+}
+
+// Compress 按压缩算法重新压缩value, value小于threshold或者压缩后没有变小时不压缩
+// Meta.Value始终保存未压缩的值, 回收时可以用新的算法重新压缩
+func (e *Entry) Compress(c Compression, threshold int) error{
+	//值分离时文件中只有值日志中的位置, 不需要压缩
+	if e.state & valuePointerFlag != 0{
+		return nil
+	}
+	e.stored = nil
+	e.setCompression(NoCompression)
+	if c == NoCompression || len(e.Meta.Value) == 0 || len(e.Meta.Value) < threshold{
+		return nil
+	}
+
+	data, err := c.compress(e.Meta.Value)
+	if err != nil{
+		return err
+	}
+	if len(data) >= len(e.Meta.Value){
+		return nil
+	}
+	e.stored = data
+	e.setCompression(c)
+	return nil
+}
+
+// SetValuePointer 文件中保存value在值日志中的位置p, Meta.Value仍然是原来的值
+func (e *Entry) SetValuePointer(p ValuePointer){
+	e.setCompression(NoCompression)
+	e.stored = p.Encode()
+	e.state |= valuePointerFlag
+}
+
+// ValuePointer 返回value在值日志中的位置, value没有分离时返回false
+func (e *Entry) ValuePointer() (ValuePointer, bool){
+	if e.state & valuePointerFlag == 0{
+		return ValuePointer{}, false
+	}
+	p, err := DecodeValuePointer(e.storedValue())
+	return p, err == nil
+}
+
+// Compression value在文件中使用的压缩算法
+func (e *Entry) Compression() Compression{
+	return Compression(e.state >> 12 & 0x07)
+}
+
+func (e *Entry) setCompression(c Compression){
+	e.state = e.state &^ 0x7000 | uint16(c) << 12
+}
+
+//value在文件中的大小, 从头部解码之后、解析value之前即为头部记录的大小
+func (e *Entry) storedSize() uint32{
+	if e.stored != nil{
+		return uint32(len(e.stored))
+	}
+	return e.Meta.ValueSize
+}
+
+//写入文件的value
+func (e *Entry) storedValue() []byte{
+	if e.stored != nil{
+		return e.stored
+	}
+	return e.Meta.Value
 }
 
 func (e *Entry) Encode()([]byte, error){
@@ -90,27 +186,45 @@ func (e *Entry) Encode()([]byte, error){
 		return nil, ErrInvalidEntry
 	}
 
-	ks, vs := e.Meta.KeySize, e.Meta.ValueSize
+	ks, vs := e.Meta.KeySize, e.storedSize()
 	es := e.Meta.ExtraSize
-	buf := make([]byte, e.Size())
+	buf := make([]byte, entryHeaderSize + ks + vs + es)
 
-	binary.BigEndian.PutUint32(buf[4:8], ks)
-	binary.BigEndian.PutUint32(buf[8:12], vs)
-	binary.BigEndian.PutUint32(buf[12:16], es)
-	binary.BigEndian.PutUint16(buf[16:18], e.state)
-	binary.BigEndian.PutUint64(buf[18:26], e.Timestamp)
+	e.encodeHeader(buf)
 	copy(buf[entryHeaderSize:entryHeaderSize+ks], e.Meta.Key)
-	copy(buf[entryHeaderSize+ks:(entryHeaderSize+ks+vs)], e.Meta.Value)
+	copy(buf[entryHeaderSize+ks:(entryHeaderSize+ks+vs)], e.storedValue())
 	if es > 0 {
 		copy(buf[(entryHeaderSize+ks+vs):(entryHeaderSize+ks+vs+es)], e.Meta.Extra)
 	}
 
-	crc := crc32.ChecksumIEEE(e.Meta.Value)
-	binary.BigEndian.PutUint32(buf[0:4], crc)  //0:4 crc of value
+	if !e.Encrypted(){
+		crc := crc32.ChecksumIEEE(e.storedValue())
+		binary.BigEndian.PutUint32(buf[0:4], crc)  //0:4 crc of the stored value
+		return buf, nil
+	}
 
+	//加密key, value和extra, 头部参与认证
+	if e.cipher == nil{
+		return nil, ErrNoCipher
+	}
+	sealed, err := e.cipher.seal(buf[entryHeaderSize:], buf[4:entryHeaderSize])
+	if err != nil{
+		return nil, err
+	}
+	buf = append(buf[:entryHeaderSize], sealed...)
+	binary.BigEndian.PutUint32(buf[0:4], crc32.ChecksumIEEE(sealed))  //0:4 crc of the sealed body
 	return buf, nil
 }
 
+//编码crc之外的头部信息
+func (e *Entry) encodeHeader(buf []byte){
+	binary.BigEndian.PutUint32(buf[4:8], e.Meta.KeySize)
+	binary.BigEndian.PutUint32(buf[8:12], e.storedSize())
+	binary.BigEndian.PutUint32(buf[12:16], e.Meta.ExtraSize)
+	binary.BigEndian.PutUint16(buf[16:18], e.state)
+	binary.BigEndian.PutUint64(buf[18:26], e.Timestamp)
+}
+
 func Decode(buf []byte)(*Entry, error){
 	ks := binary.BigEndian.Uint32(buf[4:8])
 	vs := binary.BigEndian.Uint32(buf[8:12])
@@ -131,10 +245,90 @@ func Decode(buf []byte)(*Entry, error){
 	}, nil
 }
 
+//从紧跟在头部之后的buf中解析key, value和extra并校验crc, 未压缩和加密时buf不会被拷贝
+//加密的entry使用c解密
+func (e *Entry) decodeBody(buf []byte, c *Cipher) error{
+	ks, vs, es := e.Meta.KeySize, e.Meta.ValueSize, e.Meta.ExtraSize
+	if e.Encrypted(){
+		var err error
+		if buf, err = e.decrypt(buf, c); err != nil{
+			return err
+		}
+	}
+	if uint32(len(buf)) < ks + vs + es{
+		return ErrInvalidEntry
+	}
+
+	if ks > 0{
+		e.Meta.Key = buf[:ks:ks]
+	}
+	if vs > 0{
+		e.Meta.Value = buf[ks:ks+vs:ks+vs]
+	}
+	if es > 0{
+		e.Meta.Extra = buf[ks+vs:ks+vs+es:ks+vs+es]
+	}
+	if !e.Encrypted(){
+		if err := e.check(); err != nil{
+			return err
+		}
+	}
+	return e.decompress()
+}
+
+//校验密文的crc并解密, 返回key, value和extra的明文
+func (e *Entry) decrypt(buf []byte, c *Cipher) ([]byte, error){
+	n := e.Meta.KeySize + e.Meta.ValueSize + e.Meta.ExtraSize + sealOverhead
+	if uint32(len(buf)) < n{
+		return nil, ErrInvalidEntry
+	}
+	buf = buf[:n]
+	if crc32.ChecksumIEEE(buf) != e.crc32{
+		return nil, ErrInvalidCrc
+	}
+	if c == nil{
+		return nil, ErrNoCipher
+	}
+
+	header := make([]byte, entryHeaderSize)
+	e.encodeHeader(header)
+	plain, err := c.open(buf, header[4:])
+	if err != nil{
+		return nil, err
+	}
+	e.cipher = c
+	return plain, nil
+}
+
+//解压value, 之后Meta.Value和ValueSize都是未压缩的值
+func (e *Entry) decompress() error{
+	c := e.Compression()
+	if c == NoCompression{
+		return nil
+	}
+
+	val, err := c.decompress(e.Meta.Value)
+	if err != nil{
+		return err
+	}
+	e.stored = e.Meta.Value
+	e.Meta.Value = val
+	e.Meta.ValueSize = uint32(len(val))
+	return nil
+}
+
+//校验value的crc
+func (e *Entry) check() error{
+	if crc32.ChecksumIEEE(e.storedValue()) != e.crc32{
+		return ErrInvalidCrc
+	}
+	return nil
+}
+
 func (e *Entry) GetType() uint16{
-	return e.state >> 8
+	return e.state >> 8 & 0x0f
 }
 
 func (e *Entry) GetMark() uint16{
-	return e.state & (2<<7 - 1)
+	return e.state & (1<<7 - 1)
 }
\ No newline at end of file
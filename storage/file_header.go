@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"stardb/vfs"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnsupportedFileVersion = errors.New("storage/file_header: unsupported db file version")
+	ErrFileTypeMismatch = errors.New("storage/file_header: data type in the file header does not match the file name")
+)
+
+const (
+	// FileVersionLegacy 没有文件头的旧格式, entry从文件开头写起
+	FileVersionLegacy uint16 = 0
+
+	// FileVersion1 文件开头是16字节的文件头: magic(8) + 版本(2) + 数据类型(2) + 保留(4)
+	FileVersion1 uint16 = 1
+
+	// CurrentFileVersion 新建的数据文件使用的格式版本
+	CurrentFileVersion = FileVersion1
+
+	fileHeaderSize = 16
+
+	migrateTmpFile = "stardb_migrate.tmp"
+)
+
+//旧格式文件开头是entry的crc和KeySize, KeySize的最高字节不会是'D', 因此不会被误认为文件头
+var fileMagic = []byte("STARDBFH")
+
+//编码文件头
+func encodeFileHeader(eType uint16) []byte{
+	buf := make([]byte, fileHeaderSize)
+	copy(buf, fileMagic)
+	binary.BigEndian.PutUint16(buf[8:10], CurrentFileVersion)
+	binary.BigEndian.PutUint16(buf[10:12], eType)
+	return buf
+}
+
+//解析文件头, 没有文件头时返回FileVersionLegacy
+func decodeFileHeader(buf []byte, eType uint16) (uint16, error){
+	if len(buf) < fileHeaderSize || !bytes.Equal(buf[:len(fileMagic)], fileMagic){
+		return FileVersionLegacy, nil
+	}
+	version := binary.BigEndian.Uint16(buf[8:10])
+	if version > CurrentFileVersion{
+		return 0, ErrUnsupportedFileVersion
+	}
+	if binary.BigEndian.Uint16(buf[10:12]) != eType{
+		return 0, ErrFileTypeMismatch
+	}
+	return version, nil
+}
+
+//读取已有文件的格式版本, 空文件写入当前版本的文件头
+func initFileHeader(file vfs.File, eType uint16) (uint16, error){
+	info, err := file.Stat()
+	if err != nil{
+		return 0, err
+	}
+	if info.Size() == 0{
+		if _, err = file.WriteAt(encodeFileHeader(eType), 0); err != nil{
+			return 0, err
+		}
+		return CurrentFileVersion, nil
+	}
+
+	buf := make([]byte, fileHeaderSize)
+	n, err := file.ReadAt(buf, 0)
+	if err != nil && err != io.EOF{
+		return 0, err
+	}
+	return decodeFileHeader(buf[:n], eType)
+}
+
+// Version 数据文件的格式版本
+func (df *DBFile) Version() uint16{
+	return df.version
+}
+
+// DataOffset 第一个entry在文件中的偏移量
+func (df *DBFile) DataOffset() int64{
+	if df.version == FileVersionLegacy{
+		return 0
+	}
+	return fileHeaderSize
+}
+
+// DataFileIds 返回目录下每种数据类型的数据文件id, 按id从小到大排列
+func DataFileIds(fs vfs.FS, path string) (map[uint16][]uint32, error){
+	dir, err := fs.ReadDir(path)  //读取目录下的所有文件
+	if err != nil{
+		return nil, err
+	}
+
+	ids := make(map[uint16][]int)
+	for _, d := range dir {
+		if strings.Contains(d.Name(), ".data"){
+			splitNames := strings.Split(d.Name(), ".")
+			if len(splitNames) != 3{
+				continue
+			}
+			id, _ := strconv.Atoi(splitNames[0])
+
+			for dataType, suffix := range DBFileSuffixName{
+				if splitNames[2] == suffix{
+					ids[uint16(dataType)] = append(ids[uint16(dataType)], id)
+				}
+			}
+		}
+	}
+
+	fileIds := make(map[uint16][]uint32)
+	for dataType, typeIds := range ids{
+		sort.Ints(typeIds)
+		for _, id := range typeIds{
+			fileIds[dataType] = append(fileIds[dataType], uint32(id))
+		}
+	}
+	return fileIds, nil
+}
+
+// MigrateFile 把旧格式的数据文件离线重写为当前格式, 返回entry偏移量增加的大小, 已是当前格式时返回0
+// 只保留完整的entry, MMap模式下文件末尾的填充会被去掉, 加密的entry不需要解密
+func MigrateFile(fs vfs.FS, path string, fileId uint32, eType uint16) (int64, error){
+	filePath := path + PathSeparator + fmt.Sprintf(DBFileFormatNames[eType], fileId)
+	file, err := fs.Open(filePath)
+	if err != nil{
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil{
+		return 0, err
+	}
+	if info.Size() > 0{
+		version, err := initFileHeader(file, eType)
+		if err != nil{
+			return 0, err
+		}
+		if version == CurrentFileVersion{
+			return 0, nil
+		}
+	}
+
+	//只根据entry的头部计算大小, 找到最后一个完整entry的结尾
+	var end int64
+	header := make([]byte, entryHeaderSize)
+	for end + entryHeaderSize <= info.Size(){
+		if _, err = file.ReadAt(header, end); err != nil{
+			return 0, err
+		}
+		e, err := Decode(header)
+		if err != nil{
+			return 0, err
+		}
+		if e.Meta.KeySize == 0 || end + int64(e.Size()) > info.Size(){
+			break
+		}
+		end += int64(e.Size())
+	}
+
+	tmpPath := path + PathSeparator + migrateTmpFile
+	tmp, err := fs.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, FilePerm)
+	if err != nil{
+		return 0, err
+	}
+	defer fs.Remove(tmpPath)
+
+	if _, err = tmp.Write(encodeFileHeader(eType)); err == nil{
+		_, err = io.Copy(tmp, io.NewSectionReader(file, 0, end))
+	}
+	if err == nil{
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil{
+		err = closeErr
+	}
+	if err != nil{
+		return 0, err
+	}
+
+	if err = fs.Rename(tmpPath, filePath); err != nil{
+		return 0, err
+	}
+	return fileHeaderSize, fs.SyncDir(path)
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"stardb/vfs"
+	"testing"
+)
+
+//写入没有文件头的旧格式数据文件
+func writeLegacyFile(t *testing.T, dir string, fileId uint32, eType uint16, entries ...*Entry){
+	var buf bytes.Buffer
+	for _, e := range entries{
+		b, err := e.Encode()
+		if err != nil{
+			t.Fatal(err)
+		}
+		buf.Write(b)
+	}
+	path := filepath.Join(dir, fmt.Sprintf(DBFileFormatNames[eType], fileId))
+	if err := ioutil.WriteFile(path, buf.Bytes(), FilePerm); err != nil{
+		t.Fatal(err)
+	}
+}
+
+func TestDBFile_Legacy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e1 := NewEntryNoExtra([]byte("k1"), []byte("v1"), Hash, 0)
+	e2 := NewEntry([]byte("k2"), []byte("v2"), []byte("field"), Hash, 1)
+	writeLegacyFile(t, dir, 3, Hash, e1, e2)
+
+	check := func(method FileRWMethod, version uint16){
+		df, err := NewDBFile(vfs.OS, dir, 3, method, defaultBlockSize, Hash)
+		if err != nil{
+			t.Fatal(err)
+		}
+		defer df.Close(false)
+		if df.Version() != version{
+			t.Errorf("expected version %d, got %d", version, df.Version())
+		}
+
+		scanner := NewScanner(df, 64)
+		offset := df.DataOffset()
+		for _, want := range []*Entry{e1, e2}{
+			e, off, err := scanner.Next()
+			if err != nil || off != offset || !bytes.Equal(e.Meta.Key, want.Meta.Key) || !bytes.Equal(e.Meta.Extra, want.Meta.Extra){
+				t.Errorf("scan entry fail, offset:%d err:%v", off, err)
+				return
+			}
+			if val, err := df.ReadValue(off, e.Meta.KeySize, 0, int64(e.Meta.ValueSize)); err != nil || !bytes.Equal(val, want.Meta.Value){
+				t.Errorf("read value fail, val:%s err:%v", val, err)
+			}
+			offset += int64(e.Size())
+		}
+		if _, _, err = scanner.Next(); err != io.EOF{
+			t.Errorf("expected io.EOF, got %v", err)
+		}
+	}
+	check(FileIO, FileVersionLegacy)
+	check(MMap, FileVersionLegacy)
+
+	//MMap模式打开后文件末尾有填充, 迁移时会去掉
+	shift, err := MigrateFile(vfs.OS, dir, 3, Hash)
+	if err != nil || shift != fileHeaderSize{
+		t.Fatalf("migrate fail, shift:%d err:%v", shift, err)
+	}
+	info, _ := os.Stat(filepath.Join(dir, fmt.Sprintf(DBFileFormatNames[Hash], 3)))
+	if info.Size() != fileHeaderSize + int64(e1.Size() + e2.Size()){
+		t.Errorf("unexpected file size %d", info.Size())
+	}
+	check(FileIO, CurrentFileVersion)
+
+	if shift, err = MigrateFile(vfs.OS, dir, 3, Hash); err != nil || shift != 0{
+		t.Errorf("migrate twice, shift:%d err:%v", shift, err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, migrateTmpFile)); !os.IsNotExist(err){
+		t.Errorf("tmp file left, err:%v", err)
+	}
+}
+
+func TestDecodeFileHeader(t *testing.T) {
+	header := encodeFileHeader(List)
+	if v, err := decodeFileHeader(header, List); err != nil || v != CurrentFileVersion{
+		t.Errorf("decode fail, version:%d err:%v", v, err)
+	}
+	if _, err := decodeFileHeader(header, Set); err != ErrFileTypeMismatch{
+		t.Errorf("expected ErrFileTypeMismatch, got %v", err)
+	}
+	header[9] = byte(CurrentFileVersion + 1)
+	if _, err := decodeFileHeader(header, List); err != ErrUnsupportedFileVersion{
+		t.Errorf("expected ErrUnsupportedFileVersion, got %v", err)
+	}
+
+	e, _ := NewEntryNoExtra([]byte("key"), []byte("value"), List, 0).Encode()
+	if v, err := decodeFileHeader(e, List); err != nil || v != FileVersionLegacy{
+		t.Errorf("expected legacy version, got %d err:%v", v, err)
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"bufio"
+	"io"
+	"math"
+)
+
+// DefaultScanBufferSize 顺序读取数据文件时的缓冲区大小: 1MB
+const DefaultScanBufferSize = 1024 * 1024
+
+// Scanner 从第一个entry开始按顺序读取数据文件中的entry
+// FileIO模式下通过带缓冲的reader读取, 减少系统调用, MMap模式下从映射的内存拷贝
+type Scanner struct {
+	df     *DBFile
+	reader *bufio.Reader
+	header []byte
+	offset int64
+	noCopy bool
+}
+
+// NewScanner 新建一个数据文件的顺序读取器, bufSize为FileIO模式下的缓冲区大小
+func NewScanner(df *DBFile, bufSize int) *Scanner{
+	s := &Scanner{df: df, header: make([]byte, entryHeaderSize), offset: df.DataOffset()}
+	if df.method == FileIO{
+		s.reader = bufio.NewReaderSize(io.NewSectionReader(df.File, s.offset, math.MaxInt64), bufSize)
+	}
+	return s
+}
+
+// NoCopy MMap模式下返回的entry直接引用映射的内存, 不再拷贝
+// 只能用于回收这样不保留entry的扫描, entry不能修改, 文件关闭之后也不能再访问
+func (s *Scanner) NoCopy() *Scanner{
+	s.noCopy = true
+	return s
+}
+
+// Next 返回下一个entry和它的偏移量, 读到文件末尾时返回io.EOF
+// 文件末尾不完整的entry以及KeySize为0的头部(MMap模式下文件末尾的填充)同样视为文件末尾
+func (s *Scanner) Next()(e *Entry, offset int64, err error){
+	offset = s.offset
+	if s.df.method == MMap{
+		e, err = s.nextMMap()
+	}else{
+		e, err = s.nextFileIO()
+	}
+	if err != nil{
+		return nil, offset, err
+	}
+
+	s.offset += int64(e.Size())
+	return e, offset, nil
+}
+
+func (s *Scanner) nextFileIO()(*Entry, error){
+	if _, err := io.ReadFull(s.reader, s.header); err != nil{
+		return nil, eofIfTruncated(err)
+	}
+	e, err := Decode(s.header)
+	if err != nil{
+		return nil, err
+	}
+	if e.Meta.KeySize == 0{
+		return nil, io.EOF
+	}
+
+	body := make([]byte, e.Size() - entryHeaderSize)
+	if _, err = io.ReadFull(s.reader, body); err != nil{
+		return nil, eofIfTruncated(err)
+	}
+	if err = e.decodeBody(body, s.df.cipher); err != nil{
+		return nil, err
+	}
+	return e, nil
+}
+
+func (s *Scanner) nextMMap()(*Entry, error){
+	header, err := s.df.readAt(s.offset, entryHeaderSize)
+	if err != nil{
+		return nil, err
+	}
+	e, err := Decode(header)
+	if err != nil{
+		return nil, err
+	}
+	if e.Meta.KeySize == 0{
+		return nil, io.EOF
+	}
+
+	body, err := s.df.readAt(s.offset + entryHeaderSize, int64(e.Size() - entryHeaderSize))
+	if err != nil{
+		return nil, err
+	}
+	if !s.noCopy{
+		body = append([]byte(nil), body...)
+	}
+	if err = e.decodeBody(body, s.df.cipher); err != nil{
+		return nil, err
+	}
+	return e, nil
+}
+
+func eofIfTruncated(err error) error{
+	if err == io.ErrUnexpectedEOF{
+		return io.EOF
+	}
+	return err
+}
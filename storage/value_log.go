@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"stardb/vfs"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// ValueLogType 值日志文件使用的类型, 不属于任何数据结构
+	ValueLogType uint16 = 0x0f
+
+	valuePointerSize = 20
+)
+
+var ErrInvalidValuePointer = errors.New("storage/value_log: invalid value pointer")
+
+// ValuePointer value在值日志中的位置
+type ValuePointer struct {
+	FileId    uint32
+	Offset    int64
+	Size      uint32   //entry在值日志中的大小
+	ValueSize uint32   //value的长度
+}
+
+// Encode 编码为定长的20字节
+func (p ValuePointer) Encode() []byte{
+	buf := make([]byte, valuePointerSize)
+	binary.BigEndian.PutUint32(buf[0:4], p.FileId)
+	binary.BigEndian.PutUint64(buf[4:12], uint64(p.Offset))
+	binary.BigEndian.PutUint32(buf[12:16], p.Size)
+	binary.BigEndian.PutUint32(buf[16:20], p.ValueSize)
+	return buf
+}
+
+func DecodeValuePointer(buf []byte) (ValuePointer, error){
+	if len(buf) != valuePointerSize{
+		return ValuePointer{}, ErrInvalidValuePointer
+	}
+	return ValuePointer{
+		FileId: binary.BigEndian.Uint32(buf[0:4]),
+		Offset: int64(binary.BigEndian.Uint64(buf[4:12])),
+		Size: binary.BigEndian.Uint32(buf[12:16]),
+		ValueSize: binary.BigEndian.Uint32(buf[16:20]),
+	}, nil
+}
+
+/*
+ *ValueLog 保存分离出来的大value, entry的key和value与数据文件中的格式相同, 类型为ValueLog
+ *写满blockSize之后切换到新的文件, 旧的文件只读, 由调用方判断其中的value是否有效并回收
+ */
+type ValueLog struct {
+	mu        sync.RWMutex
+	fs        vfs.FS
+	path      string
+	method    FileRWMethod
+	blockSize int64
+	cipher    *Cipher
+	files     map[uint32]*DBFile
+	activeId  uint32
+}
+
+// OpenValueLog 打开目录下的值日志, 从最后一个文件的末尾继续写入
+func OpenValueLog(fs vfs.FS, path string, method FileRWMethod, blockSize int64, c *Cipher) (*ValueLog, error){
+	ids, err := ValueLogFileIds(fs, path)
+	if err != nil{
+		return nil, err
+	}
+	if len(ids) == 0{
+		ids = []uint32{0}
+	}
+
+	vl := &ValueLog{fs: fs, path: path, method: method, blockSize: blockSize, cipher: c, files: make(map[uint32]*DBFile)}
+	for _, id := range ids{
+		df, err := vl.openFile(id)
+		if err != nil{
+			vl.Close(false)
+			return nil, err
+		}
+		vl.files[id] = df
+	}
+	vl.activeId = ids[len(ids) - 1]
+
+	//已有文件的写偏移为最后一个完整entry的结尾
+	for id, df := range vl.files{
+		scanner := NewScanner(df, DefaultScanBufferSize).NoCopy()
+		for{
+			e, offset, err := scanner.Next()
+			if err == io.EOF{
+				break
+			}
+			if err != nil{
+				vl.Close(false)
+				return nil, err
+			}
+			df.Offset = offset + int64(e.Size())
+		}
+		if id == vl.activeId{
+			if err := df.Resume(df.Offset); err != nil{
+				vl.Close(false)
+				return nil, err
+			}
+		}
+	}
+	return vl, nil
+}
+
+func (vl *ValueLog) openFile(id uint32) (*DBFile, error){
+	df, err := NewDBFile(vl.fs, vl.path, id, vl.method, vl.blockSize, ValueLogType)
+	if err != nil{
+		return nil, err
+	}
+	df.SetCipher(vl.cipher)
+	return df, nil
+}
+
+// Write 将entry追加到值日志, 返回它的位置
+func (vl *ValueLog) Write(e *Entry) (ValuePointer, error){
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+
+	active := vl.files[vl.activeId]
+	if active.Offset + int64(e.Size()) > vl.blockSize && active.Offset > active.DataOffset(){
+		if err := active.Sync(); err != nil{
+			return ValuePointer{}, err
+		}
+		df, err := vl.openFile(vl.activeId + 1)
+		if err != nil{
+			return ValuePointer{}, err
+		}
+		vl.activeId++
+		vl.files[vl.activeId] = df
+		active = df
+	}
+
+	if err := active.Write(e); err != nil{
+		return ValuePointer{}, err
+	}
+	return ValuePointer{
+		FileId: vl.activeId,
+		Offset: active.Offset - int64(e.Size()),
+		Size: e.Size(),
+		ValueSize: e.Meta.ValueSize,
+	}, nil
+}
+
+// Read 读取p处的entry, MMap模式下同样是拷贝, Remove解除文件的映射之后仍然可以使用
+func (vl *ValueLog) Read(p ValuePointer) (*Entry, error){
+	vl.mu.RLock()
+	defer vl.mu.RUnlock()
+
+	df, ok := vl.files[p.FileId]
+	if !ok{
+		return nil, ErrInvalidValuePointer
+	}
+	return df.ReadEntry(p.Offset, p.Size)
+}
+
+// ReadValue 读取p处value中从start开始的n个字节
+func (vl *ValueLog) ReadValue(p ValuePointer, keySize uint32, start, n int64) ([]byte, error){
+	vl.mu.RLock()
+	defer vl.mu.RUnlock()
+
+	df, ok := vl.files[p.FileId]
+	if !ok{
+		return nil, ErrInvalidValuePointer
+	}
+	return df.ReadValue(p.Offset, keySize, start, n)
+}
+
+// Contains p是否指向值日志中已经写入的位置, 写入中途崩溃时数据文件中的位置可能已经失效
+func (vl *ValueLog) Contains(p ValuePointer) bool{
+	vl.mu.RLock()
+	defer vl.mu.RUnlock()
+
+	df, ok := vl.files[p.FileId]
+	return ok && p.Offset >= df.DataOffset() && p.Offset + int64(p.Size) <= df.Offset
+}
+
+// ActiveFile 当前写入的文件
+func (vl *ValueLog) ActiveFile() *DBFile{
+	vl.mu.RLock()
+	defer vl.mu.RUnlock()
+	return vl.files[vl.activeId]
+}
+
+// ArchivedFiles 已经写满的文件, 按id从小到大排列
+func (vl *ValueLog) ArchivedFiles() []*DBFile{
+	vl.mu.RLock()
+	defer vl.mu.RUnlock()
+
+	var files []*DBFile
+	for id, df := range vl.files{
+		if id != vl.activeId{
+			files = append(files, df)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Id < files[j].Id
+	})
+	return files
+}
+
+// Remove 删除一个已经写满的文件
+func (vl *ValueLog) Remove(id uint32) error{
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+
+	df, ok := vl.files[id]
+	if !ok || id == vl.activeId{
+		return nil
+	}
+	delete(vl.files, id)
+	if err := df.Close(false); err != nil{
+		return err
+	}
+	return vl.fs.Remove(vl.path + PathSeparator + fmt.Sprintf(DBFileFormatNames[ValueLogType], id))
+}
+
+// Sync 持久化当前写入的文件
+func (vl *ValueLog) Sync() error{
+	return vl.ActiveFile().Sync()
+}
+
+// Close 关闭所有文件
+func (vl *ValueLog) Close(sync bool) (err error){
+	vl.mu.Lock()
+	defer vl.mu.Unlock()
+
+	for id, df := range vl.files{
+		if e := df.Close(sync && id == vl.activeId); e != nil{
+			err = e
+		}
+	}
+	return
+}
+
+// ValueLogFileIds 返回目录下值日志文件的id, 按id从小到大排列
+func ValueLogFileIds(fs vfs.FS, path string) ([]uint32, error){
+	dir, err := fs.ReadDir(path)
+	if err != nil{
+		return nil, err
+	}
+
+	var ids []uint32
+	for _, d := range dir{
+		if !strings.HasSuffix(d.Name(), ".vlog"){
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(d.Name(), ".vlog"), 10, 32)
+		if err == nil{
+			ids = append(ids, uint32(id))
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"stardb/vfs"
+	"testing"
+)
+
+func TestValueLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stardb")
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, method := range []FileRWMethod{FileIO, MMap}{
+		os.RemoveAll(dir)
+		os.MkdirAll(dir, os.ModePerm)
+
+		vl, err := OpenValueLog(vfs.OS, dir, method, 4 * 1024, nil)
+		if err != nil{
+			t.Fatal(err)
+		}
+		var ptrs []ValuePointer
+		for i := 0; i < 10; i++{
+			e := NewEntryNoExtra([]byte("key"), bytes.Repeat([]byte{byte(i)}, 1000), ValueLogType, 0)
+			p, err := vl.Write(e)
+			if err != nil{
+				t.Fatal(err)
+			}
+			if !vl.Contains(p) || p.ValueSize != 1000{
+				t.Errorf("unexpected pointer %+v", p)
+			}
+			ptrs = append(ptrs, p)
+		}
+		if len(vl.ArchivedFiles()) == 0{
+			t.Errorf("expected archived value log files")
+		}
+		if err = vl.Close(true); err != nil{
+			t.Fatal(err)
+		}
+
+		//重新打开后从最后一个文件的末尾继续写入
+		if vl, err = OpenValueLog(vfs.OS, dir, method, 4 * 1024, nil); err != nil{
+			t.Fatal(err)
+		}
+		p, err := vl.Write(NewEntryNoExtra([]byte("key"), []byte("last"), ValueLogType, 0))
+		if err != nil{
+			t.Fatal(err)
+		}
+		last := ptrs[len(ptrs) - 1]
+		if p.FileId != last.FileId || p.Offset != last.Offset + int64(last.Size){
+			t.Errorf("expected to append after %+v, got %+v", last, p)
+		}
+		ptrs = append(ptrs, p)
+		for i, p := range ptrs[:10]{
+			e, err := vl.Read(p)
+			if err != nil || !bytes.Equal(e.Meta.Value, bytes.Repeat([]byte{byte(i)}, 1000)){
+				t.Errorf("read %+v fail, err:%v", p, err)
+			}
+			if val, err := vl.ReadValue(p, 3, 10, 2); err != nil || !bytes.Equal(val, []byte{byte(i), byte(i)}){
+				t.Errorf("read value %+v fail, err:%v", p, err)
+			}
+		}
+
+		first := vl.ArchivedFiles()[0].Id
+		if err = vl.Remove(first); err != nil{
+			t.Fatal(err)
+		}
+		if vl.Contains(ptrs[0]){
+			t.Errorf("removed file still contains %+v", ptrs[0])
+		}
+		if _, err = vl.Read(ptrs[0]); err != ErrInvalidValuePointer{
+			t.Errorf("expected ErrInvalidValuePointer, got %v", err)
+		}
+		if ids, _ := ValueLogFileIds(vfs.OS, dir); len(ids) == 0 || ids[0] == first{
+			t.Errorf("unexpected value log files %v", ids)
+		}
+		vl.Close(false)
+	}
+}
+
+func TestEntry_ValuePointer(t *testing.T) {
+	p := ValuePointer{FileId: 3, Offset: 1 << 40, Size: 1234, ValueSize: 1000}
+	e := NewEntryNoExtra([]byte("key"), bytes.Repeat([]byte("v"), 1000), String, 0)
+	e.SetValuePointer(p)
+	if err := e.Compress(Zstd, 0); err != nil{
+		t.Fatal(err)
+	}
+	if e.Size() != entryHeaderSize + 3 + valuePointerSize || e.GetMark() != 0 || e.Compression() != NoCompression{
+		t.Errorf("unexpected entry size %d", e.Size())
+	}
+
+	buf, err := e.Encode()
+	if err != nil{
+		t.Fatal(err)
+	}
+	d, _ := Decode(buf)
+	if err = d.decodeBody(buf[entryHeaderSize:], nil); err != nil{
+		t.Fatal(err)
+	}
+	if got, ok := d.ValuePointer(); !ok || got != p{
+		t.Errorf("expected %+v, got %+v", p, got)
+	}
+	if _, ok := NewEntryNoExtra([]byte("key"), []byte("v"), String, 0).ValuePointer(); ok{
+		t.Errorf("unexpected value pointer")
+	}
+}
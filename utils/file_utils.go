@@ -3,8 +3,8 @@ package utils
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
+	"stardb/vfs"
 )
 
 // Exist 校验目录或文件是否存在
@@ -16,8 +16,8 @@ func Exist(path string) bool {
 	return true
 }
 
-//拷贝目录
-func CopyDir(src string, dst string) error{
+//拷贝fs中的目录
+func CopyDir(fs vfs.FS, src string, dst string) error{
 	var (
 		err error
 		dir []os.FileInfo
@@ -25,15 +25,15 @@ func CopyDir(src string, dst string) error{
 	)
 
 	//判断原目录是否存在
-	if srcInfo, err = os.Stat(src); err != nil{
+	if srcInfo, err = fs.Stat(src); err != nil{
 		return err
 	}
 	//创建目标目录
-	if err = os.MkdirAll(dst, srcInfo.Mode()); err != nil{
+	if err = fs.MkdirAll(dst, srcInfo.Mode()); err != nil{
 		return err
 	}
 	//读取src下的文件和目录
-	if dir, err = ioutil.ReadDir(src); err != nil{
+	if dir, err = fs.ReadDir(src); err != nil{
 		return err
 	}
 
@@ -42,11 +42,11 @@ func CopyDir(src string, dst string) error{
 		dstPath := fmt.Sprintf("%s%s%s", dst, string(os.PathSeparator), fd.Name())//path.Join(dst, fd.Name())
 
 		if fd.IsDir(){
-			if err = CopyDir(srcPath, dstPath); err != nil{  //递归复制
+			if err = CopyDir(fs, srcPath, dstPath); err != nil{  //递归复制
 				return err
 			}
 		} else{
-			if err = CopyFile(srcPath, dstPath); err != nil{
+			if err = CopyFile(fs, srcPath, dstPath); err != nil{
 				return err
 			}
 		}
@@ -55,34 +55,32 @@ func CopyDir(src string, dst string) error{
 	return nil
 }
 
-//CopyFile 拷贝文件
-func CopyFile(src string, dst string) error {
+//CopyFile 拷贝fs中的文件
+func CopyFile(fs vfs.FS, src string, dst string) error {
 	var(
 		err error
-		srcFile *os.File
-		dstFile *os.File
+		srcFile vfs.File
+		dstFile vfs.File
 		srcInfo os.FileInfo
 	)
 
-	if srcFile, err = os.Open(src); err != nil{
+	if srcFile, err = fs.Open(src); err != nil{
 		return err
 	}
 
 	defer srcFile.Close()
 
-	if dstFile, err = os.Create(dst); err != nil{
+	if srcInfo, err = srcFile.Stat(); err != nil{
 		return err
 	}
 
-	defer dstFile.Close()
-
-	if _, err = io.Copy(dstFile, srcFile); err != nil{
-		return err
-	}
-    //将src的访问权限设置给dst
-	if srcInfo, err = os.Stat(src); err != nil{
+	//新建的dst使用src的访问权限
+	if dstFile, err = fs.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, srcInfo.Mode()); err != nil{
 		return err
 	}
 
-	return os.Chmod(dst, srcInfo.Mode())
+	defer dstFile.Close()
+
+	_, err = io.Copy(dstFile, srcFile)
+	return err
 }
\ No newline at end of file
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"stardb/vfs"
 	"testing"
 )
 
@@ -8,7 +9,7 @@ func TestCopyDir(t *testing.T) {
 	srcPath := "D:\\github\\stardb\\testFile\\tmp1"
 	dstPath := "D:\\github\\stardb\\testFile\\tmp2"
 
-	err := CopyDir(srcPath, dstPath)
+	err := CopyDir(vfs.OS, srcPath, dstPath)
 	if err != nil{
 		t.Error("CopyDir err:", err)
 	}
@@ -18,7 +19,7 @@ func TestCopyFile(t *testing.T) {
 	srcFile := "D:\\github\\stardb\\testFile\\tmp1\\aaa.txt"
 	dstFile := "D:\\github\\stardb\\testFile\\tmp1\\bbb.txt"
 
-	err := CopyFile(srcFile, dstFile)
+	err := CopyFile(vfs.OS, srcFile, dstFile)
 	if err != nil{
 		t.Error("CopyFile err:", err)
 	}
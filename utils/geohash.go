@@ -0,0 +1,196 @@
+package utils
+
+import "math"
+
+//与redis兼容的geohash, 经纬度编码为52bit的整数作为zset的score
+
+const (
+	// GeoStepMax 经度和纬度各使用26bit
+	GeoStepMax = 26
+	// GeoLatMin 可以编码的最小纬度, 同redis
+	GeoLatMin = -85.05112878
+	// GeoLatMax 可以编码的最大纬度
+	GeoLatMax = 85.05112878
+	// GeoLongMin 可以编码的最小经度
+	GeoLongMin = -180.0
+	// GeoLongMax 可以编码的最大经度
+	GeoLongMax = 180.0
+
+	earthRadiusInMeters = 6372797.560856
+	geoAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+)
+
+// GeoValid 经纬度是否可以编码
+func GeoValid(longitude, latitude float64) bool{
+	return longitude >= GeoLongMin && longitude <= GeoLongMax && latitude >= GeoLatMin && latitude <= GeoLatMax
+}
+
+// GeoEncode 将经纬度编码为52bit的geohash
+func GeoEncode(longitude, latitude float64) uint64{
+	return geoEncode(longitude, latitude, GeoLatMin, GeoLatMax)
+}
+
+// GeoDecode 返回geohash所在区域中心的经纬度
+func GeoDecode(bits uint64) (longitude, latitude float64){
+	ilat, ilong := deinterleave(bits)
+	scale := float64(uint64(1) << GeoStepMax)
+
+	latMin := GeoLatMin + float64(ilat) / scale * (GeoLatMax - GeoLatMin)
+	latMax := GeoLatMin + float64(ilat + 1) / scale * (GeoLatMax - GeoLatMin)
+	longMin := GeoLongMin + float64(ilong) / scale * (GeoLongMax - GeoLongMin)
+	longMax := GeoLongMin + float64(ilong + 1) / scale * (GeoLongMax - GeoLongMin)
+
+	longitude = math.Max(GeoLongMin, math.Min(GeoLongMax, (longMin + longMax) / 2))
+	latitude = math.Max(GeoLatMin, math.Min(GeoLatMax, (latMin + latMax) / 2))
+	return
+}
+
+// GeoHashString 返回标准的11位geohash字符串, 标准geohash的纬度范围为-90~90
+func GeoHashString(bits uint64) string{
+	longitude, latitude := GeoDecode(bits)
+	std := geoEncode(longitude, latitude, -90, 90)
+
+	buf := make([]byte, 11)
+	for i := 0; i < 11; i++{
+		idx := 0
+		if i < 10{
+			idx = int(std >> uint(52 - (i + 1) * 5)) & 0x1f
+		}
+		buf[i] = geoAlphabet[idx]
+	}
+	return string(buf)
+}
+
+// GeoDistance 两点之间的球面距离, 单位为米
+func GeoDistance(long1, lat1, long2, lat2 float64) float64{
+	lat1r, lat2r := degToRad(lat1), degToRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	v := math.Sin((degToRad(long2) - degToRad(long1)) / 2)
+	return 2 * earthRadiusInMeters * math.Asin(math.Sqrt(u * u + math.Cos(lat1r) * math.Cos(lat2r) * v * v))
+}
+
+// GeoInBox 点是否在以(longitude, latitude)为中心, 宽width高height(米)的矩形中
+func GeoInBox(longitude, latitude, width, height, pointLong, pointLat float64) bool{
+	if earthRadiusInMeters * math.Abs(degToRad(pointLat) - degToRad(latitude)) > height / 2{
+		return false
+	}
+	return GeoDistance(longitude, pointLat, pointLong, pointLat) <= width / 2
+}
+
+/*
+ *返回覆盖以(longitude, latitude)为中心, 宽width高height(米)区域的score范围, 每项为[min, max]
+ *选择能用不超过9个geohash区域覆盖该矩形的最大精度
+ */
+func GeoScoreRanges(longitude, latitude, width, height float64) [][2]uint64{
+	latDelta := radToDeg(height / 2 / earthRadiusInMeters)
+	latLow, latHigh := latitude - latDelta, latitude + latDelta
+
+	//经度范围按离极点最近的纬度计算
+	fullLong := true
+	var longDelta float64
+	if edge := math.Max(math.Abs(latLow), math.Abs(latHigh)); edge < 90{
+		longDelta = radToDeg(width / 2 / earthRadiusInMeters / math.Cos(degToRad(edge)))
+		fullLong = longDelta >= 180
+	}
+
+	for step := uint(GeoStepMax); step >= 1; step--{
+		//step为1时经纬度各只有2个区域, 一定可以覆盖
+		limit := int64(3)
+		if step == 1{
+			limit = 2
+		}
+
+		cells := int64(1) << step
+		latCells, ok := cellRange(latLow, latHigh, GeoLatMin, GeoLatMax, cells, false, limit)
+		if !ok{
+			continue
+		}
+		longCells, ok := cellRange(longitude - longDelta, longitude + longDelta, GeoLongMin, GeoLongMax, cells, fullLong, limit)
+		if !ok{
+			continue
+		}
+
+		var ranges [][2]uint64
+		shift := 2 * (GeoStepMax - step)
+		for _, ilat := range latCells{
+			for _, ilong := range longCells{
+				bits := interleave(uint32(ilat), uint32(ilong))
+				ranges = append(ranges, [2]uint64{bits << shift, (bits + 1) << shift - 1})
+			}
+		}
+		return ranges
+	}
+	return nil
+}
+
+//返回[low, high]覆盖的区域编号, 经度超出范围时环绕, 数量超过limit时ok为false
+func cellRange(low, high, min, max float64, cells int64, full bool, limit int64) (res []int64, ok bool){
+	first, last := int64(0), cells - 1
+	if !full && high - low < max - min{
+		width := (max - min) / float64(cells)
+		first = int64(math.Floor((low - min) / width))
+		last = int64(math.Floor((high - min) / width))
+	}
+	if last - first + 1 > limit{
+		return nil, false
+	}
+
+	seen := make(map[int64]bool)
+	for i := first; i <= last; i++{
+		c := i
+		if min == GeoLongMin{
+			c = ((i % cells) + cells) % cells
+		}else if c < 0 || c >= cells{
+			continue
+		}
+		if !seen[c]{
+			seen[c] = true
+			res = append(res, c)
+		}
+	}
+	return res, true
+}
+
+func geoEncode(longitude, latitude, latMin, latMax float64) uint64{
+	scale := float64(uint64(1) << GeoStepMax)
+	latOffset := (latitude - latMin) / (latMax - latMin) * scale
+	longOffset := (longitude - GeoLongMin) / (GeoLongMax - GeoLongMin) * scale
+	return interleave(uint32(latOffset), uint32(longOffset))
+}
+
+//x占偶数位, y占奇数位
+func interleave(x, y uint32) uint64{
+	return spread(x) | spread(y) << 1
+}
+
+func deinterleave(bits uint64) (x, y uint32){
+	return squash(bits), squash(bits >> 1)
+}
+
+func spread(v uint32) uint64{
+	x := uint64(v)
+	x = (x | x << 16) & 0x0000FFFF0000FFFF
+	x = (x | x << 8) & 0x00FF00FF00FF00FF
+	x = (x | x << 4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x << 2) & 0x3333333333333333
+	x = (x | x << 1) & 0x5555555555555555
+	return x
+}
+
+func squash(x uint64) uint32{
+	x &= 0x5555555555555555
+	x = (x | x >> 1) & 0x3333333333333333
+	x = (x | x >> 2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x >> 4) & 0x00FF00FF00FF00FF
+	x = (x | x >> 8) & 0x0000FFFF0000FFFF
+	x = (x | x >> 16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
+
+func degToRad(deg float64) float64{
+	return deg * math.Pi / 180
+}
+
+func radToDeg(rad float64) float64{
+	return rad * 180 / math.Pi
+}
@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGeoEncode(t *testing.T) {
+	//与redis文档中GEOADD Sicily的结果一致
+	assert.Equal(t, uint64(3479099956230698), GeoEncode(13.361389, 38.115556))
+	assert.Equal(t, uint64(3479447370796909), GeoEncode(15.087269, 37.502669))
+
+	long, lat := GeoDecode(3479099956230698)
+	assert.InDelta(t, 13.36138933897018433, long, 1e-12)
+	assert.InDelta(t, 38.11555639549629859, lat, 1e-12)
+}
+
+func TestGeoHashString(t *testing.T) {
+	assert.Equal(t, "sqc8b49rny0", GeoHashString(GeoEncode(13.361389, 38.115556)))
+	assert.Equal(t, "sqdtr74hyu0", GeoHashString(GeoEncode(15.087269, 37.502669)))
+}
+
+func TestGeoDistance(t *testing.T) {
+	long1, lat1 := GeoDecode(GeoEncode(13.361389, 38.115556))
+	long2, lat2 := GeoDecode(GeoEncode(15.087269, 37.502669))
+	assert.InDelta(t, 166274.1516, GeoDistance(long1, lat1, long2, lat2), 1e-3)
+}
+
+func TestGeoScoreRanges(t *testing.T) {
+	score := GeoEncode(13.361389, 38.115556)
+	covered := func(ranges [][2]uint64) bool {
+		for _, r := range ranges{
+			if score >= r[0] && score <= r[1]{
+				return true
+			}
+		}
+		return false
+	}
+
+	ranges := GeoScoreRanges(15, 37, 400000, 400000)
+	assert.True(t, len(ranges) <= 9)
+	assert.True(t, covered(ranges))
+
+	assert.True(t, covered(GeoScoreRanges(13.361389, 38.115556, 10, 10)))
+	assert.True(t, covered(GeoScoreRanges(-170, 38.115556, 40000000, 100)))
+}
@@ -0,0 +1,132 @@
+package vfs
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+)
+
+/*
+ *FaultFS 包装另一个文件系统并按设置注入错误, 用于测试写入失败后的恢复
+ *支持Sync出错、写入只完成一半和磁盘空间不足, Reset后恢复正常
+ */
+type FaultFS struct {
+	FS
+	mu         sync.Mutex
+	syncErr    error
+	shortWrite bool
+	limit      int64  //剩余可写入的字节数, 小于0时不限制
+}
+
+type faultFile struct {
+	File
+	fs *FaultFS
+}
+
+// NewFaultFS 新建包装fs的FaultFS, 初始时不注入任何错误
+func NewFaultFS(fs FS) *FaultFS{
+	return &FaultFS{FS: fs, limit: -1}
+}
+
+// SetSyncError 之后文件的Sync和SyncDir返回err, err为nil时取消
+func (f *FaultFS) SetSyncError(err error){
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.syncErr = err
+}
+
+// SetShortWrite 之后每次写入只写入一半数据并返回io.ErrShortWrite
+func (f *FaultFS) SetShortWrite(short bool){
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.shortWrite = short
+}
+
+// SetSpaceLimit 之后最多再写入n个字节, 超出的部分返回ENOSPC
+func (f *FaultFS) SetSpaceLimit(n int64){
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.limit = n
+}
+
+// Reset 取消所有注入的错误
+func (f *FaultFS) Reset(){
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.syncErr = nil
+	f.shortWrite = false
+	f.limit = -1
+}
+
+func (f *FaultFS) OpenFile(name string, flag int, perm os.FileMode) (File, error){
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil{
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f}, nil
+}
+
+func (f *FaultFS) Open(name string) (File, error){
+	file, err := f.FS.Open(name)
+	if err != nil{
+		return nil, err
+	}
+	return &faultFile{File: file, fs: f}, nil
+}
+
+func (f *FaultFS) SyncDir(path string) error{
+	if err := f.syncError(); err != nil{
+		return err
+	}
+	return f.FS.SyncDir(path)
+}
+
+func (f *FaultFS) syncError() error{
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.syncErr
+}
+
+//本次写入可以写入的字节数和随后返回的错误
+func (f *FaultFS) allow(name string, n int) (int, error){
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	if f.shortWrite && n > 0{
+		n, err = n / 2, io.ErrShortWrite
+	}
+	if f.limit >= 0 && int64(n) > f.limit{
+		n, err = int(f.limit), &os.PathError{Op: "write", Path: name, Err: syscall.ENOSPC}
+	}
+	if f.limit >= 0{
+		f.limit -= int64(n)
+	}
+	return n, err
+}
+
+func (f *faultFile) Write(p []byte) (int, error){
+	n, ferr := f.fs.allow(f.Name(), len(p))
+	n, err := f.File.Write(p[:n])
+	if err != nil{
+		return n, err
+	}
+	return n, ferr
+}
+
+func (f *faultFile) WriteAt(p []byte, off int64) (int, error){
+	n, ferr := f.fs.allow(f.Name(), len(p))
+	n, err := f.File.WriteAt(p[:n], off)
+	if err != nil{
+		return n, err
+	}
+	return n, ferr
+}
+
+func (f *faultFile) Sync() error{
+	if err := f.fs.syncError(); err != nil{
+		return err
+	}
+	return f.File.Sync()
+}
@@ -0,0 +1,55 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestFaultFS(t *testing.T) {
+	fs := NewFaultFS(NewMemFS())
+	f, err := fs.OpenFile("/a", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil{
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	//只写入一半
+	fs.SetShortWrite(true)
+	if n, err := f.WriteAt([]byte("abcd"), 0); n != 2 || err != io.ErrShortWrite{
+		t.Fatalf("expected short write, got %d %v", n, err)
+	}
+
+	//空间不足时写入剩余空间后返回ENOSPC
+	fs.Reset()
+	fs.SetSpaceLimit(3)
+	if n, err := f.WriteAt([]byte("ab"), 0); n != 2 || err != nil{
+		t.Fatalf("unexpected write result %d %v", n, err)
+	}
+	n, err := f.WriteAt([]byte("cd"), 2)
+	if n != 1 || !errors.Is(err, syscall.ENOSPC){
+		t.Fatalf("expected ENOSPC, got %d %v", n, err)
+	}
+
+	syncErr := errors.New("sync failed")
+	fs.SetSyncError(syncErr)
+	if err = f.Sync(); err != syncErr{
+		t.Fatalf("expected sync error, got %v", err)
+	}
+	if err = fs.SyncDir("/"); err != syncErr{
+		t.Fatalf("expected sync error, got %v", err)
+	}
+
+	fs.Reset()
+	if _, err = f.WriteAt([]byte("cd"), 2); err != nil{
+		t.Fatal(err)
+	}
+	if err = f.Sync(); err != nil{
+		t.Fatal(err)
+	}
+	if b, _ := ReadFile(fs, "/a"); string(b) != "abcd"{
+		t.Fatalf("unexpected content %q", b)
+	}
+}
@@ -0,0 +1,402 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errDirNotEmpty = errors.New("directory not empty")
+
+/*
+ *MemFS 内存中的文件系统, 用于测试, 可以并发使用
+ *文件的读写和os包一致, Sync和SyncDir只校验文件和目录是否存在
+ */
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string]*memNode
+	dirs  map[string]time.Time  //目录及其修改时间
+}
+
+type (
+	memNode struct {
+		mu      sync.RWMutex
+		data    []byte
+		mode    os.FileMode
+		modTime time.Time
+	}
+
+	memFile struct {
+		name    string
+		node    *memNode
+		flag    int
+		offset  int64   //Read和Write使用的偏移量
+		closed  bool
+	}
+
+	memFileInfo struct {
+		name    string
+		size    int64
+		mode    os.FileMode
+		modTime time.Time
+	}
+)
+
+// NewMemFS 新建一个只有根目录的内存文件系统
+func NewMemFS() *MemFS{
+	fs := &MemFS{files: make(map[string]*memNode), dirs: make(map[string]time.Time)}
+	fs.dirs[string(filepath.Separator)] = time.Now()
+	fs.dirs["."] = time.Now()
+	return fs
+}
+
+func (fs *MemFS) OpenFile(name string, flag int, perm os.FileMode) (File, error){
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	node, ok := fs.files[name]
+	if ok && flag & os.O_CREATE != 0 && flag & os.O_EXCL != 0{
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	if !ok{
+		if flag & os.O_CREATE == 0{
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		if _, isDir := fs.dirs[name]; isDir{
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		}
+		if _, ok := fs.dirs[filepath.Dir(name)]; !ok{
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		node = &memNode{mode: perm, modTime: time.Now()}
+		fs.files[name] = node
+	}
+
+	if flag & os.O_TRUNC != 0 && flag & (os.O_WRONLY|os.O_RDWR) != 0{
+		node.mu.Lock()
+		node.data = nil
+		node.modTime = time.Now()
+		node.mu.Unlock()
+	}
+	return &memFile{name: name, node: node, flag: flag}, nil
+}
+
+func (fs *MemFS) Open(name string) (File, error){
+	name = filepath.Clean(name)
+	fs.mu.RLock()
+	_, isDir := fs.dirs[name]
+	fs.mu.RUnlock()
+	//目录只能用于Stat
+	if isDir{
+		return &memFile{name: name, node: &memNode{mode: os.ModeDir | 0755}, flag: os.O_RDONLY}, nil
+	}
+	return fs.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (fs *MemFS) Remove(name string) error{
+	name = filepath.Clean(name)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.files[name]; ok{
+		delete(fs.files, name)
+		fs.touch(filepath.Dir(name))
+		return nil
+	}
+	if _, ok := fs.dirs[name]; ok{
+		if len(fs.children(name)) > 0{
+			return &os.PathError{Op: "remove", Path: name, Err: errDirNotEmpty}
+		}
+		delete(fs.dirs, name)
+		return nil
+	}
+	return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+}
+
+func (fs *MemFS) RemoveAll(path string) error{
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	prefix := path + string(filepath.Separator)
+	for name := range fs.files{
+		if name == path || strings.HasPrefix(name, prefix){
+			delete(fs.files, name)
+		}
+	}
+	for name := range fs.dirs{
+		if name == path || strings.HasPrefix(name, prefix){
+			delete(fs.dirs, name)
+		}
+	}
+	return nil
+}
+
+func (fs *MemFS) Rename(oldpath, newpath string) error{
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, ok := fs.dirs[filepath.Dir(newpath)]; !ok{
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if node, ok := fs.files[oldpath]; ok{
+		if _, isDir := fs.dirs[newpath]; isDir{
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrExist}
+		}
+		delete(fs.files, oldpath)
+		fs.files[newpath] = node
+		fs.touch(filepath.Dir(oldpath))
+		fs.touch(filepath.Dir(newpath))
+		return nil
+	}
+	if _, ok := fs.dirs[oldpath]; !ok{
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+
+	//移动目录及其下的所有文件
+	prefix := oldpath + string(filepath.Separator)
+	for name, node := range fs.files{
+		if strings.HasPrefix(name, prefix){
+			delete(fs.files, name)
+			fs.files[newpath + name[len(oldpath):]] = node
+		}
+	}
+	for name, t := range fs.dirs{
+		if name == oldpath || strings.HasPrefix(name, prefix){
+			delete(fs.dirs, name)
+			fs.dirs[newpath + name[len(oldpath):]] = t
+		}
+	}
+	return nil
+}
+
+func (fs *MemFS) MkdirAll(path string, perm os.FileMode) error{
+	path = filepath.Clean(path)
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for p := path; ; p = filepath.Dir(p){
+		if _, ok := fs.files[p]; ok{
+			return &os.PathError{Op: "mkdir", Path: p, Err: os.ErrExist}
+		}
+		if _, ok := fs.dirs[p]; ok{
+			break
+		}
+		fs.dirs[p] = time.Now()
+		if filepath.Dir(p) == p{
+			break
+		}
+	}
+	return nil
+}
+
+func (fs *MemFS) Stat(name string) (os.FileInfo, error){
+	name = filepath.Clean(name)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if node, ok := fs.files[name]; ok{
+		return node.info(name), nil
+	}
+	if t, ok := fs.dirs[name]; ok{
+		return &memFileInfo{name: filepath.Base(name), mode: os.ModeDir | 0755, modTime: t}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+func (fs *MemFS) ReadDir(dirname string) ([]os.FileInfo, error){
+	dirname = filepath.Clean(dirname)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if _, ok := fs.dirs[dirname]; !ok{
+		return nil, &os.PathError{Op: "open", Path: dirname, Err: os.ErrNotExist}
+	}
+	infos := fs.children(dirname)
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+	return infos, nil
+}
+
+func (fs *MemFS) SyncDir(path string) error{
+	path = filepath.Clean(path)
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	if _, ok := fs.dirs[path]; !ok{
+		return &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+//目录下直接包含的文件和目录, 调用方需持有fs.mu
+func (fs *MemFS) children(dirname string) []os.FileInfo{
+	var infos []os.FileInfo
+	for name, node := range fs.files{
+		if filepath.Dir(name) == dirname{
+			infos = append(infos, node.info(name))
+		}
+	}
+	for name, t := range fs.dirs{
+		if name != dirname && filepath.Dir(name) == dirname{
+			infos = append(infos, &memFileInfo{name: filepath.Base(name), mode: os.ModeDir | 0755, modTime: t})
+		}
+	}
+	return infos
+}
+
+//更新目录的修改时间, 调用方需持有fs.mu
+func (fs *MemFS) touch(dirname string){
+	if _, ok := fs.dirs[dirname]; ok{
+		fs.dirs[dirname] = time.Now()
+	}
+}
+
+func (n *memNode) info(name string) os.FileInfo{
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return &memFileInfo{name: filepath.Base(name), size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+func (f *memFile) Name() string{
+	return f.name
+}
+
+func (f *memFile) Read(p []byte) (int, error){
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if err == io.EOF && n > 0{
+		err = nil
+	}
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error){
+	if f.closed{
+		return 0, os.ErrClosed
+	}
+	if f.flag & os.O_WRONLY != 0{
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrPermission}
+	}
+	f.node.mu.RLock()
+	defer f.node.mu.RUnlock()
+
+	if off >= int64(len(f.node.data)){
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p){
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error){
+	if f.flag & os.O_APPEND != 0{
+		f.node.mu.RLock()
+		f.offset = int64(len(f.node.data))
+		f.node.mu.RUnlock()
+	}
+	n, err := f.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error){
+	if f.closed{
+		return 0, os.ErrClosed
+	}
+	if f.flag & (os.O_WRONLY|os.O_RDWR) == 0{
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: os.ErrPermission}
+	}
+	f.node.mu.Lock()
+	defer f.node.mu.Unlock()
+
+	if end := off + int64(len(p)); end > int64(len(f.node.data)){
+		f.node.grow(end)
+	}
+	copy(f.node.data[off:], p)
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Truncate(size int64) error{
+	if f.closed{
+		return os.ErrClosed
+	}
+	f.node.mu.Lock()
+	defer f.node.mu.Unlock()
+
+	if size > int64(len(f.node.data)){
+		f.node.grow(size)
+	}else{
+		f.node.data = f.node.data[:size]
+	}
+	f.node.modTime = time.Now()
+	return nil
+}
+
+func (f *memFile) Stat() (os.FileInfo, error){
+	if f.closed{
+		return nil, os.ErrClosed
+	}
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) Sync() error{
+	if f.closed{
+		return os.ErrClosed
+	}
+	return nil
+}
+
+func (f *memFile) Close() error{
+	if f.closed{
+		return os.ErrClosed
+	}
+	f.closed = true
+	return nil
+}
+
+//扩展文件到size, 新增的部分为0, 调用方需持有n.mu
+func (n *memNode) grow(size int64){
+	if size <= int64(cap(n.data)){
+		n.data = n.data[:size]
+		return
+	}
+	data := make([]byte, size, size * 2)
+	copy(data, n.data)
+	n.data = data
+}
+
+func (fi *memFileInfo) Name() string{
+	return fi.name
+}
+
+func (fi *memFileInfo) Size() int64{
+	return fi.size
+}
+
+func (fi *memFileInfo) Mode() os.FileMode{
+	return fi.mode
+}
+
+func (fi *memFileInfo) ModTime() time.Time{
+	return fi.modTime
+}
+
+func (fi *memFileInfo) IsDir() bool{
+	return fi.mode.IsDir()
+}
+
+func (fi *memFileInfo) Sys() interface{}{
+	return nil
+}
@@ -0,0 +1,136 @@
+package vfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestMemFS_File(t *testing.T) {
+	fs := NewMemFS()
+	if _, err := fs.OpenFile("/db/a.data", os.O_CREATE|os.O_RDWR, 0644); !os.IsNotExist(err){
+		t.Fatalf("expected not exist error without parent dir, got %v", err)
+	}
+	if err := fs.MkdirAll("/db/sub", os.ModePerm); err != nil{
+		t.Fatal(err)
+	}
+
+	f, err := fs.OpenFile("/db/a.data", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil{
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte("hello")); err != nil{
+		t.Fatal(err)
+	}
+	//超出文件末尾写入时中间填充0
+	if _, err = f.WriteAt([]byte("world"), 8); err != nil{
+		t.Fatal(err)
+	}
+	buf := make([]byte, 20)
+	n, err := f.ReadAt(buf, 0)
+	if err != io.EOF || !bytes.Equal(buf[:n], []byte("hello\x00\x00\x00world")){
+		t.Fatalf("unexpected content %q, err:%v", buf[:n], err)
+	}
+	if err = f.Truncate(5); err != nil{
+		t.Fatal(err)
+	}
+	if info, _ := f.Stat(); info.Size() != 5 || info.Name() != "a.data"{
+		t.Fatalf("unexpected file info %s %d", info.Name(), info.Size())
+	}
+	if err = f.Close(); err != nil{
+		t.Fatal(err)
+	}
+	if _, err = f.Write([]byte("x")); err != os.ErrClosed{
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+
+	if _, err = fs.OpenFile("/db/a.data", os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644); !os.IsExist(err){
+		t.Fatalf("expected exist error, got %v", err)
+	}
+	b, err := ReadFile(fs, "/db/a.data")
+	if err != nil || string(b) != "hello"{
+		t.Fatalf("unexpected content %q, err:%v", b, err)
+	}
+
+	//只读打开的文件不能写入, O_TRUNC清空文件
+	r, _ := fs.Open("/db/a.data")
+	if _, err = r.Write([]byte("x")); err == nil{
+		t.Fatal("expected error writing a read only file")
+	}
+	r.Close()
+	w, _ := fs.OpenFile("/db/a.data", os.O_WRONLY|os.O_TRUNC, 0)
+	w.Close()
+	if b, _ = ReadFile(fs, "/db/a.data"); len(b) != 0{
+		t.Fatalf("expected empty file, got %q", b)
+	}
+}
+
+func TestMemFS_Dir(t *testing.T) {
+	fs := NewMemFS()
+	if err := fs.MkdirAll("/db/reclaim", os.ModePerm); err != nil{
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/db/b.data", "/db/a.data", "/db/reclaim/a.data"}{
+		f, err := fs.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil{
+			t.Fatal(err)
+		}
+		f.Write([]byte(name))
+		f.Close()
+	}
+
+	infos, err := fs.ReadDir("/db")
+	if err != nil{
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos{
+		names = append(names, info.Name())
+	}
+	if len(names) != 3 || names[0] != "a.data" || names[1] != "b.data" || names[2] != "reclaim" || !infos[2].IsDir(){
+		t.Fatalf("unexpected dir entries %v", names)
+	}
+
+	if err = fs.Remove("/db/reclaim"); err == nil{
+		t.Fatal("expected error removing a non-empty dir")
+	}
+	if err = fs.Rename("/db/reclaim/a.data", "/db/a.data"); err != nil{
+		t.Fatal(err)
+	}
+	if b, _ := ReadFile(fs, "/db/a.data"); string(b) != "/db/reclaim/a.data"{
+		t.Fatalf("unexpected content after rename %q", b)
+	}
+	if err = fs.Rename("/db", "/backup"); err != nil{
+		t.Fatal(err)
+	}
+	if Exist(fs, "/db/b.data") || !Exist(fs, "/backup/b.data") || !Exist(fs, "/backup/reclaim"){
+		t.Fatal("dir is not moved by rename")
+	}
+
+	if err = fs.RemoveAll("/backup"); err != nil{
+		t.Fatal(err)
+	}
+	if Exist(fs, "/backup") || Exist(fs, "/backup/b.data"){
+		t.Fatal("dir is not removed")
+	}
+	if err = fs.SyncDir("/backup"); !os.IsNotExist(err){
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+}
+
+func TestMemFS_ReadAll(t *testing.T) {
+	fs := NewMemFS()
+	f, _ := fs.OpenFile("/a", os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	f.Write([]byte("ab"))
+	f.Write([]byte("cd"))
+	f.Close()
+
+	f, _ = fs.Open("/a")
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil || string(b) != "abcd"{
+		t.Fatalf("unexpected content %q, err:%v", b, err)
+	}
+}
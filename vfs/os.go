@@ -0,0 +1,58 @@
+package vfs
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+type osFS struct{}
+
+func (osFS) OpenFile(name string, flag int, perm os.FileMode) (File, error){
+	file, err := os.OpenFile(name, flag, perm)
+	if err != nil{
+		//避免返回值为nil的*os.File
+		return nil, err
+	}
+	return file, nil
+}
+
+func (osFS) Open(name string) (File, error){
+	file, err := os.Open(name)
+	if err != nil{
+		return nil, err
+	}
+	return file, nil
+}
+
+func (osFS) Remove(name string) error{
+	return os.Remove(name)
+}
+
+func (osFS) RemoveAll(path string) error{
+	return os.RemoveAll(path)
+}
+
+func (osFS) Rename(oldpath, newpath string) error{
+	return os.Rename(oldpath, newpath)
+}
+
+func (osFS) MkdirAll(path string, perm os.FileMode) error{
+	return os.MkdirAll(path, perm)
+}
+
+func (osFS) Stat(name string) (os.FileInfo, error){
+	return os.Stat(name)
+}
+
+func (osFS) ReadDir(dirname string) ([]os.FileInfo, error){
+	return ioutil.ReadDir(dirname)
+}
+
+func (osFS) SyncDir(path string) error{
+	dir, err := os.Open(path)
+	if err != nil{
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,62 @@
+package vfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// File 文件系统中打开的文件, *os.File实现了该接口
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.WriterAt
+	io.Closer
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+}
+
+// FS stardb使用的文件系统操作, 参数和返回的错误与os包中的同名函数一致
+type FS interface {
+	// OpenFile 按flag打开文件, 同os.OpenFile
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+
+	// Open 以只读方式打开文件
+	Open(name string) (File, error)
+
+	Remove(name string) error
+	RemoveAll(path string) error
+	Rename(oldpath, newpath string) error
+	MkdirAll(path string, perm os.FileMode) error
+	Stat(name string) (os.FileInfo, error)
+
+	// ReadDir 返回目录下的文件和目录, 按名称排列
+	ReadDir(dirname string) ([]os.FileInfo, error)
+
+	// SyncDir 刷新目录, 使目录下文件的创建、删除和重命名持久化
+	SyncDir(path string) error
+}
+
+// OS 直接使用os包的文件系统
+var OS FS = osFS{}
+
+// Exist 校验目录或文件是否存在
+func Exist(fs FS, path string) bool{
+	if _, err := fs.Stat(path); os.IsNotExist(err){
+		return false
+	}
+	return true
+}
+
+// ReadFile 读取整个文件
+func ReadFile(fs FS, name string) ([]byte, error){
+	file, err := fs.Open(name)
+	if err != nil{
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
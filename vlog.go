@@ -0,0 +1,169 @@
+package stardb
+
+import (
+	"io"
+	"stardb/index"
+	"stardb/storage"
+	"time"
+)
+
+/*
+ *值分离: 不小于ValueLogThreshold的String value保存在值日志中, 数据文件的entry和索引中只保存它的位置
+ *Reclaim只重写较小的位置信息, 值日志由ValueLogGC单独回收
+ */
+
+//打开值日志, 没有开启值分离并且目录下没有值日志文件时返回nil
+func openValueLog(config Config, c *storage.Cipher) (*storage.ValueLog, error){
+	ids, err := storage.ValueLogFileIds(config.fileSystem(), config.DirPath)
+	if err != nil{
+		return nil, err
+	}
+	if config.ValueLogThreshold == 0 && len(ids) == 0{
+		return nil, nil
+	}
+	return storage.OpenValueLog(config.fileSystem(), config.DirPath, config.RwMethod, config.BlockSize, c)
+}
+
+//value达到阈值时写入值日志, entry中只保存它的位置, 调用方需持有strIndex.mu
+func (db *StarDB) separateValue(e *storage.Entry) error{
+	threshold := db.config.ValueLogThreshold
+	if db.vlog == nil || threshold == 0 || e.Meta.ValueSize < threshold{
+		return nil
+	}
+
+	ve := storage.NewEntryNoExtra(e.Meta.Key, e.Meta.Value, storage.ValueLogType, 0)
+	if err := db.prepareEntry(ve); err != nil{
+		return err
+	}
+	p, err := db.vlog.Write(ve)
+	if err != nil{
+		return err
+	}
+
+	//value需要先于数据文件中的位置持久化
+	if db.syncRequired(){
+		err = db.vlog.Sync()
+	}else if db.config.syncPolicy() == SyncEverySec{
+		_, err = db.committer.add(db.vlog.ActiveFile(), false)
+	}
+	if err != nil{
+		return err
+	}
+	e.SetValuePointer(p)
+	return nil
+}
+
+//重放时解析entry中的位置, KeyValueMemMode下从值日志加载value, 位置已经失效时返回false
+//写入中途崩溃时数据文件中的位置可能先于value持久化, 这样的entry被忽略
+func (db *StarDB) loadValuePointer(e *storage.Entry, idx *index.Indexer, p storage.ValuePointer) bool{
+	if db.vlog == nil || !db.vlog.Contains(p){
+		return false
+	}
+
+	idx.ValuePtr = &p
+	e.Meta.Value = nil
+	e.Meta.ValueSize = p.ValueSize
+	if db.config.IdxMode == KeyValueMemMode{
+		ve, err := db.vlog.Read(p)
+		if err != nil{
+			return false
+		}
+		e.Meta.Value = ve.Meta.Value
+	}
+	return true
+}
+
+//从值日志读取value
+func (db *StarDB) readValueLog(p *storage.ValuePointer)([]byte, error){
+	if db.vlog == nil{
+		return nil, storage.ErrInvalidValuePointer
+	}
+	e, err := db.vlog.Read(*p)
+	if err != nil{
+		return nil, err
+	}
+	return e.Meta.Value, nil
+}
+
+// ValueLogGC 回收值日志, 失效数据的比例达到ValueLogGCRatio的文件中有效的value会被重新写入, 然后删除该文件
+// 与Reclaim相互独立, 没有需要回收的文件时返回ErrValueLogGCUnreached
+func (db *StarDB) ValueLogGC() error{
+	if db.vlog == nil{
+		return ErrValueLogGCUnreached
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	var files []*storage.DBFile
+	ratio := db.config.valueLogGCRatio()
+	db.strIndex.mu.RLock()
+	for _, df := range db.vlog.ArchivedFiles(){
+		size := df.Offset - df.DataOffset()
+		if size <= 0 || float64(db.meta.ValueLogDiscard[df.Id]) >= float64(size) * ratio{
+			files = append(files, df)
+		}
+	}
+	db.strIndex.mu.RUnlock()
+	if len(files) == 0{
+		return ErrValueLogGCUnreached
+	}
+
+	for _, df := range files{
+		//重写的value会保存到索引中, 扫描时不能直接引用即将删除的文件的映射
+		scanner := storage.NewScanner(df, storage.DefaultScanBufferSize)
+		for{
+			e, offset, err := scanner.Next()
+			if err == io.EOF{
+				break
+			}
+			if err != nil{
+				return err
+			}
+			if err = db.rewriteValue(e, df.Id, offset); err != nil{
+				return err
+			}
+		}
+
+		//重写的value和新的位置都持久化之后才能删除文件
+		if err := db.syncValueLogRewrite(); err != nil{
+			return err
+		}
+		if err := db.vlog.Remove(df.Id); err != nil{
+			return err
+		}
+		db.strIndex.mu.Lock()
+		delete(db.meta.ValueLogDiscard, df.Id)
+		db.strIndex.mu.Unlock()
+	}
+	return nil
+}
+
+//值日志fileId文件中offset处的value仍然有效时重新写入, 保留key的过期时间
+func (db *StarDB) rewriteValue(e *storage.Entry, fileId uint32, offset int64)(err error){
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	node := db.strIndex.idxList.Get(e.Meta.Key)
+	if node == nil{
+		return nil
+	}
+	p := node.Value().(*index.Indexer).ValuePtr
+	if p == nil || p.FileId != fileId || p.Offset != offset{
+		return nil
+	}
+	if deadline, exist := db.expires[String][string(e.Meta.Key)]; exist && deadline <= time.Now().Unix(){
+		return nil
+	}
+	return db.setValKeepTTL(e.Meta.Key, e.Meta.Value)
+}
+
+func (db *StarDB) syncValueLogRewrite()(err error){
+	db.strIndex.mu.Lock()
+	defer db.strIndex.mu.unlock(&err)
+
+	if err := db.vlog.Sync(); err != nil{
+		return err
+	}
+	return db.activeFile[String].Sync()
+}
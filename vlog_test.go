@@ -0,0 +1,135 @@
+package stardb
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"stardb/storage"
+	"testing"
+)
+
+func vlogFiles(dir string) []string{
+	files, _ := filepath.Glob(filepath.Join(dir, "*.vlog"))
+	return files
+}
+
+func TestStarDB_ValueLog(t *testing.T) {
+	modes := []struct{
+		idx    DataIndexMode
+		method storage.FileRWMethod
+	}{
+		{KeyValueMemMode, storage.FileIO},
+		{KeyOnlyMemMode, storage.FileIO},
+		{KeyValueMemMode, storage.MMap},  //GC删除的文件解除映射之后索引中的value仍然可以访问
+		{KeyOnlyMemMode, storage.MMap},
+	}
+	for _, mode := range modes{
+		dir, _ := ioutil.TempDir("", "stardb")
+		config := DefaultConfig()
+		config.DirPath = dir
+		config.IdxMode = mode.idx
+		config.RwMethod = mode.method
+		config.BlockSize = 4 * 1024
+		config.ReclaimThreshold = 1
+		config.ValueLogThreshold = 512
+
+		db, err := Open(config)
+		assert.Nil(t, err)
+
+		value := func(i, round int) []byte{
+			return bytes.Repeat([]byte(fmt.Sprintf("%d-%d|", i, round)), 200)
+		}
+		for i := 0; i < 50; i++{
+			assert.Nil(t, db.Set([]byte(fmt.Sprintf("key-%d", i)), value(i, 0)))
+		}
+		assert.Nil(t, db.Set([]byte("small"), []byte("v")))
+		assert.Nil(t, db.MSet([]byte("m1"), value(100, 0), []byte("m2"), []byte("v2")))
+		assert.Nil(t, db.Expire([]byte("key-0"), 1000))
+
+		check := func(round int){
+			for i := 0; i < 50; i++{
+				val, err := db.Get([]byte(fmt.Sprintf("key-%d", i)))
+				assert.Nil(t, err)
+				assert.Equal(t, value(i, round), val)
+			}
+			val, _ := db.Get([]byte("small"))
+			assert.Equal(t, []byte("v"), val)
+			val, _ = db.Get([]byte("m1"))
+			assert.Equal(t, value(100, 0), val)
+			assert.Equal(t, len(value(1, round)), db.StrLen([]byte("key-1")))
+			part, err := db.GetRange([]byte("key-1"), 4, 8)
+			assert.Nil(t, err)
+			assert.Equal(t, value(1, round)[4:9], part)
+			assert.True(t, db.TTL([]byte("key-0")) > 0)
+		}
+		check(0)
+
+		//数据文件中只有value的位置, 回收时值日志保持不变
+		vlogs := vlogFiles(dir)
+		assert.True(t, len(vlogs) > 1)
+		for i := 0; i < 50; i++{
+			assert.Nil(t, db.Set([]byte(fmt.Sprintf("key-%d", i)), value(i, 1)))
+		}
+		assert.Nil(t, db.Expire([]byte("key-0"), 1000))
+		assert.Nil(t, db.Reclaim())
+		check(1)
+
+		//旧的value全部失效, GC之后最早的文件被删除
+		assert.Nil(t, db.ValueLogGC())
+		_, err = os.Stat(vlogs[0])
+		assert.True(t, os.IsNotExist(err))
+		check(1)
+		assert.Equal(t, ErrValueLogGCUnreached, db.ValueLogGC())
+
+		db.Close()
+		db, err = Open(config)
+		assert.Nil(t, err)
+		check(1)
+
+		//关闭值分离之后已有的value仍然可以读取, GC时写回数据文件
+		db.Close()
+		config.ValueLogThreshold = 0
+		config.ValueLogGCRatio = 0.01
+		db, err = Open(config)
+		assert.Nil(t, err)
+		check(1)
+		assert.Nil(t, db.Set([]byte("key-1"), value(1, 1)))
+		for db.ValueLogGC() == nil{
+		}
+		check(1)
+		db.Close()
+
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStarDB_ValueLogLostValue(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "stardb")
+	defer os.RemoveAll(dir)
+	config := DefaultConfig()
+	config.DirPath = dir
+	config.IdxMode = KeyOnlyMemMode
+	config.ValueLogThreshold = 16
+
+	db, err := Open(config)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Set([]byte("key"), bytes.Repeat([]byte("a"), 100)))
+	assert.Nil(t, db.Set([]byte("key"), bytes.Repeat([]byte("b"), 100)))
+	db.Close()
+
+	//模拟数据文件中的位置先于value持久化, 最后一次写入的value丢失
+	vlog := filepath.Join(dir, fmt.Sprintf(storage.DBFileFormatNames[storage.ValueLogType], 0))
+	info, err := os.Stat(vlog)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Truncate(vlog, info.Size() - 10))
+
+	db, err = Open(config)
+	assert.Nil(t, err)
+	defer db.Close()
+	val, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("a"), 100), val)
+}